@@ -18,6 +18,7 @@ import (
 	"strings"
 
 	mcli_fs "mcli/packages/mcli-filesystem"
+	mcli_http "mcli/packages/mcli-http"
 	mcli_secrets "mcli/packages/mcli-secrets"
 	mcli_type "mcli/packages/mcli-type"
 	mcli_utils "mcli/packages/mcli-utils"
@@ -314,52 +315,57 @@ func getFullPath(partialPath string) (string, error) {
 	return "", fmt.Errorf("partial path format doesn't support")
 }
 
-// LoadHttpPlugins loads HTTP plugins from a shared object (.so) file.
+// httpPluginModule is http plugin loaded from shared object file or error of its loading
+type httpPluginModule struct {
+	path   string
+	plugin mcli_type.HttpPlugin
+	err    error
+}
+
+// LoadHttpPlugins loads HTTP plugins from shared object (.so) files of plugin directory.
 //
 // It takes two parameters:
-//   - module: The path to the shared object file containing the HTTP plugins.
-//     If empty, it defaults to "plugins/http_default_plugins/http_plugins_compiled/http_default_handlers.so".
-//   - name:   The name of the symbol (exported function or variable) to be looked up in the shared object.
-//     This symbol is expected to implement the mcli_type.HandlerFuncsPlugin interface.
+//   - dir:  The path to the folder with shared object files.
+//     If empty, it defaults to "plugins/http_default_plugins/http_plugins_compiled".
+//   - name: The name of the symbol (exported variable) to be looked up in every shared object.
+//     This symbol is expected to implement the mcli_type.HttpPlugin interface or
+//     the mcli_type.HandlerFuncsPlugin interface of api version 1, the last one is named after its file.
 //
-// The function returns a map of string to http.HandlerFunc, representing the loaded HTTP handler functions.
-// If successful, the map and nil error are returned. If any error occurs during the loading process, the function
-// returns nil map and an error describing the issue.
-func LoadHttpPlugins(module string, name string) (map[string]http.HandlerFunc, error) {
+// The function returns one module for every file found, failed modules have err set.
+// Missing directory means there are no plugins, error is returned if platform does not support plugins.
+func LoadHttpPlugins(dir string, name string) ([]httpPluginModule, error) {
 	// Check if the operating system is Linux
 	if runtime.GOOS != "linux" {
 		return nil, errors.New("current platform not supported, plugins are only supported on Linux")
 	}
 
-	if module == "" {
-		module = "plugins/http_default_plugins/http_plugins_compiled/http_default_handlers.so"
-	}
-
-	// 1. open the so file to load the symbols
-	plug, err := plugin.Open(module)
-	if err != nil {
-		return nil, err
+	if dir == "" {
+		dir = "plugins/http_default_plugins/http_plugins_compiled"
 	}
-
-	// 2. look up a symbol (an exported function or variable)
-	// in this case, variable Greeter
-	symVariable, err := plug.Lookup(name)
+	files, err := filepath.Glob(filepath.Join(dir, "*.so"))
 	if err != nil {
 		return nil, err
 	}
-
-	// 3. Assert that loaded symbol is of a desired type
-	// in this case interface type Greeter (defined above)
-	var handlerFuncs mcli_type.HandlerFuncsPlugin
-	handlerFuncs, ok := symVariable.(mcli_type.HandlerFuncsPlugin)
-	if !ok {
-		return nil, err
+	modules := make([]httpPluginModule, 0, len(files))
+	for _, file := range files {
+		module := httpPluginModule{path: file}
+		symVariable, err := LoadPlugin(file, name)
+		if err != nil {
+			module.err = err
+			modules = append(modules, module)
+			continue
+		}
+		switch p := symVariable.(type) {
+		case mcli_type.HttpPlugin:
+			module.plugin = p
+		case mcli_type.HandlerFuncsPlugin:
+			module.plugin = mcli_http.NewLegacyHttpPlugin(strings.TrimSuffix(filepath.Base(file), ".so"), p)
+		default:
+			module.err = fmt.Errorf("symbol %s of %s does not implement http plugin contract", name, file)
+		}
+		modules = append(modules, module)
 	}
-
-	// handlerFuncs.GetHandlerFuncs()
-	mapHandlerFuncs := handlerFuncs.GetHandlerFuncsV2("HTTP_ECHO")
-
-	return mapHandlerFuncs, nil
+	return modules, nil
 }
 
 func LoadPlugin(modulePath string, objectName string) (plugin.Symbol, error) {
@@ -471,28 +477,11 @@ func ReadConfigFile(configFile string) (err error) {
 				Elogger.Err(err).Msg("config file " + configFile + " does not exist")
 				return err
 			}
-			configContentString := string(configContent)
-
-			templateRegExp, err := regexp.Compile(`{{\$.+?}}`)
+			configContentString, err := expandConfigVars(string(configContent))
 			if err != nil {
 				Elogger.Err(err).Msg("config file " + configFile + " does not exist")
 				return err
 			}
-			allVarsEntries := mcli_utils.RemoveDuplicatesStr(templateRegExp.FindAllString(configContentString, -1))
-			for _, varEntry := range allVarsEntries {
-				// if template entry end on $}} - we replace it from GlobalMap
-				if strings.HasSuffix(varEntry, "$}}") {
-					mapkey := strings.ReplaceAll(varEntry, "{{$", "")
-					mapkey = strings.ReplaceAll(mapkey, "$}}", "")
-					configContentString = strings.ReplaceAll(configContentString, varEntry, GlobalMap[mapkey])
-				}
-				// if template entry end on }} - we replace it from env
-				if strings.HasSuffix(varEntry, "}}") && !strings.HasSuffix(varEntry, "$}}") {
-					osEnv := strings.ReplaceAll(varEntry, "{{$", "")
-					osEnv = strings.ReplaceAll(osEnv, "}}", "")
-					configContentString = strings.ReplaceAll(configContentString, varEntry, os.Getenv(osEnv))
-				}
-			}
 
 			err = yaml.Unmarshal([]byte(configContentString), &Config)
 			if err != nil {
@@ -513,19 +502,13 @@ func ReadConfigFile(configFile string) (err error) {
 	}
 	return
 }
-func ReadEmbedConfigFile(configData []byte) (err error) {
-
-	if len(configData) == 0 {
-		Elogger.Err(err).Msg("embed config file is empty")
-	}
-	Ilogger.Trace().Msg(fmt.Sprint("parsing embed config data"))
-
-	configContentString := string(configData)
 
+// expandConfigVars replaces {{$Name$}} entries of config by GlobalMap values
+// and {{$NAME}} entries by environment variables
+func expandConfigVars(configContentString string) (string, error) {
 	templateRegExp, err := regexp.Compile(`{{\$.+?}}`)
 	if err != nil {
-		Elogger.Err(err).Msg("Error compile regexp for config template processing")
-		return err
+		return "", err
 	}
 	allVarsEntries := mcli_utils.RemoveDuplicatesStr(templateRegExp.FindAllString(configContentString, -1))
 	for _, varEntry := range allVarsEntries {
@@ -535,13 +518,41 @@ func ReadEmbedConfigFile(configData []byte) (err error) {
 			mapkey = strings.ReplaceAll(mapkey, "$}}", "")
 			configContentString = strings.ReplaceAll(configContentString, varEntry, GlobalMap[mapkey])
 		}
-		// if template entry ends on }} - we replace it from env
+		// if template entry end on }} - we replace it from env
 		if strings.HasSuffix(varEntry, "}}") && !strings.HasSuffix(varEntry, "$}}") {
 			osEnv := strings.ReplaceAll(varEntry, "{{$", "")
 			osEnv = strings.ReplaceAll(osEnv, "}}", "")
 			configContentString = strings.ReplaceAll(configContentString, varEntry, os.Getenv(osEnv))
 		}
 	}
+	return configContentString, nil
+}
+
+// parseConfigFile reads config file into cfg the same way as ReadConfigFile, errors are returned instead of exit
+func parseConfigFile(configFile string, cfg *ConfigData) error {
+	configContent, err := os.ReadFile(configFile)
+	if err != nil {
+		return err
+	}
+	configContentString, err := expandConfigVars(string(configContent))
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal([]byte(configContentString), cfg)
+}
+
+func ReadEmbedConfigFile(configData []byte) (err error) {
+
+	if len(configData) == 0 {
+		Elogger.Err(err).Msg("embed config file is empty")
+	}
+	Ilogger.Trace().Msg(fmt.Sprint("parsing embed config data"))
+
+	configContentString, err := expandConfigVars(string(configData))
+	if err != nil {
+		Elogger.Err(err).Msg("Error compile regexp for config template processing")
+		return err
+	}
 
 	err = yaml.Unmarshal([]byte(configContentString), &Config)
 	if err != nil {
@@ -4,12 +4,15 @@ Copyright © 2022 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -18,6 +21,7 @@ import (
 	mcli_http "mcli/packages/mcli-http"
 	mcli_redis "mcli/packages/mcli-redis"
 	mcli_secrets "mcli/packages/mcli-secrets"
+	mcli_type "mcli/packages/mcli-type"
 
 	"github.com/spf13/cobra"
 )
@@ -29,328 +33,551 @@ var httpCmd = &cobra.Command{
 	For example: mcli http --static-path ./http-static --static-prefix static
 	it lookup index.html in ./http-static/html/index.html, other static assets in ./http-static/...
 	and we can refer to it in url by /static/... prefix
+	On SIGHUP config file is read again and router, middlewares, templates and plugins are rebuilt,
+	if new config is not valid server keeps running with previous one.
+	On SIGINT and SIGTERM requests are drained for http.server.shutdown-timeout milliseconds.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		var port, baseUrl, staticPath, staticPrefix, tlsKey, tlsCert string
-		var timeout int64 = 0
-		var routerV2 bool
-
-		port, _ = cmd.Flags().GetString("port")
-		isPortSet := cmd.Flags().Lookup("port").Changed
-		staticPath, _ = cmd.Flags().GetString("static-path")
-		isStaticPathSet := cmd.Flags().Lookup("static-path").Changed
-		staticPrefix, _ = cmd.Flags().GetString("static-prefix")
-		isStaticPrefix := cmd.Flags().Lookup("static-prefix").Changed
-		baseUrl, _ = cmd.Flags().GetString("base-url")
-		isBaseUrl := cmd.Flags().Lookup("base-url").Changed
-
-		tlsKey, _ = cmd.Flags().GetString("tls-key")
-		tlsCert, _ = cmd.Flags().GetString("tls-cert")
-		timeout, _ = cmd.Flags().GetInt64("timeout")
-		isTimeoutSet := cmd.Flags().Lookup("timeout").Changed
-		routerV2, _ = cmd.Flags().GetBool("v2-router")
-
-		// process configuration or setup defaults
-		Config.Http.Server.RouterV2 = routerV2
-
-		if !isPortSet && len(Config.Http.Server.Port) > 0 {
-			port = Config.Http.Server.Port
-		}
-		if !isTimeoutSet && Config.Http.Server.Timeout > 0 {
-			timeout = Config.Http.Server.Timeout
-		}
-		if !isStaticPathSet && len(Config.Http.Server.StaticPath) > 0 {
-			staticPath = Config.Http.Server.StaticPath
-		}
-		if !isStaticPrefix && len(Config.Http.Server.StaticPrefix) > 0 {
-			staticPrefix = Config.Http.Server.StaticPrefix
-		}
-		if !isBaseUrl && len(Config.Http.Server.BaseUrl) > 0 {
-			baseUrl = Config.Http.Server.BaseUrl
+		params := getHttpServerParams(cmd)
+		closeTracing, err := setupHttpTracing(cmd)
+		if err != nil {
+			Elogger.Fatal().Msgf("http tracing setup error: %v", err)
 		}
-		baseUrl = strings.Trim(baseUrl, "/")
-
-		tmplPath, _ := GetStringParam("tmpl-path", cmd, Config.Http.Server.TmplPath)
-		tmplPrefix, _ := GetStringParam("tmpl-prefix", cmd, Config.Http.Server.TmplPrefix)
-		tmplDataPath, _ := GetStringParam("tmpl-datapath", cmd, Config.Http.Server.TmplDataPath)
+		defer closeTracing()
 
 		// Channel for interrupt signal
 		StopHttpChan := make(chan os.Signal, 1)
+		// Channel for config reload signal
+		ReloadHttpChan := make(chan os.Signal, 1)
 
-		// mcli_http.InitMainRoutes(staticPath, staticPrefix)
-
-		mcli_http.HttpConfig = Config.Http
-		rOpts := mcli_http.RouterOptions{BaseUrl: baseUrl}
-		rOpts.Ctx = Ctx
-		rOpts.Notify = Notify
-		r := mcli_http.NewRouter(staticPath, staticPrefix, Ilogger, Elogger, &rOpts)
-
-		// load plugins route handlers
-
-		HttpDefaultPluginRouteMap, err := LoadHttpPlugins("", "HandlerFuncsPlugin")
+		current, err := buildHttpRouter(params, false)
 		if err != nil {
-			Elogger.Error().Msg(err.Error())
-		}
-		fmt.Println(HttpDefaultPluginRouteMap)
-		// root route
-		// get path to root template
-		rootPageTmplPath, err := getFullPath(Config.Http.Server.RootPage.RootPageTemplate)
-		if err != nil {
-			Elogger.Error().Msg(err.Error())
-			rootPageTmplPath = ""
+			closeTracing()
+			Elogger.Fatal().Msgf("http server setup error: %v", err)
 		}
+		handler := &swappableHandler{}
+		mcli_http.PublishServerState(current.router.State())
+		handler.current.Store(current)
 
-		rootHandler, err := mcli_http.GetRootHandler(rootPageTmplPath, baseUrl,
-			Config.Http.Server.RootPage.RootPageTitle,
-			"/",
-			Config.Http.Server.Auth.SignInRoute)
+		var srv *http.Server
+		if len(params.tlsCert) > 0 && len(params.tlsKey) > 0 {
 
-		if err != nil {
-			Elogger.Fatal().Msgf("error reading file: %v", err)
-		}
-		r.AddRouteWithHandler("/", mcli_http.Equal, rootHandler)
+			srv = &http.Server{
+				Addr:         ":" + params.port,
+				Handler:      handler,
+				ReadTimeout:  time.Duration(params.timeout * int64(time.Millisecond)),
+				WriteTimeout: time.Duration(params.timeout * 3 * int64(time.Millisecond)),
+				IdleTimeout:  time.Duration(params.timeout * 4 * int64(time.Millisecond)),
+				TLSConfig: &tls.Config{
+					MinVersion:               tls.VersionTLS13,
+					PreferServerCipherSuites: true,
+				},
+			}
 
-		// Context to stop server and pass into other goroutines
-		// ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				if err := srv.ListenAndServeTLS(params.tlsCert, params.tlsKey); err != nil && err != http.ErrServerClosed {
+					Elogger.Fatal().Msg(err.Error())
+				}
+			}()
+		} else {
+			srv = &http.Server{
+				Addr:         ":" + params.port,
+				Handler:      handler,
+				ReadTimeout:  time.Duration(params.timeout * int64(time.Millisecond)),
+				WriteTimeout: time.Duration(params.timeout * 3 * int64(time.Millisecond)),
+				IdleTimeout:  time.Duration(params.timeout * 4 * int64(time.Millisecond)),
+			}
 
-		serverTemplates := Config.Http.Server.Templates
+			go func() {
+				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+					Elogger.Fatal().Msg(err.Error())
+				}
+			}()
+		}
 
-		if len(tmplPath) > 0 {
-			serverTemplates = make([]mcli_http.TemplateEntry, 0, 1)
-			serverTemplates[0] = mcli_http.TemplateEntry{TmplName: "fromcmdline", TmplType: "standart",
-				TmplPath: tmplPath, TmplPrefix: tmplPrefix, TmplDataPath: tmplDataPath}
+		signal.Notify(StopHttpChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+		signal.Notify(ReloadHttpChan, syscall.SIGHUP)
+		Ilogger.Info().Msg(fmt.Sprintf("http server started on port %s", params.port))
+
+	serve:
+		for {
+			select {
+			case <-ReloadHttpChan:
+				Ilogger.Info().Msg("reloading http server config")
+				if err := reloadHttpConfig(cmd, handler, params); err != nil {
+					Elogger.Error().Msgf("config reload failed, server keeps running with previous config: %v", err)
+					continue
+				}
+				Ilogger.Info().Msg("http server config reloaded")
+			case <-StopHttpChan:
+				break serve
+			}
 		}
-		r.SetTemplatesRoutes(Ctx, serverTemplates)
 
-		// echo route for testing and debugging
-		if echoRouteFromPlugin, ok := HttpDefaultPluginRouteMap["HTTP_ECHO"]; ok {
-			r.AddRouteWithHandler("/echo", mcli_http.Equal, mcli_http.HandlerFunc(echoRouteFromPlugin))
-		} else {
-			r.AddRouteWithHandler("/echo", mcli_http.Equal, mcli_http.Http_Echo)
+		Ilogger.Info().Msg(fmt.Sprintf("http server stopped on port %s", params.port))
+
+		// in-flight requests are drained for shutdown timeout, then connections are closed
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			Elogger.Error().Msg(fmt.Sprintf("server shutdown failed: %+v", err))
+			srv.Close()
 		}
+		handler.current.Load().release()
+		Ilogger.Info().Msg("server shutting down properly")
+	},
+}
 
-		r.AddRouteWithHandler(`/regexp-test/([a-zA-Z]+)/(\d+)`, mcli_http.Regexp, mcli_http.Regexp_Test)
+// httpServerParams are settings of http server from command flags or config
+type httpServerParams struct {
+	port, baseUrl, staticPath, staticPrefix string
+	tmplPath, tmplPrefix, tmplDataPath      string
+	tlsKey, tlsCert                         string
+	timeout                                 int64
+}
 
-		// setting up middleware
+// getHttpServerParams takes settings from flags, not changed flags are taken from config
+func getHttpServerParams(cmd *cobra.Command) httpServerParams {
+	var params httpServerParams
+
+	params.port, _ = cmd.Flags().GetString("port")
+	isPortSet := cmd.Flags().Lookup("port").Changed
+	params.staticPath, _ = cmd.Flags().GetString("static-path")
+	isStaticPathSet := cmd.Flags().Lookup("static-path").Changed
+	params.staticPrefix, _ = cmd.Flags().GetString("static-prefix")
+	isStaticPrefix := cmd.Flags().Lookup("static-prefix").Changed
+	params.baseUrl, _ = cmd.Flags().GetString("base-url")
+	isBaseUrl := cmd.Flags().Lookup("base-url").Changed
+
+	params.tlsKey, _ = cmd.Flags().GetString("tls-key")
+	params.tlsCert, _ = cmd.Flags().GetString("tls-cert")
+	params.timeout, _ = cmd.Flags().GetInt64("timeout")
+	isTimeoutSet := cmd.Flags().Lookup("timeout").Changed
+	routerV2, _ := cmd.Flags().GetBool("v2-router")
+
+	// process configuration or setup defaults
+	Config.Http.Server.RouterV2 = routerV2
+
+	if !isPortSet && len(Config.Http.Server.Port) > 0 {
+		params.port = Config.Http.Server.Port
+	}
+	if !isTimeoutSet && Config.Http.Server.Timeout > 0 {
+		params.timeout = Config.Http.Server.Timeout
+	}
+	if !isStaticPathSet && len(Config.Http.Server.StaticPath) > 0 {
+		params.staticPath = Config.Http.Server.StaticPath
+	}
+	if !isStaticPrefix && len(Config.Http.Server.StaticPrefix) > 0 {
+		params.staticPrefix = Config.Http.Server.StaticPrefix
+	}
+	if !isBaseUrl && len(Config.Http.Server.BaseUrl) > 0 {
+		params.baseUrl = Config.Http.Server.BaseUrl
+	}
+	params.baseUrl = strings.Trim(params.baseUrl, "/")
+
+	params.tmplPath, _ = GetStringParam("tmpl-path", cmd, Config.Http.Server.TmplPath)
+	params.tmplPrefix, _ = GetStringParam("tmpl-prefix", cmd, Config.Http.Server.TmplPrefix)
+	params.tmplDataPath, _ = GetStringParam("tmpl-datapath", cmd, Config.Http.Server.TmplDataPath)
+	return params
+}
 
-		err = r.Use(mcli_http.NewCORS(Ilogger, Elogger, mcli_http.HttpConfig.Server.CorsParamFilePath))
-		if err != nil {
-			Elogger.Error().Err(err)
-		}
+// shutdownTimeout is time to drain requests on shutdown and to keep replaced router on reload
+func shutdownTimeout() time.Duration {
+	if Config.Http.Server.ShutdownTimeout > 0 {
+		return time.Duration(Config.Http.Server.ShutdownTimeout * int64(time.Millisecond))
+	}
+	return 10 * time.Second
+}
 
-		// err := r.Use(mcli_http.NewLogger(Ilogger, Elogger, mcli_http.LoggerOpts{ShowUrl: true, ShowIp: false}))
-		// if err != nil {
-		// 	Elogger.Error().Err(err)
-		// }
+// httpRouter is router built from config with resources released when router is replaced or server stops
+type httpRouter struct {
+	router *mcli_http.Router
+	cancel context.CancelFunc
+	// redis store opened for this router, common store is not closed
+	redisStore *mcli_redis.RedisStore
+}
 
-		var redisStore *mcli_redis.RedisStore
+func (h *httpRouter) release() {
+	h.cancel()
+	if h.redisStore != nil {
+		h.redisStore.RedisPool.Close()
+	}
+}
 
-		if Config.Http.Server.Auth.IsAuthenticate {
-			var err error
-			if Config.Http.Server.Auth.RedisUseCommon && CommonRedisStore != nil {
-				redisStore = CommonRedisStore
-			} else {
+// swappableHandler serves requests by current router, it is replaced atomically on config reload
+type swappableHandler struct {
+	current atomic.Pointer[httpRouter]
+}
 
-				if Config.Http.Server.Auth.RedisHost == "" {
-					Config.Http.Server.Auth.RedisHost = Config.Common.RedisHost
-					Config.Http.Server.Auth.RedisPwd = Config.Common.RedisPwd
-				}
-				if Config.Http.Server.Auth.RedisHost == ":" {
-					Config.Http.Server.Auth.RedisHost = fmt.Sprintf("%s:%s", "localhost", "6379")
-				}
+func (h *swappableHandler) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	h.current.Load().router.ServeHTTP(res, req)
+}
 
-				// Ilogger.Trace().Msgf("%v, %v", Config.Common.RedisHost, Config.Common.RedisPwd)
-				// _, err = mcli_redis.InitCache(Config.Http.Server.Auth.RedisHost, Config.Http.Server.Auth.RedisPwd)
-				redisStore, err = mcli_redis.NewRedisStore("redishttp_"+Config.Common.AppName, Config.Http.Server.Auth.RedisHost,
-					Config.Http.Server.Auth.RedisPwd, "userlist", Config.Http.Server.Auth.RedisDatabaseNo)
-				if err != nil {
-					Elogger.Fatal().Msg(fmt.Sprintf("error init redis store: %v\n", err.Error()))
-				}
-				_, err = redisStore.RedisPool.Get().Do("PING")
-				if err != nil {
-					Elogger.Fatal().Msgf("redis connection error: %v", err.Error())
-				}
-				Ilogger.Trace().Msg("Ping Pong to redis server is successful")
-			}
-			r.KVStore = redisStore
-			r.CredentialStore = mcli_http.NewUserStore(redisStore, "userlist")
+// reloadHttpConfig re-reads config file and builds new router from it.
+// If config or router is not valid current config and router stay in use.
+func reloadHttpConfig(cmd *cobra.Command, handler *swappableHandler, started httpServerParams) error {
+	configFile, _ := rootCmd.Flags().GetString("config")
+	if _, err := os.Stat(configFile); err != nil {
+		return fmt.Errorf("config file %s is not available: %w", configFile, err)
+	}
+	var newConfig ConfigData
+	if err := parseConfigFile(configFile, &newConfig); err != nil {
+		return err
+	}
+
+	// new router is built with its own server state, state of current router is not changed
+	previousHttp := Config.Http
+	Config.Http = newConfig.Http
+	params := getHttpServerParams(cmd)
+	if params.port != started.port || params.tlsCert != started.tlsCert || params.tlsKey != started.tlsKey {
+		Elogger.Warn().Msg("port and tls settings are applied after restart only")
+	}
+	next, err := buildHttpRouter(params, true)
+	if err != nil {
+		Config.Http = previousHttp
+		return err
+	}
+
+	mcli_http.PublishServerState(next.router.State())
+	previous := handler.current.Swap(next)
+	// requests started before swap are served by previous router with its state until drained
+	drainTimeout := shutdownTimeout()
+	go func() {
+		time.Sleep(drainTimeout)
+		previous.release()
+	}()
+	return nil
+}
 
-			// internalSecretStorePath := filepath.Join(GlobalMap["RootPath"], "internal-secrets")
-			// _, _, err = mcli_utils.IsExistsAndCreate(internalSecretStorePath, true)
-			// if err != nil {
-			// 	Elogger.Fatal().Msgf("internal secret store error - path do not exists: %v", err.Error())
-			// }
+// buildHttpRouter builds router with middlewares, templates and plugins from current config.
+// Router gets new server state which is published by caller when router is put in service.
+// Template errors fail reload only, on start they are logged as server may run without templates.
+func buildHttpRouter(params httpServerParams, reload bool) (*httpRouter, error) {
+	state := mcli_http.NewServerState(Config.Http)
+	ctx, cancel := context.WithCancel(Ctx)
+	result := &httpRouter{cancel: cancel}
+	built := false
+	defer func() {
+		if !built {
+			result.release()
+		}
+	}()
+
+	rOpts := mcli_http.RouterOptions{BaseUrl: params.baseUrl}
+	rOpts.Ctx = ctx
+	rOpts.Notify = Notify
+	rOpts.State = state
+	r := mcli_http.NewRouter(params.staticPath, params.staticPrefix, Ilogger, Elogger, &rOpts)
+	result.router = r
+
+	// message catalogs for t template function, sign in and error pages
+	catalog, err := loadI18nCatalog()
+	if err != nil {
+		Elogger.Error().Msgf("error loading message catalogs: %v", err)
+	}
+	state.Catalog = catalog
+	// fetcher of remote markdown pages and data sources
+	state.RemoteContent = newRemoteContent()
+
+	// root route
+	// get path to root template
+	rootPageTmplPath, err := getFullPath(Config.Http.Server.RootPage.RootPageTemplate)
+	if err != nil {
+		Elogger.Error().Msg(err.Error())
+		rootPageTmplPath = ""
+	}
+
+	rootHandler, err := mcli_http.GetRootHandler(rootPageTmplPath, params.baseUrl,
+		Config.Http.Server.RootPage.RootPageTitle,
+		"/",
+		Config.Http.Server.Auth.SignInRoute)
+
+	if err != nil {
+		return nil, fmt.Errorf("error reading root page template: %w", err)
+	}
+	r.AddRouteWithHandler("/", mcli_http.Equal, rootHandler)
+
+	serverTemplates := Config.Http.Server.Templates
+
+	if len(params.tmplPath) > 0 {
+		serverTemplates = []mcli_http.TemplateEntry{{TmplName: "fromcmdline", TmplType: "standart",
+			TmplPath: params.tmplPath, TmplPrefix: params.tmplPrefix, TmplDataPath: params.tmplDataPath}}
+	}
+	if err := r.SetTemplatesRoutes(ctx, serverTemplates); err != nil {
+		if reload {
+			return nil, fmt.Errorf("error loading templates: %w", err)
+		}
+		Elogger.Error().Msgf("error loading templates: %v", err)
+	}
 
-			internalSecretStore := mcli_secrets.NewSecretsEntries(mcli_fs.GetFile, mcli_fs.SetFile, mcli_crypto.AesCypher, nil)
-			internalVaultPath := GlobalMap["RootSecretVaultPath"]
+	// full-text search over template and markdown pages
+	if Config.Http.Server.Search.Enabled {
+		if err := r.EnableSearch(ctx, Config.Http.Server.Search.Route); err != nil {
+			Elogger.Error().Msgf("error building search index: %v", err)
+		}
+	}
 
-			if err := internalSecretStore.FillStore(internalVaultPath, GlobalMap["RootSecretKeyPath"]); err != nil {
-				Elogger.Fatal().Msg(err.Error())
-			}
-			secretMapa := internalSecretStore.GetSecretPlainMap()
-			cookieKey1, cookieKey2 := "", ""
-			cookieKey1Secret, ok := secretMapa["CookieKey1"]
+	r.AddRouteWithHandler(`/regexp-test/([a-zA-Z]+)/(\d+)`, mcli_http.Regexp, mcli_http.Regexp_Test)
 
-			if ok {
-				cookieKey1 = cookieKey1Secret.Secret
-				if err != nil {
-					Elogger.Fatal().Msg(err.Error())
-				}
-				// Ilogger.Trace().Msg(cookieKey1)
-			} else {
-				cookieKey1 = string(mcli_secrets.GenKey(32))
+	// setting up middleware
 
-				secretEntry1, err := internalSecretStore.NewEntry("CookieKey1", "CookieKey1", "Key 1 for Cookie encription")
-				if err != nil {
-					Elogger.Fatal().Msgf("cookieKey1 new entry error: %v", err)
-				}
-				secretEntry1.SetSecret(fmt.Sprintf("%x", cookieKey1), true, false)
-				// Ilogger.Trace().Msg(fmt.Sprintf("%x", cookieKey1))
+	r.Use(mcli_http.NewRequestId(Ilogger))
+	if Config.Http.Server.SecurityHeaders.Enabled {
+		security := mcli_http.NewSecurityHeaders(Config.Http.Server.SecurityHeaders)
+		r.Use(security)
+		if reportRoute := security.ReportRoute(); len(reportRoute) > 0 {
+			r.AddRouteWithHandler(reportRoute, mcli_http.Equal, mcli_http.CSPReportHandler(Ilogger))
+		}
+	}
 
-				internalSecretStore.AddEntry(secretEntry1)
-				internalSecretStore.Save(internalVaultPath, GlobalMap["RootSecretKeyPath"])
-			}
+	cors, err := newHttpCORS(state.Config)
+	if err != nil {
+		return nil, err
+	}
+	r.Use(cors)
 
-			cookieKey2Secret, ok := secretMapa["CookieKey2"]
+	r.Use(mcli_http.NewLocale(Config.Http.Server.I18n.UrlPrefix))
 
-			if ok {
-				cookieKey2 = cookieKey2Secret.Secret
-				if err != nil {
-					Elogger.Fatal().Msg(err.Error())
-				}
-				// Ilogger.Trace().Msg(cookieKey2)
-			} else {
-				// time.Sleep(200 * time.Millisecond)
-				cookieKey2 = string(mcli_secrets.GenKey(32))
-				secretEntry2, err := internalSecretStore.NewEntry("CookieKey2", "CookieKey2", "Key 2 for Cookie encription")
-				if err != nil {
-					Elogger.Fatal().Msgf("cookieKey2 new entry error: %v", err)
-				}
-				secretEntry2.SetSecret(fmt.Sprintf("%x", cookieKey2), true, false)
-				// Ilogger.Trace().Msg(fmt.Sprintf("%x", cookieKey2))
-				internalSecretStore.AddEntry(secretEntry2)
+	// err := r.Use(mcli_http.NewLogger(Ilogger, Elogger, mcli_http.LoggerOpts{ShowUrl: true, ShowIp: false}))
+	// if err != nil {
+	// 	Elogger.Error().Err(err)
+	// }
 
-				internalSecretStore.Save(internalVaultPath, GlobalMap["RootSecretKeyPath"])
-			}
-			isEncCookie := Config.Http.Server.Auth.SecureAuthToken
-
-			var cookieByteKey1, cookieByteKey2 []byte
-			if len(cookieKey1) > 0 && len(cookieKey2) > 0 {
-				isEncCookie = true
-				cookieByteKey1, err = mcli_secrets.LoadByteKeyFromHexString(cookieKey1)
-				if err != nil {
-					isEncCookie = false
-				}
-				cookieByteKey2, err = mcli_secrets.LoadByteKeyFromHexString(cookieKey2)
-				if err != nil {
-					isEncCookie = false
-				}
-			}
-			mcli_http.SetSecretCookieOptions(isEncCookie, Config.Http.Server.Auth.AuthTokenName,
-				cookieByteKey1, cookieByteKey2)
+	if Config.Http.Server.Auth.IsAuthenticate {
+		result.redisStore, err = setupHttpAuth(r, params.baseUrl)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		Ilogger.Warn().Msg("Authentication and sessions are disabled !!!")
+	}
 
-			// init auth middleware
-			err = r.Use(mcli_http.NewAuth(r.CredentialStore, r.KVStore, isEncCookie))
+	// response cache is set up after auth middleware to keep authenticated responses out of it
+	if Config.Http.Server.Cache.Enabled {
+		responseCache, err := mcli_http.NewResponseCache(Config.Http.Server.Cache, r.KVStore, Elogger)
+		if err != nil {
+			return nil, fmt.Errorf("response cache setup error: %w", err)
+		}
+		r.Use(responseCache)
+		if purgeRoute := Config.Http.Server.Cache.PurgeRoute; len(purgeRoute) > 0 {
+			purgeHandler, err := responseCache.PurgeHandler()
 			if err != nil {
-				Elogger.Error().Msg(err.Error())
+				return nil, fmt.Errorf("response cache purge route %s: %w", purgeRoute, err)
 			}
+			r.AddRouteWithHandler(purgeRoute, mcli_http.Equal, purgeHandler)
+		}
+	}
 
-			// process route to signin template
-			signInTmplPath, err := getFullPath(Config.Http.Server.Auth.SignInTemplate)
-			if err != nil {
-				Elogger.Error().Msg(err.Error())
-				signInTmplPath = ""
-			}
-			signInHandler, err := mcli_http.GetSignInHandler(signInTmplPath, baseUrl,
-				Config.Http.Server.Auth.SignInRoute, Config.Http.Server.Auth.SignInRedirect)
-			if err != nil {
-				Elogger.Fatal().Msgf("error reading file: %v", err)
-			}
-			r.AddRouteWithHandler(Config.Http.Server.Auth.SignInRoute, mcli_http.Prefix,
-				signInHandler)
+	// rest api over kv store collections, common redis store is used if auth store is not set up
+	if Config.Http.Server.Rest.Enabled {
+		var kvStore mcli_type.KVStorer
+		if r.KVStore == nil && CommonRedisStore != nil {
+			kvStore = CommonRedisStore
+		}
+		if _, err := r.EnableRestAPI(Config.Http.Server.Rest, kvStore); err != nil {
+			return nil, fmt.Errorf("rest api setup error: %w", err)
+		}
+	}
+
+	// plugins routes are registered after middlewares which they may require
+	if _, err := registerHttpPlugins(ctx, r); err != nil {
+		Elogger.Error().Msgf("error loading plugins: %v", err)
+	}
+	// echo route for testing and debugging if it is not served by plugin
+	if !r.HasRoute("/echo", mcli_http.Equal) {
+		r.AddRouteWithHandler("/echo", mcli_http.Equal, mcli_http.Http_Echo)
+	}
+	// middleware chain is built before router serves concurrent requests
+	r.ConstructFinalHandler()
+	built = true
+	return result, nil
+}
 
-			// r.PrintRoutes()
-			// store := mcli_http.UserRedisStore{RedisPool: mcli_http.RedisPool, CollectionPrefix: "userlist"}
-			// c, _ := store.GetAllUsers("")
-			// for _, user := range c {
-			// 	fmt.Println(*user)
-			// }
+// setupHttpTracing makes spans of http server, reverse proxy and requests to be exported
+// to file from --spans-file flag or http.tracing.spans-file config, returned function closes file
+func setupHttpTracing(cmd *cobra.Command) (func(), error) {
+	spansFile, _ := cmd.Flags().GetString("spans-file")
+	if len(spansFile) > 0 {
+		spansFile, _ = filepath.Abs(spansFile)
+	} else if len(Config.Http.Tracing.SpansFile) > 0 {
+		fullPath, err := getFullPath(Config.Http.Tracing.SpansFile)
+		if err != nil {
+			return nil, err
+		}
+		spansFile = fullPath
+	}
+	if len(spansFile) == 0 {
+		return func() {}, nil
+	}
+	writer, err := mcli_http.NewSpanFileWriter(spansFile)
+	if err != nil {
+		return nil, err
+	}
+	mcli_http.SpanExport = writer
+	return func() {
+		mcli_http.SpanExport = nil
+		writer.Close()
+	}, nil
+}
 
-		} else {
-			Ilogger.Warn().Msg("Authentication and sessions are disabled !!!")
+// newHttpCORS creates cors middleware from cors section of config or from cors file
+func newHttpCORS(config mcli_http.Http) (*mcli_http.CORS, error) {
+	if corsConfig := config.Server.Cors; corsConfig != nil {
+		cors, err := mcli_http.NewCORSWithConfig(Ilogger, Elogger, *corsConfig)
+		if err != nil {
+			return nil, fmt.Errorf("cors config is not valid: %w", err)
 		}
+		return cors, nil
+	}
+	cors := mcli_http.NewCORS(Ilogger, Elogger, config.Server.CorsParamFilePath)
+	if cors == nil {
+		return nil, fmt.Errorf("cors config %s is not loaded", config.Server.CorsParamFilePath)
+	}
+	return cors, nil
+}
 
-		// TODO: add CORS and CSRF middleware
-		var srv *http.Server
-		if len(tlsCert) > 0 && len(tlsKey) > 0 {
+// setupHttpAuth sets up user and session stores, auth middleware and sign in route.
+// Redis store opened for http server is returned to be closed with router.
+func setupHttpAuth(r *mcli_http.Router, baseUrl string) (*mcli_redis.RedisStore, error) {
+	var redisStore, ownStore *mcli_redis.RedisStore
+	var err error
+	if Config.Http.Server.Auth.RedisUseCommon && CommonRedisStore != nil {
+		redisStore = CommonRedisStore
+	} else {
+
+		if Config.Http.Server.Auth.RedisHost == "" {
+			Config.Http.Server.Auth.RedisHost = Config.Common.RedisHost
+			Config.Http.Server.Auth.RedisPwd = Config.Common.RedisPwd
+		}
+		if Config.Http.Server.Auth.RedisHost == ":" {
+			Config.Http.Server.Auth.RedisHost = fmt.Sprintf("%s:%s", "localhost", "6379")
+		}
 
-			srv = &http.Server{
-				Addr:         ":" + port,
-				Handler:      r,
-				ReadTimeout:  time.Duration(timeout * int64(time.Millisecond)),
-				WriteTimeout: time.Duration(timeout * 3 * int64(time.Millisecond)),
-				IdleTimeout:  time.Duration(timeout * 4 * int64(time.Millisecond)),
-				TLSConfig: &tls.Config{
-					MinVersion:               tls.VersionTLS13,
-					PreferServerCipherSuites: true,
-				},
-			}
+		redisStore, err = mcli_redis.NewRedisStore("redishttp_"+Config.Common.AppName, Config.Http.Server.Auth.RedisHost,
+			Config.Http.Server.Auth.RedisPwd, "userlist", Config.Http.Server.Auth.RedisDatabaseNo)
+		if err != nil {
+			return nil, fmt.Errorf("error init redis store: %w", err)
+		}
+		ownStore = redisStore
+		_, err = redisStore.RedisPool.Get().Do("PING")
+		if err != nil {
+			return ownStore, fmt.Errorf("redis connection error: %w", err)
+		}
+		Ilogger.Trace().Msg("Ping Pong to redis server is successful")
+	}
+	r.KVStore = redisStore
+	if Config.Http.Server.RemoteContent.CacheInKV {
+		r.State().RemoteContent.KVStore = redisStore
+	}
+	r.CredentialStore = mcli_http.NewUserStore(redisStore, "userlist")
+
+	internalSecretStore := mcli_secrets.NewSecretsEntries(mcli_fs.GetFile, mcli_fs.SetFile, mcli_crypto.AesCypher, nil)
+	internalVaultPath := GlobalMap["RootSecretVaultPath"]
+
+	if err := internalSecretStore.FillStore(internalVaultPath, GlobalMap["RootSecretKeyPath"]); err != nil {
+		return ownStore, err
+	}
+	secretMapa := internalSecretStore.GetSecretPlainMap()
+	cookieKey1, cookieKey2 := "", ""
+	cookieKey1Secret, ok := secretMapa["CookieKey1"]
+
+	if ok {
+		cookieKey1 = cookieKey1Secret.Secret
+	} else {
+		cookieKey1 = string(mcli_secrets.GenKey(32))
+
+		secretEntry1, err := internalSecretStore.NewEntry("CookieKey1", "CookieKey1", "Key 1 for Cookie encription")
+		if err != nil {
+			return ownStore, fmt.Errorf("cookieKey1 new entry error: %w", err)
+		}
+		secretEntry1.SetSecret(fmt.Sprintf("%x", cookieKey1), true, false)
 
-			go func() {
-				if Config.Http.Server.Auth.IsAuthenticate {
-					defer func() {
-						// for _, pool := range mcli_redis.MapRedisPool {
-						// 	pool.Close()
-						// }
-						redisStore.RedisPool.Close()
-					}()
-				}
-				if err := srv.ListenAndServeTLS(tlsCert, tlsKey); err != nil && err != http.ErrServerClosed {
-					Elogger.Fatal().Msg(err.Error())
-				}
-			}()
-		} else {
-			srv = &http.Server{
-				Addr:         ":" + port,
-				Handler:      r,
-				ReadTimeout:  time.Duration(timeout * int64(time.Millisecond)),
-				WriteTimeout: time.Duration(timeout * 3 * int64(time.Millisecond)),
-				IdleTimeout:  time.Duration(timeout * 4 * int64(time.Millisecond)),
-			}
+		internalSecretStore.AddEntry(secretEntry1)
+		internalSecretStore.Save(internalVaultPath, GlobalMap["RootSecretKeyPath"])
+	}
 
-			go func() {
-				if Config.Http.Server.Auth.IsAuthenticate {
-					defer func() {
-						// for _, pool := range mcli_redis.MapRedisPool {
-						// 	pool.Close()
-						// }
-						redisStore.RedisPool.Close()
-					}()
-				}
-				if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-					Elogger.Fatal().Msg(err.Error())
-				}
-			}()
+	cookieKey2Secret, ok := secretMapa["CookieKey2"]
+
+	if ok {
+		cookieKey2 = cookieKey2Secret.Secret
+	} else {
+		cookieKey2 = string(mcli_secrets.GenKey(32))
+		secretEntry2, err := internalSecretStore.NewEntry("CookieKey2", "CookieKey2", "Key 2 for Cookie encription")
+		if err != nil {
+			return ownStore, fmt.Errorf("cookieKey2 new entry error: %w", err)
 		}
+		secretEntry2.SetSecret(fmt.Sprintf("%x", cookieKey2), true, false)
+		internalSecretStore.AddEntry(secretEntry2)
 
-		signal.Notify(StopHttpChan, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
-		Ilogger.Info().Msg(fmt.Sprintf("http server started on port %s", port))
+		internalSecretStore.Save(internalVaultPath, GlobalMap["RootSecretKeyPath"])
+	}
+	isEncCookie := Config.Http.Server.Auth.SecureAuthToken
 
-		<-StopHttpChan
+	var cookieByteKey1, cookieByteKey2 []byte
+	if len(cookieKey1) > 0 && len(cookieKey2) > 0 {
+		isEncCookie = true
+		cookieByteKey1, err = mcli_secrets.LoadByteKeyFromHexString(cookieKey1)
+		if err != nil {
+			isEncCookie = false
+		}
+		cookieByteKey2, err = mcli_secrets.LoadByteKeyFromHexString(cookieKey2)
+		if err != nil {
+			isEncCookie = false
+		}
+	}
+	r.State().SetSecretCookieOptions(isEncCookie, Config.Http.Server.Auth.AuthTokenName,
+		cookieByteKey1, cookieByteKey2)
+
+	// init auth middleware
+	r.Use(mcli_http.NewAuth(r.CredentialStore, r.KVStore, isEncCookie))
+
+	// process route to signin template
+	signInTmplPath, err := getFullPath(Config.Http.Server.Auth.SignInTemplate)
+	if err != nil {
+		Elogger.Error().Msg(err.Error())
+		signInTmplPath = ""
+	}
+	signInHandler, err := mcli_http.GetSignInHandler(r.State(), signInTmplPath, baseUrl,
+		Config.Http.Server.Auth.SignInRoute, Config.Http.Server.Auth.SignInRedirect)
+	if err != nil {
+		return ownStore, fmt.Errorf("error reading sign in template: %w", err)
+	}
+	r.AddRouteWithHandler(Config.Http.Server.Auth.SignInRoute, mcli_http.Prefix,
+		signInHandler)
+	return ownStore, nil
+}
 
-		Ilogger.Info().Msg(fmt.Sprintf("http server stopped on port %s", port))
+// loadI18nCatalog returns message catalogs from http.server.i18n config section,
+// catalog is returned with loading error to be used without messages of files
+func loadI18nCatalog() (*mcli_http.MessageCatalog, error) {
+	catalog := mcli_http.NewMessageCatalog(Config.Http.Server.I18n.DefaultLocale)
+	if len(Config.Http.Server.I18n.CatalogPath) == 0 {
+		return catalog, nil
+	}
+	catalogPath, err := getFullPath(Config.Http.Server.I18n.CatalogPath)
+	if err != nil {
+		return catalog, err
+	}
+	return catalog, catalog.LoadDir(catalogPath)
+}
 
-		if err := srv.Shutdown(Ctx); err != nil {
-			Elogger.Fatal().Msg(fmt.Sprintf("server shutdown failed: %+v", err))
-		}
-		Ilogger.Info().Msg("server shutting down properly")
-	},
+// newRemoteContent returns fetcher of remote sources from http.server.remote-content config section
+func newRemoteContent() *mcli_http.RemoteFetcher {
+	remoteConfig := Config.Http.Server.RemoteContent
+	fetcher := mcli_http.NewRemoteFetcher(remoteConfig.AllowedHosts,
+		time.Duration(remoteConfig.Timeout*int64(time.Millisecond)), remoteConfig.MaxBodySize)
+	if remoteConfig.FreshFor > 0 {
+		fetcher.FreshFor = time.Duration(remoteConfig.FreshFor * int64(time.Second))
+	}
+	fetcher.ErrorLog = Elogger
+	return fetcher
 }
 
 func init() {
 	rootCmd.AddCommand(httpCmd)
 
 	httpCmd.Flags().Int64P("timeout", "t", 5000, "Specify timeout for http server service")
+	httpCmd.PersistentFlags().String("spans-file", "", "Specify file to append span timings as JSON lines")
 
 	// setup flags
 	var port, staticPath, staticPrefix string = "8080", "http-static", "static"
@@ -0,0 +1,86 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+)
+
+// buildCmd represents the http build command
+var buildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Renders templates and markdown pages into static site",
+	Long: `Renders every template and markdown page with its data files and partials into output folder,
+rewrites links to relative ones, copies static assets and writes sitemap.xml if --site-url is given.
+Build fails if any page cannot be rendered or refers to missing data.
+Example usage:
+	mcli http build --out ./public --site-url https://docs.direct-dev.ru
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outDir, _ := cmd.Flags().GetString("out")
+		siteUrl, _ := cmd.Flags().GetString("site-url")
+		staticPath, _ := GetStringParam("static-path", cmd, Config.Http.Server.StaticPath)
+		staticPrefix, _ := GetStringParam("static-prefix", cmd, Config.Http.Server.StaticPrefix)
+		baseUrl, _ := GetStringParam("base-url", cmd, Config.Http.Server.BaseUrl)
+		baseUrl = strings.Trim(baseUrl, "/")
+
+		tmplPath, _ := cmd.Flags().GetString("tmpl-path")
+		tmplPrefix, _ := cmd.Flags().GetString("tmpl-prefix")
+		tmplDataPath, _ := cmd.Flags().GetString("tmpl-datapath")
+
+		state := mcli_http.NewServerState(Config.Http)
+		var err error
+		if state.Catalog, err = loadI18nCatalog(); err != nil {
+			Elogger.Fatal().Msgf("error loading message catalogs: %v", err)
+		}
+		state.RemoteContent = newRemoteContent()
+		mcli_http.PublishServerState(state)
+
+		rOpts := mcli_http.RouterOptions{BaseUrl: baseUrl, Ctx: Ctx, Notify: Notify, StrictTemplateData: true,
+			State: state}
+		r := mcli_http.NewRouter(staticPath, staticPrefix, Ilogger, Elogger, &rOpts)
+
+		serverTemplates := make([]mcli_http.TemplateEntry, 0, len(Config.Http.Server.Templates))
+		if len(tmplPath) > 0 {
+			serverTemplates = append(serverTemplates, mcli_http.TemplateEntry{TmplName: "fromcmdline",
+				TmplType: "standart", TmplPath: tmplPath, TmplPrefix: tmplPrefix, TmplDataPath: tmplDataPath})
+		} else {
+			for _, t := range Config.Http.Server.Templates {
+				// templates are rendered once, so refreshing is not needed
+				t.TmplRefreshType = ""
+				serverTemplates = append(serverTemplates, t)
+			}
+		}
+		if err := r.SetTemplatesRoutes(Ctx, serverTemplates); err != nil {
+			Elogger.Fatal().Msgf("error loading templates: %v", err)
+		}
+
+		result, err := r.BuildSite(mcli_http.SiteBuildOptions{OutDir: outDir, SiteUrl: siteUrl})
+		if err != nil {
+			Elogger.Fatal().Msgf("site build failed: %v", err)
+		}
+		for _, page := range result.Pages {
+			Ilogger.Trace().Msgf("page written: %s", page)
+		}
+		fmt.Printf("site built in %s: %d pages, %d static assets\n", outDir, len(result.Pages), result.Assets)
+	},
+}
+
+func init() {
+	httpCmd.AddCommand(buildCmd)
+
+	buildCmd.Flags().StringP("out", "o", "http-build", "Specify output folder for static site")
+	buildCmd.Flags().String("site-url", "", "Specify absolute url of published site for sitemap, sitemap is not written without it")
+	buildCmd.Flags().String("base-url", "", "Specify base url path used in links of pages")
+	buildCmd.Flags().String("static-path", "http-static", "Specify relative path to static folder")
+	buildCmd.Flags().String("static-prefix", "static", "Specify url prefix part to static content")
+	buildCmd.Flags().String("tmpl-path", "", "Specify path to template folder instead of configured templates")
+	buildCmd.Flags().String("tmpl-prefix", "", "Specify url prefix part of template content")
+	buildCmd.Flags().String("tmpl-datapath", "", "Specify path to data files of templates")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// cacheCmd represents the http cache command
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Commands to manage response cache of http server",
+	Long: `Response cache of http server is configured in http.server.cache section of config.
+Cached responses are kept in memory of server process or in kv store, so they are managed through
+purge endpoint of running server.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// cachePurgeCmd represents the http cache purge command
+var cachePurgeCmd = &cobra.Command{
+	Use:   "purge [path-prefix]",
+	Short: "Removes cached responses which paths start with prefix, all responses without prefix",
+	Long: `Calls purge endpoint of running http server (http.server.cache.purge-route) or reverse proxy.
+Example usage:
+	mcli http cache purge /srv-1/tmpl/
+	mcli http cache purge --url http://localhost:8080/_mcli/cache/purge --token secret
+`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		purgeUrl, _ := cmd.Flags().GetString("url")
+		token, _ := cmd.Flags().GetString("token")
+		cacheConfig := Config.Http.Server.Cache
+		if len(purgeUrl) == 0 {
+			if len(cacheConfig.PurgeRoute) == 0 {
+				Elogger.Fatal().Msg("purge route is not configured in http.server.cache.purge-route, use --url")
+			}
+			purgeUrl = fmt.Sprintf("http://localhost:%s%s", Config.Http.Server.Port,
+				Config.Http.GetFullUrl(cacheConfig.PurgeRoute))
+		}
+		if !cmd.Flags().Lookup("token").Changed {
+			token = cacheConfig.PurgeToken
+		}
+
+		target, err := url.Parse(purgeUrl)
+		if err != nil {
+			Elogger.Fatal().Msgf("wrong purge url: %v", err)
+		}
+		if len(args) > 0 {
+			query := target.Query()
+			query.Set("path", args[0])
+			target.RawQuery = query.Encode()
+		}
+		req, err := http.NewRequest(http.MethodPost, target.String(), nil)
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		response, err := (&http.Client{Timeout: 10 * time.Second}).Do(req)
+		if err != nil {
+			Elogger.Fatal().Msgf("purge request error: %v", err)
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		if response.StatusCode != http.StatusOK {
+			Elogger.Fatal().Msgf("purge failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+		}
+		fmt.Println(strings.TrimSpace(string(body)))
+	},
+}
+
+func init() {
+	httpCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cachePurgeCmd)
+
+	cachePurgeCmd.Flags().String("url", "", "Specify url of purge endpoint, default is built from config")
+	cachePurgeCmd.Flags().String("token", "", "Specify bearer token of purge endpoint, default is http.server.cache.purge-token")
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"os"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+)
+
+// mockCmd represents the http mock command
+var mockCmd = &cobra.Command{
+	Use:   "mock [file ...]",
+	Short: "Mock http server with responses declared in yaml files",
+	Long: `Mock serves responses of routes declared in yaml files as stand-in of upstream api for offline tests.
+Routes of files are tried in order, first route which matches method, path, query, headers and body responds:
+	routes:
+	  - name: host
+	    match:
+	      method: GET
+	      path: /shodan/host/:ip          # path-match: equal (default), prefix or regexp
+	      query: {key: "[a-zA-Z0-9]+"}    # values are regexps of whole value
+	      body: {json: {a: 1}}            # or equals, contains, regexp
+	    response:
+	      status: 200
+	      headers: {X-Mock: [shodan]}
+	      json: {ip_str: "{{ .Params.ip }}", id: "{{ uuid }}"}   # or body or body-file
+	    delay: 100                        # ms, random up to delay-max
+	    fault: {type: status, status: 502, rate: 0.3}           # abort, reset or status
+	    times: 1                          # route is skipped after given number of responses
+Body, body-file and strings of json are templates with .Method, .Path, .Query, .Header, .Params, .Body,
+.JSON (decoded body), .Count (number of request of route) and functions of http server templates.
+Recordings of 'mcli http reverse --record' are replayed after declared routes by --replay: responses of the
+same request are served in recorded order and the last is repeated.
+Example usage:
+	mcli http mock http-data/http-mocks/shodan.yaml -p 8090
+	mcli http reverse -p 8080 --base-url https://api.shodan.io --record shodan.jsonl
+	mcli http mock --replay shodan.jsonl --replay-timing -p 8090
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		port, _ := cmd.Flags().GetString("port")
+		tlsCert, _ := cmd.Flags().GetString("tls-cert")
+		tlsKey, _ := cmd.Flags().GetString("tls-key")
+		replayFiles, _ := cmd.Flags().GetStringSlice("replay")
+		replayTiming, _ := cmd.Flags().GetBool("replay-timing")
+
+		var routes []mcli_http.MockRoute
+		for _, file := range args {
+			config, err := mcli_http.LoadMockConfig(file)
+			if err != nil {
+				Elogger.Fatal().Msgf("mock file reading error: %v", err)
+			}
+			routes = append(routes, config.Routes...)
+		}
+		for _, file := range replayFiles {
+			content, err := os.ReadFile(file)
+			if err != nil {
+				Elogger.Fatal().Msgf("recording reading error: %v", err)
+			}
+			records, err := mcli_http.ParseMockRecords(content)
+			if err != nil {
+				Elogger.Fatal().Msgf("recording %s: %v", file, err)
+			}
+			replayed, err := mcli_http.MockRoutesFromRecords(records, replayTiming)
+			if err != nil {
+				Elogger.Fatal().Msgf("recording %s: %v", file, err)
+			}
+			routes = append(routes, replayed...)
+		}
+		if len(routes) == 0 {
+			Elogger.Fatal().Msg("no mock routes, give mock files or recordings by --replay")
+		}
+
+		state := mcli_http.NewServerState(Config.Http)
+		// mock routes are dispatched in order of declaration
+		state.Config.Server.RouterV2 = false
+		mcli_http.PublishServerState(state)
+		r := mcli_http.NewRouter("", "", Ilogger, Elogger, &mcli_http.RouterOptions{Ctx: Ctx, Notify: Notify})
+		r.Use(mcli_http.NewRequestId(Ilogger))
+		if _, err := r.EnableMock(routes); err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+
+		srv := &http.Server{Addr: fmt.Sprintf("%s:%s", host, port), Handler: r}
+		Ilogger.Info().Msgf("mock server with %d routes started on %s", len(routes), srv.Addr)
+		var err error
+		if len(tlsCert) > 0 && len(tlsKey) > 0 {
+			srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+			err = srv.ListenAndServeTLS(tlsCert, tlsKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			Elogger.Fatal().Msg(err.Error())
+		}
+	},
+}
+
+func init() {
+	httpCmd.AddCommand(mockCmd)
+
+	mockCmd.Flags().StringP("port", "p", "8090", "Specify port for mock server")
+	mockCmd.Flags().StringP("host", "H", "0.0.0.0", "Specify host for mock server")
+	mockCmd.Flags().String("tls-cert", "", "Specify tls-cert file")
+	mockCmd.Flags().String("tls-key", "", "Specify tls-key file")
+	mockCmd.Flags().StringSlice("replay", nil, "Specify recording of 'mcli http reverse --record' to replay")
+	mockCmd.Flags().Bool("replay-timing", false, "Delay replayed responses by recorded durations")
+}
@@ -0,0 +1,171 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	mcli_http "mcli/packages/mcli-http"
+	mcli_type "mcli/packages/mcli-type"
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"github.com/spf13/cobra"
+)
+
+// httpPluginSymbol is name of variable exported by http plugins
+const httpPluginSymbol = "HandlerFuncsPlugin"
+
+// registerHttpPlugins loads shared object plugins from http.server.plugins.dir and starts out-of-process plugins
+// from http.server.plugins.processes, then registers them in router. Results of loading are available
+// by r.Plugins(), started processes are stopped when ctx is done or by caller.
+func registerHttpPlugins(ctx context.Context, r *mcli_http.Router) ([]*mcli_http.ProcessPlugin, error) {
+	pluginsConfig := Config.Http.Server.Plugins
+	dir := pluginsConfig.Dir
+	if len(dir) > 0 {
+		fullDir, err := getFullPath(dir)
+		if err != nil {
+			return nil, err
+		}
+		dir = fullDir
+	}
+	modules, err := LoadHttpPlugins(dir, httpPluginSymbol)
+	if err != nil {
+		// out-of-process plugins work where shared objects are not supported
+		if len(pluginsConfig.Processes) == 0 {
+			return nil, err
+		}
+		Elogger.Error().Msgf("shared object plugins are not loaded: %v", err)
+	}
+	for _, module := range modules {
+		fileName := strings.TrimSuffix(filepath.Base(module.path), ".so")
+		if module.err != nil {
+			r.AddPluginStatus(mcli_http.PluginStatus{Name: fileName, Path: module.path, Status: "failed",
+				Error: module.err.Error()})
+			Elogger.Error().Msgf("plugin %s is not loaded: %v", module.path, module.err)
+			continue
+		}
+		registerHttpPlugin(r, module.path, module.plugin, slices.Contains(pluginsConfig.Disabled, fileName))
+	}
+
+	processes := make([]*mcli_http.ProcessPlugin, 0, len(pluginsConfig.Processes))
+	for _, process := range pluginsConfig.Processes {
+		fileName := filepath.Base(process.Path)
+		if slices.Contains(pluginsConfig.Disabled, fileName) {
+			r.AddPluginStatus(mcli_http.PluginStatus{Name: fileName, Path: process.Path, Status: "disabled"})
+			continue
+		}
+		path, err := getFullPath(process.Path)
+		if err == nil {
+			processPlugin := mcli_http.NewProcessPlugin(ctx, path, process.Args,
+				time.Duration(process.Timeout*int64(time.Millisecond)), Ilogger, Elogger)
+			if err = processPlugin.Start(); err == nil {
+				if registerHttpPlugin(r, path, processPlugin, false) {
+					processes = append(processes, processPlugin)
+				} else {
+					processPlugin.Stop()
+				}
+				continue
+			}
+		}
+		r.AddPluginStatus(mcli_http.PluginStatus{Name: fileName, Path: process.Path, Status: "failed", Error: err.Error()})
+		Elogger.Error().Msgf("plugin %s is not started: %v", process.Path, err)
+	}
+	return processes, nil
+}
+
+// registerHttpPlugin registers loaded plugin with its config and reports whether it is registered
+func registerHttpPlugin(r *mcli_http.Router, path string, plugin mcli_type.HttpPlugin, disabled bool) bool {
+	pluginsConfig := Config.Http.Server.Plugins
+	manifest := plugin.Manifest()
+	if disabled || slices.Contains(pluginsConfig.Disabled, manifest.Name) {
+		r.AddPluginStatus(mcli_http.PluginStatus{Name: manifest.Name, Version: manifest.Version,
+			ApiVersion: manifest.ApiVersion, Path: path, Status: "disabled"})
+		return false
+	}
+	if err := r.RegisterPlugin(path, plugin, pluginsConfig.Config[manifest.Name]); err != nil {
+		Elogger.Error().Msgf("plugin %s is not registered: %v", path, err)
+		return false
+	}
+	Ilogger.Trace().Msgf("plugin %s %s is registered from %s", manifest.Name, manifest.Version, path)
+	return true
+}
+
+// pluginsCmd represents the http plugins command
+var pluginsCmd = &cobra.Command{
+	Use:   "plugins",
+	Short: "Commands to manage http server plugins",
+	Long: `Http plugins are shared object files from http.server.plugins.dir folder
+or executables from http.server.plugins.processes started by mcli and served over unix socket.
+Each plugin declares its routes, methods, required middlewares and config schema.
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// pluginsListCmd represents the http plugins list command
+var pluginsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "Lists http plugins with their routes and load errors",
+	Long: `Loads and starts plugins the same way as http server does and shows which of them are loaded,
+disabled or failed (f.e. unsupported api version, invalid config or route collisions).
+Example usage:
+	mcli http plugins list -o json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outputType, _ := cmd.Flags().GetString("output")
+		mcli_http.PublishServerState(mcli_http.NewServerState(Config.Http))
+
+		// router with middlewares and routes of server which plugins may collide with
+		r := mcli_http.NewRouter("", "", Ilogger, Elogger, &mcli_http.RouterOptions{Ctx: Ctx, Notify: Notify})
+		r.Use(mcli_http.NewLocale(Config.Http.Server.I18n.UrlPrefix))
+		if Config.Http.Server.Auth.IsAuthenticate {
+			r.Use(mcli_http.NewAuth(nil, nil, false))
+			r.AddRouteWithHandler(Config.Http.Server.Auth.SignInRoute, mcli_http.Prefix, nil)
+		}
+		r.AddRouteWithHandler("/", mcli_http.Equal, nil)
+		processes, err := registerHttpPlugins(Ctx, r)
+		if err != nil {
+			Elogger.Fatal().Msgf("error loading plugins: %v", err)
+		}
+		for _, process := range processes {
+			process.Stop()
+		}
+
+		plugins := r.Plugins()
+		if outputType == "json" {
+			out, err := mcli_utils.PrettyJsonEncodeToString(plugins)
+			if err != nil {
+				Elogger.Fatal().Msg(err.Error())
+			}
+			fmt.Println(out)
+			return
+		}
+		if len(plugins) == 0 {
+			fmt.Println("no plugins found")
+			return
+		}
+		for _, p := range plugins {
+			fmt.Printf("%-20s %-10s api v%d  %-8s %s\n", p.Name, p.Version, p.ApiVersion, p.Status, p.Path)
+			if len(p.Routes) > 0 {
+				fmt.Printf("    routes: %s\n", strings.Join(p.Routes, ", "))
+			}
+			if len(p.Error) > 0 {
+				fmt.Printf("    error: %s\n", p.Error)
+			}
+		}
+	},
+}
+
+func init() {
+	httpCmd.AddCommand(pluginsCmd)
+	pluginsCmd.AddCommand(pluginsListCmd)
+
+	pluginsListCmd.Flags().StringP("output", "o", "plain", "Specify output format: plain or json")
+}
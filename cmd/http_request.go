@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,10 +13,14 @@ import (
 	"net/http"
 	UrlPackage "net/url"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	mcli_http "mcli/packages/mcli-http"
+
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -39,6 +44,62 @@ type httpRequestOpts struct {
 	MaxIdleConnsPerHost int
 	body                interface{}
 	headers             map[string][]string
+	// content type which replaces type of body and Content-Type of headers
+	contentType string
+	// request as it is sent is written to dump
+	dump  io.Writer
+	retry mcli_http.RetryPolicy
+	// authentication of request, secrets of vault are got by resolveSecret, OAuth2 tokens are kept in tokens
+	auth          *mcli_http.RequestAuth
+	resolveSecret mcli_http.SecretResolver
+	tokens        *mcli_http.TokenCache
+	// TLS settings of client, defaults are used if it is nil
+	tlsConfig *tls.Config
+	// cookies of requests, they are not kept if it is nil
+	jar *mcli_http.CookieJar
+	// number of followed redirects, 10 if it is 0, redirect response is returned if it is negative
+	maxRedirects int
+
+	client     *http.Client
+	clientOnce sync.Once
+}
+
+// httpClient returns client of options, it is created once and its connections are shared by requests of options
+func (opts *httpRequestOpts) httpClient() *http.Client {
+	opts.clientOnce.Do(func() {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.MaxIdleConns = opts.MaxIdleConns
+		t.MaxConnsPerHost = opts.MaxConnsPerHost
+		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+		if opts.tlsConfig != nil {
+			t.TLSClientConfig = opts.tlsConfig
+		}
+
+		opts.client = &http.Client{
+			Timeout:   time.Duration(opts.timeout * int64(time.Millisecond)),
+			Transport: t,
+		}
+		if opts.jar != nil {
+			opts.client.Jar = opts.jar
+		}
+		maxRedirects := opts.maxRedirects
+		if maxRedirects == 0 {
+			maxRedirects = 10
+		}
+		opts.client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if maxRedirects < 0 {
+				return http.ErrUseLastResponse
+			}
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if opts.dump != nil {
+				fmt.Fprintf(opts.dump, "* redirect %d to %s\n", len(via), req.URL)
+			}
+			return nil
+		}
+	})
+	return opts.client
 }
 
 func httpRequestDo(ctx context.Context, method, url string, opts *httpRequestOpts) (*http.Response, error) {
@@ -48,34 +109,101 @@ func httpRequestDo(ctx context.Context, method, url string, opts *httpRequestOpt
 	if ctx == nil {
 		ctx = context.Background()
 	}
+	// request continues trace of span in ctx or starts new one
+	ctx, span := mcli_http.StartSpan(ctx, "http request")
+	defer span.End()
 	mapHeaders := opts.headers
 
 	body := opts.body
-	var builder strings.Builder
-	err = json.NewEncoder(&builder).Encode(body)
+	if body != nil && (strings.EqualFold(method, http.MethodGet) || strings.EqualFold(method, http.MethodHead)) {
+		Ilogger.Debug().Msgf("body of %s request is not sent", method)
+		body = nil
+	}
+	bodyReader, contentType, err := mcli_http.EncodeRequestBody(body)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("body encoding error: %w", err)
 	}
 
-	req, err = http.NewRequestWithContext(ctx, method, url, io.NopCloser(strings.NewReader(builder.String())))
+	req, err = http.NewRequestWithContext(ctx, method, url, bodyReader)
 
 	if err == nil {
 		req.Header["User-Agent"] = []string{fmt.Sprintf("mcli %v", MainMap["VERSION"])}
+		span.InjectHeaders(req.Header)
 		for k, v := range mapHeaders {
+			// headers given by user replace generated ones, correlation headers as well
+			k = http.CanonicalHeaderKey(k)
+			if k == "X-Request-Id" && len(v) > 0 {
+				span.RequestId = v[0]
+			}
 			req.Header[k] = v
 		}
+		// type of form body is kept, type of other bodies is set if headers do not have one
+		if len(contentType) > 0 && (mcli_http.IsFormBody(body) || len(req.Header.Values("Content-Type")) == 0) {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if len(opts.contentType) > 0 {
+			req.Header.Set("Content-Type", opts.contentType)
+		}
+		span.SetAttribute("method", method)
+		span.SetAttribute("url", url)
+
+		client := opts.httpClient()
+		// values of secrets are not shown in dump and errors
+		redact := strings.NewReplacer()
+		if opts.auth != nil {
+			secrets, err := opts.auth.Apply(req, opts.resolveSecret, opts.tokens, client)
+			redact = secretRedactor(secrets)
+			if err != nil {
+				return nil, errors.New(redact.Replace(err.Error()))
+			}
+			span.SetAttribute("auth", opts.auth.Type)
+		}
 
-		// do request
-		t := http.DefaultTransport.(*http.Transport).Clone()
-		t.MaxIdleConns = opts.MaxIdleConns
-		t.MaxConnsPerHost = opts.MaxConnsPerHost
-		t.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
-
-		client := &http.Client{
-			Timeout:   time.Duration(opts.timeout * int64(time.Millisecond)),
-			Transport: t,
+		// do request, transient failures are retried by policy
+		attempt := 0
+		for ; ; attempt++ {
+			if opts.dump != nil {
+				dumpRequest(opts.dump, req, redact)
+			}
+			response, err = client.Do(req)
+			if urlErr, ok := err.(*UrlPackage.Error); ok {
+				urlErr.URL = redact.Replace(urlErr.URL)
+			}
+			if attempt >= opts.retry.Attempts || !opts.retry.ShouldRetry(ctx, response, err) {
+				break
+			}
+			delay := opts.retry.Backoff(attempt+1, response)
+			reason := ""
+			if err != nil {
+				reason = err.Error()
+			} else {
+				reason = response.Status
+				io.Copy(io.Discard, response.Body)
+				response.Body.Close()
+			}
+			Ilogger.Debug().Msgf("retry %d of %d in %s: %s", attempt+1, opts.retry.Attempts, delay, reason)
+			if opts.dump != nil {
+				fmt.Fprintf(opts.dump, "* retry %d of %d in %s: %s\n", attempt+1, opts.retry.Attempts,
+					delay.Round(time.Millisecond), reason)
+			}
+			if err := mcli_http.SleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			if req.GetBody != nil {
+				if req.Body, err = req.GetBody(); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if opts.dump != nil && response != nil && response.TLS != nil {
+			mcli_http.WriteTLSSummary(opts.dump, "* ", response.TLS)
+		}
+		span.SetAttribute("attempts", attempt+1)
+		if err != nil {
+			span.SetAttribute("error", err.Error())
+		} else {
+			span.SetAttribute("status", response.StatusCode)
 		}
-		response, err = client.Do(req)
 		return response, err
 
 	} else {
@@ -104,6 +232,25 @@ func loadFromJYSAOMNL(input, format string, isFile bool) (parsed interface{}, er
 	if format == "yaml" {
 		decodeYAML := yaml.NewDecoder(in)
 		err = decodeYAML.Decode(&parsed)
+	} else if format == "form" {
+		// form is urlencoded, fields may be on separate lines
+		var content []byte
+		var values UrlPackage.Values
+		if content, err = io.ReadAll(in); err != nil {
+			return
+		}
+		if values, err = UrlPackage.ParseQuery(strings.Join(strings.Fields(string(content)), "&")); err != nil {
+			return
+		}
+		fields := make(map[string]interface{}, len(values))
+		for k, vs := range values {
+			items := make([]interface{}, len(vs))
+			for i, v := range vs {
+				items[i] = v
+			}
+			fields[k] = items
+		}
+		parsed = fields
 	} else {
 		decodeJSON := json.NewDecoder(in)
 		err = decodeJSON.Decode(&parsed)
@@ -179,6 +326,28 @@ func bodyParser(body string) (bodyData map[string]interface{}, err error) {
 	return
 }
 
+// formParser returns fields of form given as json object or in json, yaml or form file
+func formParser(form string) (map[string][]string, error) {
+	ext := filepath.Ext(strings.ToLower(form))
+	isFile := ext == ".json" || ext == ".yaml" || ext == ".yml" || ext == ".form"
+
+	format := "json"
+	if ext == ".yaml" || ext == ".yml" {
+		format = "yaml"
+	} else if ext == ".form" {
+		format = "form"
+	}
+	fs, err := loadFromJYSAOMNL(form, format, isFile)
+	if err != nil {
+		return nil, err
+	}
+	formMap, ok := fs.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("wrong format for form - should be map[string]interface{}")
+	}
+	return mcli_http.FormValues(formMap), nil
+}
+
 // requestCmd represents the request command
 var requestCmd = &cobra.Command{
 	Use:   "request",
@@ -188,6 +357,49 @@ var requestCmd = &cobra.Command{
 	For example: 
 	mcli http request --url http://localhost:8080/echo -m POST -s '{"Content-Type":["application/json"]}'  \ 
 		-b '{"id": 1001}'
+	Body is json of -b, form of -f (urlencoded or multipart with '@path' files) or content of --body-file,
+	Content-Type is set by body if it is not given, GET and HEAD requests are sent without body:
+	mcli http request -u http://localhost:8080/srv-1/upload -m POST -f '{"name":"report","file":"@report.pdf"}'
+	mcli http request -u http://localhost:8080/srv-1/echo -m POST -f login.form
+	cat data.xml | mcli http request -u http://localhost:8080/srv-1/echo -m PUT --body-file - --content-type application/xml
+	Response is checked by --expect-* flags and http.request.assert section of config, status 2xx is expected by default.
+	Exit code is 0 if checks passed, 3 if assertions failed and 4 if request is not done:
+	mcli http request -u http://localhost:8080/srv-1/echo --expect-status 200 --expect-header 'Content-Type: ^text/plain' \
+		--expect-body '^Method: GET' --max-latency 300 --report report.xml
+	mcli http request -u http://localhost:8080/srv-1/api/notes/a --expect-json '$.iserror=false' --expect-json '$.payload.key'
+	Response body is written to stdout or to file of -o as it is received, -i prints status line and headers before it,
+	--format pretty indents json body and --format yaml converts it to yaml. -V dumps request to stderr as it is sent
+	and status line and headers of response:
+	mcli http request -u http://localhost:8080/srv-1/api/notes -i --format pretty
+	mcli http request -u https://example.com/big.iso -o big.iso -V
+	Transient failures (429, 502, 503, 504 or chosen statuses, errors with --retry-on-error) are retried with
+	exponential backoff and jitter, Retry-After header is respected:
+	mcli http request -u http://localhost:8080/srv-1/echo --retry 3 --retry-delay 100 --retry-on-error
+	Load mode sends -n requests by -c workers, optionally limited by --rate, and prints latency percentiles,
+	throughput and histogram of statuses. Exit code is 4 if some request failed and 3 if assertions failed:
+	mcli http request -u http://localhost:8080/srv-1/echo -n 1000 -c 20
+	mcli http request -u http://localhost:8080/srv-1/echo -n 300 -c 10 --rate 50 --expect-status 200
+	Auth uses secret of vault (mcli secrets): basic sends login and secret, bearer sends secret as token,
+	oauth2-cc gets token of client credentials grant from --token-url by login and secret of secret as client id
+	and client secret, token is cached until it expires. Values of secrets are hidden in -V output:
+	mcli http request -u https://api.example.com/user --auth basic --auth-secret example-user
+	mcli http request -u https://api.example.com/user --auth bearer --auth-secret example-token -V
+	mcli http request -u https://api.example.com/user --auth oauth2-cc --auth-secret example-client \
+		--token-url https://auth.example.com/oauth/token --scope read --scope write
+	Servers are verified by system CA certificates and --ca-cert (file or redis:// key of mcli cert), --cert and --key
+	are client certificate of mTLS, --pin checks public key of server chain, --tls-info (or -V) prints handshake:
+	mcli http request -u https://localhost:8443/echo --ca-cert ~/.mcli/certs/ca.crt --tls-info
+	mcli http request -u https://localhost:8443/echo --ca-cert redis://certificates:ca --cert client.crt --key client.key
+	mcli http request -u https://example.com --pin sha256/AbCdEf...= --pin sha256/GhIjKl...=
+	Cookies are kept in --cookie-jar file by --profile, so session of sign in is used by next requests,
+	--show-cookies prints cookies set by responses, redirects are followed up to --max-redirects:
+	mcli http request -u http://localhost:8080/signin -m POST -f '{"login":"bob","password":"..."}' \
+		--cookie-jar ~/.mcli/cookies.json --profile bob --show-cookies
+	mcli http request -u http://localhost:8080/srv-1/api/notes --cookie-jar ~/.mcli/cookies.json --profile bob
+	mcli http request -u http://localhost:8080/old -i --max-redirects 0
+	--to-curl prints equivalent curl command instead of sending request, OAuth2 token is shown as ***,
+	curl and HAR are imported by import command:
+	mcli http request -u http://localhost:8080/srv-1/upload -m POST -f '{"file":"@report.pdf"}' --to-curl
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -195,7 +407,7 @@ var requestCmd = &cobra.Command{
 		var method, baseURL, url, headers, body string
 		var timeout int64 = 0
 		var mapHeaders map[string][]string
-		var mapBody map[string]interface{}
+		var requestBody interface{}
 
 		timeout, _ = cmd.Flags().GetInt64("timeout")
 		isTimeoutSet := cmd.Flags().Lookup("timeout").Changed
@@ -213,6 +425,12 @@ var requestCmd = &cobra.Command{
 		body, _ = cmd.Flags().GetString("body")
 		isBodySet := cmd.Flags().Lookup("body").Changed
 
+		form, _ := cmd.Flags().GetString("form")
+		isFormSet := cmd.Flags().Lookup("form").Changed
+		isMultipart, _ := cmd.Flags().GetBool("multipart")
+		bodyFile, _ := cmd.Flags().GetString("body-file")
+		contentType, _ := cmd.Flags().GetString("content-type")
+
 		// process configuration or setup defaults
 		if !isMethodSet && len(Config.Http.Request.Method) > 0 {
 			method = Config.Http.Request.Method
@@ -227,14 +445,30 @@ var requestCmd = &cobra.Command{
 			baseURL = strings.TrimSpace(Config.Http.Request.BaseURL)
 		}
 
-		if !isBodySet && len(Config.Http.Request.Body) > 0 {
-			mapBody = Config.Http.Request.Body
-		} else {
-			var bErr error
-			mapBody, bErr = bodyParser(body)
+		switch {
+		case bodyFile == "-":
+			// stdin is read on start
+			requestBody = []byte(strings.Join(Input.InputSlice, ""))
+		case len(bodyFile) > 0:
+			requestBody = mcli_http.FileBody(bodyFile)
+		case isFormSet:
+			fields, fErr := formParser(form)
+			if fErr != nil {
+				Elogger.Fatal().Msg(fmt.Sprintf("form parsing error: %v ", fErr.Error()))
+			}
+			requestBody = mcli_http.NewFormBody(fields, isMultipart)
+		case isBodySet:
+			mapBody, bErr := bodyParser(body)
 			if bErr != nil {
-				Elogger.Error().Msg(fmt.Sprintf("body parsing error: %v ", bErr.Error()))
+				Elogger.Fatal().Msg(fmt.Sprintf("body parsing error: %v ", bErr.Error()))
 			}
+			requestBody = mapBody
+			// body of .form file is form
+			if filepath.Ext(strings.ToLower(body)) == ".form" {
+				requestBody = mcli_http.NewFormBody(mcli_http.FormValues(mapBody), isMultipart)
+			}
+		case len(Config.Http.Request.Body) > 0:
+			requestBody = Config.Http.Request.Body
 		}
 
 		if !isHeadersSet && len(Config.Http.Request.Headers) > 0 {
@@ -247,58 +481,222 @@ var requestCmd = &cobra.Command{
 			}
 		}
 
-		URL, err := UrlPackage.Parse(baseURL + url)
+		URL, err := requestURL(baseURL, url)
 		if err != nil {
 			Elogger.Fatal().Msg(fmt.Sprintf("fatal error while parsing url: %v ", err.Error()))
 		}
-		// fmt.Println(URL)
-		// URL.Path = UrlPackage.PathEscape(URL.Path)
-		// URL.RawQuery = UrlPackage.QueryEscape(URL.RawQuery)
 
 		// Do http request
 		// Ilogger.Trace().Msg(fmt.Sprintf("method: %v. url: %v %v", method, url, URL.String()))
 		reqOpts := &httpRequestOpts{
 			timeout:             timeout,
-			body:                mapBody,
+			body:                requestBody,
 			headers:             mapHeaders,
+			contentType:         contentType,
 			MaxIdleConns:        100,
 			MaxConnsPerHost:     100,
 			MaxIdleConnsPerHost: 100,
 		}
 
-		response, err := httpRequestDo(context.Background(), method, URL.String(), reqOpts)
+		assert, err := requestAssertFlags(cmd)
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		assert = Config.Http.Request.Assert.Merge(assert)
+		reportFile, _ := cmd.Flags().GetString("report")
+		reportFormat, _ := cmd.Flags().GetString("report-format")
+
+		isInclude, _ := cmd.Flags().GetBool("include")
+		outFile, _ := cmd.Flags().GetString("output")
+		format, _ := cmd.Flags().GetString("format")
+		if format != "raw" && format != "pretty" && format != "yaml" {
+			Elogger.Fatal().Msg(fmt.Sprintf("output format %s is not supported, use raw, pretty or yaml", format))
+		}
+		if IsVerbose {
+			reqOpts.dump = os.Stderr
+		}
+		reqOpts.retry = requestRetryFlags(cmd, Config.Http.Request.Retry)
+		reqOpts.auth, err = requestAuthFlags(cmd, Config.Http.Request.Auth)
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		if reqOpts.tlsConfig, err = requestTLSFlags(cmd, Config.Http.Request.TLS); err != nil {
+			Elogger.Fatal().Msg(fmt.Sprintf("tls setup error: %v", err))
+		}
+		isTLSInfo, _ := cmd.Flags().GetBool("tls-info")
+		reqOpts.maxRedirects = requestMaxRedirects(cmd)
+		var saveCookies func()
+		reqOpts.jar, saveCookies = requestCookieJar(cmd)
+		isShowCookies, _ := cmd.Flags().GetBool("show-cookies")
+		saveTokens := func() {}
+		if reqOpts.auth != nil {
+			reqOpts.resolveSecret, reqOpts.tokens, saveTokens = requestAuthStore(cmd)
+		}
+
+		var loadOpts mcli_http.LoadOptions
+		loadOpts.Requests, _ = cmd.Flags().GetInt("requests")
+		loadOpts.Concurrency, _ = cmd.Flags().GetInt("concurrency")
+		loadOpts.Rate, _ = cmd.Flags().GetFloat64("rate")
 
-		if response == nil {
-			Elogger.Fatal().Msg(fmt.Sprintf("error: response is nil %v", err.Error()))
+		// request is printed as curl command instead of sending
+		if isToCurl, _ := cmd.Flags().GetBool("to-curl"); isToCurl {
+			command, err := requestCurl(method, URL.String(), reqOpts)
+			saveTokens()
+			if err != nil {
+				Elogger.Fatal().Msg(fmt.Sprintf("curl command error: %v", err))
+			}
+			fmt.Println(command)
+			return
 		}
 
+		closeTracing, err := setupHttpTracing(cmd)
 		if err != nil {
-			Elogger.Fatal().Msg(fmt.Sprintf("error: %v. status code: %v", err.Error(), response.Status))
+			Elogger.Fatal().Msg(fmt.Sprintf("tracing setup error: %v ", err.Error()))
 		}
 
-		defer response.Body.Close()
+		// load mode: statistics of responses are printed instead of response
+		if loadOpts.Requests > 1 {
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			stats := runRequestLoad(ctx, method, URL.String(), reqOpts, assert, loadOpts)
+			stop()
+			closeTracing()
+			saveTokens()
+			saveCookies()
+			printLoadStats(stats)
+			switch {
+			case stats.Errors > 0:
+				commandExitCode = requestExitNotDone
+			case stats.Failed > 0:
+				commandExitCode = requestExitAssertFailed
+			}
+			return
+		}
+		result := mcli_http.RequestResult{Name: fmt.Sprintf("%s %s", method, URL.Path), Method: method, URL: URL.String()}
+		start := time.Now()
+		response, err := httpRequestDo(context.Background(), method, URL.String(), reqOpts)
+		closeTracing()
+		saveTokens()
+		saveCookies()
+		if isShowCookies || IsVerbose {
+			writeCookieChanges(os.Stderr, "* ", reqOpts.jar)
+		}
 
-		if response.StatusCode >= 200 && response.StatusCode < 300 {
-			buf := new(strings.Builder)
-			strBody := ""
+		if err != nil {
+			result.Duration = time.Since(start)
+			result.Error = err.Error()
+			Elogger.Error().Msg(fmt.Sprintf("error: %v", err.Error()))
+		} else {
+			defer response.Body.Close()
+			if isTLSInfo && !IsVerbose {
+				mcli_http.WriteTLSSummary(os.Stderr, "* ", response.TLS)
+			}
+			if IsVerbose {
+				writeResponseHead(os.Stderr, "< ", response)
+			}
+			if isInclude {
+				writeResponseHead(os.Stdout, "", response)
+			}
+			var out io.Writer = os.Stdout
+			if len(outFile) > 0 {
+				file, err := os.Create(outFile)
+				if err != nil {
+					Elogger.Fatal().Msg(fmt.Sprintf("error creating output file: %v", err))
+				}
+				defer file.Close()
+				out = file
+			}
 
-			_, err := io.Copy(buf, response.Body)
+			var data []byte
+			data, result.Size, err = writeResponseBody(out, response.Body, format, assert.NeedsBody())
+			result.Duration = time.Since(start)
+			result.Status = response.StatusCode
 			if err != nil {
-				Elogger.Fatal().Msg(fmt.Sprintf("error: %v", err.Error()))
+				result.Error = fmt.Sprintf("reading response body: %v", err)
+				Elogger.Error().Msg(result.Error)
+			} else if len(outFile) > 0 {
+				Ilogger.Info().Msg(fmt.Sprintf("%d bytes of response body are written to %s", result.Size, outFile))
 			}
-			strBody, err = UrlPackage.QueryUnescape(buf.String())
-			if err != nil {
-				Elogger.Fatal().Msg(fmt.Sprintf("error: %v", err.Error()))
+
+			if len(result.Error) == 0 {
+				result.Assertions = assert.Count()
+				result.Failures = assert.Check(response.StatusCode, response.Header, data, result.Duration)
+				for _, failure := range result.Failures {
+					Elogger.Error().Msg(fmt.Sprintf("assertion failed: %s", failure))
+				}
 			}
-			Ilogger.Trace().Msg(fmt.Sprintf("Response headers:\n %v", response.Header))
-			Ilogger.Trace().Msg("Response body:\n" + strBody)
-		} else {
-			Elogger.Error().Msg(fmt.Sprintf("Response status code is %v", response.StatusCode))
 		}
 
+		if len(reportFile) > 0 {
+			report := mcli_http.NewRequestReport("mcli http request", []mcli_http.RequestResult{result}, 1)
+			if err := writeRequestReport(reportFile, reportFormat, report); err != nil {
+				Elogger.Fatal().Msg(fmt.Sprintf("error writing report: %v", err))
+			}
+		}
+		commandExitCode = requestExitCode([]mcli_http.RequestResult{result})
 	},
 }
 
+// requestRetryFlags returns retry policy of config with values of changed --retry* flags
+func requestRetryFlags(cmd *cobra.Command, retry mcli_http.RetryPolicy) mcli_http.RetryPolicy {
+	flags := cmd.Flags()
+	if flags.Lookup("retry").Changed {
+		retry.Attempts, _ = flags.GetInt("retry")
+	}
+	if flags.Lookup("retry-delay").Changed || retry.Delay <= 0 {
+		retry.Delay, _ = flags.GetInt64("retry-delay")
+	}
+	if flags.Lookup("retry-max-delay").Changed || retry.MaxDelay <= 0 {
+		retry.MaxDelay, _ = flags.GetInt64("retry-max-delay")
+	}
+	if flags.Lookup("retry-status").Changed {
+		retry.Statuses, _ = flags.GetIntSlice("retry-status")
+	}
+	if flags.Lookup("retry-on-error").Changed {
+		retry.OnError, _ = flags.GetBool("retry-on-error")
+	}
+	return retry
+}
+
+// requestAssertFlags returns assertions given by --expect-* and --max-latency flags
+func requestAssertFlags(cmd *cobra.Command) (mcli_http.ResponseAssertions, error) {
+	var assert mcli_http.ResponseAssertions
+	assert.Status, _ = cmd.Flags().GetStringSlice("expect-status")
+	assert.MaxLatency, _ = cmd.Flags().GetInt64("max-latency")
+	assert.Body, _ = cmd.Flags().GetStringArray("expect-body")
+
+	headers, _ := cmd.Flags().GetStringArray("expect-header")
+	assert.Headers = make(map[string]string, len(headers))
+	for _, header := range headers {
+		name, expr, ok := strings.Cut(header, ":")
+		if !ok {
+			return assert, fmt.Errorf("header assertion %s must be given as name: regex", header)
+		}
+		assert.Headers[strings.TrimSpace(name)] = strings.TrimSpace(expr)
+	}
+
+	// $.path=value checks equality (value is json or string), $.path~regex checks match, $.path checks existence
+	checks, _ := cmd.Flags().GetStringArray("expect-json")
+	assert.Json = make(map[string]mcli_http.JsonAssertion, len(checks))
+	for _, check := range checks {
+		var assertion mcli_http.JsonAssertion
+		i := strings.IndexAny(check, "=~")
+		switch {
+		case i < 0:
+			exists := true
+			assertion.Exists = &exists
+			i = len(check)
+		case check[i] == '~':
+			assertion.Regex = check[i+1:]
+		default:
+			if err := json.Unmarshal([]byte(check[i+1:]), &assertion.Equals); err != nil {
+				assertion.Equals = check[i+1:]
+			}
+		}
+		assert.Json[strings.TrimSpace(check[:i])] = assertion
+	}
+	return assert, nil
+}
+
 func init() {
 	httpCmd.AddCommand(requestCmd)
 
@@ -307,6 +705,45 @@ func init() {
 	requestCmd.Flags().StringP("url", "u", url, "Specify URL for http request")
 	requestCmd.Flags().StringP("headers", "s", "", "Specify headers: {h1:[v1],h2:[v2,v3]}")
 	requestCmd.Flags().StringP("body", "b", "", "Specify json representation of a body")
-	requestCmd.Flags().StringP("form", "f", "", "Specify json representation of a form")
+	requestCmd.Flags().StringP("form", "f", "", "Specify form as json object or json, yaml or form file, '@path' value is file")
+	requestCmd.Flags().Bool("multipart", false, "Send form as multipart/form-data, form with files is always multipart")
+	requestCmd.Flags().String("body-file", "", "Specify file which content is sent as body, - is stdin")
+	requestCmd.Flags().String("content-type", "", "Specify Content-Type of body, it is detected by body if empty")
+	requestCmd.MarkFlagsMutuallyExclusive("body", "form", "body-file")
 	requestCmd.Flags().Int64P("timeout", "t", 5000, "Specify timeout for http services (server and request)")
+	requestCmd.Flags().StringSlice("expect-status", []string{}, "Specify allowed status codes of response: 200,201 or 2xx (default 2xx)")
+	requestCmd.Flags().StringArray("expect-header", []string{}, "Specify header assertion: 'Name: regex'")
+	requestCmd.Flags().StringArray("expect-json", []string{}, "Specify json assertion: '$.path=value', '$.path~regex' or '$.path' to check existence")
+	requestCmd.Flags().StringArray("expect-body", []string{}, "Specify regex which body must match")
+	requestCmd.Flags().Int64("max-latency", 0, "Specify max latency of response in milliseconds")
+	requestCmd.Flags().String("report", "", "Specify file to write report of request")
+	requestCmd.Flags().String("report-format", "", "Specify format of report: junit or json, junit for .xml file if empty")
+	requestCmd.Flags().BoolP("include", "i", false, "Print status line and headers of response before body")
+	requestCmd.Flags().StringP("output", "o", "", "Specify file to write response body instead of stdout")
+	requestCmd.Flags().String("format", "raw", "Specify format of json body: raw, pretty or yaml")
+	requestCmd.Flags().Int("retry", 0, "Specify number of retries of transient failures")
+	requestCmd.Flags().Int64("retry-delay", mcli_http.DefaultRetryDelay, "Specify delay before first retry in milliseconds, it is doubled for next ones")
+	requestCmd.Flags().Int64("retry-max-delay", 5000, "Specify max delay between retries in milliseconds")
+	requestCmd.Flags().IntSlice("retry-status", []int{}, "Specify status codes to retry (default 429,502,503,504)")
+	requestCmd.Flags().Bool("retry-on-error", false, "Retry on connection errors and timeouts")
+	requestCmd.Flags().IntP("requests", "n", 1, "Specify number of requests, load mode if it is more than 1")
+	requestCmd.Flags().IntP("concurrency", "c", 1, "Specify number of requests sent at the same time in load mode")
+	requestCmd.Flags().Float64("rate", 0, "Specify requests per second in load mode, not limited if 0")
+	requestCmd.Flags().String("auth", "", "Specify auth by secret of vault: basic, bearer, oauth2-cc or none")
+	requestCmd.Flags().String("auth-secret", "", "Specify name of secret of vault for auth")
+	requestCmd.Flags().String("token-url", "", "Specify token url of oauth2-cc auth")
+	requestCmd.Flags().StringSlice("scope", []string{}, "Specify scopes of oauth2-cc token")
+	requestCmd.Flags().String("vault-path", "", "Specify path to vault of auth secrets, ~/.mcli/secrets/defvault if empty")
+	requestCmd.Flags().String("keyfile-path", "", "Specify path to file to get access key of vault")
+	requestCmd.Flags().String("ca-cert", "", "Specify CA certificate to verify server, file or redis://[prefix:]key")
+	requestCmd.Flags().String("cert", "", "Specify client certificate of mTLS, file or redis://[prefix:]key")
+	requestCmd.Flags().String("key", "", "Specify key of client certificate, key next to certificate if empty")
+	requestCmd.Flags().Bool("insecure", false, "Do not verify certificate of server (unsafe)")
+	requestCmd.Flags().StringSlice("pin", []string{}, "Specify sha256/<base64> pin of public key of server chain")
+	requestCmd.Flags().Bool("tls-info", false, "Print TLS version, cipher and certificate chain of server to stderr")
+	requestCmd.Flags().String("cookie-jar", "", "Specify file to keep cookies of profile between requests")
+	requestCmd.Flags().String("profile", "default", "Specify profile of cookie jar")
+	requestCmd.Flags().Int("max-redirects", 10, "Specify number of followed redirects, 0 returns redirect response")
+	requestCmd.Flags().Bool("show-cookies", false, "Print cookies set by responses to stderr")
+	requestCmd.Flags().Bool("to-curl", false, "Print curl command of request instead of sending it, secrets are hidden")
 }
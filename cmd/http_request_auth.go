@@ -0,0 +1,164 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	mcli_crypto "mcli/packages/mcli-crypto"
+	mcli_fs "mcli/packages/mcli-filesystem"
+	mcli_http "mcli/packages/mcli-http"
+	mcli_secrets "mcli/packages/mcli-secrets"
+
+	"github.com/spf13/cobra"
+)
+
+// requestVaultPaths returns paths of vault and its key from flags or secrets section of config,
+// default vault in home directory is resolved here as home directory is not known when flags are declared
+func requestVaultPaths(cmd *cobra.Command) (vaultPath, keyFilePath string) {
+	vaultPath, _ = cmd.Flags().GetString("vault-path")
+	if !cmd.Flags().Lookup("vault-path").Changed && len(Config.Secrets.Common.VaultPath) > 0 {
+		vaultPath = Config.Secrets.Common.VaultPath
+	}
+	if len(vaultPath) == 0 {
+		vaultPath = GlobalMap["HomeDir"] + "/.mcli/secrets/defvault"
+	}
+	keyFilePath, _ = cmd.Flags().GetString("keyfile-path")
+	if !cmd.Flags().Lookup("keyfile-path").Changed && len(Config.Secrets.Common.KeyFilePath) > 0 {
+		keyFilePath = Config.Secrets.Common.KeyFilePath
+	}
+	return
+}
+
+// vaultSecretResolver returns resolver of secrets of vault, vault is read on first use
+func vaultSecretResolver(vaultPath, keyFilePath string) mcli_http.SecretResolver {
+	var once sync.Once
+	var secretStore *mcli_secrets.SecretsEntries
+	var storeErr error
+	return func(name string) (string, string, error) {
+		once.Do(func() {
+			knvp, err := mcli_secrets.NewDefaultKeyAndVaultProvider(vaultPath, keyFilePath)
+			if err != nil {
+				storeErr = fmt.Errorf("get default knv provider fault: %w", err)
+				return
+			}
+			secretStore = mcli_secrets.NewSecretsEntriesV2(mcli_fs.GetFile, mcli_fs.SetFile,
+				mcli_crypto.AesCypher, nil, knvp)
+			storeErr = secretStore.FillStoreV2()
+		})
+		if storeErr != nil {
+			return "", "", storeErr
+		}
+		entry, ok := secretStore.SecretMap[name]
+		if !ok {
+			return "", "", fmt.Errorf("secret is not found in vault %s", vaultPath)
+		}
+		secret, err := entry.GetSecret(keyFilePath, true)
+		if err != nil {
+			return "", "", fmt.Errorf("decription secret error: %w", err)
+		}
+		return entry.Login, secret, nil
+	}
+}
+
+// loadTokenCache reads OAuth2 tokens encrypted by key of vault, missing or not readable cache is empty
+func loadTokenCache(path, keyFilePath string) *mcli_http.TokenCache {
+	cache := mcli_http.NewTokenCache()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			Ilogger.Debug().Msgf("token cache reading error: %v", err)
+		}
+		return cache
+	}
+	key, err := mcli_crypto.AesCypher.GetKey(keyFilePath, false)
+	if err == nil {
+		var cypherData, raw []byte
+		if cypherData, err = hex.DecodeString(strings.TrimSpace(string(content))); err == nil {
+			if raw, err = mcli_crypto.AesCypher.Decrypt(key, cypherData, true); err == nil {
+				err = json.Unmarshal(raw, cache)
+			}
+		}
+	}
+	if err != nil {
+		Ilogger.Debug().Msgf("token cache %s is not used: %v", path, err)
+		return mcli_http.NewTokenCache()
+	}
+	return cache
+}
+
+// saveTokenCache writes changed OAuth2 tokens encrypted by key of vault
+func saveTokenCache(cache *mcli_http.TokenCache, path, keyFilePath string) error {
+	if cache == nil || !cache.Changed() {
+		return nil
+	}
+	key, err := mcli_crypto.AesCypher.GetKey(keyFilePath, false)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	cypherData, err := mcli_crypto.AesCypher.Encrypt(key, raw, true)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(hex.EncodeToString(cypherData)), 0600)
+}
+
+// requestAuthFlags returns auth of config with values of changed --auth* flags, nil if request is without auth
+func requestAuthFlags(cmd *cobra.Command, auth mcli_http.RequestAuth) (*mcli_http.RequestAuth, error) {
+	flags := cmd.Flags()
+	if flags.Lookup("auth").Changed {
+		auth.Type, _ = flags.GetString("auth")
+	}
+	if flags.Lookup("auth-secret").Changed {
+		auth.Secret, _ = flags.GetString("auth-secret")
+	}
+	if flags.Lookup("token-url").Changed {
+		auth.TokenURL, _ = flags.GetString("token-url")
+	}
+	if flags.Lookup("scope").Changed {
+		auth.Scopes, _ = flags.GetStringSlice("scope")
+	}
+	if len(auth.Type) == 0 || auth.Type == "none" {
+		return nil, nil
+	}
+	if err := auth.Validate(); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// secretRedactor replaces secrets with *** in output
+func secretRedactor(secrets []string) *strings.Replacer {
+	pairs := make([]string, 0, 2*len(secrets))
+	for _, secret := range secrets {
+		if len(secret) > 0 {
+			pairs = append(pairs, secret, "***")
+		}
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// requestAuthStore returns resolver of secrets of vault chosen by flags or config and cache of OAuth2 tokens
+// kept next to vault, save writes changed tokens
+func requestAuthStore(cmd *cobra.Command) (resolve mcli_http.SecretResolver, tokens *mcli_http.TokenCache, save func()) {
+	vaultPath, keyFilePath := requestVaultPaths(cmd)
+	tokensPath := vaultPath + ".tokens"
+	tokens = loadTokenCache(tokensPath, keyFilePath)
+	save = func() {
+		if err := saveTokenCache(tokens, tokensPath, keyFilePath); err != nil {
+			Elogger.Error().Msgf("error saving OAuth2 tokens: %v", err)
+		}
+	}
+	return vaultSecretResolver(vaultPath, keyFilePath), tokens, save
+}
@@ -0,0 +1,57 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+)
+
+// requestCookieJar returns jar of profile of cookie jar file chosen by flags or config, jar is in memory
+// if file is not given, save writes cookies of jar to file
+func requestCookieJar(cmd *cobra.Command) (jar *mcli_http.CookieJar, save func()) {
+	file, _ := cmd.Flags().GetString("cookie-jar")
+	if !cmd.Flags().Lookup("cookie-jar").Changed && len(Config.Http.Request.CookieJar) > 0 {
+		file = Config.Http.Request.CookieJar
+	}
+	profile, _ := cmd.Flags().GetString("profile")
+	if !cmd.Flags().Lookup("profile").Changed && len(Config.Http.Request.Profile) > 0 {
+		profile = Config.Http.Request.Profile
+	}
+	if len(file) == 0 {
+		return mcli_http.NewCookieJar(), func() {}
+	}
+	jar, err := mcli_http.LoadCookieJar(file, profile)
+	if err != nil {
+		Elogger.Fatal().Msgf("cookie jar loading error: %v", err)
+	}
+	return jar, func() {
+		if err := jar.Save(file, profile); err != nil {
+			Elogger.Error().Msgf("cookie jar saving error: %v", err)
+		}
+	}
+}
+
+// requestMaxRedirects returns limit of redirects for options: 0 of flag means redirects are not followed
+func requestMaxRedirects(cmd *cobra.Command) int {
+	maxRedirects, _ := cmd.Flags().GetInt("max-redirects")
+	if !cmd.Flags().Lookup("max-redirects").Changed && Config.Http.Request.MaxRedirects > 0 {
+		maxRedirects = Config.Http.Request.MaxRedirects
+	}
+	if maxRedirects <= 0 {
+		return -1
+	}
+	return maxRedirects
+}
+
+// writeCookieChanges writes cookies set or removed by responses, every line starts with prefix
+func writeCookieChanges(w io.Writer, prefix string, jar *mcli_http.CookieJar) {
+	for _, change := range jar.Changes() {
+		fmt.Fprintf(w, "%scookie of %s: %s\n", prefix, change.URL, change)
+	}
+}
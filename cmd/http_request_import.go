@@ -0,0 +1,219 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// requestCurl returns curl command equivalent to request of options, values of auth secrets are hidden
+// and OAuth2 token is not fetched
+func requestCurl(method, url string, opts *httpRequestOpts) (string, error) {
+	body := opts.body
+	if strings.EqualFold(method, http.MethodGet) || strings.EqualFold(method, http.MethodHead) {
+		body = nil
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return "", err
+	}
+	for name, values := range opts.headers {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+	}
+	if len(opts.contentType) > 0 {
+		req.Header.Set("Content-Type", opts.contentType)
+	}
+	redact := strings.NewReplacer()
+	if opts.auth != nil && opts.auth.Type == "oauth2-cc" {
+		// token is not requested to print command, placeholder is shown instead
+		req.Header.Set("Authorization", "Bearer ***")
+	} else if opts.auth != nil {
+		secrets, err := opts.auth.Apply(req, opts.resolveSecret, opts.tokens, opts.httpClient())
+		redact = secretRedactor(secrets)
+		if err != nil {
+			return "", fmt.Errorf("%s", redact.Replace(err.Error()))
+		}
+	}
+	if opts.jar != nil {
+		for _, cookie := range opts.jar.Cookies(req.URL) {
+			req.AddCookie(cookie)
+		}
+	}
+	command, err := mcli_http.CurlCommand(method, req.URL.String(), req.Header, body)
+	return redact.Replace(command), err
+}
+
+// readImportSources returns contents of files, stdin is read if there are no files or file is -
+func readImportSources(paths []string) ([][]byte, error) {
+	if len(paths) == 0 {
+		paths = []string{"-"}
+	}
+	contents := make([][]byte, 0, len(paths))
+	for _, path := range paths {
+		if path == "-" {
+			// stdin is read on start
+			contents = append(contents, []byte(strings.Join(Input.InputSlice, "")))
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		contents = append(contents, content)
+	}
+	return contents, nil
+}
+
+// importedRequestConfig is http.request section of config of imported request
+type importedRequestConfig struct {
+	Http struct {
+		Request struct {
+			Timeout int64                  `yaml:"timeout,omitempty"`
+			Method  string                 `yaml:"method"`
+			URL     string                 `yaml:"url"`
+			Headers map[string][]string    `yaml:"headers,omitempty"`
+			Body    map[string]interface{} `yaml:"body,omitempty"`
+		} `yaml:"request"`
+	} `yaml:"http"`
+}
+
+// newImportedRequestConfig returns config of request, config keeps only json object bodies
+func newImportedRequestConfig(request mcli_http.CollectionRequest) (importedRequestConfig, error) {
+	var config importedRequestConfig
+	if request.Form != nil || len(request.BodyFile) > 0 {
+		return config, fmt.Errorf("form or file body of %s can not be kept in config, import it as collection", request.Name)
+	}
+	body, isObject := request.Body.(map[string]interface{})
+	if request.Body != nil && !isObject {
+		return config, fmt.Errorf("body of %s is not json object, import it as collection", request.Name)
+	}
+	config.Http.Request.Timeout = request.Timeout
+	config.Http.Request.Method = request.Method
+	config.Http.Request.URL = request.URL
+	config.Http.Request.Headers = request.Headers
+	config.Http.Request.Body = body
+	return config, nil
+}
+
+// requestImportCmd represents the import command
+var requestImportCmd = &cobra.Command{
+	Use:   "import [file ...]",
+	Short: "Import curl commands or HAR captures as collection or config",
+	Long: `Import converts curl commands (as "Copy as cURL" of browser gives them) or requests of HAR file of browser
+to collection of 'mcli http request run' or to http.request section of config. Files are read from arguments,
+stdin is read if file is not given or it is -. Format is detected by .har extension if --from is not given.
+Methods, headers, cookies (-b of curl, cookies of HAR) and bodies are kept: json bodies are objects,
+urlencoded and multipart forms are forms, @file data is body file. Files of multipart forms of HAR must be
+placed near collection as HAR does not keep their content.
+Example usage:
+	mcli http request import requests.sh -o requests.yaml
+	echo "curl -X POST https://example.com/api -H 'Content-Type: application/json' -d '{\"a\":1}'" | \
+		mcli http request import --to config
+	mcli http request import session.har --match '/api/' --name portal -o portal.yaml
+Imported requests are sent by run or single request is printed back as curl command by --to-curl:
+	mcli http request run requests.yaml --to-curl
+	mcli http request -u http://localhost:8080/srv-1/echo -m POST -b '{"id":1}' --to-curl
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+		outFile, _ := cmd.Flags().GetString("output")
+		name, _ := cmd.Flags().GetString("name")
+		match, _ := cmd.Flags().GetString("match")
+		if len(from) == 0 {
+			from = "curl"
+			if len(args) > 0 && strings.EqualFold(filepath.Ext(args[0]), ".har") {
+				from = "har"
+			}
+		}
+		var filter *regexp.Regexp
+		if len(match) > 0 {
+			var err error
+			if filter, err = regexp.Compile(match); err != nil {
+				Elogger.Fatal().Msgf("match expression error: %v", err)
+			}
+		}
+
+		contents, err := readImportSources(args)
+		if err != nil {
+			Elogger.Fatal().Msgf("import reading error: %v", err)
+		}
+		collection := mcli_http.RequestCollection{Name: name}
+		for _, content := range contents {
+			var requests []mcli_http.CollectionRequest
+			switch from {
+			case "curl":
+				requests, err = mcli_http.ParseCurlCommands(string(content))
+			case "har":
+				requests, err = mcli_http.ParseHAR(content)
+			default:
+				Elogger.Fatal().Msgf("import format %s is not supported, use curl or har", from)
+			}
+			if err != nil {
+				Elogger.Fatal().Msgf("import error: %v", err)
+			}
+			collection.Requests = append(collection.Requests, requests...)
+		}
+		if filter != nil {
+			collection.Requests = slices.DeleteFunc(collection.Requests, func(request mcli_http.CollectionRequest) bool {
+				return !filter.MatchString(request.URL)
+			})
+		}
+		mcli_http.UniqueRequestNames(collection.Requests)
+
+		var imported interface{}
+		switch to {
+		case "collection":
+			imported = collection
+		case "config":
+			if len(collection.Requests) != 1 {
+				Elogger.Fatal().Msgf("config keeps one request, %d are imported, import them as collection",
+					len(collection.Requests))
+			}
+			if imported, err = newImportedRequestConfig(collection.Requests[0]); err != nil {
+				Elogger.Fatal().Msg(err.Error())
+			}
+		default:
+			Elogger.Fatal().Msgf("import target %s is not supported, use collection or config", to)
+		}
+
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(imported); err != nil {
+			Elogger.Fatal().Msgf("import encoding error: %v", err)
+		}
+		encoder.Close()
+		if len(outFile) == 0 {
+			os.Stdout.Write(buf.Bytes())
+			return
+		}
+		if err := os.WriteFile(outFile, buf.Bytes(), 0644); err != nil {
+			Elogger.Fatal().Msgf("error writing %s: %v", outFile, err)
+		}
+		Ilogger.Info().Msgf("%d requests are imported to %s", len(collection.Requests), outFile)
+	},
+}
+
+func init() {
+	requestCmd.AddCommand(requestImportCmd)
+
+	requestImportCmd.Flags().String("from", "", "Specify format of input: curl or har (default by extension of file)")
+	requestImportCmd.Flags().String("to", "collection", "Specify format of output: collection or config")
+	requestImportCmd.Flags().StringP("output", "o", "", "Specify file to write output instead of stdout")
+	requestImportCmd.Flags().String("name", "", "Specify name of collection")
+	requestImportCmd.Flags().String("match", "", "Specify regex which url of imported request must match")
+}
@@ -0,0 +1,99 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+
+	mcli_http "mcli/packages/mcli-http"
+)
+
+// runRequestLoad sends the same request many times, responses are checked by assertions
+func runRequestLoad(ctx context.Context, method, url string, opts *httpRequestOpts,
+	assert mcli_http.ResponseAssertions, loadOpts mcli_http.LoadOptions) *mcli_http.LoadStats {
+	// connections of pool are enough for all workers
+	pool := max(loadOpts.Concurrency, 1)
+	opts.MaxIdleConns, opts.MaxConnsPerHost, opts.MaxIdleConnsPerHost = pool, pool, pool
+	opts.dump = nil
+
+	return mcli_http.RunLoad(ctx, loadOpts, func(ctx context.Context) mcli_http.LoadResult {
+		start := time.Now()
+		response, err := httpRequestDo(ctx, method, url, opts)
+		if err != nil {
+			return mcli_http.LoadResult{Err: err}
+		}
+		defer response.Body.Close()
+		result := mcli_http.LoadResult{Status: response.StatusCode}
+		var body []byte
+		if assert.NeedsBody() {
+			body, err = io.ReadAll(response.Body)
+			result.Size = int64(len(body))
+		} else {
+			result.Size, err = io.Copy(io.Discard, response.Body)
+		}
+		if err != nil {
+			result.Err = fmt.Errorf("reading response body: %w", err)
+			return result
+		}
+		result.Failed = len(assert.Check(response.StatusCode, response.Header, body, time.Since(start))) > 0
+		return result
+	})
+}
+
+// printLoadStats prints latency percentiles, throughput and histograms of statuses and errors
+func printLoadStats(stats *mcli_http.LoadStats) {
+	round := func(d time.Duration) time.Duration {
+		if d < time.Millisecond {
+			return d.Round(time.Microsecond)
+		}
+		return d.Round(10 * time.Microsecond)
+	}
+	fmt.Printf("Requests:    %d in %s, %d errors, %d failed assertions\n", stats.Requests,
+		stats.Duration.Round(time.Millisecond), stats.Errors, stats.Failed)
+	fmt.Printf("Throughput:  %.1f req/s, %.1f KB/s\n", stats.Throughput(),
+		float64(stats.Bytes)/1024/max(stats.Duration.Seconds(), 1e-9))
+	if len(stats.Latencies) > 0 {
+		fmt.Printf("Latency:     min %s, mean %s, max %s\n", round(stats.Latencies[0]), round(stats.Mean()),
+			round(stats.Latencies[len(stats.Latencies)-1]))
+		fmt.Printf("             p50 %s, p95 %s, p99 %s\n", round(stats.Percentile(50)),
+			round(stats.Percentile(95)), round(stats.Percentile(99)))
+	}
+
+	if len(stats.Statuses) > 0 {
+		fmt.Println("Status codes:")
+		codes := make([]int, 0, len(stats.Statuses))
+		for code := range stats.Statuses {
+			codes = append(codes, code)
+		}
+		slices.Sort(codes)
+		for _, code := range codes {
+			count := stats.Statuses[code]
+			color := ColorGreen
+			if code >= 400 {
+				color = ColorRed
+			} else if code >= 300 {
+				color = ColorYellow
+			}
+			bar := strings.Repeat("#", max(count*40/stats.Requests, 1))
+			fmt.Printf("  %s%d%s %8d %5.1f%% %s\n", color, code, ColorReset, count,
+				float64(count)*100/float64(stats.Requests), bar)
+		}
+	}
+	if len(stats.ErrorTexts) > 0 {
+		fmt.Println("Errors:")
+		texts := make([]string, 0, len(stats.ErrorTexts))
+		for text := range stats.ErrorTexts {
+			texts = append(texts, text)
+		}
+		slices.SortFunc(texts, func(a, b string) int { return stats.ErrorTexts[b] - stats.ErrorTexts[a] })
+		for _, text := range texts {
+			fmt.Printf("  %8d %s\n", stats.ErrorTexts[text], text)
+		}
+	}
+}
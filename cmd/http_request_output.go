@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	UrlPackage "net/url"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	mcli_utils "mcli/packages/mcli-utils"
+)
+
+// max size of request body in verbose dump
+const dumpBodyLimit = 64 * 1024
+
+// requestURL joins base url and url, absolute url is used as is
+func requestURL(baseURL, url string) (*UrlPackage.URL, error) {
+	target, err := UrlPackage.Parse(url)
+	if err != nil || len(baseURL) == 0 || target.IsAbs() {
+		return target, err
+	}
+	if len(url) == 0 {
+		return UrlPackage.Parse(baseURL)
+	}
+	return UrlPackage.Parse(strings.TrimSuffix(baseURL, "/") + "/" + strings.TrimPrefix(url, "/"))
+}
+
+// writePrefixedLines writes every line of text with prefix
+func writePrefixedLines(w io.Writer, prefix string, text []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(text))
+	for scanner.Scan() {
+		fmt.Fprintf(w, "%s%s\n", prefix, scanner.Text())
+	}
+}
+
+// dumpRequest writes request as it is sent: "> " lines of request line and headers, then text body,
+// secrets are replaced by redact
+func dumpRequest(w io.Writer, req *http.Request, redact *strings.Replacer) {
+	head, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		fmt.Fprintf(w, "* request dump error: %v\n", err)
+		return
+	}
+	writePrefixedLines(w, "> ", bytes.TrimRight([]byte(redact.Replace(string(head))), "\r\n"))
+	fmt.Fprintln(w, ">")
+	if req.GetBody == nil {
+		return
+	}
+	rc, err := req.GetBody()
+	if err != nil {
+		return
+	}
+	defer rc.Close()
+	body, _ := io.ReadAll(io.LimitReader(rc, dumpBodyLimit+1))
+	switch {
+	case len(body) == 0:
+	case len(body) > dumpBodyLimit || !utf8.Valid(body):
+		fmt.Fprintf(w, "* body of %d bytes is not shown\n", req.ContentLength)
+	default:
+		body = []byte(redact.Replace(string(body)))
+		w.Write(body)
+		if !bytes.HasSuffix(body, []byte("\n")) {
+			fmt.Fprintln(w)
+		}
+	}
+}
+
+// writeResponseHead writes status line and headers sorted by name, every line starts with prefix
+func writeResponseHead(w io.Writer, prefix string, response *http.Response) {
+	fmt.Fprintf(w, "%s%s %s\n", prefix, response.Proto, response.Status)
+	names := make([]string, 0, len(response.Header))
+	for name := range response.Header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range response.Header[name] {
+			fmt.Fprintf(w, "%s%s: %s\n", prefix, name, value)
+		}
+	}
+	fmt.Fprintln(w, strings.TrimSpace(prefix))
+}
+
+// writeResponseBody writes body to out in format and returns size of body. Body is streamed if it is written
+// as is and is not needed for checks, otherwise it is read into memory and returned.
+func writeResponseBody(out io.Writer, body io.Reader, format string, needsBody bool) ([]byte, int, error) {
+	if format == "raw" && !needsBody {
+		size, err := io.Copy(out, body)
+		return nil, int(size), err
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return data, len(data), err
+	}
+	_, err = out.Write(formatResponseBody(data, format))
+	return data, len(data), err
+}
+
+// formatResponseBody returns json body indented (pretty) with order of keys kept or converted to yaml,
+// other bodies are returned as is
+func formatResponseBody(body []byte, format string) []byte {
+	if format != "pretty" && format != "yaml" {
+		return body
+	}
+	if !json.Valid(body) {
+		Ilogger.Debug().Msg("response body is not json, it is printed as is")
+		return body
+	}
+	if format == "pretty" {
+		var buf bytes.Buffer
+		json.Indent(&buf, bytes.TrimSpace(body), "", "  ")
+		buf.WriteByte('\n')
+		return buf.Bytes()
+	}
+	data, err := mcli_utils.JsonStringToInterface(string(body))
+	if err != nil {
+		return body
+	}
+	formatted, err := mcli_utils.YamlEncodeToString(data)
+	if err != nil {
+		return body
+	}
+	return []byte(formatted)
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestRequestURL(t *testing.T) {
+	tests := []struct {
+		base, url, want string
+	}{
+		{"", "http://localhost:8080/echo", "http://localhost:8080/echo"},
+		{"http://localhost:8080/srv-1", "/echo", "http://localhost:8080/srv-1/echo"},
+		{"http://localhost:8080/srv-1/", "echo?a=1", "http://localhost:8080/srv-1/echo?a=1"},
+		{"http://localhost:8080/srv-1/", "/echo", "http://localhost:8080/srv-1/echo"},
+		{"http://localhost:8080/srv-1", "", "http://localhost:8080/srv-1"},
+		{"http://localhost:8080/srv-1", "https://example.com/x", "https://example.com/x"},
+	}
+	for _, test := range tests {
+		got, err := requestURL(test.base, test.url)
+		if err != nil || got.String() != test.want {
+			t.Errorf("requestURL(%q, %q) = %v, %v, want %s", test.base, test.url, got, err, test.want)
+		}
+	}
+	if _, err := requestURL("http://localhost:8080", "http://[::1"); err == nil {
+		t.Error("invalid url must be rejected")
+	}
+}
+
+func TestWriteResponseHead(t *testing.T) {
+	response := &http.Response{Proto: "HTTP/1.1", Status: "200 OK",
+		Header: http.Header{"X-B": {"2"}, "Content-Type": {"text/plain"}, "X-A": {"1", "3"}}}
+	tests := []struct {
+		prefix, want string
+	}{
+		{"", "HTTP/1.1 200 OK\nContent-Type: text/plain\nX-A: 1\nX-A: 3\nX-B: 2\n\n"},
+		{"< ", "< HTTP/1.1 200 OK\n< Content-Type: text/plain\n< X-A: 1\n< X-A: 3\n< X-B: 2\n<\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		writeResponseHead(&out, test.prefix, response)
+		if out.String() != test.want {
+			t.Errorf("prefix %q: unexpected head:\n%s", test.prefix, out.String())
+		}
+	}
+}
+
+func TestFormatResponseBody(t *testing.T) {
+	tests := []struct {
+		body, format, want string
+	}{
+		{`{"b":1,"a":[true]}`, "raw", `{"b":1,"a":[true]}`},
+		{` {"b":1,"a":[true]} `, "pretty", "{\n  \"b\": 1,\n  \"a\": [\n    true\n  ]\n}\n"},
+		{`{"name":"mcli"}`, "yaml", "name: mcli\n"},
+		{"plain text", "pretty", "plain text"},
+		{"<p>page</p>", "yaml", "<p>page</p>"},
+	}
+	for _, test := range tests {
+		if got := string(formatResponseBody([]byte(test.body), test.format)); got != test.want {
+			t.Errorf("%s body %q: got %q, want %q", test.format, test.body, got, test.want)
+		}
+	}
+}
+
+// chunkedReader returns chunks one by one and fails if next chunk is read before previous one is written to out
+type chunkedReader struct {
+	chunks []string
+	out    *bytes.Buffer
+	read   int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	if r.read > 0 && r.out.Len() < r.read {
+		return 0, errors.New("body is not streamed")
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks, r.read = r.chunks[1:], r.read+n
+	return n, nil
+}
+
+func TestWriteResponseBody(t *testing.T) {
+	tests := []struct {
+		format    string
+		needsBody bool
+		streamed  bool
+		want      string
+	}{
+		{"raw", false, true, `{"a":1}`},
+		{"raw", true, false, `{"a":1}`},
+		{"pretty", false, false, "{\n  \"a\": 1\n}\n"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		var reader io.Reader = strings.NewReader(`{"a":1}`)
+		if test.streamed {
+			reader = &chunkedReader{chunks: []string{`{"a"`, `:1}`}, out: &out}
+		}
+		data, size, err := writeResponseBody(&out, reader, test.format, test.needsBody)
+		if err != nil || size != 7 || out.String() != test.want {
+			t.Errorf("%s %v: got %q of %d bytes: %v", test.format, test.needsBody, out.String(), size, err)
+		}
+		if streamed := data == nil; streamed != test.streamed {
+			t.Errorf("%s %v: body must be streamed %v", test.format, test.needsBody, test.streamed)
+		}
+	}
+}
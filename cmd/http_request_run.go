@@ -0,0 +1,430 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+// requestRunOpts are settings of collection run from flags
+type requestRunOpts struct {
+	timeout  int64
+	failFast bool
+	// secrets of vault and OAuth2 tokens of auth
+	resolveSecret mcli_http.SecretResolver
+	tokens        *mcli_http.TokenCache
+	// TLS settings of http.request.tls section of config
+	tlsConfig *tls.Config
+	// cookies shared by requests of run
+	jar          *mcli_http.CookieJar
+	maxRedirects int
+}
+
+// loadRequestCollection reads collection file, {{$VAR}} and {{$Name$}} entries are expanded as in config file,
+// files with .jsonl or .ndjson extension have request per line
+func loadRequestCollection(path string) (*mcli_http.RequestCollection, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	expanded, err := expandConfigVars(string(content))
+	if err != nil {
+		return nil, err
+	}
+	format := "yaml"
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".jsonl" || ext == ".ndjson" {
+		format = "jsonl"
+	}
+	collection, err := mcli_http.ParseRequestCollection([]byte(expanded), format)
+	if err != nil {
+		return nil, fmt.Errorf("collection %s: %w", path, err)
+	}
+	return collection, nil
+}
+
+// loadRequestEnvironments adds environments from yaml file (environment name -> variables) to collection
+func loadRequestEnvironments(path string, collection *mcli_http.RequestCollection) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	expanded, err := expandConfigVars(string(content))
+	if err != nil {
+		return err
+	}
+	var environments map[string]map[string]string
+	if err := yaml.Unmarshal([]byte(expanded), &environments); err != nil {
+		return fmt.Errorf("environments file %s: %w", path, err)
+	}
+	if collection.Environments == nil {
+		collection.Environments = make(map[string]map[string]string, len(environments))
+	}
+	for name, vars := range environments {
+		collection.Environments[name] = vars
+	}
+	return nil
+}
+
+// runRequestCollection runs requests in order, values captured from response are variables of next requests
+func runRequestCollection(ctx context.Context, collection *mcli_http.RequestCollection,
+	requests []mcli_http.CollectionRequest, vars map[string]string, opts requestRunOpts) []mcli_http.RequestResult {
+	// requests of run are spans of one trace
+	ctx, span := mcli_http.StartSpan(ctx, "http request run")
+	defer span.End()
+	span.SetAttribute("collection", collection.Name)
+
+	results := make([]mcli_http.RequestResult, 0, len(requests))
+	for _, request := range requests {
+		result := runCollectionRequest(ctx, collection, request, vars, opts)
+		results = append(results, result)
+		if result.Failed() && opts.failFast {
+			break
+		}
+	}
+	return results
+}
+
+func runCollectionRequest(ctx context.Context, collection *mcli_http.RequestCollection,
+	request mcli_http.CollectionRequest, vars map[string]string, opts requestRunOpts) mcli_http.RequestResult {
+	result := mcli_http.RequestResult{Name: request.Name, Method: request.Method, URL: request.URL}
+	prepared, err := collection.Prepare(request, vars)
+	result.Method, result.URL = prepared.Method, prepared.URL
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	reqOpts, err := collectionRequestOpts(prepared, opts)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+
+	start := time.Now()
+	response, err := httpRequestDo(ctx, prepared.Method, prepared.URL, reqOpts)
+	if err != nil {
+		result.Duration = time.Since(start)
+		result.Error = err.Error()
+		return result
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	result.Duration = time.Since(start)
+	result.Status, result.Size = response.StatusCode, len(body)
+	if err != nil {
+		result.Error = fmt.Sprintf("reading response body: %v", err)
+		return result
+	}
+	Ilogger.Trace().Msgf("%s response headers: %v", request.Name, response.Header)
+	Ilogger.Trace().Msgf("%s response body:\n%s", request.Name, body)
+
+	result.Assertions = prepared.Assert.Count()
+	result.Failures = prepared.Assert.Check(response.StatusCode, response.Header, body, result.Duration)
+	result.Captured, err = prepared.CaptureAll(response.StatusCode, response.Header, body, vars)
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// collectionRequestOpts returns options of prepared request of collection
+func collectionRequestOpts(prepared mcli_http.CollectionRequest, opts requestRunOpts) (*httpRequestOpts, error) {
+	timeout := prepared.Timeout
+	if timeout <= 0 {
+		timeout = opts.timeout
+	}
+	reqOpts := &httpRequestOpts{
+		timeout:             timeout,
+		body:                prepared.Body,
+		headers:             prepared.Headers,
+		retry:               prepared.Retry,
+		tlsConfig:           opts.tlsConfig,
+		jar:                 opts.jar,
+		maxRedirects:        opts.maxRedirects,
+		MaxIdleConns:        10,
+		MaxConnsPerHost:     10,
+		MaxIdleConnsPerHost: 10,
+	}
+	if len(prepared.Auth.Type) > 0 && prepared.Auth.Type != "none" {
+		if err := prepared.Auth.Validate(); err != nil {
+			return nil, err
+		}
+		reqOpts.auth = &prepared.Auth
+		reqOpts.resolveSecret, reqOpts.tokens = opts.resolveSecret, opts.tokens
+	}
+	return reqOpts, nil
+}
+
+// printCollectionCurl prints curl commands of requests, values captured from responses are not known
+func printCollectionCurl(collection *mcli_http.RequestCollection, requests []mcli_http.CollectionRequest,
+	vars map[string]string, opts requestRunOpts) {
+	for i, request := range requests {
+		if i > 0 {
+			fmt.Println()
+		}
+		prepared, err := collection.Prepare(request, vars)
+		if err != nil {
+			fmt.Printf("# %s: %v\n", request.Name, err)
+			continue
+		}
+		reqOpts, err := collectionRequestOpts(prepared, opts)
+		command := ""
+		if err == nil {
+			command, err = requestCurl(prepared.Method, prepared.URL, reqOpts)
+		}
+		if err != nil {
+			fmt.Printf("# %s: %v\n", request.Name, err)
+			continue
+		}
+		fmt.Printf("# %s\n%s\n", request.Name, command)
+	}
+}
+
+// printRequestRunSummary prints result line of every request and totals
+func printRequestRunSummary(results []mcli_http.RequestResult, total int) {
+	failed := 0
+	var duration time.Duration
+	for i, result := range results {
+		state := ColorGreen + "ok" + ColorReset
+		if result.Failed() {
+			state = ColorRed + "FAIL" + ColorReset
+			failed++
+		}
+		status := "-"
+		if result.Status > 0 {
+			status = fmt.Sprint(result.Status)
+		}
+		duration += result.Duration
+		fmt.Printf("%3d %-24s %-6s %-4s %8s %8dB  %s %s\n", i+1, result.Name, result.Method, status,
+			result.Duration.Round(time.Millisecond), result.Size, state, result.URL)
+		if len(result.Error) > 0 {
+			fmt.Printf("    error: %s\n", result.Error)
+		}
+		for _, failure := range result.Failures {
+			fmt.Printf("    assert: %s\n", failure)
+		}
+		if IsVerbose {
+			names := make([]string, 0, len(result.Captured))
+			for name := range result.Captured {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				fmt.Printf("    captured %s = %s\n", name, result.Captured[name])
+			}
+		}
+	}
+	skipped := ""
+	if total > len(results) {
+		skipped = fmt.Sprintf(", %d skipped", total-len(results))
+	}
+	fmt.Printf("\n%d requests: %d passed, %d failed%s in %s\n", len(results), len(results)-failed, failed, skipped,
+		duration.Round(time.Millisecond))
+}
+
+// exit codes of http request commands differ from code 1 of fatal errors
+const (
+	requestExitAssertFailed = 3
+	requestExitNotDone      = 4
+)
+
+// requestExitCode is 0 if all requests passed, 3 if assertions failed and 4 if some request is not done
+func requestExitCode(results []mcli_http.RequestResult) int {
+	code := 0
+	for _, result := range results {
+		if len(result.Error) > 0 {
+			return requestExitNotDone
+		}
+		if len(result.Failures) > 0 {
+			code = requestExitAssertFailed
+		}
+	}
+	return code
+}
+
+// writeRequestReport writes report in junit or json format, format is taken from extension of file if empty
+func writeRequestReport(path, format string, report mcli_http.RequestReport) error {
+	if len(format) == 0 {
+		format = "json"
+		if strings.ToLower(filepath.Ext(path)) == ".xml" {
+			format = "junit"
+		}
+	}
+	if format != "junit" && format != "json" {
+		return fmt.Errorf("report format %s is not supported, use junit or json", format)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if format == "junit" {
+		return report.WriteJUnit(file)
+	}
+	return report.WriteJSON(file)
+}
+
+// requestRunCmd represents the http request run command
+var requestRunCmd = &cobra.Command{
+	Use:   "run <collection> [name...]",
+	Short: "Runs named requests of collection file",
+	Long: `Runs requests of yaml collection or jsonl file (request per line) in order, or only named ones.
+Body of request is one of: body (object is sent as json), form (urlencoded, multipart if it has "@path" files
+or multipart: true) and body-file. Strings of requests may contain {{ var }} entries: variables come from collection, selected environment,
+--var flags and values captured from previous responses. {{$ENV_VAR}} entries are expanded as in config file.
+Collection example:
+	name: notes
+	variables:
+	  user: admin
+	environments:
+	  local:
+	    base: http://localhost:8088/srv-1
+	defaults:
+	  headers:
+	    Accept: application/json
+	requests:
+	  - name: create
+	    method: POST
+	    url: "{{ base }}/api/notes"
+	    body: {"title": "note of {{ user }}"}
+	    capture:
+	      id: $.payload.key
+	      location: {header: Location, regex: '/notes/(.+)$'}
+	  - name: get
+	    url: "{{ base }}/api/notes/{{ id }}"
+	  - name: upload
+	    method: POST
+	    url: "{{ base }}/upload"
+	    form: {note: "{{ id }}", file: "@attachment.pdf"}
+Example usage:
+	mcli http request run notes.yaml -e local
+	mcli http request run notes.yaml create get --var user=bob
+	mcli http request run notes.yaml -e local --report report.xml
+Responses are checked by assert sections of defaults and of request, status 2xx is expected if it is not given:
+	assert:
+	  status: [200, 201]
+	  headers: {Content-Type: ^application/json}
+	  json:
+	    $.payload.title: "note of {{ user }}"
+	    $.payload.key: {regex: '^[a-z0-9-]+$'}
+	    $.iserror: false
+	    $.error: {exists: false}
+	  body: ['"payload"']
+	  max-latency: 500
+Transient failures are retried by retry section of defaults or of request:
+	retry: {attempts: 3, delay: 200, max-delay: 5000, statuses: [502, 503], on-error: true}
+Requests are authenticated by auth section of defaults or of request with secret of vault, type none disables it:
+	auth: {type: oauth2-cc, secret: notes-client, token-url: "{{ base }}/oauth/token", scopes: [notes]}
+	auth: {type: bearer, secret: shodan, query-param: key}
+TLS settings of requests are taken from http.request.tls section of config:
+	tls: {ca-cert: "redis://certificates:ca", cert: client.crt, key: client.key, pins: ["sha256/AbCdEf...="]}
+Cookies set by responses are sent by next requests of run, they are kept in --cookie-jar file by --profile.
+--to-curl prints curl commands of requests instead of running them, curl and HAR are imported by import command.
+Exit code is 0 if all requests passed, 3 if assertions failed and 4 if some request is not done.
+`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		environment, _ := cmd.Flags().GetString("env")
+		envFile, _ := cmd.Flags().GetString("env-file")
+		varFlags, _ := cmd.Flags().GetStringArray("var")
+		var opts requestRunOpts
+		opts.timeout, _ = cmd.Flags().GetInt64("timeout")
+		opts.failFast, _ = cmd.Flags().GetBool("fail-fast")
+		reportFile, _ := cmd.Flags().GetString("report")
+		reportFormat, _ := cmd.Flags().GetString("report-format")
+		if !cmd.Flags().Lookup("timeout").Changed && Config.Http.Request.Timeout > 0 {
+			opts.timeout = Config.Http.Request.Timeout
+		}
+
+		collection, err := loadRequestCollection(args[0])
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		if len(envFile) > 0 {
+			if err := loadRequestEnvironments(envFile, collection); err != nil {
+				Elogger.Fatal().Msg(err.Error())
+			}
+		}
+		requests, err := collection.Select(args[1:])
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		vars, err := collection.Vars(environment)
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		for _, entry := range varFlags {
+			name, value, ok := strings.Cut(entry, "=")
+			if !ok {
+				Elogger.Fatal().Msgf("variable %s must be given as name=value", entry)
+			}
+			vars[name] = value
+		}
+
+		closeTracing, err := setupHttpTracing(cmd)
+		if err != nil {
+			Elogger.Fatal().Msgf("tracing setup error: %v", err)
+		}
+		if opts.tlsConfig, err = requestTLSConfig(Config.Http.Request.TLS); err != nil {
+			Elogger.Fatal().Msgf("tls setup error: %v", err)
+		}
+		var saveCookies func()
+		opts.jar, saveCookies = requestCookieJar(cmd)
+		opts.maxRedirects = requestMaxRedirects(cmd)
+		var saveTokens func()
+		opts.resolveSecret, opts.tokens, saveTokens = requestAuthStore(cmd)
+		if isToCurl, _ := cmd.Flags().GetBool("to-curl"); isToCurl {
+			printCollectionCurl(collection, requests, vars, opts)
+			closeTracing()
+			saveTokens()
+			return
+		}
+		results := runRequestCollection(context.Background(), collection, requests, vars, opts)
+		closeTracing()
+		saveTokens()
+		saveCookies()
+		printRequestRunSummary(results, len(requests))
+
+		if len(reportFile) > 0 {
+			name := collection.Name
+			if len(name) == 0 {
+				name = strings.TrimSuffix(filepath.Base(args[0]), filepath.Ext(args[0]))
+			}
+			if err := writeRequestReport(reportFile, reportFormat, mcli_http.NewRequestReport(name, results, len(requests))); err != nil {
+				Elogger.Fatal().Msgf("error writing report: %v", err)
+			}
+		}
+		commandExitCode = requestExitCode(results)
+	},
+}
+
+func init() {
+	requestCmd.AddCommand(requestRunCmd)
+
+	requestRunCmd.Flags().StringP("env", "e", "", "Specify environment of collection")
+	requestRunCmd.Flags().String("env-file", "", "Specify yaml file of environments: name -> variables")
+	requestRunCmd.Flags().StringArray("var", []string{}, "Specify variable as name=value, it overrides environment")
+	requestRunCmd.Flags().Int64P("timeout", "t", 5000, "Specify timeout in milliseconds of requests without timeout")
+	requestRunCmd.Flags().Bool("fail-fast", false, "Stop run after first failed request")
+	requestRunCmd.Flags().String("report", "", "Specify file to write report of run")
+	requestRunCmd.Flags().String("report-format", "", "Specify format of report: junit or json, junit for .xml file if empty")
+	requestRunCmd.Flags().String("vault-path", "", "Specify path to vault of auth secrets, ~/.mcli/secrets/defvault if empty")
+	requestRunCmd.Flags().String("keyfile-path", "", "Specify path to file to get access key of vault")
+	requestRunCmd.Flags().String("cookie-jar", "", "Specify file to keep cookies of profile between runs")
+	requestRunCmd.Flags().String("profile", "default", "Specify profile of cookie jar")
+	requestRunCmd.Flags().Int("max-redirects", 10, "Specify number of followed redirects, 0 returns redirect response")
+	requestRunCmd.Flags().Bool("to-curl", false, "Print curl commands of requests instead of running them")
+}
@@ -0,0 +1,126 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	mcli_fs "mcli/packages/mcli-filesystem"
+	mcli_http "mcli/packages/mcli-http"
+	mcli_secrets "mcli/packages/mcli-secrets"
+
+	"github.com/spf13/cobra"
+)
+
+// readPEMSource reads certificate or key from file or from redis://[prefix:]key entry of common redis store,
+// ext (.crt or .key) is added to redis key without it as gencrt stores them
+func readPEMSource(source, ext string) ([]byte, error) {
+	path, isRedis := strings.CutPrefix(source, "redis://")
+	if !isRedis {
+		return os.ReadFile(filepath.Clean(source))
+	}
+	if CommonRedisStore == nil {
+		return nil, fmt.Errorf("can not connect to redis database: CommonRedisStore is nil")
+	}
+	prefix, key := "", path
+	if i := strings.LastIndex(path, ":"); i >= 0 {
+		prefix, key = path[:i], path[i+1:]
+	}
+	if !strings.HasSuffix(key, ext) {
+		key += ext
+	}
+	content, err, ok := CommonRedisStore.GetRecord(key, prefix)
+	if err != nil && ok {
+		// keys of gencrt --encrypt are encrypted by RedisEncKey of internal vault
+		content, err = readEncryptedRedisRecord(key, prefix)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !ok || len(content) == 0 {
+		return nil, fmt.Errorf("key %s is not found in redis database", path)
+	}
+	if block, _ := pem.Decode(content); block == nil {
+		return nil, fmt.Errorf("key %s of redis database is not PEM", path)
+	}
+	return content, nil
+}
+
+// readEncryptedRedisRecord reads record of common redis store encrypted by RedisEncKey of internal vault
+func readEncryptedRedisRecord(key, prefix string) ([]byte, error) {
+	internalSecretStore := mcli_secrets.NewSecretsEntries(mcli_fs.GetFile, mcli_fs.SetFile, exportCypher, nil)
+	if err := internalSecretStore.FillStore(Config.Common.InternalVaultPath, Config.Common.InternalKeyFilePath); err != nil {
+		return nil, fmt.Errorf("record is encrypted and internal vault is not available: %w", err)
+	}
+	redisEncKey, ok := internalSecretStore.GetSecretPlainMap()["RedisEncKey"]
+	if !ok {
+		return nil, fmt.Errorf("record is encrypted and RedisEncKey is not found in internal vault")
+	}
+	CommonRedisStore.SetEncrypt(true, []byte(redisEncKey.Secret), cypher)
+	defer CommonRedisStore.SetEncrypt(false, []byte(redisEncKey.Secret), cypher)
+	content, err, _ := CommonRedisStore.GetRecord(key, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("can not decrypt record: %w", err)
+	}
+	return content, nil
+}
+
+// requestTLSConfig returns TLS config of settings, nil if defaults are used
+func requestTLSConfig(settings mcli_http.ClientTLS) (*tls.Config, error) {
+	if len(settings.CACert) == 0 && len(settings.Cert) == 0 && len(settings.Key) == 0 &&
+		!settings.Insecure && len(settings.Pins) == 0 {
+		return nil, nil
+	}
+	if len(settings.Cert) > 0 && len(settings.Key) == 0 {
+		settings.Key = strings.TrimSuffix(settings.Cert, ".crt") + ".key"
+	}
+	var caPEM, certPEM, keyPEM []byte
+	var err error
+	if len(settings.CACert) > 0 {
+		if caPEM, err = readPEMSource(settings.CACert, ".crt"); err != nil {
+			return nil, fmt.Errorf("can not read CA certificate %s: %w", settings.CACert, err)
+		}
+	}
+	if len(settings.Cert) > 0 {
+		if certPEM, err = readPEMSource(settings.Cert, ".crt"); err != nil {
+			return nil, fmt.Errorf("can not read client certificate %s: %w", settings.Cert, err)
+		}
+	}
+	if len(settings.Key) > 0 {
+		if keyPEM, err = readPEMSource(settings.Key, ".key"); err != nil {
+			return nil, fmt.Errorf("can not read client key %s: %w", settings.Key, err)
+		}
+	}
+	if settings.Insecure {
+		fmt.Fprintf(os.Stderr, "%sWARNING: certificates of servers are not verified, connection may be intercepted%s\n",
+			ColorRed, ColorReset)
+	}
+	return mcli_http.NewClientTLSConfig(caPEM, certPEM, keyPEM, settings.Insecure, settings.Pins)
+}
+
+// requestTLSFlags returns TLS config of config settings with values of changed TLS flags
+func requestTLSFlags(cmd *cobra.Command, settings mcli_http.ClientTLS) (*tls.Config, error) {
+	flags := cmd.Flags()
+	if flags.Lookup("ca-cert").Changed {
+		settings.CACert, _ = flags.GetString("ca-cert")
+	}
+	if flags.Lookup("cert").Changed {
+		settings.Cert, _ = flags.GetString("cert")
+	}
+	if flags.Lookup("key").Changed {
+		settings.Key, _ = flags.GetString("key")
+	}
+	if flags.Lookup("insecure").Changed {
+		settings.Insecure, _ = flags.GetBool("insecure")
+	}
+	if flags.Lookup("pin").Changed {
+		settings.Pins, _ = flags.GetStringSlice("pin")
+	}
+	return requestTLSConfig(settings)
+}
@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 DIRECT-DEV.RU <INFO@DIRECT-DEV.RU>
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	mcli_http "mcli/packages/mcli-http"
+
+	"github.com/spf13/cobra"
+)
+
+// restCmd represents the http rest command
+var restCmd = &cobra.Command{
+	Use:   "rest",
+	Short: "Commands of rest api over kv store collections",
+	Long: `Rest api is configured in http.server.rest section of config and served by http server:
+	GET    <route>/<collection>?page=1&per_page=20&pattern=*   list of records
+	POST   <route>/<collection>                                create record
+	GET    <route>/<collection>/<key>                          get record
+	PUT    <route>/<collection>/<key>                          replace or create record
+	PATCH  <route>/<collection>/<key>                          merge fields into record
+	DELETE <route>/<collection>/<key>                          delete record
+	GET    <route>/openapi.json                                OpenAPI document
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+	},
+}
+
+// restOpenAPICmd represents the http rest openapi command
+var restOpenAPICmd = &cobra.Command{
+	Use:   "openapi",
+	Short: "Writes OpenAPI document of rest api from config",
+	Long: `Writes OpenAPI document of collections from http.server.rest section of config.
+Example usage:
+	mcli http rest openapi -o openapi.json
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		outFile, _ := cmd.Flags().GetString("out")
+		mcli_http.PublishServerState(mcli_http.NewServerState(Config.Http))
+		api, err := mcli_http.NewRestAPI(Config.Http.Server.Rest, nil)
+		if err != nil {
+			Elogger.Fatal().Msgf("rest api config is not valid: %v", err)
+		}
+		document, err := json.MarshalIndent(api.OpenAPI(), "", "  ")
+		if err != nil {
+			Elogger.Fatal().Msg(err.Error())
+		}
+		if len(outFile) == 0 {
+			fmt.Println(string(document))
+			return
+		}
+		if err := os.WriteFile(outFile, append(document, '\n'), 0644); err != nil {
+			Elogger.Fatal().Msgf("error writing OpenAPI document: %v", err)
+		}
+		Ilogger.Info().Msgf("OpenAPI document is written to %s", outFile)
+	},
+}
+
+func init() {
+	httpCmd.AddCommand(restCmd)
+	restCmd.AddCommand(restOpenAPICmd)
+
+	restOpenAPICmd.Flags().StringP("out", "o", "", "Specify file to write OpenAPI document, stdout if empty")
+}
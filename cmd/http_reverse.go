@@ -4,6 +4,7 @@ Copyright © 2024 NAME HERE <EMAIL ADDRESS>
 package cmd
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"fmt"
@@ -12,21 +13,34 @@ import (
 	"net"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
 	"time"
 
+	mcli_http "mcli/packages/mcli-http"
+
 	"github.com/spf13/cobra"
 )
 
 type MyStringKey string
 
+// reverseCachePurgeRoute is served by reverse proxy itself when cache is on
+const reverseCachePurgeRoute = "/_mcli/cache/purge"
+
 // reverseCmd represents the reverse command
 var reverseCmd = &cobra.Command{
 	Use:   "reverse",
 	Short: "Simple http(s) reverse proxy",
 	Long: `Simple http(s) reverse proxy.
+With --cache GET responses are served from memory cache, cache is purged by POST ` + reverseCachePurgeRoute + `
+with bearer token given by --cache-purge-token, purge is off without token.
+With --record requests and responses are appended to file as json lines, 'mcli http mock --replay' serves them.
+Values of query parameters and headers given by --record-redact are replaced in record, by default
+credentials in key, api_key, token and access_token parameters and Set-Cookie headers. Record file
+is readable only by owner, bodies longer than 10MB are not recorded.
 Example usage:
-.....
+	mcli http reverse -p 8080 --base-url http://localhost:8088 --cache --cache-ttl 30
+	mcli http reverse -p 8080 --base-url https://api.shodan.io --record shodan.jsonl
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		var maxIdleConns = 100
@@ -50,6 +64,25 @@ Example usage:
 		intIdleTimeout, _ := cmd.Flags().GetInt("idle-timeout")
 		idleConnTimeout = time.Duration(intIdleTimeout) * time.Second
 
+		closeTracing, err := setupHttpTracing(cmd)
+		if err != nil {
+			fmt.Println("Error setting up tracing:", err)
+			return
+		}
+		defer closeTracing()
+
+		var recorder *mcli_http.MockRecorder
+		if recordFile, _ := cmd.Flags().GetString("record"); len(recordFile) > 0 {
+			file, err := os.OpenFile(recordFile, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				fmt.Println("Error opening record file:", err)
+				return
+			}
+			defer file.Close()
+			redact, _ := cmd.Flags().GetStringSlice("record-redact")
+			recorder = mcli_http.NewMockRecorder(file, redact)
+		}
+
 		// Parse the base URL
 		parsedURL, err := url.Parse(baseUrl) // Replace with your target URL
 		if err != nil {
@@ -97,6 +130,22 @@ Example usage:
 			// Start timing
 			start := time.Now()
 
+			var requestBody []byte
+			record := recorder != nil
+			if record && r.Body != nil {
+				requestBody, _ = io.ReadAll(io.LimitReader(r.Body, mcli_http.MockMaxBodySize+1))
+				if len(requestBody) > mcli_http.MockMaxBodySize {
+					// oversized body is streamed to target without recording
+					record = false
+					r.Body = struct {
+						io.Reader
+						io.Closer
+					}{io.MultiReader(bytes.NewReader(requestBody), r.Body), r.Body}
+				} else {
+					r.Body = io.NopCloser(bytes.NewReader(requestBody))
+				}
+			}
+
 			proxyRequest, err := CreateProxyRequest(baseURL, targetEndpoint, httpClient, r)
 			if err != nil {
 				http.Error(w, "Failed to create proxy request", http.StatusInternalServerError)
@@ -113,9 +162,17 @@ Example usage:
 			duration := time.Since(start)
 			log.Printf("Response received in: %v", duration)
 
+			requestId := "-"
+			if span := mcli_http.SpanFromContext(r.Context()); span != nil {
+				requestId = span.RequestId
+				span.SetAttribute("upstream", baseURL)
+				span.SetAttribute("upstream-status", targetResp.StatusCode)
+				span.SetAttribute("upstream-duration-ms", float64(duration.Microseconds())/1000)
+			}
 			// Log the request in Apache style
-			log.Printf("%s - - [%s] \"%s %s%s %s\" %d %d %v",
+			log.Printf("%s - %s [%s] \"%s %s%s %s\" %d %d %v",
 				r.RemoteAddr,
+				requestId,
 				time.Now().Format("02/Jan/2006:15:04:05 -0700"),
 				r.Method,
 				baseURL,
@@ -128,12 +185,53 @@ Example usage:
 
 			CopyHeaders(w.Header(), targetResp.Header)
 			w.WriteHeader(targetResp.StatusCode)
-			io.Copy(w, targetResp.Body)
+			if !record {
+				if recorder != nil {
+					log.Printf("Request body of %s %s is too large to record", r.Method, r.URL.Path)
+				}
+				io.Copy(w, targetResp.Body)
+				return
+			}
+			var responseBody mcli_http.MockBodyBuffer
+			io.Copy(w, io.TeeReader(targetResp.Body, &responseBody))
+			if responseBody.Overflow {
+				log.Printf("Response body of %s %s is too large to record", r.Method, r.URL.Path)
+				return
+			}
+			mockRecord := mcli_http.MockRecord{Time: start, Method: r.Method, URL: r.URL.RequestURI(),
+				RequestBody: requestBody, Status: targetResp.StatusCode, Headers: targetResp.Header,
+				Body: responseBody.Bytes(), Duration: duration.Milliseconds()}
+			if err := recorder.Record(mockRecord); err != nil {
+				log.Printf("Error recording response: %v", err)
+			}
 		}
 
 		// Create a new HTTP server with the reverse proxy handler
 		mux := http.NewServeMux()
 		mux.HandleFunc("/", ReverseProxyHandler)
+		var proxyHandler http.Handler = mux
+		if useCache, _ := cmd.Flags().GetBool("cache"); useCache {
+			var cacheConfig mcli_http.ResponseCacheConfig
+			cacheConfig.DefaultTtl, _ = cmd.Flags().GetInt("cache-ttl")
+			cacheConfig.MaxEntries, _ = cmd.Flags().GetInt("cache-max-entries")
+			cacheConfig.PurgeToken, _ = cmd.Flags().GetString("cache-purge-token")
+			responseCache, err := mcli_http.NewResponseCache(cacheConfig, nil, Elogger)
+			if err != nil {
+				fmt.Println("Error setting up cache:", err)
+				return
+			}
+			if purgeHandler, err := responseCache.PurgeHandler(); err == nil {
+				mux.HandleFunc(reverseCachePurgeRoute, purgeHandler)
+			} else {
+				fmt.Println("Cache purge is off:", err)
+			}
+			responseCache.SetInnerHandler(mux)
+			proxyHandler = responseCache
+		}
+		// request id and traceparent are accepted or generated here and forwarded to target
+		requestId := mcli_http.NewRequestId(Ilogger)
+		requestId.SpanName = "http reverse"
+		requestId.SetInnerHandler(proxyHandler)
 		// fmt.Println(tlsCert, tlsKey, host, port)
 		var srv *http.Server
 		if tlsCert != "" && tlsKey != "" {
@@ -151,7 +249,7 @@ Example usage:
 					MinVersion:               tls.VersionTLS13,
 					PreferServerCipherSuites: true,
 				},
-				Handler:      mux,
+				Handler:      requestId,
 				ReadTimeout:  readTimeout,
 				WriteTimeout: writeTimeout,
 				IdleTimeout:  idleConnTimeout,
@@ -166,7 +264,7 @@ Example usage:
 			// Start the HTTP server
 			srv = &http.Server{
 				Addr:         fmt.Sprintf("%s:%s", host, port),
-				Handler:      mux,
+				Handler:      requestId,
 				ReadTimeout:  readTimeout,
 				WriteTimeout: writeTimeout,
 				IdleTimeout:  idleConnTimeout,
@@ -180,6 +278,9 @@ Example usage:
 	},
 }
 
+// query parameters and headers which usually carry credentials
+var recordRedactDefaults = []string{"key", "api_key", "token", "access_token", "Set-Cookie"}
+
 func init() {
 	httpCmd.AddCommand(reverseCmd)
 
@@ -191,6 +292,12 @@ func init() {
 	reverseCmd.Flags().IntP("read-timeout", "", 30, "Specify read timeout")
 	reverseCmd.Flags().IntP("write-timeout", "", 30, "Specify write timeout")
 	reverseCmd.Flags().IntP("idle-timeout", "", 30, "Specify idle timeout")
+	reverseCmd.Flags().Bool("cache", false, "Cache GET responses of target honoring Cache-Control, Vary and ETag")
+	reverseCmd.Flags().Int("cache-ttl", 0, "Specify seconds to cache responses without Cache-Control max-age or Expires")
+	reverseCmd.Flags().Int("cache-max-entries", 1000, "Specify max number of cached urls")
+	reverseCmd.Flags().String("cache-purge-token", "", "Specify bearer token of "+reverseCachePurgeRoute+" endpoint")
+	reverseCmd.Flags().String("record", "", "Specify file to append requests and responses for 'mcli http mock --replay'")
+	reverseCmd.Flags().StringSlice("record-redact", recordRedactDefaults, "Specify query parameters and headers which values are redacted in record")
 }
 
 func CreateProxyRequest(baseURL, targetEndpoint string, client *http.Client, r *http.Request) (*http.Request, error) {
@@ -203,6 +310,10 @@ func CreateProxyRequest(baseURL, targetEndpoint string, client *http.Client, r *
 		return nil, err
 	}
 	CopyHeaders(proxyRequest.Header, r.Header)
+	// target continues trace of proxy server span
+	if span := mcli_http.SpanFromContext(r.Context()); span != nil {
+		span.InjectHeaders(proxyRequest.Header)
+	}
 
 	return proxyRequest, nil
 }
@@ -76,6 +76,10 @@ This is set of cli tool for some operations in Linux and Windows(not tested prop
 var embedConfig []byte
 var MainMap = make(map[string]interface{})
 
+// commandExitCode is set by commands which exit with code other than 0 after they are done,
+// process exits with it when deferred cleanup of Execute is finished
+var commandExitCode int
+
 // Execute adds view child commands to the root command and sets flags appropriately.
 // This is cviewed by main.main(). It only needs to happen once to the rootCmd.
 func Execute(loggers []zerolog.Logger, emConfig []byte, fromMainMap map[string]interface{}) {
@@ -87,6 +91,11 @@ func Execute(loggers []zerolog.Logger, emConfig []byte, fromMainMap map[string]i
 	if err != nil {
 		os.Exit(1)
 	}
+	defer func() {
+		if commandExitCode != 0 {
+			os.Exit(commandExitCode)
+		}
+	}()
 
 	if Ctx != nil {
 		defer func() {
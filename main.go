@@ -63,7 +63,8 @@ func main() {
 	// 	Err(errors.New("file open failed!")).
 	// 	Msg("something happened!")
 	mainMap := make(map[string]interface{}, 0)
-	mainMap["VERSION"] = Version
+	// VERSION.txt ends with newline which is not valid in User-Agent header
+	mainMap["VERSION"] = strings.TrimSpace(Version)
 	iloggers := []zerolog.Logger{iLogger, eLogger}
 	cmd.Execute(iloggers, embeddedConfigYaml, mainMap)
 }
@@ -0,0 +1,234 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// StatusAssertion is list of allowed status codes, code may be given as class: 2xx
+type StatusAssertion []string
+
+func (s *StatusAssertion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		*s = StatusAssertion{node.Value}
+		return nil
+	}
+	var codes []string
+	if err := node.Decode(&codes); err != nil {
+		return err
+	}
+	*s = codes
+	return nil
+}
+
+// Match reports whether status is one of allowed codes
+func (s StatusAssertion) Match(status int) bool {
+	code := strconv.Itoa(status)
+	for _, allowed := range s {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == code || (len(allowed) == 3 && strings.HasSuffix(allowed, "xx") && allowed[0] == code[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// JsonAssertion checks value of response json by JSONPath: equality, match of regex or existence.
+// Scalar or sequence in yaml is shorthand of equals.
+type JsonAssertion struct {
+	Equals interface{} `yaml:"equals" json:"equals,omitempty"`
+	Regex  string      `yaml:"regex" json:"regex,omitempty"`
+	Exists *bool       `yaml:"exists" json:"exists,omitempty"`
+}
+
+func (a *JsonAssertion) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.MappingNode {
+		var keys map[string]interface{}
+		if err := node.Decode(&keys); err != nil {
+			return err
+		}
+		isCheck := len(keys) > 0
+		for key := range keys {
+			if key != "equals" && key != "regex" && key != "exists" {
+				isCheck = false
+			}
+		}
+		if isCheck {
+			type plain JsonAssertion
+			return node.Decode((*plain)(a))
+		}
+	}
+	return node.Decode(&a.Equals)
+}
+
+func (a JsonAssertion) check(path string, data interface{}) string {
+	value, err := mcli_utils.JsonPathGet(data, path)
+	if a.Exists != nil {
+		if *a.Exists && err != nil {
+			return fmt.Sprintf("json %s does not exist", path)
+		}
+		if !*a.Exists && err == nil {
+			return fmt.Sprintf("json %s exists", path)
+		}
+		if !*a.Exists {
+			return ""
+		}
+	}
+	if err != nil {
+		return fmt.Sprintf("json %s: %v", path, err)
+	}
+	if len(a.Regex) > 0 {
+		str, ok := value.(string)
+		if !ok {
+			raw, _ := json.Marshal(value)
+			str = string(raw)
+		}
+		re, err := regexp.Compile(a.Regex)
+		if err != nil {
+			return fmt.Sprintf("json %s: %v", path, err)
+		}
+		if !re.MatchString(str) {
+			return fmt.Sprintf("json %s = %s does not match %s", path, str, a.Regex)
+		}
+	}
+	if a.Equals != nil && !jsonEqual(value, a.Equals) {
+		actual, _ := json.Marshal(value)
+		expected, _ := json.Marshal(a.Equals)
+		return fmt.Sprintf("json %s = %s, expected %s", path, actual, expected)
+	}
+	return ""
+}
+
+// jsonEqual compares decoded json value with expected value of any origin (yaml, flags) by their json form
+func jsonEqual(value, expected interface{}) bool {
+	var normalized interface{}
+	raw, err := json.Marshal(expected)
+	if err != nil || json.Unmarshal(raw, &normalized) != nil {
+		return false
+	}
+	return reflect.DeepEqual(value, normalized)
+}
+
+// ResponseAssertions are checks of response, every failed check is reported
+type ResponseAssertions struct {
+	// allowed status codes, 2xx if empty
+	Status StatusAssertion `yaml:"status" json:"status,omitempty"`
+	// header name -> regex of value
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"`
+	// JSONPath -> check
+	Json map[string]JsonAssertion `yaml:"json" json:"json,omitempty"`
+	// regexes of body
+	Body []string `yaml:"body" json:"body,omitempty"`
+	// milliseconds
+	MaxLatency int64 `yaml:"max-latency" json:"max-latency,omitempty"`
+}
+
+// Merge returns assertions with checks of other added, status and latency of other replace own ones if set
+func (a ResponseAssertions) Merge(other ResponseAssertions) ResponseAssertions {
+	merged := ResponseAssertions{Status: a.Status, MaxLatency: a.MaxLatency,
+		Headers: make(map[string]string), Json: make(map[string]JsonAssertion)}
+	if len(other.Status) > 0 {
+		merged.Status = other.Status
+	}
+	if other.MaxLatency > 0 {
+		merged.MaxLatency = other.MaxLatency
+	}
+	for _, source := range []ResponseAssertions{a, other} {
+		for name, value := range source.Headers {
+			merged.Headers[http.CanonicalHeaderKey(name)] = value
+		}
+		for path, check := range source.Json {
+			merged.Json[path] = check
+		}
+		merged.Body = append(merged.Body, source.Body...)
+	}
+	return merged
+}
+
+// Count returns number of checks
+func (a ResponseAssertions) Count() int {
+	count := 1 + len(a.Headers) + len(a.Json) + len(a.Body)
+	if a.MaxLatency > 0 {
+		count++
+	}
+	return count
+}
+
+// NeedsBody reports whether checks use response body
+func (a ResponseAssertions) NeedsBody() bool {
+	return len(a.Json) > 0 || len(a.Body) > 0
+}
+
+// Check returns descriptions of failed checks of response
+func (a ResponseAssertions) Check(status int, header http.Header, body []byte, latency time.Duration) []string {
+	failures := make([]string, 0)
+	allowed := a.Status
+	if len(allowed) == 0 {
+		allowed = StatusAssertion{"2xx"}
+	}
+	if !allowed.Match(status) {
+		failures = append(failures, fmt.Sprintf("status %d, expected %s", status, strings.Join(allowed, " or ")))
+	}
+	if a.MaxLatency > 0 && latency > time.Duration(a.MaxLatency)*time.Millisecond {
+		failures = append(failures, fmt.Sprintf("latency %s exceeds %dms", latency.Round(time.Millisecond), a.MaxLatency))
+	}
+
+	names := make([]string, 0, len(a.Headers))
+	for name := range a.Headers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		re, err := regexp.Compile(a.Headers[name])
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("header %s: %v", name, err))
+			continue
+		}
+		values := header.Values(name)
+		if len(values) == 0 {
+			failures = append(failures, fmt.Sprintf("header %s is absent", name))
+		} else if !slices.ContainsFunc(values, re.MatchString) {
+			failures = append(failures, fmt.Sprintf("header %s = %s does not match %s", name,
+				strings.Join(values, ", "), a.Headers[name]))
+		}
+	}
+
+	if len(a.Json) > 0 {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			failures = append(failures, fmt.Sprintf("response body is not json: %v", err))
+		} else {
+			paths := make([]string, 0, len(a.Json))
+			for path := range a.Json {
+				paths = append(paths, path)
+			}
+			slices.Sort(paths)
+			for _, path := range paths {
+				if failure := a.Json[path].check(path, data); len(failure) > 0 {
+					failures = append(failures, failure)
+				}
+			}
+		}
+	}
+
+	for _, expr := range a.Body {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("body: %v", err))
+		} else if !re.Match(body) {
+			failures = append(failures, fmt.Sprintf("body does not match %s", expr))
+		}
+	}
+	return failures
+}
@@ -0,0 +1,212 @@
+package mclihttp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SecretResolver returns login and secret of named secret of vault
+type SecretResolver func(name string) (login, secret string, err error)
+
+// RequestAuth is authentication of request by secret of vault:
+// basic - login and secret are username and password,
+// bearer - secret is token,
+// oauth2-cc - login and secret are client id and client secret of OAuth2 client credentials grant
+type RequestAuth struct {
+	Type string `yaml:"type" json:"type,omitempty"`
+	// name of secret in vault
+	Secret string `yaml:"secret" json:"secret,omitempty"`
+	// oauth2-cc token endpoint and scopes
+	TokenURL string   `yaml:"token-url" json:"token-url,omitempty"`
+	Scopes   []string `yaml:"scopes" json:"scopes,omitempty"`
+	// bearer token is sent as query parameter with this name instead of Authorization header
+	QueryParam string `yaml:"query-param" json:"query-param,omitempty"`
+}
+
+// Validate checks type and required fields of auth
+func (a RequestAuth) Validate() error {
+	switch a.Type {
+	case "basic", "bearer":
+	case "oauth2-cc":
+		if len(a.TokenURL) == 0 {
+			return fmt.Errorf("auth oauth2-cc requires token url")
+		}
+	default:
+		return fmt.Errorf("auth type %s is not supported, use basic, bearer or oauth2-cc", a.Type)
+	}
+	if len(a.Secret) == 0 {
+		return fmt.Errorf("auth %s requires name of secret", a.Type)
+	}
+	if len(a.QueryParam) > 0 && a.Type != "bearer" {
+		return fmt.Errorf("query parameter is supported only by bearer auth")
+	}
+	return nil
+}
+
+// OAuth2Token is access token of client credentials grant, zero expiry means token without expiry
+type OAuth2Token struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	Expiry      time.Time `json:"expiry"`
+}
+
+// Valid reports whether token is not expired in next 30 seconds
+func (t OAuth2Token) Valid() bool {
+	return len(t.AccessToken) > 0 && (t.Expiry.IsZero() || time.Now().Add(30*time.Second).Before(t.Expiry))
+}
+
+// TokenCache keeps OAuth2 tokens by token url, client and scopes, it is safe for concurrent use
+type TokenCache struct {
+	mu      sync.Mutex
+	Tokens  map[string]OAuth2Token `json:"tokens"`
+	changed bool
+	// concurrent requests wait for one token request
+	fetchMu sync.Mutex
+}
+
+func NewTokenCache() *TokenCache {
+	return &TokenCache{Tokens: make(map[string]OAuth2Token)}
+}
+
+// Get returns valid token by key, expired tokens are removed
+func (c *TokenCache) Get(key string) (OAuth2Token, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	token, ok := c.Tokens[key]
+	if ok && !token.Valid() {
+		delete(c.Tokens, key)
+		c.changed = true
+		return token, false
+	}
+	return token, ok
+}
+
+func (c *TokenCache) Set(key string, token OAuth2Token) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Tokens[key] = token
+	c.changed = true
+}
+
+// GetOrFetch returns valid token by key or token got by fetch
+func (c *TokenCache) GetOrFetch(key string, fetch func() (OAuth2Token, error)) (OAuth2Token, error) {
+	c.fetchMu.Lock()
+	defer c.fetchMu.Unlock()
+	if token, ok := c.Get(key); ok {
+		return token, nil
+	}
+	token, err := fetch()
+	if err != nil {
+		return token, err
+	}
+	c.Set(key, token)
+	return token, nil
+}
+
+// Changed reports whether tokens are changed since creation or loading
+func (c *TokenCache) Changed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.changed
+}
+
+// FetchClientCredentialsToken requests token of OAuth2 client credentials grant, client is authenticated by basic auth
+func FetchClientCredentialsToken(ctx context.Context, client *http.Client, tokenURL, clientID, clientSecret string,
+	scopes []string) (OAuth2Token, error) {
+	form := url.Values{"grant_type": []string{"client_credentials"}}
+	if len(scopes) > 0 {
+		form.Set("scope", strings.Join(scopes, " "))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OAuth2Token{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(clientID), url.QueryEscape(clientSecret))
+
+	response, err := client.Do(req)
+	if err != nil {
+		return OAuth2Token{}, fmt.Errorf("token request error: %w", err)
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(response.Body, 1<<20))
+	if err != nil {
+		return OAuth2Token{}, fmt.Errorf("token response reading error: %w", err)
+	}
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		TokenType        string `json:"token_type"`
+		ExpiresIn        int64  `json:"expires_in"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return OAuth2Token{}, fmt.Errorf("token response of status %d is not json: %w", response.StatusCode, err)
+	}
+	if response.StatusCode != http.StatusOK || len(result.AccessToken) == 0 {
+		return OAuth2Token{}, fmt.Errorf("token is not issued, status %d: %s %s", response.StatusCode,
+			result.Error, result.ErrorDescription)
+	}
+	token := OAuth2Token{AccessToken: result.AccessToken, TokenType: result.TokenType}
+	if result.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	}
+	return token, nil
+}
+
+// basicCredentials returns credentials of Basic Authorization header
+func basicCredentials(login, password string) string {
+	return base64.StdEncoding.EncodeToString([]byte(login + ":" + password))
+}
+
+// Apply sets Authorization header (or query parameter) of request, OAuth2 token is taken from cache or fetched.
+// Values which must be hidden in output are returned.
+func (a RequestAuth) Apply(req *http.Request, resolve SecretResolver, cache *TokenCache,
+	client *http.Client) ([]string, error) {
+	login, secret, err := resolve(a.Secret)
+	if err != nil {
+		return nil, fmt.Errorf("auth secret %s: %w", a.Secret, err)
+	}
+	secrets := []string{secret}
+	switch a.Type {
+	case "basic":
+		credentials := basicCredentials(login, secret)
+		req.Header.Set("Authorization", "Basic "+credentials)
+		secrets = append(secrets, credentials)
+	case "bearer":
+		if len(a.QueryParam) > 0 {
+			query := req.URL.Query()
+			query.Set(a.QueryParam, secret)
+			req.URL.RawQuery = query.Encode()
+			secrets = append(secrets, url.QueryEscape(secret))
+		} else {
+			req.Header.Set("Authorization", "Bearer "+secret)
+		}
+	case "oauth2-cc":
+		key := strings.Join([]string{a.TokenURL, login, strings.Join(a.Scopes, " ")}, "|")
+		token, err := cache.GetOrFetch(key, func() (OAuth2Token, error) {
+			return FetchClientCredentialsToken(req.Context(), client, a.TokenURL, login, secret, a.Scopes)
+		})
+		if err != nil {
+			return secrets, err
+		}
+		tokenType := token.TokenType
+		if len(tokenType) == 0 || strings.EqualFold(tokenType, "bearer") {
+			tokenType = "Bearer"
+		}
+		req.Header.Set("Authorization", tokenType+" "+token.AccessToken)
+		secrets = append(secrets, token.AccessToken)
+	default:
+		return nil, a.Validate()
+	}
+	return secrets, nil
+}
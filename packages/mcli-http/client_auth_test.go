@@ -0,0 +1,78 @@
+package mclihttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestAuth(t *testing.T) {
+	var issued int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, secret, ok := r.BasicAuth()
+		if !ok || id != "client" || secret != "s3cret" || r.FormValue("grant_type") != "client_credentials" ||
+			r.FormValue("scope") != "read write" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":"invalid_client"}`)
+			return
+		}
+		n := atomic.AddInt32(&issued, 1)
+		fmt.Fprintf(w, `{"access_token":"token-%d","token_type":"bearer","expires_in":3600}`, n)
+	}))
+	defer server.Close()
+
+	resolve := func(name string) (string, string, error) {
+		switch name {
+		case "user":
+			return "bob", "pa:ss", nil
+		case "client":
+			return "client", "s3cret", nil
+		}
+		return "", "", errors.New("secret is not found")
+	}
+	cache := NewTokenCache()
+	apply := func(auth RequestAuth) (*http.Request, []string, error) {
+		req, _ := http.NewRequest(http.MethodGet, "http://localhost/api?q=1", nil)
+		secrets, err := auth.Apply(req, resolve, cache, server.Client())
+		return req, secrets, err
+	}
+
+	req, secrets, err := apply(RequestAuth{Type: "basic", Secret: "user"})
+	if login, password, _ := req.BasicAuth(); err != nil || login != "bob" || password != "pa:ss" || len(secrets) != 2 {
+		t.Errorf("unexpected basic auth %q, secrets %v: %v", req.Header.Get("Authorization"), secrets, err)
+	}
+	req, _, err = apply(RequestAuth{Type: "bearer", Secret: "user", QueryParam: "key"})
+	if err != nil || req.URL.Query().Get("key") != "pa:ss" || req.URL.Query().Get("q") != "1" ||
+		len(req.Header.Get("Authorization")) > 0 {
+		t.Errorf("unexpected bearer query %s: %v", req.URL, err)
+	}
+	if _, _, err = apply(RequestAuth{Type: "bearer", Secret: "unknown"}); err == nil {
+		t.Error("unknown secret must fail")
+	}
+
+	oauth := RequestAuth{Type: "oauth2-cc", Secret: "client", TokenURL: server.URL, Scopes: []string{"read", "write"}}
+	for i := 0; i < 2; i++ {
+		req, secrets, err = apply(oauth)
+		if err != nil || req.Header.Get("Authorization") != "Bearer token-1" || secrets[len(secrets)-1] != "token-1" {
+			t.Errorf("unexpected oauth2 header %q: %v", req.Header.Get("Authorization"), err)
+		}
+	}
+	if issued != 1 || !cache.Changed() {
+		t.Errorf("token must be fetched once and cached, fetched %d", issued)
+	}
+	for key, token := range cache.Tokens {
+		token.Expiry = token.Expiry.Add(-3590 * time.Second)
+		cache.Tokens[key] = token
+	}
+	if req, _, _ = apply(oauth); req.Header.Get("Authorization") != "Bearer token-2" {
+		t.Errorf("expired token must be fetched again, got %q", req.Header.Get("Authorization"))
+	}
+	oauth.Secret = "user"
+	if _, _, err = apply(oauth); err == nil {
+		t.Error("token request of invalid client must fail")
+	}
+}
@@ -0,0 +1,166 @@
+package mclihttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// FormBody is sent as application/x-www-form-urlencoded
+type FormBody map[string][]string
+
+// MultipartBody is sent as multipart/form-data, every file is part with name of its field
+type MultipartBody struct {
+	Fields map[string][]string
+	// field name -> paths of files
+	Files map[string][]string
+}
+
+// FileBody is path of file which content is sent as is
+type FileBody string
+
+// NewFormBody returns form of fields, values "@path" are files and form with files or forced one is multipart
+func NewFormBody(fields map[string][]string, isMultipart bool) interface{} {
+	form := MultipartBody{Fields: make(map[string][]string), Files: make(map[string][]string)}
+	for name, values := range fields {
+		for _, value := range values {
+			if path, ok := strings.CutPrefix(value, "@"); ok && len(path) > 0 {
+				form.Files[name] = append(form.Files[name], path)
+			} else {
+				form.Fields[name] = append(form.Fields[name], value)
+			}
+		}
+	}
+	if len(form.Files) > 0 || isMultipart {
+		return form
+	}
+	return FormBody(form.Fields)
+}
+
+// FormValues converts decoded yaml or json object to form fields, list values are repeated fields
+func FormValues(data map[string]interface{}) map[string][]string {
+	fields := make(map[string][]string, len(data))
+	for name, value := range data {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				fields[name] = append(fields[name], fmt.Sprint(item))
+			}
+		case nil:
+			fields[name] = []string{""}
+		default:
+			fields[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return fields
+}
+
+// fileContentType returns type by extension of file or by content
+func fileContentType(path string, content []byte) string {
+	if contentType := mime.TypeByExtension(filepath.Ext(path)); len(contentType) > 0 {
+		return contentType
+	}
+	return http.DetectContentType(content)
+}
+
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func (body MultipartBody) encode() ([]byte, string, error) {
+	buf := &bytes.Buffer{}
+	writer := multipart.NewWriter(buf)
+	for _, name := range sortedKeys(body.Fields) {
+		for _, value := range body.Fields[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	for _, name := range sortedKeys(body.Files) {
+		for _, path := range body.Files[name] {
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return nil, "", err
+			}
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+				quoteEscaper.Replace(name), quoteEscaper.Replace(filepath.Base(path))))
+			header.Set("Content-Type", fileContentType(path, content))
+			part, err := writer.CreatePart(header)
+			if err != nil {
+				return nil, "", err
+			}
+			if _, err := part.Write(content); err != nil {
+				return nil, "", err
+			}
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), writer.FormDataContentType(), nil
+}
+
+// EncodeRequestBody returns content of body and its content type: forms are encoded by their types, file is read,
+// json string is application/json, other strings and bytes are sent as is, other values are encoded to json.
+// Nil body has no content.
+func EncodeRequestBody(body interface{}) (io.Reader, string, error) {
+	switch b := body.(type) {
+	case nil:
+		return nil, "", nil
+	case FormBody:
+		return strings.NewReader(url.Values(b).Encode()), "application/x-www-form-urlencoded", nil
+	case MultipartBody:
+		content, contentType, err := b.encode()
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(content), contentType, nil
+	case FileBody:
+		content, err := os.ReadFile(string(b))
+		if err != nil {
+			return nil, "", err
+		}
+		return bytes.NewReader(content), fileContentType(string(b), content), nil
+	case string:
+		if json.Valid([]byte(b)) {
+			return strings.NewReader(b), "application/json", nil
+		}
+		return strings.NewReader(b), "text/plain; charset=utf-8", nil
+	case []byte:
+		return bytes.NewReader(b), http.DetectContentType(b), nil
+	}
+	content, err := json.Marshal(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return bytes.NewReader(content), "application/json", nil
+}
+
+// IsFormBody reports whether content type of body must not be replaced by header: boundary of multipart is known
+// only by body and urlencoded form is the only meaning of form
+func IsFormBody(body interface{}) bool {
+	switch body.(type) {
+	case FormBody, MultipartBody:
+		return true
+	}
+	return false
+}
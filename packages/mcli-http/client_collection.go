@@ -0,0 +1,411 @@
+package mclihttp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"gopkg.in/yaml.v3"
+)
+
+// RequestHeaders are headers of collection request, single value may be given as string
+type RequestHeaders map[string][]string
+
+func (h *RequestHeaders) UnmarshalYAML(node *yaml.Node) error {
+	var raw map[string]interface{}
+	if err := node.Decode(&raw); err != nil {
+		return err
+	}
+	*h = make(RequestHeaders, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case []interface{}:
+			for _, item := range v {
+				(*h)[name] = append((*h)[name], fmt.Sprint(item))
+			}
+		case nil:
+			(*h)[name] = []string{}
+		default:
+			(*h)[name] = []string{fmt.Sprint(v)}
+		}
+	}
+	return nil
+}
+
+// Get returns first value of header with canonical name
+func (h RequestHeaders) Get(name string) string {
+	return http.Header(h).Get(name)
+}
+
+// Capture takes value of response into variable: by JSONPath of json body, by regex of body or of header
+// (first group or whole match) or status code. String "$.path" is shorthand of json capture, other string is regex.
+type Capture struct {
+	Json   string `yaml:"json" json:"json,omitempty"`
+	Header string `yaml:"header" json:"header,omitempty"`
+	Regex  string `yaml:"regex" json:"regex,omitempty"`
+	Status bool   `yaml:"status" json:"status,omitempty"`
+}
+
+func (c *Capture) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if strings.HasPrefix(node.Value, "$") {
+			c.Json = node.Value
+		} else {
+			c.Regex = node.Value
+		}
+		return nil
+	}
+	type plain Capture
+	return node.Decode((*plain)(c))
+}
+
+// Extract returns captured value of response
+func (c Capture) Extract(status int, header http.Header, body []byte) (string, error) {
+	if c.Status {
+		return strconv.Itoa(status), nil
+	}
+	source := string(body)
+	if len(c.Header) > 0 {
+		values := header.Values(c.Header)
+		if len(values) == 0 {
+			return "", fmt.Errorf("header %s is absent", c.Header)
+		}
+		source = strings.Join(values, "\n")
+	} else if len(c.Json) > 0 {
+		var data interface{}
+		if err := json.Unmarshal(body, &data); err != nil {
+			return "", fmt.Errorf("response body is not json: %w", err)
+		}
+		value, err := mcli_utils.JsonPathGet(data, c.Json)
+		if err != nil {
+			return "", err
+		}
+		if str, ok := value.(string); ok {
+			source = str
+		} else {
+			raw, _ := json.Marshal(value)
+			source = string(raw)
+		}
+	}
+	if len(c.Regex) == 0 {
+		return source, nil
+	}
+	re, err := regexp.Compile(c.Regex)
+	if err != nil {
+		return "", err
+	}
+	match := re.FindStringSubmatch(source)
+	if match == nil {
+		return "", fmt.Errorf("regex %s does not match", c.Regex)
+	}
+	if len(match) > 1 {
+		return match[1], nil
+	}
+	return match[0], nil
+}
+
+// CollectionRequest is named request of collection, strings may contain {{ var }} entries
+type CollectionRequest struct {
+	Name    string            `yaml:"name" json:"name"`
+	Method  string            `yaml:"method,omitempty" json:"method,omitempty"`
+	URL     string            `yaml:"url" json:"url"`
+	Query   map[string]string `yaml:"query,omitempty" json:"query,omitempty"`
+	Headers RequestHeaders    `yaml:"headers,omitempty" json:"headers,omitempty"`
+	// object or array is sent as json, string is sent as is
+	Body interface{} `yaml:"body,omitempty" json:"body,omitempty"`
+	// fields of urlencoded form, "@path" values are files of multipart form
+	Form      map[string]interface{} `yaml:"form,omitempty" json:"form,omitempty"`
+	Multipart bool                   `yaml:"multipart,omitempty" json:"multipart,omitempty"`
+	// file which content is sent as body
+	BodyFile string `yaml:"body-file,omitempty" json:"body-file,omitempty"`
+	// milliseconds
+	Timeout int64              `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	Capture map[string]Capture `yaml:"capture,omitempty" json:"capture,omitempty"`
+	Assert  ResponseAssertions `yaml:"assert,omitempty" json:"assert,omitempty"`
+	Retry   RetryPolicy        `yaml:"retry,omitempty" json:"retry,omitempty"`
+	// auth of defaults is used if type is empty, type none disables it
+	Auth RequestAuth `yaml:"auth,omitempty" json:"auth,omitempty"`
+}
+
+// RequestCollection is set of named requests run in order, captures of request are variables of next ones
+type RequestCollection struct {
+	Name string `yaml:"name,omitempty"`
+	// variables of all environments
+	Variables map[string]string `yaml:"variables,omitempty"`
+	// environment name -> variables, they override collection variables
+	Environments map[string]map[string]string `yaml:"environments,omitempty"`
+	// method, timeout, headers, query, assertions, retry and auth applied to every request
+	Defaults CollectionRequest   `yaml:"defaults,omitempty"`
+	Requests []CollectionRequest `yaml:"requests"`
+}
+
+// ParseRequestCollection parses collection in yaml (or json) format or in jsonl format, where every line is request
+func ParseRequestCollection(content []byte, format string) (*RequestCollection, error) {
+	collection := &RequestCollection{}
+	if format == "jsonl" {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if len(text) == 0 || strings.HasPrefix(text, "//") {
+				continue
+			}
+			var request CollectionRequest
+			if err := yaml.Unmarshal([]byte(text), &request); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			collection.Requests = append(collection.Requests, request)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	} else if err := yaml.Unmarshal(content, collection); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]bool, len(collection.Requests))
+	for i := range collection.Requests {
+		request := &collection.Requests[i]
+		if len(request.Name) == 0 {
+			request.Name = fmt.Sprintf("request-%d", i+1)
+		}
+		if names[request.Name] {
+			return nil, fmt.Errorf("request name %s is duplicated", request.Name)
+		}
+		names[request.Name] = true
+		if len(request.URL) == 0 {
+			return nil, fmt.Errorf("request %s has no url", request.Name)
+		}
+		bodies := 0
+		for _, isSet := range []bool{request.Body != nil, request.Form != nil, len(request.BodyFile) > 0} {
+			if isSet {
+				bodies++
+			}
+		}
+		if bodies > 1 {
+			return nil, fmt.Errorf("request %s must have only one of body, form and body-file", request.Name)
+		}
+	}
+	return collection, nil
+}
+
+// Select returns requests with given names in collection order, all requests if names are empty
+func (rc *RequestCollection) Select(names []string) ([]CollectionRequest, error) {
+	if len(names) == 0 {
+		return rc.Requests, nil
+	}
+	selected := make([]CollectionRequest, 0, len(names))
+	for _, request := range rc.Requests {
+		if slices.Contains(names, request.Name) {
+			selected = append(selected, request)
+		}
+	}
+	for _, name := range names {
+		if !slices.ContainsFunc(selected, func(r CollectionRequest) bool { return r.Name == name }) {
+			return nil, fmt.Errorf("request %s is not in collection", name)
+		}
+	}
+	return selected, nil
+}
+
+// Vars returns variables of environment, unknown not empty environment is error
+func (rc *RequestCollection) Vars(environment string) (map[string]string, error) {
+	vars := make(map[string]string, len(rc.Variables))
+	for name, value := range rc.Variables {
+		vars[name] = value
+	}
+	if len(environment) == 0 {
+		return vars, nil
+	}
+	envVars, ok := rc.Environments[environment]
+	if !ok {
+		return nil, fmt.Errorf("environment %s is not defined", environment)
+	}
+	for name, value := range envVars {
+		vars[name] = value
+	}
+	return vars, nil
+}
+
+var collectionVarRegexp = regexp.MustCompile(`{{\s*([A-Za-z_][\w.-]*)\s*}}`)
+
+// SubstituteVars replaces {{ var }} entries, names of undefined variables are returned
+func SubstituteVars(s string, vars map[string]string) (string, []string) {
+	missing := make([]string, 0)
+	result := collectionVarRegexp.ReplaceAllStringFunc(s, func(entry string) string {
+		name := collectionVarRegexp.FindStringSubmatch(entry)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing = append(missing, name)
+			return entry
+		}
+		return value
+	})
+	return result, missing
+}
+
+// substituteValue replaces variables in strings of decoded yaml or json value
+func substituteValue(value interface{}, vars map[string]string, missing *[]string) interface{} {
+	switch v := value.(type) {
+	case string:
+		result, notFound := SubstituteVars(v, vars)
+		*missing = append(*missing, notFound...)
+		return result
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			result[key] = substituteValue(item, vars, missing)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, item := range v {
+			result[i] = substituteValue(item, vars, missing)
+		}
+		return result
+	}
+	return value
+}
+
+// Prepare returns request with defaults of collection applied and variables substituted
+func (rc *RequestCollection) Prepare(request CollectionRequest, vars map[string]string) (CollectionRequest, error) {
+	missing := make([]string, 0)
+	substitute := func(s string) string {
+		result, notFound := SubstituteVars(s, vars)
+		missing = append(missing, notFound...)
+		return result
+	}
+
+	prepared := CollectionRequest{Name: request.Name, Method: request.Method, Timeout: request.Timeout,
+		Capture: request.Capture, Retry: request.Retry, Auth: request.Auth, Query: make(map[string]string), Headers: make(RequestHeaders)}
+	if prepared.Retry.Attempts == 0 {
+		prepared.Retry = rc.Defaults.Retry
+	}
+	if len(prepared.Auth.Type) == 0 {
+		prepared.Auth = rc.Defaults.Auth
+	}
+	prepared.Auth.Secret = substitute(prepared.Auth.Secret)
+	prepared.Auth.TokenURL = substitute(prepared.Auth.TokenURL)
+	if len(prepared.Method) == 0 {
+		prepared.Method = rc.Defaults.Method
+	}
+	if len(prepared.Method) == 0 {
+		prepared.Method = http.MethodGet
+	}
+	prepared.Method = strings.ToUpper(prepared.Method)
+	if prepared.Timeout <= 0 {
+		prepared.Timeout = rc.Defaults.Timeout
+	}
+	prepared.URL = substitute(request.URL)
+	for _, query := range []map[string]string{rc.Defaults.Query, request.Query} {
+		for name, value := range query {
+			prepared.Query[name] = substitute(value)
+		}
+	}
+	// headers of request replace default headers with the same name
+	for _, headers := range []RequestHeaders{rc.Defaults.Headers, request.Headers} {
+		for name, values := range headers {
+			substituted := make([]string, len(values))
+			for i, value := range values {
+				substituted[i] = substitute(value)
+			}
+			prepared.Headers[http.CanonicalHeaderKey(name)] = substituted
+		}
+	}
+	prepared.Body = substituteValue(request.Body, vars, &missing)
+	if request.Form != nil {
+		form := substituteValue(request.Form, vars, &missing).(map[string]interface{})
+		prepared.Body = NewFormBody(FormValues(form), request.Multipart)
+	} else if len(request.BodyFile) > 0 {
+		prepared.Body = FileBody(substitute(request.BodyFile))
+	}
+	prepared.Assert = rc.Defaults.Assert.Merge(request.Assert)
+	for name, value := range prepared.Assert.Headers {
+		prepared.Assert.Headers[name] = substitute(value)
+	}
+	for path, check := range prepared.Assert.Json {
+		check.Regex = substitute(check.Regex)
+		check.Equals = substituteValue(check.Equals, vars, &missing)
+		prepared.Assert.Json[path] = check
+	}
+	for i, expr := range prepared.Assert.Body {
+		prepared.Assert.Body[i] = substitute(expr)
+	}
+
+	if len(missing) > 0 {
+		return prepared, fmt.Errorf("variables are not defined: %s",
+			strings.Join(mcli_utils.RemoveDuplicatesStr(missing), ", "))
+	}
+	if len(prepared.Query) > 0 {
+		target, err := url.Parse(prepared.URL)
+		if err != nil {
+			return prepared, err
+		}
+		query := target.Query()
+		for name, value := range prepared.Query {
+			query.Set(name, value)
+		}
+		target.RawQuery = query.Encode()
+		prepared.URL = target.String()
+	}
+	return prepared, nil
+}
+
+// RequestResult is outcome of collection request
+type RequestResult struct {
+	Name     string            `json:"name"`
+	Method   string            `json:"method"`
+	URL      string            `json:"url"`
+	Status   int               `json:"status"`
+	Duration time.Duration     `json:"-"` // written as duration_ms
+	Size     int               `json:"size"`
+	Captured map[string]string `json:"captured,omitempty"`
+	// request is not done or response is not read or captured
+	Error string `json:"error,omitempty"`
+	// number of checked assertions and descriptions of failed ones
+	Assertions int      `json:"assertions"`
+	Failures   []string `json:"failures,omitempty"`
+}
+
+// MarshalJSON writes duration of result in milliseconds as duration_ms
+func (result RequestResult) MarshalJSON() ([]byte, error) {
+	type plainResult RequestResult
+	return json.Marshal(struct {
+		plainResult
+		Duration float64 `json:"duration_ms"`
+	}{plainResult(result), durationMs(result.Duration)})
+}
+
+func (result RequestResult) Failed() bool {
+	return len(result.Error) > 0 || len(result.Failures) > 0
+}
+
+// CaptureAll extracts captures of request from response, variables are set for captured values
+func (request CollectionRequest) CaptureAll(status int, header http.Header, body []byte,
+	vars map[string]string) (map[string]string, error) {
+	captured := make(map[string]string, len(request.Capture))
+	names := make([]string, 0, len(request.Capture))
+	for name := range request.Capture {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		value, err := request.Capture[name].Extract(status, header, body)
+		if err != nil {
+			return captured, fmt.Errorf("capture %s: %w", name, err)
+		}
+		captured[name] = value
+		vars[name] = value
+	}
+	return captured, nil
+}
@@ -0,0 +1,210 @@
+package mclihttp
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRequestCollection(t *testing.T) {
+	collection, err := ParseRequestCollection([]byte(`
+name: notes
+variables: {user: admin, base: http://localhost}
+environments:
+  prod: {base: "https://example.com"}
+defaults:
+  timeout: 3000
+  headers: {Accept: application/json, X-User: "{{ user }}"}
+requests:
+  - name: create
+    method: post
+    url: "{{base}}/notes"
+    query: {draft: "{{ draft }}"}
+    headers: {x-user: [a, b]}
+    body: {title: "note of {{ user }}", tags: ["{{ user }}", 1]}
+    capture:
+      id: $.payload.key
+      location: {header: Location, regex: '/notes/(.+)$'}
+  - url: "{{ base }}/notes/{{ id }}"
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if collection.Requests[1].Name != "request-2" {
+		t.Errorf("request without name must get generated name, got %q", collection.Requests[1].Name)
+	}
+	if _, err := collection.Select([]string{"missing"}); err == nil {
+		t.Error("unknown request name must be rejected")
+	}
+	if _, err := collection.Vars("dev"); err == nil {
+		t.Error("unknown environment must be rejected")
+	}
+	vars, _ := collection.Vars("prod")
+
+	if _, err := collection.Prepare(collection.Requests[0], vars); err == nil || !strings.Contains(err.Error(), "draft") {
+		t.Errorf("undefined variable must be reported, got %v", err)
+	}
+	vars["draft"] = "yes"
+	prepared, err := collection.Prepare(collection.Requests[0], vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared.Method != http.MethodPost || prepared.URL != "https://example.com/notes?draft=yes" || prepared.Timeout != 3000 {
+		t.Errorf("unexpected prepared request: %+v", prepared)
+	}
+	if strings.Join(prepared.Headers["X-User"], ",") != "a,b" || prepared.Headers.Get("Accept") != "application/json" {
+		t.Errorf("request headers must be merged with defaults: %v", prepared.Headers)
+	}
+	body := prepared.Body.(map[string]interface{})
+	if body["title"] != "note of admin" || body["tags"].([]interface{})[0] != "admin" || body["tags"].([]interface{})[1] != 1 {
+		t.Errorf("variables of body are not substituted: %v", body)
+	}
+
+	header := http.Header{"Location": []string{"/api/notes/42"}}
+	captured, err := prepared.CaptureAll(http.StatusCreated, header, []byte(`{"payload":{"key":"k1"}}`), vars)
+	if err != nil || captured["id"] != "k1" || captured["location"] != "42" || vars["id"] != "k1" {
+		t.Errorf("unexpected captures: %v %v", captured, err)
+	}
+	if _, err := prepared.CaptureAll(http.StatusCreated, header, []byte(`not json`), vars); err == nil {
+		t.Error("json capture of not json body must fail")
+	}
+	prepared, err = collection.Prepare(collection.Requests[1], vars)
+	if err != nil || prepared.URL != "https://example.com/notes/k1" || prepared.Method != http.MethodGet {
+		t.Errorf("captured variable is not used: %+v %v", prepared, err)
+	}
+
+	collection, err = ParseRequestCollection([]byte(`{"name": "a", "url": "http://a", "capture": {"n": "$.items[-1]['x-y']"}}
+
+{"name": "b", "url": "http://b", "headers": {"Accept": "text/plain"}}
+`), "jsonl")
+	if err != nil || len(collection.Requests) != 2 || collection.Requests[1].Headers.Get("Accept") != "text/plain" {
+		t.Fatalf("unexpected jsonl collection: %+v %v", collection, err)
+	}
+	captured, err = collection.Requests[0].CaptureAll(http.StatusOK, nil, []byte(`{"items":[{"x-y":1},{"x-y":{"z":true}}]}`), vars)
+	if err != nil || captured["n"] != `{"z":true}` {
+		t.Errorf("json path capture of last item: %v %v", captured, err)
+	}
+	if _, err := ParseRequestCollection([]byte(`{"name": "a", "url": "http://a"}`+"\n"+`{"name": "a", "url": "http://b"}`), "jsonl"); err == nil {
+		t.Error("duplicated request name must be rejected")
+	}
+}
+
+func TestResponseAssertions(t *testing.T) {
+	collection, err := ParseRequestCollection([]byte(`
+variables: {user: admin}
+defaults:
+  assert: {status: 2xx, headers: {content-type: json}, max-latency: 100}
+requests:
+  - url: http://localhost/notes
+    assert:
+      status: [201, 409]
+      json:
+        $.payload.user: "{{ user }}"
+        $.payload.tags: [a, 1]
+        $.payload.key: {regex: '^k\d+$'}
+        $.error: {exists: false}
+      body: ['"payload"']
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	prepared, err := collection.Prepare(collection.Requests[0], map[string]string{"user": "admin"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if prepared.Assert.Count() != 8 {
+		t.Errorf("default assertions must be merged: %+v", prepared.Assert)
+	}
+	header := http.Header{"Content-Type": []string{"application/json"}}
+	body := []byte(`{"payload":{"user":"admin","tags":["a",1],"key":"k1"}}`)
+	if failures := prepared.Assert.Check(http.StatusConflict, header, body, 0); len(failures) != 0 {
+		t.Errorf("unexpected failures: %v", failures)
+	}
+	body = []byte(`{"payload":{"user":"bob","tags":["a"],"key":"x"},"error":""}`)
+	failures := prepared.Assert.Check(http.StatusOK, http.Header{}, body, 200*time.Millisecond)
+	if len(failures) != 7 {
+		t.Errorf("all assertions except body must fail: %v", failures)
+	}
+
+	report := NewRequestReport("notes", []RequestResult{{Name: "a"}, {Name: "b", Error: "timeout"},
+		{Name: "c", Failures: failures}}, 4)
+	var out strings.Builder
+	if err := report.WriteJUnit(&out); err != nil {
+		t.Fatal(err)
+	}
+	if report.Passed != 1 || report.Failed != 2 || report.Skipped != 1 ||
+		!strings.Contains(out.String(), `<testsuite name="notes" tests="4" failures="1" errors="1" skipped="1"`) ||
+		!strings.Contains(out.String(), `<failure message="status 200, expected 201 or 409" type="assertion">`) {
+		t.Errorf("unexpected junit report: %s", out.String())
+	}
+
+	report.Results[0].Duration = 1500 * time.Microsecond
+	report.Duration = 2 * time.Second
+	out.Reset()
+	if err := report.WriteJSON(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), `"duration_ms": 2000`) || !strings.Contains(out.String(), `"duration_ms": 1.5`) ||
+		strings.Contains(out.String(), `"duration":`) {
+		t.Errorf("durations of json report must be in milliseconds: %s", out.String())
+	}
+}
+
+func TestEncodeRequestBody(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "note.txt")
+	os.WriteFile(file, []byte("attached note"), 0644)
+	collection, err := ParseRequestCollection([]byte(`
+requests:
+  - name: form
+    url: http://localhost/form
+    form: {name: "{{ user }}", tags: [a, b]}
+  - name: upload
+    url: http://localhost/upload
+    form: {name: "{{ user }}", file: "@{{ file }}"}
+`), "yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"user": "bob smith", "file": file}
+
+	prepared, _ := collection.Prepare(collection.Requests[0], vars)
+	reader, contentType, err := EncodeRequestBody(prepared.Body)
+	content, _ := io.ReadAll(reader)
+	if err != nil || contentType != "application/x-www-form-urlencoded" || string(content) != "name=bob+smith&tags=a&tags=b" {
+		t.Errorf("unexpected form body: %s %q %v", contentType, content, err)
+	}
+
+	prepared, _ = collection.Prepare(collection.Requests[1], vars)
+	reader, contentType, err = EncodeRequestBody(prepared.Body)
+	if err != nil || !strings.HasPrefix(contentType, "multipart/form-data; boundary=") {
+		t.Fatalf("unexpected multipart body: %s %v", contentType, err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/upload", reader)
+	req.Header.Set("Content-Type", contentType)
+	if err := req.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	part, header, err := req.FormFile("file")
+	if err != nil || req.FormValue("name") != "bob smith" || header.Filename != "note.txt" ||
+		!strings.HasPrefix(header.Header.Get("Content-Type"), "text/plain") {
+		t.Fatalf("unexpected multipart form: %v %v", req.MultipartForm, err)
+	}
+	if content, _ := io.ReadAll(part); string(content) != "attached note" {
+		t.Errorf("unexpected file content: %q", content)
+	}
+
+	if _, contentType, _ := EncodeRequestBody(map[string]interface{}{"a": 1}); contentType != "application/json" {
+		t.Errorf("object must be sent as json, got %s", contentType)
+	}
+	if _, contentType, _ := EncodeRequestBody(FileBody(file)); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("type of file must be detected, got %s", contentType)
+	}
+	if _, err := ParseRequestCollection([]byte(`requests: [{url: http://a, body: x, form: {a: b}}]`), "yaml"); err == nil {
+		t.Error("request with body and form must be rejected")
+	}
+}
@@ -0,0 +1,242 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+// StoredCookie is cookie of jar, host only cookie is sent only to host of its domain
+type StoredCookie struct {
+	Name     string    `json:"name"`
+	Value    string    `json:"value"`
+	Domain   string    `json:"domain"`
+	Path     string    `json:"path"`
+	Expires  time.Time `json:"expires,omitempty"`
+	Secure   bool      `json:"secure,omitempty"`
+	HttpOnly bool      `json:"http-only,omitempty"`
+	HostOnly bool      `json:"host-only,omitempty"`
+}
+
+// expired reports whether cookie is expired, cookies without expiry are kept until jar is cleared
+func (c StoredCookie) expired(now time.Time) bool {
+	return !c.Expires.IsZero() && !now.Before(c.Expires)
+}
+
+// matches reports whether cookie is sent with request to url
+func (c StoredCookie) matches(u *url.URL) bool {
+	host := strings.ToLower(u.Hostname())
+	if c.HostOnly && host != c.Domain || !c.HostOnly && !domainMatch(host, c.Domain) {
+		return false
+	}
+	if c.Secure && u.Scheme != "https" {
+		return false
+	}
+	requestPath := u.EscapedPath()
+	if len(requestPath) == 0 {
+		requestPath = "/"
+	}
+	return requestPath == c.Path || strings.HasPrefix(requestPath, c.Path) &&
+		(strings.HasSuffix(c.Path, "/") || requestPath[len(c.Path)] == '/')
+}
+
+func domainMatch(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// cookieDomain returns domain of cookie set by host and whether cookie is host only, it is not ok for
+// domains which host may not set cookies for. Cookies of ip hosts are host only, cookies of public suffixes
+// like "co.uk" are accepted only as host only cookies of the suffix itself (RFC 6265 5.3)
+func cookieDomain(host, domain string) (string, bool, bool) {
+	domain = strings.TrimPrefix(strings.ToLower(domain), ".")
+	if len(domain) == 0 {
+		return host, true, true
+	}
+	if net.ParseIP(host) != nil {
+		return host, true, domain == host
+	}
+	if !domainMatch(host, domain) {
+		return "", false, false
+	}
+	if suffix, _ := publicsuffix.PublicSuffix(domain); suffix == domain {
+		return host, true, domain == host
+	}
+	return domain, false, true
+}
+
+// defaultCookiePath returns directory of path of url as default path of cookie (RFC 6265 5.1.4)
+func defaultCookiePath(u *url.URL) string {
+	dir := path.Dir(u.EscapedPath())
+	if !strings.HasPrefix(dir, "/") {
+		return "/"
+	}
+	return dir
+}
+
+// CookieChange is cookie set or removed by response
+type CookieChange struct {
+	URL     string
+	Cookie  StoredCookie
+	Removed bool
+}
+
+func (c CookieChange) String() string {
+	if c.Removed {
+		return fmt.Sprintf("%s removed (domain %s, path %s)", c.Cookie.Name, c.Cookie.Domain, c.Cookie.Path)
+	}
+	attrs := []string{"domain " + c.Cookie.Domain, "path " + c.Cookie.Path}
+	if c.Cookie.Expires.IsZero() {
+		attrs = append(attrs, "session")
+	} else {
+		attrs = append(attrs, "expires "+c.Cookie.Expires.UTC().Format(time.RFC3339))
+	}
+	if c.Cookie.Secure {
+		attrs = append(attrs, "secure")
+	}
+	if c.Cookie.HttpOnly {
+		attrs = append(attrs, "http-only")
+	}
+	return fmt.Sprintf("%s=%s (%s)", c.Cookie.Name, c.Cookie.Value, strings.Join(attrs, ", "))
+}
+
+// CookieJar is cookie jar which keeps cookies of profile in file, it is safe for concurrent use
+type CookieJar struct {
+	mu      sync.Mutex
+	cookies []StoredCookie
+	changes []CookieChange
+}
+
+func NewCookieJar() *CookieJar {
+	return &CookieJar{cookies: make([]StoredCookie, 0)}
+}
+
+// SetCookies implements http.CookieJar, cookies of other domains are ignored
+func (j *CookieJar) SetCookies(u *url.URL, cookies []*http.Cookie) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	host := strings.ToLower(u.Hostname())
+	for _, cookie := range cookies {
+		stored := StoredCookie{Name: cookie.Name, Value: cookie.Value, Path: cookie.Path,
+			Secure: cookie.Secure, HttpOnly: cookie.HttpOnly}
+		var ok bool
+		stored.Domain, stored.HostOnly, ok = cookieDomain(host, cookie.Domain)
+		if !ok {
+			continue
+		}
+		if !strings.HasPrefix(stored.Path, "/") {
+			stored.Path = defaultCookiePath(u)
+		}
+		removed := false
+		switch {
+		case cookie.MaxAge < 0:
+			removed = true
+		case cookie.MaxAge > 0:
+			stored.Expires = now.Add(time.Duration(cookie.MaxAge) * time.Second)
+		case !cookie.Expires.IsZero():
+			stored.Expires = cookie.Expires
+			removed = stored.expired(now)
+		}
+
+		j.cookies = slices.DeleteFunc(j.cookies, func(c StoredCookie) bool {
+			return c.Name == stored.Name && c.Domain == stored.Domain && c.Path == stored.Path
+		})
+		if !removed {
+			j.cookies = append(j.cookies, stored)
+		}
+		j.changes = append(j.changes, CookieChange{URL: u.String(), Cookie: stored, Removed: removed})
+	}
+}
+
+// Cookies implements http.CookieJar, cookies with longer paths are first
+func (j *CookieJar) Cookies(u *url.URL) []*http.Cookie {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	matched := make([]StoredCookie, 0)
+	for _, cookie := range j.cookies {
+		if !cookie.expired(now) && cookie.matches(u) {
+			matched = append(matched, cookie)
+		}
+	}
+	slices.SortStableFunc(matched, func(a, b StoredCookie) int { return len(b.Path) - len(a.Path) })
+	result := make([]*http.Cookie, len(matched))
+	for i, cookie := range matched {
+		result[i] = &http.Cookie{Name: cookie.Name, Value: cookie.Value}
+	}
+	return result
+}
+
+// Changes returns cookies set or removed by responses in order
+func (j *CookieJar) Changes() []CookieChange {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return slices.Clone(j.changes)
+}
+
+// LoadCookieJar reads cookies of profile from json file of profiles, missing file is empty jar
+func LoadCookieJar(file, profile string) (*CookieJar, error) {
+	jar := NewCookieJar()
+	profiles, err := readCookieProfiles(file)
+	if err != nil {
+		return jar, err
+	}
+	now := time.Now()
+	for _, cookie := range profiles[profile] {
+		if !cookie.expired(now) {
+			jar.cookies = append(jar.cookies, cookie)
+		}
+	}
+	return jar, nil
+}
+
+// Save writes not expired cookies of jar as profile of json file, other profiles of file are kept
+func (j *CookieJar) Save(file, profile string) error {
+	profiles, err := readCookieProfiles(file)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	now := time.Now()
+	profiles[profile] = slices.DeleteFunc(slices.Clone(j.cookies), func(c StoredCookie) bool { return c.expired(now) })
+	j.mu.Unlock()
+
+	content, err := json.MarshalIndent(profiles, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0600)
+}
+
+func readCookieProfiles(file string) (map[string][]StoredCookie, error) {
+	profiles := make(map[string][]StoredCookie)
+	content, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return profiles, nil
+	}
+	if err != nil {
+		return profiles, err
+	}
+	if len(strings.TrimSpace(string(content))) == 0 {
+		return profiles, nil
+	}
+	if err := json.Unmarshal(content, &profiles); err != nil {
+		return profiles, fmt.Errorf("cookie jar %s is not valid: %w", file, err)
+	}
+	return profiles, nil
+}
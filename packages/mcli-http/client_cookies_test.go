@@ -0,0 +1,105 @@
+package mclihttp
+
+import (
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCookieJar(t *testing.T) {
+	jar := NewCookieJar()
+	signin, _ := url.Parse("https://portal.example.com/auth/signin")
+	jar.SetCookies(signin, []*http.Cookie{
+		{Name: "session-token", Value: "abc", Path: "/", HttpOnly: true, MaxAge: 3600},
+		{Name: "auth-step", Value: "2"},
+		{Name: "shared", Value: "1", Domain: ".example.com", Path: "/", Secure: true},
+		{Name: "foreign", Value: "x", Domain: "other.com"},
+		{Name: "old", Value: "x", Expires: time.Now().Add(-time.Hour)},
+	})
+	names := func(rawURL string) map[string]string {
+		u, _ := url.Parse(rawURL)
+		result := make(map[string]string)
+		for _, cookie := range jar.Cookies(u) {
+			result[cookie.Name] = cookie.Value
+		}
+		return result
+	}
+	if got := names("https://portal.example.com/auth/step"); len(got) != 3 || got["auth-step"] != "2" {
+		t.Errorf("unexpected cookies of auth path: %v", got)
+	}
+	if got := names("https://portal.example.com/authors"); len(got) != 2 || got["session-token"] != "abc" {
+		t.Errorf("cookie of /auth path must not be sent to /authors: %v", got)
+	}
+	if got := names("https://api.example.com/"); len(got) != 1 || got["shared"] != "1" {
+		t.Errorf("only domain cookie must be sent to subdomain: %v", got)
+	}
+	if got := names("http://sub.api.example.com/"); len(got) != 0 {
+		t.Errorf("secure cookie must not be sent by http: %v", got)
+	}
+	if changes := jar.Changes(); len(changes) != 4 || !changes[3].Removed {
+		t.Errorf("unexpected changes: %v", changes)
+	}
+
+	file := filepath.Join(t.TempDir(), "cookies.json")
+	if err := jar.Save(file, "bob"); err != nil {
+		t.Fatal(err)
+	}
+	jar.SetCookies(signin, []*http.Cookie{{Name: "session-token", Path: "/", MaxAge: -1}})
+	if err := jar.Save(file, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if jar, _ = LoadCookieJar(file, "bob"); len(names("https://portal.example.com/")) != 2 {
+		t.Errorf("cookies of profile bob are not loaded: %v", jar.cookies)
+	}
+	if jar, _ = LoadCookieJar(file, "alice"); names("https://portal.example.com/")["session-token"] != "" {
+		t.Errorf("removed cookie is loaded: %v", jar.cookies)
+	}
+}
+
+func TestCookieJarDomains(t *testing.T) {
+	jar := NewCookieJar()
+	set := func(rawURL string, cookies ...*http.Cookie) {
+		u, _ := url.Parse(rawURL)
+		jar.SetCookies(u, cookies)
+	}
+	sent := func(rawURL string) map[string]bool {
+		u, _ := url.Parse(rawURL)
+		result := make(map[string]bool)
+		for _, cookie := range jar.Cookies(u) {
+			result[cookie.Name] = true
+		}
+		return result
+	}
+	set("https://shop.example.co.uk/", &http.Cookie{Name: "suffix", Value: "x", Domain: "co.uk"},
+		&http.Cookie{Name: "site", Value: "x", Domain: "example.co.uk"})
+	set("https://user.github.io/", &http.Cookie{Name: "pages", Value: "x", Domain: "github.io"})
+	set("https://co.uk/", &http.Cookie{Name: "own-suffix", Value: "x", Domain: "co.uk"})
+	set("http://10.0.0.1/", &http.Cookie{Name: "ip", Value: "x", Domain: "10.0.0.1"},
+		&http.Cookie{Name: "ip-suffix", Value: "x", Domain: "0.0.1"})
+
+	if got := sent("https://other.co.uk/"); len(got) != 0 {
+		t.Errorf("cookie of public suffix must not be shared: %v", got)
+	}
+	if got := sent("https://www.example.co.uk/"); len(got) != 1 || !got["site"] {
+		t.Errorf("cookie of registered domain must be shared: %v", got)
+	}
+	if got := sent("https://attacker.github.io/"); len(got) != 0 {
+		t.Errorf("cookie of private public suffix must not be shared: %v", got)
+	}
+	if got := sent("https://co.uk/"); len(got) != 1 || !got["own-suffix"] {
+		t.Errorf("public suffix host must keep host only cookie: %v", got)
+	}
+	if got := sent("http://10.0.0.1/"); len(got) != 1 || !got["ip"] {
+		t.Errorf("ip host must keep host only cookie: %v", got)
+	}
+	if got := sent("http://20.0.0.1/"); len(got) != 0 {
+		t.Errorf("cookie of ip host must not be shared: %v", got)
+	}
+	for _, cookie := range jar.cookies {
+		if cookie.Name == "ip" && !cookie.HostOnly {
+			t.Errorf("cookie of ip host must be host only: %v", cookie)
+		}
+	}
+}
@@ -0,0 +1,543 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// skippedImportHeaders are set by client itself, Accept-Encoding disables decompression of response by client
+var skippedImportHeaders = []string{"Content-Length", "Host", "Connection", "Accept-Encoding"}
+
+// RequestName returns name of request by method and path of url: "post-api-notes"
+func RequestName(method, rawURL string) string {
+	parts := []string{strings.ToLower(method)}
+	if target, err := url.Parse(rawURL); err == nil {
+		for _, segment := range strings.Split(target.Path, "/") {
+			if len(segment) > 0 {
+				parts = append(parts, segment)
+			}
+		}
+	}
+	name := strings.Trim(nonNameChars.ReplaceAllString(strings.Join(parts, "-"), "-"), "-")
+	if len(name) > 60 {
+		name = strings.TrimRight(name[:60], "-")
+	}
+	return name
+}
+
+var nonNameChars = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+
+// UniqueRequestNames makes names of requests unique by suffix -2, -3 ...
+func UniqueRequestNames(requests []CollectionRequest) {
+	used := make(map[string]int, len(requests))
+	for i := range requests {
+		name := requests[i].Name
+		if used[name] > 0 {
+			requests[i].Name = fmt.Sprintf("%s-%d", name, used[name]+1)
+		}
+		used[name]++
+	}
+}
+
+// shellQuote quotes string by single quotes for POSIX shell
+func shellQuote(s string) string {
+	if len(s) > 0 && !strings.ContainsFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=@,%+", r))
+	}) {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// CurlCommand returns curl command which sends request with method, url, headers and body as EncodeRequestBody does:
+// forms are --data-urlencode, --form-string and -F options, file is --data-binary @path, Cookie header is -b option
+func CurlCommand(method, rawURL string, header http.Header, body interface{}) (string, error) {
+	header = header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	// first line is method and url, next ones are options with values
+	command := "curl"
+	switch method = strings.ToUpper(method); {
+	case method == http.MethodHead:
+		command += " -I"
+	case method != http.MethodGet || body != nil:
+		command += " -X " + method
+	}
+	lines := []string{command + " " + shellQuote(rawURL)}
+
+	bodyLines := make([]string, 0)
+	defaultType := ""
+	switch b := body.(type) {
+	case nil:
+	case FormBody:
+		// curl sets type of urlencoded form
+		if strings.HasPrefix(header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			header.Del("Content-Type")
+		}
+		for _, name := range sortedKeys(b) {
+			for _, value := range b[name] {
+				bodyLines = append(bodyLines, "--data-urlencode "+shellQuote(name+"="+value))
+			}
+		}
+	case MultipartBody:
+		// boundary is known only by curl
+		header.Del("Content-Type")
+		for _, name := range sortedKeys(b.Fields) {
+			for _, value := range b.Fields[name] {
+				bodyLines = append(bodyLines, "--form-string "+shellQuote(name+"="+value))
+			}
+		}
+		for _, name := range sortedKeys(b.Files) {
+			for _, path := range b.Files[name] {
+				bodyLines = append(bodyLines, "-F "+shellQuote(name+"=@"+path))
+			}
+		}
+	case FileBody:
+		defaultType = mime.TypeByExtension(filepath.Ext(string(b)))
+		if len(defaultType) == 0 {
+			defaultType = "application/octet-stream"
+		}
+		bodyLines = append(bodyLines, "--data-binary "+shellQuote("@"+string(b)))
+	case string:
+		defaultType = "text/plain; charset=utf-8"
+		if json.Valid([]byte(b)) {
+			defaultType = "application/json"
+		}
+		bodyLines = append(bodyLines, "--data-raw "+shellQuote(b))
+	case []byte:
+		if !utf8.Valid(b) {
+			return "", fmt.Errorf("binary body of %d bytes can not be argument of curl, use body file", len(b))
+		}
+		defaultType = http.DetectContentType(b)
+		bodyLines = append(bodyLines, "--data-raw "+shellQuote(string(b)))
+	default:
+		content, err := json.Marshal(body)
+		if err != nil {
+			return "", err
+		}
+		defaultType = "application/json"
+		bodyLines = append(bodyLines, "--data-raw "+shellQuote(string(content)))
+	}
+	// curl sends -d data as urlencoded form if type is not given
+	if len(defaultType) > 0 && len(header.Values("Content-Type")) == 0 {
+		header.Set("Content-Type", defaultType)
+	}
+
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		for _, value := range header[name] {
+			if name == "Cookie" {
+				lines = append(lines, "-b "+shellQuote(value))
+			} else {
+				lines = append(lines, "-H "+shellQuote(name+": "+value))
+			}
+		}
+	}
+	lines = append(lines, bodyLines...)
+	return strings.Join(lines, " \\\n  "), nil
+}
+
+// curlValueOptions are options of curl with value, options which are not imported are skipped with their values
+var curlValueOptions = map[string]string{
+	"-X": "request", "--request": "request", "-H": "header", "--header": "header",
+	"-d": "data", "--data": "data", "--data-ascii": "data", "--data-binary": "data-binary", "--data-raw": "data-raw",
+	"--data-urlencode": "data-urlencode", "--json": "json", "-F": "form", "--form": "form", "--form-string": "form-string",
+	"-b": "cookie", "--cookie": "cookie", "-u": "user", "--user": "user", "-A": "user-agent", "--user-agent": "user-agent",
+	"-e": "referer", "--referer": "referer", "--url": "url", "-m": "max-time", "--max-time": "max-time",
+	"-o": "", "--output": "", "-x": "", "--proxy": "", "-w": "", "--write-out": "", "-c": "", "--cookie-jar": "",
+	"--connect-timeout": "", "--retry": "", "--cacert": "", "--cert": "", "-E": "", "--key": "", "--resolve": "",
+	"--max-redirs": "", "--limit-rate": "", "-T": "", "--upload-file": "", "-r": "", "--range": "", "-K": "",
+	"--config": "", "--interface": "", "--retry-delay": "", "--retry-max-time": "", "-U": "", "--proxy-user": "",
+}
+
+// ParseCurlCommands parses curl commands of text, command may continue on next line after backslash
+func ParseCurlCommands(text string) ([]CollectionRequest, error) {
+	commands, err := splitShellWords(text)
+	if err != nil {
+		return nil, err
+	}
+	requests := make([]CollectionRequest, 0, len(commands))
+	for _, words := range commands {
+		if len(words) == 0 {
+			continue
+		}
+		request, err := parseCurlWords(words)
+		if err != nil {
+			return nil, fmt.Errorf("command %d: %w", len(requests)+1, err)
+		}
+		requests = append(requests, request)
+	}
+	if len(requests) == 0 {
+		return nil, fmt.Errorf("curl command is not found")
+	}
+	UniqueRequestNames(requests)
+	return requests, nil
+}
+
+func parseCurlWords(words []string) (CollectionRequest, error) {
+	request := CollectionRequest{Headers: make(RequestHeaders)}
+	if words[0] != "curl" {
+		return request, fmt.Errorf("command %s is not curl", words[0])
+	}
+	var data, formParts, cookies []string
+	var isGet, isHead, isDataFile bool
+	setHeader := func(line string) {
+		name, value, _ := strings.Cut(line, ":")
+		name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+		if len(name) == 0 || slices.Contains(skippedImportHeaders, name) {
+			return
+		}
+		request.Headers[name] = append(request.Headers[name], strings.TrimSpace(value))
+	}
+
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		option, value := word, ""
+		kind, hasValue := curlValueOptions[word]
+		switch {
+		case !strings.HasPrefix(word, "-"):
+			request.URL = word
+			continue
+		case hasValue:
+			if i+1 >= len(words) {
+				return request, fmt.Errorf("option %s has no value", word)
+			}
+			i++
+			value = words[i]
+		case !strings.HasPrefix(word, "--") && len(word) > 2:
+			// short option with value in the same word (-XPOST) or several flags (-sSL)
+			if kind, hasValue = curlValueOptions[word[:2]]; hasValue {
+				option, value = word[:2], word[2:]
+			} else {
+				for _, flag := range word[1:] {
+					switch flag {
+					case 'G':
+						isGet = true
+					case 'I':
+						isHead = true
+					}
+				}
+				continue
+			}
+		}
+
+		if !hasValue {
+			switch option {
+			case "-G", "--get":
+				isGet = true
+			case "-I", "--head":
+				isHead = true
+			}
+			continue
+		}
+		switch kind {
+		case "request":
+			request.Method = strings.ToUpper(value)
+		case "header":
+			setHeader(value)
+		case "data", "data-binary":
+			if strings.HasPrefix(value, "@") {
+				isDataFile = true
+			}
+			data = append(data, value)
+		case "data-raw":
+			data = append(data, value)
+		case "data-urlencode":
+			name, content, found := strings.Cut(value, "=")
+			if !found {
+				name, content = "", value
+			}
+			encoded := url.QueryEscape(content)
+			if len(name) > 0 {
+				encoded = name + "=" + encoded
+			}
+			data = append(data, encoded)
+		case "json":
+			data = append(data, value)
+			if len(request.Headers.Get("Content-Type")) == 0 {
+				setHeader("Content-Type: application/json")
+			}
+			if len(request.Headers.Get("Accept")) == 0 {
+				setHeader("Accept: application/json")
+			}
+		case "form", "form-string":
+			// attributes of file (;type=...) are not kept
+			if name, content, found := strings.Cut(value, "="); found && kind == "form" && strings.HasPrefix(content, "@") {
+				content, _, _ = strings.Cut(content[1:], ";")
+				value = name + "=@" + content
+			} else if found && kind == "form" && strings.HasPrefix(content, "<") {
+				// curl sends content of file as field value, collection form has only file uploads
+				return request, fmt.Errorf("form field %s value is read from file %s, it is not supported", name, content[1:])
+			} else if kind == "form-string" && found && strings.HasPrefix(content, "@") {
+				return request, fmt.Errorf("form field %s value starts with @, it would be file", name)
+			}
+			formParts = append(formParts, value)
+		case "cookie":
+			if !strings.Contains(value, "=") {
+				// cookie file of curl is not imported
+				continue
+			}
+			cookies = append(cookies, value)
+		case "user":
+			login, password, _ := strings.Cut(value, ":")
+			setHeader("Authorization: Basic " + basicCredentials(login, password))
+		case "user-agent":
+			setHeader("User-Agent: " + value)
+		case "referer":
+			setHeader("Referer: " + value)
+		case "url":
+			request.URL = value
+		case "max-time":
+			seconds, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return request, fmt.Errorf("max time %s is not number", value)
+			}
+			request.Timeout = int64(seconds * 1000)
+		}
+	}
+	if len(request.URL) == 0 {
+		return request, fmt.Errorf("curl command has no url")
+	}
+	if !strings.Contains(request.URL, "://") {
+		request.URL = "http://" + request.URL
+	}
+	if len(cookies) > 0 {
+		request.Headers["Cookie"] = append(request.Headers["Cookie"], strings.Join(cookies, "; "))
+	}
+
+	contentType := strings.ToLower(request.Headers.Get("Content-Type"))
+	switch {
+	case len(formParts) > 0:
+		form := make(map[string][]string)
+		for _, part := range formParts {
+			name, value, _ := strings.Cut(part, "=")
+			form[name] = append(form[name], value)
+		}
+		request.Form, request.Multipart = formFields(form), true
+		if strings.HasPrefix(contentType, "multipart/") {
+			delete(request.Headers, "Content-Type")
+		}
+	case len(data) > 0 && isGet:
+		separator := "?"
+		if strings.Contains(request.URL, "?") {
+			separator = "&"
+		}
+		request.URL += separator + strings.Join(data, "&")
+	case len(data) == 1 && isDataFile:
+		request.BodyFile = data[0][1:]
+	case len(data) > 0:
+		setImportedBody(&request, strings.Join(data, "&"), contentType)
+	}
+
+	switch {
+	case len(request.Method) > 0:
+	case isHead:
+		request.Method = http.MethodHead
+	case len(data) > 0 && !isGet || len(formParts) > 0:
+		request.Method = http.MethodPost
+	default:
+		request.Method = http.MethodGet
+	}
+	request.Name = RequestName(request.Method, request.URL)
+	if len(request.Headers) == 0 {
+		request.Headers = nil
+	}
+	return request, nil
+}
+
+// setImportedBody sets json body as object, urlencoded form as form and other content as string
+func setImportedBody(request *CollectionRequest, content, contentType string) {
+	var parsed interface{}
+	isForm := len(contentType) == 0 || strings.HasPrefix(contentType, "application/x-www-form-urlencoded")
+	switch {
+	case (len(contentType) == 0 || strings.Contains(contentType, "json")) && json.Unmarshal([]byte(content), &parsed) == nil:
+		request.Body = parsed
+	case isForm && strings.Contains(content, "="):
+		values, err := url.ParseQuery(content)
+		if err != nil {
+			request.Body = content
+			return
+		}
+		request.Form = formFields(values)
+		delete(request.Headers, "Content-Type")
+	default:
+		request.Body = content
+	}
+}
+
+// formFields returns form of collection, repeated fields are lists
+func formFields(values map[string][]string) map[string]interface{} {
+	form := make(map[string]interface{}, len(values))
+	for name, list := range values {
+		if len(list) == 1 {
+			form[name] = list[0]
+			continue
+		}
+		items := make([]interface{}, len(list))
+		for i, value := range list {
+			items[i] = value
+		}
+		form[name] = items
+	}
+	return form
+}
+
+// splitShellWords splits text to commands of words as POSIX shell: quotes, $'...' strings, backslash escapes,
+// line continuations and # comments. Commands are separated by new lines, ; and &&.
+func splitShellWords(text string) ([][]string, error) {
+	commands := make([][]string, 0)
+	words := make([]string, 0)
+	var word strings.Builder
+	inWord := false
+	endWord := func() {
+		if inWord {
+			words = append(words, word.String())
+			word.Reset()
+			inWord = false
+		}
+	}
+	endCommand := func() {
+		endWord()
+		if len(words) > 0 {
+			commands = append(commands, words)
+			words = make([]string, 0)
+		}
+	}
+
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\':
+			if i+1 < len(runes) {
+				i++
+				if runes[i] == '\r' && i+1 < len(runes) && runes[i+1] == '\n' {
+					i++
+				}
+				if runes[i] != '\n' {
+					word.WriteRune(runes[i])
+					inWord = true
+				}
+			}
+		case r == '\'':
+			end := slices.Index(runes[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("single quote is not closed")
+			}
+			word.WriteString(string(runes[i+1 : i+1+end]))
+			inWord = true
+			i += end + 1
+		case r == '$' && i+1 < len(runes) && runes[i+1] == '\'':
+			n, err := readAnsiCString(runes[i+2:], &word)
+			if err != nil {
+				return nil, err
+			}
+			inWord = true
+			i += n + 2
+		case r == '"':
+			closed := false
+			for i++; i < len(runes); i++ {
+				if runes[i] == '"' {
+					closed = true
+					break
+				}
+				if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune("\"\\$`\n", runes[i+1]) {
+					i++
+					if runes[i] == '\n' {
+						continue
+					}
+				}
+				word.WriteRune(runes[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("double quote is not closed")
+			}
+			inWord = true
+		case r == '#' && !inWord:
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			endCommand()
+		case r == '\n' || r == ';':
+			endCommand()
+		case r == '&' && i+1 < len(runes) && runes[i+1] == '&':
+			i++
+			endCommand()
+		case r == ' ' || r == '\t' || r == '\r':
+			endWord()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	endCommand()
+	return commands, nil
+}
+
+// readAnsiCString reads $'...' string till closing quote, number of read runes including quote is returned
+func readAnsiCString(runes []rune, word *strings.Builder) (int, error) {
+	escapes := map[rune]rune{'n': '\n', 't': '\t', 'r': '\r', '\\': '\\', '\'': '\'', '"': '"', 'a': '\a',
+		'b': '\b', 'f': '\f', 'v': '\v', 'e': 0x1b, '?': '?'}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\'' {
+			return i + 1, nil
+		}
+		if r != '\\' || i+1 >= len(runes) {
+			word.WriteRune(r)
+			continue
+		}
+		i++
+		if escaped, ok := escapes[runes[i]]; ok {
+			word.WriteRune(escaped)
+			continue
+		}
+		digits := map[rune]int{'x': 2, 'u': 4, 'U': 8}[runes[i]]
+		if digits == 0 {
+			word.WriteRune('\\')
+			word.WriteRune(runes[i])
+			continue
+		}
+		end := i + 1
+		for end < len(runes) && end <= i+digits && strings.ContainsRune("0123456789abcdefABCDEF", runes[end]) {
+			end++
+		}
+		code, err := strconv.ParseUint(string(runes[i+1:end]), 16, 32)
+		if err != nil {
+			return 0, fmt.Errorf("escape \\%c in $'...' string is not valid", runes[i])
+		}
+		if runes[i] == 'x' {
+			// bytes of \x escapes are utf-8 sequences
+			word.WriteByte(byte(code))
+		} else {
+			word.WriteRune(rune(code))
+		}
+		i = end - 1
+	}
+	return 0, fmt.Errorf("$' quote is not closed")
+}
+
+// importedHeader reports whether header of captured request is kept
+func importedHeader(name string) bool {
+	return !strings.HasPrefix(name, ":") && !slices.Contains(skippedImportHeaders, http.CanonicalHeaderKey(name))
+}
+
+// fileFieldName returns base name of file of form field
+func fileFieldName(fileName string) string {
+	return path.Base(strings.ReplaceAll(fileName, "\\", "/"))
+}
@@ -0,0 +1,110 @@
+package mclihttp
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestCurlRoundTrip(t *testing.T) {
+	commands := `# copied from browser
+curl 'https://portal.example.com/api/notes?draft=1' \
+  -H 'accept: application/json' \
+  -H $'x-note: it\'s \u00e9' \
+  -b 'session-token=abc; lang=ru' \
+  -H 'content-type: application/json' \
+  -H 'Accept-Encoding: gzip' \
+  --data-raw '{"title":"note","tags":["a","b"]}' \
+  --compressed
+curl -sSL -XPUT "https://portal.example.com/upload" -F 'file=@report.pdf;type=application/pdf' -F "name=q3" -u bob:secret
+curl -d 'a=1&a=2' --data-urlencode 'b=x y' https://portal.example.com/form; curl -I portal.example.com -m 2.5
+`
+	requests, err := ParseCurlCommands(commands)
+	if err != nil || len(requests) != 4 {
+		t.Fatalf("unexpected requests %v: %v", requests, err)
+	}
+	notes := requests[0]
+	if notes.Name != "post-api-notes" || notes.Method != http.MethodPost || notes.Headers.Get("X-Note") != "it's é" ||
+		notes.Headers.Get("Cookie") != "session-token=abc; lang=ru" || len(notes.Headers["Accept-Encoding"]) > 0 ||
+		!reflect.DeepEqual(notes.Body, map[string]interface{}{"title": "note", "tags": []interface{}{"a", "b"}}) {
+		t.Errorf("unexpected json request: %+v", notes)
+	}
+	upload := requests[1]
+	if upload.Method != http.MethodPut || !upload.Multipart || upload.Form["file"] != "@report.pdf" ||
+		upload.Form["name"] != "q3" || upload.Headers.Get("Authorization") != "Basic Ym9iOnNlY3JldA==" {
+		t.Errorf("unexpected multipart request: %+v", upload)
+	}
+	form := requests[2]
+	if form.Method != http.MethodPost || !reflect.DeepEqual(form.Form,
+		map[string]interface{}{"a": []interface{}{"1", "2"}, "b": "x y"}) {
+		t.Errorf("unexpected form request: %+v", form)
+	}
+	if head := requests[3]; head.Method != http.MethodHead || head.URL != "http://portal.example.com" || head.Timeout != 2500 {
+		t.Errorf("unexpected head request: %+v", head)
+	}
+
+	// requests are the same after export to curl and import
+	collection := &RequestCollection{}
+	for _, request := range requests {
+		prepared, err := collection.Prepare(request, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		command, err := CurlCommand(prepared.Method, prepared.URL, http.Header(prepared.Headers), prepared.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		imported, err := ParseCurlCommands(command)
+		if err != nil || len(imported) != 1 {
+			t.Fatalf("command is not parsed: %s: %v", command, err)
+		}
+		again := imported[0]
+		if again.Method != request.Method || again.URL != request.URL || !reflect.DeepEqual(again.Body, request.Body) ||
+			!reflect.DeepEqual(again.Form, request.Form) || again.Multipart != request.Multipart {
+			t.Errorf("request %s is changed by round trip:\n%s\n%+v", request.Name, command, again)
+		}
+		for name, values := range request.Headers {
+			if !reflect.DeepEqual(again.Headers[name], values) {
+				t.Errorf("header %s of %s is changed by round trip: %v", name, request.Name, again.Headers[name])
+			}
+		}
+	}
+}
+
+func TestParseCurlFormFromFile(t *testing.T) {
+	if _, err := ParseCurlCommands("curl -F 'note=<note.txt' https://portal.example.com/notes"); err == nil {
+		t.Error("field value read from file must not be imported as file upload")
+	}
+}
+
+func TestParseHAR(t *testing.T) {
+	har := `{"log": {"entries": [
+		{"request": {"method": "GET", "url": "https://portal.example.com/api/notes",
+			"headers": [{"name": ":authority", "value": "portal.example.com"}, {"name": "accept", "value": "*/*"}],
+			"cookies": [{"name": "session-token", "value": "abc"}]}},
+		{"request": {"method": "POST", "url": "https://portal.example.com/signin",
+			"headers": [{"name": "Content-Type", "value": "application/x-www-form-urlencoded"}],
+			"postData": {"mimeType": "application/x-www-form-urlencoded", "text": "login=bob&password=p%40ss"}}},
+		{"request": {"method": "POST", "url": "https://portal.example.com/upload",
+			"postData": {"mimeType": "multipart/form-data; boundary=x", "params": [
+				{"name": "note", "value": "1"}, {"name": "file", "fileName": "C:\\docs\\report.pdf"}]}}},
+		{"request": {"method": "GET", "url": "https://portal.example.com/api/notes"}}
+	]}}`
+	requests, err := ParseHAR([]byte(har))
+	if err != nil || len(requests) != 4 {
+		t.Fatalf("unexpected requests %v: %v", requests, err)
+	}
+	if r := requests[0]; r.Headers.Get("Cookie") != "session-token=abc" || r.Headers.Get("Accept") != "*/*" ||
+		len(r.Headers) != 2 {
+		t.Errorf("unexpected headers: %v", r.Headers)
+	}
+	if r := requests[1]; r.Form["password"] != "p@ss" || len(r.Headers) > 0 {
+		t.Errorf("unexpected form: %+v", r)
+	}
+	if r := requests[2]; !r.Multipart || r.Form["file"] != "@report.pdf" || r.Form["note"] != "1" {
+		t.Errorf("unexpected multipart form: %+v", r)
+	}
+	if requests[3].Name != "get-api-notes-2" {
+		t.Errorf("names must be unique: %s", requests[3].Name)
+	}
+}
@@ -0,0 +1,100 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// harNameValue is header, cookie, query or form parameter of HAR
+type harNameValue struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	FileName string `json:"fileName"`
+}
+
+// harLog is part of HTTP Archive used to import requests
+type harLog struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method   string         `json:"method"`
+				URL      string         `json:"url"`
+				Headers  []harNameValue `json:"headers"`
+				Cookies  []harNameValue `json:"cookies"`
+				PostData *struct {
+					MimeType string         `json:"mimeType"`
+					Text     string         `json:"text"`
+					Params   []harNameValue `json:"params"`
+				} `json:"postData"`
+			} `json:"request"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+// ParseHAR returns requests of entries of HTTP Archive in order
+func ParseHAR(content []byte) ([]CollectionRequest, error) {
+	var har harLog
+	if err := json.Unmarshal(content, &har); err != nil {
+		return nil, fmt.Errorf("HAR is not valid: %w", err)
+	}
+	requests := make([]CollectionRequest, 0, len(har.Log.Entries))
+	for _, entry := range har.Log.Entries {
+		source := entry.Request
+		request := CollectionRequest{Method: strings.ToUpper(source.Method), URL: source.URL, Headers: make(RequestHeaders)}
+		request.Name = RequestName(request.Method, request.URL)
+		for _, header := range source.Headers {
+			if importedHeader(header.Name) {
+				name := http.CanonicalHeaderKey(header.Name)
+				request.Headers[name] = append(request.Headers[name], header.Value)
+			}
+		}
+		if len(source.Cookies) > 0 && len(request.Headers["Cookie"]) == 0 {
+			pairs := make([]string, len(source.Cookies))
+			for i, cookie := range source.Cookies {
+				pairs[i] = cookie.Name + "=" + cookie.Value
+			}
+			request.Headers["Cookie"] = []string{strings.Join(pairs, "; ")}
+		}
+
+		if data := source.PostData; data != nil && (len(data.Text) > 0 || len(data.Params) > 0) {
+			mimeType := strings.ToLower(data.MimeType)
+			if len(request.Headers.Get("Content-Type")) == 0 && len(data.MimeType) > 0 {
+				request.Headers["Content-Type"] = []string{data.MimeType}
+			}
+			switch {
+			case strings.HasPrefix(mimeType, "multipart/form-data") && len(data.Params) > 0:
+				form := make(map[string][]string)
+				for _, param := range data.Params {
+					value := param.Value
+					if len(param.FileName) > 0 {
+						// content of file is not kept by HAR, file with its name must be near collection
+						value = "@" + fileFieldName(param.FileName)
+					}
+					form[param.Name] = append(form[param.Name], value)
+				}
+				request.Form, request.Multipart = formFields(form), true
+				delete(request.Headers, "Content-Type")
+			case strings.HasPrefix(mimeType, "application/x-www-form-urlencoded") && len(data.Text) == 0:
+				form := make(map[string][]string)
+				for _, param := range data.Params {
+					name, _ := url.QueryUnescape(param.Name)
+					value, _ := url.QueryUnescape(param.Value)
+					form[name] = append(form[name], value)
+				}
+				request.Form = formFields(form)
+				delete(request.Headers, "Content-Type")
+			default:
+				setImportedBody(&request, data.Text, mimeType)
+			}
+		}
+		if len(request.Headers) == 0 {
+			request.Headers = nil
+		}
+		requests = append(requests, request)
+	}
+	UniqueRequestNames(requests)
+	return requests, nil
+}
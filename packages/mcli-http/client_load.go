@@ -0,0 +1,139 @@
+package mclihttp
+
+import (
+	"context"
+	"math"
+	"slices"
+	"sync"
+	"time"
+)
+
+// LoadOptions are settings of load run
+type LoadOptions struct {
+	// number of requests
+	Requests int
+	// number of requests sent at the same time
+	Concurrency int
+	// requests per second, not limited if it is 0
+	Rate float64
+}
+
+// LoadResult is outcome of one request of load run
+type LoadResult struct {
+	Status int
+	Size   int64
+	// assertions of response are failed
+	Failed bool
+	Err    error
+}
+
+// LoadStats are latency percentiles, throughput and histograms of statuses and errors of load run
+type LoadStats struct {
+	Requests  int
+	Errors    int
+	Failed    int
+	Bytes     int64
+	Duration  time.Duration
+	Latencies []time.Duration
+	// status code -> number of responses
+	Statuses map[int]int
+	// error text -> number of requests
+	ErrorTexts map[string]int
+}
+
+func (s *LoadStats) add(result LoadResult, latency time.Duration) {
+	s.Requests++
+	s.Latencies = append(s.Latencies, latency)
+	if result.Err != nil {
+		s.Errors++
+		s.ErrorTexts[result.Err.Error()]++
+		return
+	}
+	s.Statuses[result.Status]++
+	s.Bytes += result.Size
+	if result.Failed {
+		s.Failed++
+	}
+}
+
+// Percentile returns latency which p percents of requests do not exceed (nearest rank)
+func (s *LoadStats) Percentile(p float64) time.Duration {
+	if len(s.Latencies) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(s.Latencies))))
+	return s.Latencies[min(max(rank, 1), len(s.Latencies))-1]
+}
+
+// Mean returns average latency
+func (s *LoadStats) Mean() time.Duration {
+	if len(s.Latencies) == 0 {
+		return 0
+	}
+	var total time.Duration
+	for _, latency := range s.Latencies {
+		total += latency
+	}
+	return total / time.Duration(len(s.Latencies))
+}
+
+// Throughput returns requests per second
+func (s *LoadStats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Requests) / s.Duration.Seconds()
+}
+
+// RunLoad sends requests by do at concurrency and rate of options, run is stopped when context is done
+func RunLoad(ctx context.Context, opts LoadOptions, do func(ctx context.Context) LoadResult) *LoadStats {
+	stats := &LoadStats{Statuses: make(map[int]int), ErrorTexts: make(map[string]int),
+		Latencies: make([]time.Duration, 0, opts.Requests)}
+	concurrency := min(max(opts.Concurrency, 1), max(opts.Requests, 1))
+
+	jobs := make(chan struct{})
+	go func() {
+		defer close(jobs)
+		var ticker *time.Ticker
+		if opts.Rate > 0 {
+			ticker = time.NewTicker(time.Duration(float64(time.Second) / opts.Rate))
+			defer ticker.Stop()
+		}
+		for i := 0; i < opts.Requests; i++ {
+			if ticker != nil && i > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case jobs <- struct{}{}:
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range jobs {
+				requestStart := time.Now()
+				result := do(ctx)
+				latency := time.Since(requestStart)
+				mu.Lock()
+				stats.add(result, latency)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	stats.Duration = time.Since(start)
+	slices.Sort(stats.Latencies)
+	return stats
+}
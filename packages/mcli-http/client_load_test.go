@@ -0,0 +1,82 @@
+package mclihttp
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunLoad(t *testing.T) {
+	var calls, active, peak int32
+	stats := RunLoad(context.Background(), LoadOptions{Requests: 40, Concurrency: 4},
+		func(ctx context.Context) LoadResult {
+			n := atomic.AddInt32(&calls, 1)
+			current := atomic.AddInt32(&active, 1)
+			for {
+				old := atomic.LoadInt32(&peak)
+				if current <= old || atomic.CompareAndSwapInt32(&peak, old, current) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&active, -1)
+			switch {
+			case n%10 == 0:
+				return LoadResult{Err: errors.New("connection refused")}
+			case n%4 == 0:
+				return LoadResult{Status: http.StatusServiceUnavailable, Size: 10, Failed: true}
+			}
+			return LoadResult{Status: http.StatusOK, Size: 100}
+		})
+	if calls != 40 || stats.Requests != 40 || peak > 4 || peak < 2 {
+		t.Errorf("unexpected calls %d, requests %d or concurrency %d", calls, stats.Requests, peak)
+	}
+	if stats.Errors != 4 || stats.ErrorTexts["connection refused"] != 4 || stats.Failed != 8 ||
+		stats.Statuses[http.StatusOK] != 28 || stats.Statuses[http.StatusServiceUnavailable] != 8 {
+		t.Errorf("unexpected histograms: %+v", stats)
+	}
+	if stats.Percentile(50) > stats.Percentile(99) || stats.Percentile(99) != stats.Latencies[39] ||
+		stats.Percentile(50) != stats.Latencies[19] || stats.Throughput() <= 0 {
+		t.Errorf("unexpected percentiles: %v", stats.Latencies)
+	}
+
+	start := time.Now()
+	stats = RunLoad(context.Background(), LoadOptions{Requests: 5, Concurrency: 5, Rate: 50},
+		func(ctx context.Context) LoadResult { return LoadResult{Status: http.StatusOK} })
+	if elapsed := time.Since(start); stats.Requests != 5 || elapsed < 70*time.Millisecond {
+		t.Errorf("rate is not limited: %d requests in %s", stats.Requests, elapsed)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{Attempts: 3, Delay: 100, MaxDelay: 300}
+	ctx := context.Background()
+	if !policy.ShouldRetry(ctx, &http.Response{StatusCode: http.StatusBadGateway}, nil) ||
+		policy.ShouldRetry(ctx, &http.Response{StatusCode: http.StatusInternalServerError}, nil) ||
+		policy.ShouldRetry(ctx, nil, errors.New("timeout")) {
+		t.Error("default statuses must be retried, errors only if it is enabled")
+	}
+	policy.OnError, policy.Statuses = true, []int{http.StatusInternalServerError}
+	if !policy.ShouldRetry(ctx, nil, errors.New("timeout")) ||
+		!policy.ShouldRetry(ctx, &http.Response{StatusCode: http.StatusInternalServerError}, nil) {
+		t.Error("chosen statuses and errors must be retried")
+	}
+
+	for attempt, limits := range map[int][2]time.Duration{1: {50, 100}, 2: {100, 200}, 3: {150, 300}, 5: {150, 300}} {
+		delay := policy.Backoff(attempt, nil)
+		if delay < limits[0]*time.Millisecond || delay > limits[1]*time.Millisecond {
+			t.Errorf("delay of attempt %d is %s", attempt, delay)
+		}
+	}
+	response := &http.Response{Header: http.Header{"Retry-After": []string{"1"}}}
+	if delay := policy.Backoff(1, response); delay != 300*time.Millisecond {
+		t.Errorf("Retry-After must be limited by max delay, got %s", delay)
+	}
+	// collection retry without delay uses default delay instead of a millisecond
+	if delay := (RetryPolicy{Attempts: 3}).Backoff(1, nil); delay < 100*time.Millisecond || delay > 200*time.Millisecond {
+		t.Errorf("delay of policy without delay is %s", delay)
+	}
+}
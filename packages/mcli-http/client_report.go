@@ -0,0 +1,118 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// RequestReport is summary of collection run
+type RequestReport struct {
+	Name      string          `json:"name"`
+	Timestamp time.Time       `json:"timestamp"`
+	Total     int             `json:"total"`
+	Passed    int             `json:"passed"`
+	Failed    int             `json:"failed"`
+	Skipped   int             `json:"skipped"`
+	Duration  time.Duration   `json:"-"` // written as duration_ms
+	Results   []RequestResult `json:"results"`
+}
+
+// NewRequestReport counts results of run, requests without result are skipped
+func NewRequestReport(name string, results []RequestResult, total int) RequestReport {
+	report := RequestReport{Name: name, Timestamp: time.Now(), Total: total, Results: results,
+		Skipped: total - len(results)}
+	for _, result := range results {
+		if result.Failed() {
+			report.Failed++
+		} else {
+			report.Passed++
+		}
+		report.Duration += result.Duration
+	}
+	return report
+}
+
+// MarshalJSON writes duration of report in milliseconds as duration_ms
+func (report RequestReport) MarshalJSON() ([]byte, error) {
+	type plainReport RequestReport
+	return json.Marshal(struct {
+		plainReport
+		Duration float64 `json:"duration_ms"`
+	}{plainReport(report), durationMs(report.Duration)})
+}
+
+// durationMs returns duration in milliseconds with microsecond precision
+func durationMs(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// WriteJSON writes report as indented json
+func (report RequestReport) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Error     *junitFailure `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitTestSuite struct {
+	XMLName   xml.Name        `xml:"testsuite"`
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes report as JUnit XML testsuite: failed assertions are failures, request errors are errors
+func (report RequestReport) WriteJUnit(w io.Writer) error {
+	suite := junitTestSuite{Name: report.Name, Tests: report.Total, Skipped: report.Skipped,
+		Time: junitSeconds(report.Duration), Timestamp: report.Timestamp.Format("2006-01-02T15:04:05")}
+	for _, result := range report.Results {
+		testCase := junitTestCase{Name: result.Name, ClassName: report.Name, Time: junitSeconds(result.Duration),
+			SystemOut: fmt.Sprintf("%s %s -> %d", result.Method, result.URL, result.Status)}
+		if len(result.Error) > 0 {
+			testCase.Error = &junitFailure{Message: result.Error, Type: "error", Text: result.Error}
+			suite.Errors++
+		} else if len(result.Failures) > 0 {
+			testCase.Failure = &junitFailure{Message: result.Failures[0], Type: "assertion",
+				Text: strings.Join(result.Failures, "\n")}
+			suite.Failures++
+		}
+		suite.TestCases = append(suite.TestCases, testCase)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
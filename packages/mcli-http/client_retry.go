@@ -0,0 +1,81 @@
+package mclihttp
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy is retry of request with exponential backoff and jitter on chosen status codes or on errors
+type RetryPolicy struct {
+	// number of retries, request is not retried if it is 0
+	Attempts int `yaml:"attempts" json:"attempts,omitempty"`
+	// milliseconds before first retry, it is doubled for every next one, DefaultRetryDelay if it is 0
+	Delay int64 `yaml:"delay" json:"delay,omitempty"`
+	// milliseconds, limit of delay
+	MaxDelay int64 `yaml:"max-delay" json:"max-delay,omitempty"`
+	// status codes to retry, 429, 502, 503 and 504 if empty
+	Statuses []int `yaml:"statuses" json:"statuses,omitempty"`
+	// retry on errors of connection and timeouts
+	OnError bool `yaml:"on-error" json:"on-error,omitempty"`
+}
+
+// DefaultRetryDelay is delay before first retry in milliseconds when policy does not set it
+const DefaultRetryDelay int64 = 200
+
+var defaultRetryStatuses = []int{http.StatusTooManyRequests, http.StatusBadGateway,
+	http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+
+// ShouldRetry reports whether response or error of request is transient
+func (p RetryPolicy) ShouldRetry(ctx context.Context, response *http.Response, err error) bool {
+	if err != nil {
+		// canceled run is not retried
+		return p.OnError && ctx.Err() == nil && !errors.Is(err, context.Canceled)
+	}
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryStatuses
+	}
+	return slices.Contains(statuses, response.StatusCode)
+}
+
+// Backoff returns delay before retry with number attempt (from 1): delay * 2^(attempt-1) limited by max delay,
+// random half of it is jitter. Retry-After header of response in seconds is used if it is longer.
+func (p RetryPolicy) Backoff(attempt int, response *http.Response) time.Duration {
+	delay := time.Duration(p.Delay) * time.Millisecond
+	if delay <= 0 {
+		delay = time.Duration(DefaultRetryDelay) * time.Millisecond
+	}
+	maxDelay := time.Duration(p.MaxDelay) * time.Millisecond
+	if maxDelay <= 0 {
+		maxDelay = 30 * time.Second
+	}
+	for i := 1; i < attempt && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxDelay)
+	delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+
+	if response != nil {
+		if seconds, err := strconv.Atoi(response.Header.Get("Retry-After")); err == nil {
+			delay = max(delay, min(time.Duration(seconds)*time.Second, maxDelay))
+		}
+	}
+	return delay
+}
+
+// SleepContext waits for duration, it returns error of context if context is done before
+func SleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,115 @@
+package mclihttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ClientTLS are TLS settings of requests, certificates and keys are files or redis://[prefix:]key entries
+type ClientTLS struct {
+	// CA certificate to verify server certificates in addition to system ones
+	CACert string `yaml:"ca-cert"`
+	// client certificate and key of mTLS
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+	// server certificates are not verified
+	Insecure bool `yaml:"insecure"`
+	// sha256/<base64> pins of public keys, one of certificates of verified chain (leaf if insecure) must match
+	Pins []string `yaml:"pins"`
+}
+
+// SPKIPin returns sha256/<base64> pin of public key of certificate
+func SPKIPin(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// NewClientTLSConfig returns TLS config by PEM contents of CA certificate and client certificate and key,
+// empty contents are not used. Pins are checked even if verification of certificates is skipped.
+func NewClientTLSConfig(caPEM, certPEM, keyPEM []byte, insecure bool, pins []string) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: insecure}
+	if len(caPEM) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New("CA certificate has no PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+	if len(certPEM) > 0 || len(keyPEM) > 0 {
+		cert, err := tls.X509KeyPair(certPEM, keyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate error: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	if len(pins) > 0 {
+		for _, pin := range pins {
+			if !strings.HasPrefix(pin, "sha256/") {
+				return nil, fmt.Errorf("pin %s must be given as sha256/<base64>", pin)
+			}
+		}
+		config.VerifyConnection = func(state tls.ConnectionState) error {
+			if len(state.PeerCertificates) == 0 {
+				return errors.New("server has no certificates to check pins")
+			}
+			// certificates sent by server are trusted only if they are in verified chains,
+			// without verification only leaf certificate is pinned
+			candidates := state.PeerCertificates[:1]
+			if !insecure {
+				candidates = nil
+				for _, chain := range state.VerifiedChains {
+					candidates = append(candidates, chain...)
+				}
+			}
+			for _, cert := range candidates {
+				if slices.Contains(pins, SPKIPin(cert)) {
+					return nil
+				}
+			}
+			return fmt.Errorf("public key pin %s of %s does not match", SPKIPin(state.PeerCertificates[0]),
+				state.PeerCertificates[0].Subject.CommonName)
+		}
+	}
+	return config, nil
+}
+
+// WriteTLSSummary writes negotiated version, cipher suite and protocol and certificate chain of handshake,
+// every line starts with prefix
+func WriteTLSSummary(w io.Writer, prefix string, state *tls.ConnectionState) {
+	if state == nil {
+		return
+	}
+	fmt.Fprintf(w, "%sTLS %s, %s", prefix, strings.TrimPrefix(tls.VersionName(state.Version), "TLS "),
+		tls.CipherSuiteName(state.CipherSuite))
+	if len(state.NegotiatedProtocol) > 0 {
+		fmt.Fprintf(w, ", ALPN %s", state.NegotiatedProtocol)
+	}
+	fmt.Fprintln(w)
+	if len(state.ServerName) > 0 {
+		fmt.Fprintf(w, "%sserver name: %s, verified: %v\n", prefix, state.ServerName, len(state.VerifiedChains) > 0)
+	}
+	for i, cert := range state.PeerCertificates {
+		left := time.Until(cert.NotAfter)
+		expiry := fmt.Sprintf("expires %s (%d days)", cert.NotAfter.UTC().Format(time.DateOnly), int(left.Hours()/24))
+		if left <= 0 {
+			expiry = fmt.Sprintf("expired %s", cert.NotAfter.UTC().Format(time.DateOnly))
+		}
+		fmt.Fprintf(w, "%s%d subject: %s\n", prefix, i, cert.Subject)
+		fmt.Fprintf(w, "%s  issuer: %s\n", prefix, cert.Issuer)
+		fmt.Fprintf(w, "%s  %s, pin %s\n", prefix, expiry, SPKIPin(cert))
+		if len(cert.DNSNames) > 0 {
+			fmt.Fprintf(w, "%s  names: %s\n", prefix, strings.Join(cert.DNSNames, ", "))
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package mclihttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClientTLSConfig(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	// rejected handshakes are expected
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	pin := SPKIPin(server.Certificate())
+
+	cases := []struct {
+		name     string
+		ca       []byte
+		insecure bool
+		pins     []string
+		ok       bool
+	}{
+		{name: "unknown CA"},
+		{name: "CA", ca: caPEM, ok: true},
+		{name: "insecure", insecure: true, ok: true},
+		{name: "pin", ca: caPEM, pins: []string{"sha256/other=", pin}, ok: true},
+		{name: "wrong pin", ca: caPEM, pins: []string{"sha256/other="}},
+		{name: "insecure with wrong pin", insecure: true, pins: []string{"sha256/other="}},
+	}
+	for _, c := range cases {
+		tlsConfig, err := NewClientTLSConfig(c.ca, nil, nil, c.insecure, c.pins)
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if (err == nil) != c.ok {
+			t.Errorf("%s: unexpected result: %v", c.name, err)
+		}
+	}
+
+	if _, err := NewClientTLSConfig([]byte("not pem"), nil, nil, false, nil); err == nil {
+		t.Error("CA without certificates must fail")
+	}
+	if _, err := NewClientTLSConfig(nil, nil, nil, false, []string{"md5/x"}); err == nil ||
+		!strings.Contains(err.Error(), "sha256") {
+		t.Errorf("pin of unknown hash must fail: %v", err)
+	}
+}
+
+func TestClientTLSPinOfUnverifiedCertificate(t *testing.T) {
+	// certificate of trusted server is pinned
+	trusted := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	pinned := trusted.Certificate()
+	trusted.Close()
+
+	// server sends its own leaf and appends pinned certificate to chain
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "intruder"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour),
+		IPAddresses: []net.IP{net.ParseIP("127.0.0.1")}, KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, _ := x509.ParseCertificate(leaf)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf, pinned.Raw}, PrivateKey: key}}}
+	server.StartTLS()
+	defer server.Close()
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf})
+
+	cases := []struct {
+		name     string
+		ca       []byte
+		insecure bool
+		pin      string
+		ok       bool
+	}{
+		{name: "insecure with appended pin", insecure: true, pin: SPKIPin(pinned)},
+		{name: "verified with appended pin", ca: leafPEM, pin: SPKIPin(pinned)},
+		{name: "verified with leaf pin", ca: leafPEM, pin: SPKIPin(leafCert), ok: true},
+	}
+	for _, c := range cases {
+		tlsConfig, err := NewClientTLSConfig(c.ca, nil, nil, c.insecure, []string{c.pin})
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if (err == nil) != c.ok {
+			t.Errorf("%s: unexpected result: %v", c.name, err)
+		}
+	}
+}
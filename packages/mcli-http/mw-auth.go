@@ -2,6 +2,7 @@ package mclihttp
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"strings"
 	"time"
@@ -29,7 +30,7 @@ func NewAuth(userStore mcli_type.CredentialStorer, kvStore mcli_type.KVStorer, i
 
 func (auth *Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 
-	_, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router)
+	router, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router)
 	if !ok {
 		http.Error(res, "Status Unauthorized: No router in Context", http.StatusUnauthorized)
 		return
@@ -39,8 +40,9 @@ func (auth *Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	// fmt.Println("checking password")
 	// fmt.Println(r.CredentialStore.CheckPassword("admin", "userOk"))
 
+	st := router.State()
 	var ctx context.Context = req.Context()
-	cookie, err := auth.GetCookie(req, cookieName)
+	cookie, err := auth.GetCookie(req, st.cookieName)
 	// if no cookieName = "session-token" then sets noAuth in context
 	if len(cookie) == 0 || err != nil {
 		ctx = context.WithValue(ctx, go_common_ddru.ContextKey("IsAuth"), false)
@@ -50,7 +52,7 @@ func (auth *Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		// fmt.Printf("%s cookie in context of route %s: %s\n", cookieName, req.URL, cookie)
 
 		// getting user from kvStore
-		sessionPrefix := HttpConfig.Server.Auth.SessionsRedisPrefix
+		sessionPrefix := st.Config.Server.Auth.SessionsRedisPrefix
 		if sessionPrefix == "" {
 			sessionPrefix = "session-list"
 		}
@@ -84,21 +86,21 @@ func (auth *Auth) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 		// processing different cases with user state
 
 		if !user.Confirmed {
-			http.Redirect(res, req, HttpConfig.GetFullUrl(HttpConfig.Server.Auth.SignUpConfirmRoute),
+			http.Redirect(res, req, st.Config.GetFullUrl(st.Config.Server.Auth.SignUpConfirmRoute),
 				http.StatusTemporaryRedirect)
 			return
 		}
 
 		if user.Blocked {
 			// if user blocked - redirect to signup route
-			http.Redirect(res, req, HttpConfig.GetFullUrl(HttpConfig.Server.Auth.SignUpRoute),
+			http.Redirect(res, req, st.Config.GetFullUrl(st.Config.Server.Auth.SignUpRoute),
 				http.StatusTemporaryRedirect)
 			return
 		}
 
 		if user.Expired {
 			// if password has expired - redirect to change password route
-			http.Redirect(res, req, HttpConfig.GetFullUrl(HttpConfig.Server.Auth.SignInChangeRoute),
+			http.Redirect(res, req, st.Config.GetFullUrl(st.Config.Server.Auth.SignInChangeRoute),
 				http.StatusTemporaryRedirect)
 			return
 		}
@@ -125,7 +127,11 @@ func (auth *Auth) GetCookie(r *http.Request, cName string) (string, error) {
 	if auth.isEncCookie {
 		var value string
 
-		err = s.Decode(cookieName, cookie.Value, &value)
+		st := stateOf(r)
+		if st.secureCookie == nil {
+			return "", fmt.Errorf("keys of session cookie are not set")
+		}
+		err = st.secureCookie.Decode(cName, cookie.Value, &value)
 		return value, err
 	}
 	return cookie.Value, err
@@ -135,7 +141,7 @@ func (auth *Auth) SetCookie(w http.ResponseWriter, session *Session) error {
 	var cookieValueToStore = session.Token
 	var err error
 	if auth.isEncCookie {
-		cookieValueToStore, err = s.Encode(session.CookieName, session.Token)
+		cookieValueToStore, err = session.serverState().encodeCookie(session.CookieName, session.Token)
 	}
 	if err == nil {
 		cookie := &http.Cookie{
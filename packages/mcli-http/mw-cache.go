@@ -0,0 +1,561 @@
+package mclihttp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mcli_type "mcli/packages/mcli-type"
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"github.com/rs/zerolog"
+)
+
+// ResponseCacheConfig configures shared cache of GET responses
+type ResponseCacheConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// memory or kv
+	Storage    string `yaml:"storage"`
+	MaxEntries int    `yaml:"max-entries"`
+	// responses with larger bodies are not cached
+	MaxBodySize int64 `yaml:"max-body-size"`
+	// seconds, used for responses without Cache-Control max-age or Expires, 0 means such responses are not cached
+	DefaultTtl int `yaml:"default-ttl"`
+	// seconds stale responses with ETag or Last-Modified are kept for revalidation
+	KeepStale int    `yaml:"keep-stale"`
+	KVPrefix  string `yaml:"kv-prefix"`
+	// responses to authenticated requests are not shared by default
+	CacheAuthenticated bool `yaml:"cache-authenticated"`
+	// ttl in seconds overrides freshness given by response, negative ttl turns caching of route off
+	Routes []struct {
+		RouteMatch `yaml:",inline"`
+		Ttl        int `yaml:"ttl"`
+	} `yaml:"routes"`
+	// route of purge endpoint relative to base url, empty turns endpoint off
+	PurgeRoute string `yaml:"purge-route"`
+	// bearer token of purge endpoint
+	PurgeToken string `yaml:"purge-token"`
+	// role of users which may purge without token, endpoint is off without both token and role
+	PurgeRole string `yaml:"purge-role"`
+}
+
+// cachedResponse is stored representation of response
+type cachedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header"`
+	Body   []byte      `json:"body"`
+	// request header values the response varies by
+	Vary    map[string]string `json:"vary,omitempty"`
+	Stored  time.Time         `json:"stored"`
+	Expires time.Time         `json:"expires"`
+	// csp nonce which body was rendered with
+	Nonce string `json:"nonce,omitempty"`
+}
+
+func (cr *cachedResponse) isFresh(now time.Time) bool {
+	return now.Before(cr.Expires)
+}
+
+func (cr *cachedResponse) canRevalidate() bool {
+	return len(cr.Header.Get("ETag")) > 0 || len(cr.Header.Get("Last-Modified")) > 0
+}
+
+// ResponseCache middleware serves GET and HEAD requests from cache honoring Cache-Control, Vary and ETag,
+// stale responses are revalidated with conditional requests to inner handler
+type ResponseCache struct {
+	Inner    http.Handler
+	ErrorLog zerolog.Logger
+	config   ResponseCacheConfig
+	cache    mcli_type.Cacher
+	kvStore  mcli_type.KVStorer
+
+	// mu guards index and memory cache, kv store is accessed without lock
+	mu sync.Mutex
+	// cache key -> time entry may be removed, index of entries for purge
+	keys map[string]time.Time
+}
+
+// cacheRecorder passes response to client and keeps copy of it for cache,
+// response 304 to revalidation request made by cache is kept from client
+type cacheRecorder struct {
+	http.ResponseWriter
+	status       int
+	body         bytes.Buffer
+	maxBodySize  int64
+	tooLarge     bool
+	revalidating bool
+	swallowed    bool
+}
+
+func (rec *cacheRecorder) WriteHeader(code int) {
+	if rec.status != 0 {
+		return
+	}
+	rec.status = code
+	if rec.revalidating && code == http.StatusNotModified {
+		rec.swallowed = true
+		return
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *cacheRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	if rec.swallowed {
+		return len(b), nil
+	}
+	if !rec.tooLarge {
+		if int64(rec.body.Len()+len(b)) > rec.maxBodySize {
+			rec.tooLarge = true
+			rec.body.Reset()
+		} else {
+			rec.body.Write(b)
+		}
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *cacheRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok && !rec.swallowed {
+		flusher.Flush()
+	}
+}
+
+func (rec *cacheRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func NewResponseCache(config ResponseCacheConfig, kvStore mcli_type.KVStorer, outErrLog zerolog.Logger) (*ResponseCache, error) {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = 1000
+	}
+	if config.MaxBodySize <= 0 {
+		config.MaxBodySize = 1 << 20
+	}
+	if config.KeepStale <= 0 {
+		config.KeepStale = 3600
+	}
+	if len(config.KVPrefix) == 0 {
+		config.KVPrefix = "http-cache"
+	}
+	for i := range config.Routes {
+		if err := config.Routes[i].compile(); err != nil {
+			return nil, fmt.Errorf("cache route %s: %w", config.Routes[i].Pattern, err)
+		}
+	}
+	rc := &ResponseCache{ErrorLog: outErrLog, config: config, keys: make(map[string]time.Time)}
+	switch config.Storage {
+	case "", "memory":
+		// ccache ttl is number of milliseconds entries live after last store when cache is optimized
+		rc.cache = mcli_utils.NewCCache(time.Duration(config.KeepStale*1000), config.MaxEntries, nil, nil, nil)
+	case "kv":
+		if kvStore == nil {
+			return nil, fmt.Errorf("cache storage kv needs kv store")
+		}
+		rc.kvStore = kvStore
+	default:
+		return nil, fmt.Errorf("unknown cache storage %s", config.Storage)
+	}
+	return rc, nil
+}
+
+func (rc *ResponseCache) SetInnerHandler(next http.Handler) {
+	rc.Inner = next
+}
+
+// cacheControl parses Cache-Control header into directive -> value map
+func cacheControl(header http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if len(name) > 0 {
+				directives[strings.ToLower(name)] = strings.Trim(arg, `"`)
+			}
+		}
+	}
+	return directives
+}
+
+// routeTtl returns ttl override of route matching request
+func (rc *ResponseCache) routeTtl(req *http.Request) (int, bool) {
+	path := routerRelativePath(req)
+	for _, route := range rc.config.Routes {
+		if route.match(path) {
+			return route.Ttl, true
+		}
+	}
+	return 0, false
+}
+
+func (rc *ResponseCache) key(req *http.Request) string {
+	return req.Host + "|" + req.URL.RequestURI() + "|" + LocaleFromRequest(req)
+}
+
+// isCacheableRequest checks request method, authentication, cookies and directives of client
+func (rc *ResponseCache) isCacheableRequest(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	if !rc.config.CacheAuthenticated && (IsAuthRequest(req) || len(req.Header.Get("Authorization")) > 0) {
+		return false
+	}
+	// pages for client with session or csrf cookie may carry csrf token bound to the cookie
+	if len(csrfBinding(req)) > 0 {
+		return false
+	}
+	if ttl, ok := rc.routeTtl(req); ok && ttl < 0 {
+		return false
+	}
+	_, noStore := cacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+// freshness returns period response may be served from cache without revalidation
+// and reports whether response may be stored at all
+func (rc *ResponseCache) freshness(req *http.Request, status int, header http.Header) (time.Duration, bool) {
+	switch status {
+	case http.StatusOK, http.StatusNonAuthoritativeInfo, http.StatusMultipleChoices, http.StatusMovedPermanently,
+		http.StatusNotFound, http.StatusGone:
+	default:
+		return 0, false
+	}
+	if len(header.Values("Set-Cookie")) > 0 || slices.Contains(header.Values("Vary"), "*") {
+		return 0, false
+	}
+	directives := cacheControl(header)
+	if _, ok := directives["no-store"]; ok {
+		return 0, false
+	}
+	if _, ok := directives["private"]; ok {
+		return 0, false
+	}
+	validators := len(header.Get("ETag")) > 0 || len(header.Get("Last-Modified")) > 0
+	if _, ok := directives["no-cache"]; ok {
+		return 0, validators
+	}
+	if ttl, ok := rc.routeTtl(req); ok && ttl > 0 {
+		return time.Duration(ttl) * time.Second, true
+	}
+	for _, name := range []string{"s-maxage", "max-age"} {
+		if value, ok := directives[name]; ok {
+			seconds, err := strconv.Atoi(value)
+			if err != nil || seconds <= 0 {
+				return 0, validators
+			}
+			return time.Duration(seconds) * time.Second, true
+		}
+	}
+	if expires := header.Get("Expires"); len(expires) > 0 {
+		expiresTime, err := http.ParseTime(expires)
+		if err != nil || !expiresTime.After(time.Now()) {
+			return 0, validators
+		}
+		return time.Until(expiresTime), true
+	}
+	if rc.config.DefaultTtl > 0 {
+		return time.Duration(rc.config.DefaultTtl) * time.Second, true
+	}
+	return 0, validators
+}
+
+// varyNames returns canonical names of request headers response varies by
+func varyNames(header http.Header) []string {
+	names := make([]string, 0)
+	for _, value := range header.Values("Vary") {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); len(name) > 0 {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	return names
+}
+
+func (rc *ResponseCache) load(key string) []*cachedResponse {
+	if rc.kvStore != nil {
+		raw, err, ok := rc.kvStore.GetRecord(key, rc.config.KVPrefix)
+		if err != nil || !ok {
+			return nil
+		}
+		var variants []*cachedResponse
+		if err := rc.kvStore.GetUnMarshal()(raw, &variants); err != nil {
+			return nil
+		}
+		return variants
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	value, err := rc.cache.Get(key)
+	if err != nil {
+		return nil
+	}
+	variants, _ := value.([]*cachedResponse)
+	return variants
+}
+
+func (rc *ResponseCache) store(key string, variants []*cachedResponse, keepUntil time.Time) {
+	rc.mu.Lock()
+	rc.keys[key] = keepUntil
+	if rc.kvStore != nil {
+		rc.mu.Unlock()
+		if err := rc.kvStore.SetRecordEx(key, variants, int(time.Until(keepUntil).Seconds())+1, rc.config.KVPrefix); err != nil {
+			rc.ErrorLog.Error().Msgf("response for %s is not cached: %v", key, err)
+		}
+		return
+	}
+	defer rc.mu.Unlock()
+	rc.cache.Set(key, nil, 0, variants)
+	// index of memory cache must not outgrow cache bounded by max entries
+	if len(rc.keys) > 2*rc.config.MaxEntries {
+		now := time.Now()
+		for k, until := range rc.keys {
+			if _, err := rc.cache.Get(k); err != nil || now.After(until) {
+				delete(rc.keys, k)
+			}
+		}
+	}
+}
+
+func (rc *ResponseCache) remove(key string) {
+	rc.mu.Lock()
+	delete(rc.keys, key)
+	if rc.kvStore != nil {
+		rc.mu.Unlock()
+		rc.kvStore.RemoveRecord(key, rc.config.KVPrefix)
+		return
+	}
+	defer rc.mu.Unlock()
+	rc.cache.Remove(key)
+}
+
+// lookup returns variant matching vary headers of request
+func (rc *ResponseCache) lookup(key string, req *http.Request) *cachedResponse {
+	for _, variant := range rc.load(key) {
+		matched := true
+		for name, value := range variant.Vary {
+			if strings.Join(req.Header.Values(name), ", ") != value {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return variant
+		}
+	}
+	return nil
+}
+
+// save replaces variant with the same vary values and drops variants which are too old to revalidate,
+// variant saved concurrently for the same key may be lost, it is cached again by next request
+func (rc *ResponseCache) save(key string, entry *cachedResponse) {
+	now := time.Now()
+	keepFor := time.Duration(rc.config.KeepStale) * time.Second
+	keep := func(v *cachedResponse) time.Time {
+		if v.canRevalidate() {
+			return v.Expires.Add(keepFor)
+		}
+		return v.Expires
+	}
+	variants := []*cachedResponse{entry}
+	keepUntil := keep(entry)
+	for _, variant := range rc.load(key) {
+		if fmt.Sprint(variant.Vary) == fmt.Sprint(entry.Vary) || now.After(keep(variant)) {
+			continue
+		}
+		variants = append(variants, variant)
+		if until := keep(variant); until.After(keepUntil) {
+			keepUntil = until
+		}
+	}
+	rc.store(key, variants, keepUntil)
+}
+
+// Purge removes cached responses which paths start with prefix, empty prefix removes all, returns number of removed keys
+func (rc *ResponseCache) Purge(pathPrefix string) int {
+	rc.mu.Lock()
+	keys := make([]string, 0, len(rc.keys))
+	indexed := make(map[string]bool, len(rc.keys))
+	for key := range rc.keys {
+		keys = append(keys, key)
+		indexed[key] = true
+	}
+	rc.mu.Unlock()
+	if rc.kvStore != nil {
+		// entries stored by previous runs of server are not in index
+		if records, err := rc.kvStore.GetRecords("*", rc.config.KVPrefix); err == nil {
+			for key := range records {
+				key = strings.TrimPrefix(key, rc.config.KVPrefix+":")
+				if !indexed[key] {
+					keys = append(keys, key)
+				}
+			}
+		}
+	}
+	purged := 0
+	for _, key := range keys {
+		_, rest, _ := strings.Cut(key, "|")
+		if strings.HasPrefix(rest, pathPrefix) {
+			rc.remove(key)
+			purged++
+		}
+	}
+	return purged
+}
+
+// serve writes cached response, nonce of cached body is replaced with nonce of current request
+func (rc *ResponseCache) serve(res http.ResponseWriter, req *http.Request, entry *cachedResponse, state string) {
+	for name, values := range entry.Header {
+		res.Header()[name] = slices.Clone(values)
+	}
+	res.Header().Set("Age", strconv.Itoa(int(time.Since(entry.Stored).Seconds())))
+	res.Header().Set("X-Cache", state)
+
+	etag := entry.Header.Get("ETag")
+	if match := req.Header.Get("If-None-Match"); len(etag) > 0 && len(match) > 0 &&
+		(match == "*" || slices.Contains(strings.Split(strings.ReplaceAll(match, " ", ""), ","), etag)) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+	body := entry.Body
+	if nonce := CSPNonce(req); len(entry.Nonce) > 0 && len(nonce) > 0 {
+		body = bytes.ReplaceAll(body, []byte(entry.Nonce), []byte(nonce))
+	}
+	res.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	res.WriteHeader(entry.Status)
+	if req.Method != http.MethodHead {
+		res.Write(body)
+	}
+}
+
+func (rc *ResponseCache) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	if !rc.isCacheableRequest(req) {
+		if req.Method == http.MethodGet || req.Method == http.MethodHead {
+			res.Header().Set("X-Cache", "BYPASS")
+			rc.Inner.ServeHTTP(res, req)
+			return
+		}
+		// successful unsafe request invalidates cached responses of its url
+		rec := &statusRecorder{ResponseWriter: res}
+		rc.Inner.ServeHTTP(rec, req)
+		if req.Method != http.MethodOptions && rec.status < http.StatusBadRequest {
+			rc.remove(rc.key(req))
+		}
+		return
+	}
+
+	key := rc.key(req)
+	entry := rc.lookup(key, req)
+	_, noCache := cacheControl(req.Header)["no-cache"]
+	if entry != nil && entry.isFresh(time.Now()) && !noCache {
+		rc.serve(res, req, entry, "HIT")
+		return
+	}
+
+	// headers set by outer middlewares are not part of cached response
+	outerHeader := res.Header().Clone()
+	rec := &cacheRecorder{ResponseWriter: res, maxBodySize: rc.config.MaxBodySize}
+	innerReq := req
+	if entry != nil && entry.canRevalidate() &&
+		len(req.Header.Get("If-None-Match")) == 0 && len(req.Header.Get("If-Modified-Since")) == 0 {
+		innerReq = req.Clone(req.Context())
+		if etag := entry.Header.Get("ETag"); len(etag) > 0 {
+			innerReq.Header.Set("If-None-Match", etag)
+		}
+		if lastModified := entry.Header.Get("Last-Modified"); len(lastModified) > 0 {
+			innerReq.Header.Set("If-Modified-Since", lastModified)
+		}
+		rec.revalidating = true
+	}
+	res.Header().Set("X-Cache", "MISS")
+	rc.Inner.ServeHTTP(rec, innerReq)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if rec.swallowed {
+		// not modified: cached response is refreshed with new freshness and validators
+		refreshed := *entry
+		refreshed.Header = entry.Header.Clone()
+		for _, name := range []string{"Cache-Control", "Expires", "ETag", "Last-Modified", "Date"} {
+			if value := res.Header().Get(name); len(value) > 0 {
+				refreshed.Header.Set(name, value)
+			}
+		}
+		ttl, _ := rc.freshness(req, entry.Status, refreshed.Header)
+		refreshed.Stored = time.Now()
+		refreshed.Expires = refreshed.Stored.Add(ttl)
+		rc.save(key, &refreshed)
+		rc.serve(res, req, &refreshed, "REVALIDATED")
+		return
+	}
+
+	if req.Method == http.MethodHead || rec.tooLarge {
+		return
+	}
+	ttl, ok := rc.freshness(req, rec.status, res.Header())
+	if !ok {
+		return
+	}
+	header := res.Header().Clone()
+	for name, values := range outerHeader {
+		if slices.Equal(header[name], values) {
+			delete(header, name)
+		}
+	}
+	for _, name := range []string{"X-Cache", "Content-Length", "Connection", "Keep-Alive", "Transfer-Encoding", "Age"} {
+		header.Del(name)
+	}
+	if len(header.Get("ETag")) == 0 {
+		sum := sha1.Sum(rec.body.Bytes())
+		header.Set("ETag", `W/"`+hex.EncodeToString(sum[:8])+`"`)
+	}
+	entry = &cachedResponse{Status: rec.status, Header: header, Body: slices.Clone(rec.body.Bytes()),
+		Vary: make(map[string]string), Stored: time.Now(), Nonce: CSPNonce(req)}
+	entry.Expires = entry.Stored.Add(ttl)
+	for _, name := range varyNames(header) {
+		entry.Vary[name] = strings.Join(req.Header.Values(name), ", ")
+	}
+	rc.save(key, entry)
+}
+
+// PurgeHandler removes cached responses: POST purge-route?path=/prefix. It is allowed with purge token
+// or for users with purge role, handler is not returned when neither of them is configured.
+func (rc *ResponseCache) PurgeHandler() (HandlerFunc, error) {
+	if len(rc.config.PurgeToken) == 0 && len(rc.config.PurgeRole) == 0 {
+		return nil, fmt.Errorf("purge of cache needs purge token or purge role")
+	}
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			res.Header().Set("Allow", http.MethodPost)
+			HttpErrorLocalized(res, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+		if !rc.isPurgeAllowed(req) {
+			HttpErrorLocalized(res, req, http.StatusForbidden, "")
+			return
+		}
+		purged := rc.Purge(req.URL.Query().Get("path"))
+		RenderJSON(res, map[string]int{"purged": purged}, false)
+	}, nil
+}
+
+func (rc *ResponseCache) isPurgeAllowed(req *http.Request) bool {
+	if token := rc.config.PurgeToken; len(token) > 0 {
+		given, found := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if found && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1 {
+			return true
+		}
+	}
+	return len(rc.config.PurgeRole) > 0 && tmplHasRole(req, rc.config.PurgeRole)
+}
@@ -0,0 +1,166 @@
+package mclihttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+func TestResponseCache(t *testing.T) {
+	config := ResponseCacheConfig{Enabled: true, PurgeToken: "secret"}
+	config.Routes = append(config.Routes, struct {
+		RouteMatch `yaml:",inline"`
+		Ttl        int `yaml:"ttl"`
+	}{RouteMatch{Pattern: "/private/", Match: "prefix"}, -1})
+	rc, err := NewResponseCache(config, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	innerCalls := 0
+	maxAge := "max-age=60"
+	rc.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		innerCalls++
+		res.Header().Set("ETag", `"v1"`)
+		res.Header().Set("Cache-Control", maxAge)
+		res.Header().Set("Vary", "Accept-Language")
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		res.Write([]byte("body " + req.Header.Get("Accept-Language")))
+	}))
+	serve := func(method, path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		res := httptest.NewRecorder()
+		rc.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en"})
+	if res.Header().Get("X-Cache") != "MISS" || innerCalls != 1 || res.Body.String() != "body en" {
+		t.Fatalf("first request must miss: %v %q", res.Header(), res.Body.String())
+	}
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en"})
+	if res.Header().Get("X-Cache") != "HIT" || innerCalls != 1 || res.Body.String() != "body en" {
+		t.Fatalf("second request must hit: %v %q", res.Header(), res.Body.String())
+	}
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en", "If-None-Match": `"v1"`})
+	if res.Code != http.StatusNotModified || innerCalls != 1 {
+		t.Errorf("conditional request must be answered from cache with 304, got %d", res.Code)
+	}
+
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "ru"})
+	if res.Header().Get("X-Cache") != "MISS" || res.Body.String() != "body ru" {
+		t.Errorf("other vary value must miss: %v %q", res.Header(), res.Body.String())
+	}
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en"})
+	if res.Header().Get("X-Cache") != "HIT" || res.Body.String() != "body en" {
+		t.Errorf("variants must be kept side by side: %v %q", res.Header(), res.Body.String())
+	}
+
+	maxAge = "no-cache"
+	calls := innerCalls
+	serve(http.MethodGet, "/stale", nil)
+	res = serve(http.MethodGet, "/stale", nil)
+	if res.Header().Get("X-Cache") != "REVALIDATED" || res.Code != http.StatusOK || res.Body.String() != "body " ||
+		innerCalls != calls+2 {
+		t.Errorf("no-cache response must be revalidated: %d %v %q", res.Code, res.Header(), res.Body.String())
+	}
+	maxAge = "max-age=60"
+
+	calls = innerCalls
+	serve(http.MethodGet, "/page", map[string]string{"Authorization": "Bearer x"})
+	res = serve(http.MethodGet, "/private/data", nil)
+	if res.Header().Get("X-Cache") != "BYPASS" || innerCalls != calls+2 {
+		t.Errorf("authenticated requests and routes with negative ttl must bypass cache: %v", res.Header())
+	}
+
+	for _, cookie := range []string{CurrentServerState().cookieName + "=session", csrfCookieName + "=client"} {
+		calls = innerCalls
+		res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en", "Cookie": cookie})
+		if res.Header().Get("X-Cache") != "BYPASS" || innerCalls != calls+1 {
+			t.Errorf("request with cookie %s must bypass cache: %v", cookie, res.Header())
+		}
+	}
+
+	serve(http.MethodPost, "/page", nil)
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en"})
+	if res.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("unsafe request must invalidate cached url: %v", res.Header())
+	}
+
+	purge := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/cache/purge?path=/page", nil)
+		req.RemoteAddr = "127.0.0.1:40000"
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		res := httptest.NewRecorder()
+		purgeHandler, err := rc.PurgeHandler()
+		if err != nil {
+			t.Fatal(err)
+		}
+		purgeHandler(res, req)
+		return res
+	}
+	if res := purge("wrong"); res.Code != http.StatusForbidden {
+		t.Errorf("purge with wrong token must be forbidden, got %d", res.Code)
+	}
+	if res := purge(""); res.Code != http.StatusForbidden {
+		t.Errorf("purge of local client without token must be forbidden, got %d", res.Code)
+	}
+	if res := purge("secret"); res.Code != http.StatusOK || res.Body.String() != `{"purged":1}` {
+		t.Errorf("unexpected purge response: %d %q", res.Code, res.Body.String())
+	}
+	res = serve(http.MethodGet, "/page", map[string]string{"Accept-Language": "en"})
+	if res.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("purged response must not be served: %v", res.Header())
+	}
+}
+
+func TestResponseCachePurgeAccess(t *testing.T) {
+	rc, err := NewResponseCache(ResponseCacheConfig{Enabled: true}, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rc.PurgeHandler(); err == nil {
+		t.Error("purge handler without token and role must not be returned")
+	}
+
+	rc, err = NewResponseCache(ResponseCacheConfig{Enabled: true, PurgeRole: "admin"}, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	purgeHandler, err := rc.PurgeHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	purge := func(roles ...string) int {
+		req := httptest.NewRequest(http.MethodPost, "/cache/purge", nil)
+		req.RemoteAddr = "127.0.0.1:40000"
+		if len(roles) > 0 {
+			user := &Credential{Username: "test", Roles: roles}
+			req = req.WithContext(context.WithValue(req.Context(), go_common_ddru.ContextKey("AuthUser"), user))
+		}
+		res := httptest.NewRecorder()
+		purgeHandler(res, req)
+		return res.Code
+	}
+	if code := purge(); code != http.StatusForbidden {
+		t.Errorf("purge of anonymous local client must be forbidden, got %d", code)
+	}
+	if code := purge("editor"); code != http.StatusForbidden {
+		t.Errorf("purge of user without role must be forbidden, got %d", code)
+	}
+	if code := purge("admin"); code != http.StatusOK {
+		t.Errorf("purge of user with role must be allowed, got %d", code)
+	}
+}
@@ -2,22 +2,43 @@ package mclihttp
 
 import (
 	"encoding/json"
-	"io"
+	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/rs/zerolog"
-	// "github.com/rs/zerolog/pkgerrors"
 )
 
-// CORSConfig represents the CORS configuration read from the file
-type CORS struct {
-	InfoLog        zerolog.Logger
-	ErrorLog       zerolog.Logger
-	corsFilepath   string
-	AllowedDomains map[string]AllowedMethods `json:"allowed_domains"`
-	Inner          http.Handler
+// CORSPolicy describes which cross-origin requests are allowed.
+// Origins may be exact ("https://example.com"), wildcard "*",
+// subdomain patterns ("https://*.example.com") or any port patterns ("http://localhost:*").
+type CORSPolicy struct {
+	AllowedOrigins   []string `json:"allowed_origins" yaml:"allowed-origins"`
+	AllowedMethods   []string `json:"allowed_methods" yaml:"allowed-methods"`
+	AllowedHeaders   []string `json:"allowed_headers" yaml:"allowed-headers"`
+	ExposedHeaders   []string `json:"exposed_headers" yaml:"exposed-headers"`
+	AllowCredentials bool     `json:"allow_credentials" yaml:"allow-credentials"`
+	// seconds browser may cache preflight response
+	MaxAge int `json:"max_age" yaml:"max-age"`
+}
+
+// CORSRoutePolicy is policy for routes matching pattern, pattern is relative to base url of router.
+// Empty lists and max age are inherited from default policy.
+type CORSRoutePolicy struct {
+	RouteMatch `yaml:",inline"`
+	CORSPolicy `yaml:",inline"`
+}
+
+// CORSConfig represents the CORS configuration read from cors file or main config
+type CORSConfig struct {
+	Default CORSPolicy        `json:"default" yaml:"default"`
+	Routes  []CORSRoutePolicy `json:"routes" yaml:"routes"`
+	// legacy format: origin -> methods
+	AllowedDomains map[string]AllowedMethods `json:"allowed_domains" yaml:"-"`
 }
 
 // AllowedMethods represents the allowed methods for a specific domain
@@ -25,6 +46,22 @@ type AllowedMethods struct {
 	Methods []string `json:"methods"`
 }
 
+// CORS middleware answers preflight requests itself and adds CORS headers to responses for allowed origins
+type CORS struct {
+	InfoLog      zerolog.Logger
+	ErrorLog     zerolog.Logger
+	corsFilepath string
+	Config       CORSConfig
+	Inner        http.Handler
+}
+
+// defaultCORSPolicy allows no origins, cross-origin requests must be allowed explicitly
+var defaultCORSPolicy = CORSPolicy{
+	AllowedMethods: []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete},
+	AllowedHeaders: []string{"Content-Type", "Authorization"},
+}
+
 func NewCORS(outILog zerolog.Logger, outErrLog zerolog.Logger, corsFilepath string) *CORS {
 	cors := CORS{InfoLog: outILog, ErrorLog: outErrLog, corsFilepath: corsFilepath}
 
@@ -37,29 +74,55 @@ func NewCORS(outILog zerolog.Logger, outErrLog zerolog.Logger, corsFilepath stri
 	return &cors
 }
 
+// NewCORSWithConfig creates middleware from config section of main config file
+func NewCORSWithConfig(outILog zerolog.Logger, outErrLog zerolog.Logger, config CORSConfig) (*CORS, error) {
+	cors := CORS{InfoLog: outILog, ErrorLog: outErrLog}
+	if err := cors.SetConfig(config); err != nil {
+		return nil, err
+	}
+	return &cors, nil
+}
+
 func (cors *CORS) ServeHTTP(res http.ResponseWriter, req *http.Request) {
-	// Handle preflight requests
-	if req.Method == http.MethodOptions {
+	origin := req.Header.Get("Origin")
+	// responses differ by origin, caches must not mix them up
+	res.Header().Add("Vary", "Origin")
+	if len(origin) == 0 {
 		cors.Inner.ServeHTTP(res, req)
+		return
 	}
-	origin := req.Header.Get("Origin")
 	cors.InfoLog.Trace().Msgf("cors check. origin = %v", origin)
+	policy := cors.policyFor(req)
+	allowed := policy.isAllowedOrigin(origin)
 
-	if _, ok := cors.AllowedDomains["*"]; ok || len(origin) == 0 || origin == "localhost" {
-		res.Header().Set("Access-Control-Allow-Origin", "*")
-		res.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE")
-		res.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-	} else {
-		if methods, ok := cors.AllowedDomains[origin]; ok {
-			// Set CORS headers for the allowed domain and methods
-			res.Header().Set("Access-Control-Allow-Origin", origin)
-			res.Header().Set("Access-Control-Allow-Methods", strings.Join(methods.Methods, ","))
-			res.Header().Set("Access-Control-Allow-Headers", "Content-Type")
-
-		} else {
-			// Deny CORS for all other domains
+	// preflight requests are answered here and never reach handlers
+	if requestMethod := req.Header.Get("Access-Control-Request-Method"); req.Method == http.MethodOptions &&
+		len(requestMethod) > 0 {
+		res.Header().Add("Vary", "Access-Control-Request-Method")
+		res.Header().Add("Vary", "Access-Control-Request-Headers")
+		requestHeaders := parseHeaderList(req.Header.Get("Access-Control-Request-Headers"))
+		if !allowed || !policy.isAllowedMethod(requestMethod) || !policy.areAllowedHeaders(requestHeaders) {
+			cors.InfoLog.Trace().Msgf("cors preflight from %s for %s %v is denied", origin, requestMethod, requestHeaders)
 			res.WriteHeader(http.StatusForbidden)
-			res.Write([]byte("Forbidden - CORS not allowed for this domain"))
+			return
+		}
+		policy.setOriginHeaders(res, origin)
+		res.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+		if len(requestHeaders) > 0 {
+			res.Header().Set("Access-Control-Allow-Headers", strings.Join(requestHeaders, ", "))
+		}
+		if policy.MaxAge > 0 {
+			res.Header().Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// browser blocks responses without CORS headers, same-origin requests with Origin header still work
+	if allowed {
+		policy.setOriginHeaders(res, origin)
+		if len(policy.ExposedHeaders) > 0 {
+			res.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
 		}
 	}
 	cors.Inner.ServeHTTP(res, req)
@@ -69,43 +132,182 @@ func (cors *CORS) SetInnerHandler(next http.Handler) {
 	cors.Inner = next
 }
 
-func (cors *CORS) LoadCORSConfig(filepath string) error {
-	var reader io.Reader
-	var err error
-	if filepath == "" && cors.corsFilepath == "" {
-		defaultCORS := `
-		{
-			"allowed_domains": {
-				"*": {
-					"methods": [
-						"GET",
-						"POST",
-						"OPTIONS",
-						"PUT",
-						"DELETE"
-					]
+// policyFor returns policy of first route matching request path or default policy
+func (cors *CORS) policyFor(req *http.Request) CORSPolicy {
+	path := routerRelativePath(req)
+	for _, route := range cors.Config.Routes {
+		if route.match(path) {
+			return route.CORSPolicy
+		}
+	}
+	return cors.Config.Default
+}
+
+func (policy *CORSPolicy) isAllowedOrigin(origin string) bool {
+	for _, pattern := range policy.AllowedOrigins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *CORSPolicy) isAllowedMethod(method string) bool {
+	return slices.ContainsFunc(policy.AllowedMethods, func(allowed string) bool {
+		return strings.EqualFold(allowed, method)
+	})
+}
+
+func (policy *CORSPolicy) areAllowedHeaders(headers []string) bool {
+	if slices.Contains(policy.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range headers {
+		if !slices.ContainsFunc(policy.AllowedHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, header)
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// setOriginHeaders sets allowed origin, wildcard is not allowed by browsers for requests with credentials
+func (policy *CORSPolicy) setOriginHeaders(res http.ResponseWriter, origin string) {
+	if slices.Contains(policy.AllowedOrigins, "*") && !policy.AllowCredentials {
+		res.Header().Set("Access-Control-Allow-Origin", "*")
+	} else {
+		res.Header().Set("Access-Control-Allow-Origin", origin)
+	}
+	if policy.AllowCredentials {
+		res.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// matchOrigin checks origin against pattern: "*", exact origin, "https://*.example.com",
+// "*.example.com" for any scheme or "http://localhost:*" for any port
+func matchOrigin(pattern, origin string) bool {
+	pattern = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(pattern), "/"))
+	origin = strings.ToLower(origin)
+	if pattern == "*" || pattern == origin {
+		return true
+	}
+	originUrl, err := url.Parse(origin)
+	if err != nil || len(originUrl.Scheme) == 0 || len(originUrl.Host) == 0 {
+		return false
+	}
+	scheme, host, found := strings.Cut(pattern, "://")
+	if !found {
+		scheme, host = originUrl.Scheme, pattern
+	}
+	if scheme != originUrl.Scheme {
+		return false
+	}
+	originHost := originUrl.Host
+	if hostname, found := strings.CutSuffix(host, ":*"); found {
+		host, originHost = hostname, originUrl.Hostname()
+	}
+	if suffix, found := strings.CutPrefix(host, "*."); found {
+		return strings.HasSuffix(originHost, "."+suffix)
+	}
+	return host == originHost
+}
+
+// parseHeaderList splits comma separated header names
+func parseHeaderList(value string) []string {
+	headers := make([]string, 0)
+	for _, header := range strings.Split(value, ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 {
+			headers = append(headers, http.CanonicalHeaderKey(header))
+		}
+	}
+	return headers
+}
+
+// SetConfig validates config, converts legacy allowed_domains and applies defaults
+func (cors *CORS) SetConfig(config CORSConfig) error {
+	if len(config.AllowedDomains) > 0 && len(config.Default.AllowedOrigins) == 0 {
+		for origin, methods := range config.AllowedDomains {
+			config.Default.AllowedOrigins = append(config.Default.AllowedOrigins, origin)
+			for _, method := range methods.Methods {
+				if !slices.Contains(config.Default.AllowedMethods, method) {
+					config.Default.AllowedMethods = append(config.Default.AllowedMethods, method)
 				}
 			}
-		}`
-		reader = strings.NewReader(defaultCORS)
-	} else {
-		if filepath == "" && cors.corsFilepath != "" {
-			filepath = cors.corsFilepath
 		}
-		file, err := os.Open(filepath)
-		if err != nil {
-			return err
+		slices.Sort(config.Default.AllowedOrigins)
+	}
+	config.Default = config.Default.inherit(defaultCORSPolicy)
+	if err := config.Default.validate(); err != nil {
+		return fmt.Errorf("cors default policy: %w", err)
+	}
+
+	routes := make([]CORSRoutePolicy, 0, len(config.Routes))
+	for _, route := range config.Routes {
+		if err := route.compile(); err != nil {
+			return fmt.Errorf("cors route %s: %w", route.Pattern, err)
+		}
+		route.CORSPolicy = route.CORSPolicy.inherit(config.Default)
+		if err := route.CORSPolicy.validate(); err != nil {
+			return fmt.Errorf("cors route %s: %w", route.Pattern, err)
 		}
-		defer file.Close()
-		reader = file
+		routes = append(routes, route)
 	}
+	config.Routes = routes
 
-	var config CORS
-	decoder := json.NewDecoder(reader)
-	err = decoder.Decode(&config)
+	cors.Config = config
+	return nil
+}
+
+// validate rejects policy which lets any origin make requests with credentials
+func (policy CORSPolicy) validate() error {
+	if policy.AllowCredentials && slices.Contains(policy.AllowedOrigins, "*") {
+		return fmt.Errorf("allow_credentials can not be used with \"*\" origin, list allowed origins")
+	}
+	return nil
+}
+
+// inherit fills empty fields of policy from parent
+func (policy CORSPolicy) inherit(parent CORSPolicy) CORSPolicy {
+	methods := make([]string, 0, len(policy.AllowedMethods))
+	for _, method := range policy.AllowedMethods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	policy.AllowedMethods = methods
+	if len(policy.AllowedOrigins) == 0 {
+		policy.AllowedOrigins = parent.AllowedOrigins
+	}
+	if len(policy.AllowedMethods) == 0 {
+		policy.AllowedMethods = parent.AllowedMethods
+	}
+	if len(policy.AllowedHeaders) == 0 {
+		policy.AllowedHeaders = parent.AllowedHeaders
+	}
+	if len(policy.ExposedHeaders) == 0 {
+		policy.ExposedHeaders = parent.ExposedHeaders
+	}
+	if policy.MaxAge == 0 {
+		policy.MaxAge = parent.MaxAge
+	}
+	return policy
+}
+
+func (cors *CORS) LoadCORSConfig(filepath string) error {
+	if filepath == "" {
+		filepath = cors.corsFilepath
+	}
+	if filepath == "" {
+		return cors.SetConfig(CORSConfig{})
+	}
+	file, err := os.Open(filepath)
 	if err != nil {
 		return err
 	}
-	cors.AllowedDomains = config.AllowedDomains
-	return nil
+	defer file.Close()
+
+	var config CORSConfig
+	if err := json.NewDecoder(file).Decode(&config); err != nil {
+		return err
+	}
+	return cors.SetConfig(config)
 }
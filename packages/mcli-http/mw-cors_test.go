@@ -0,0 +1,131 @@
+package mclihttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern, origin string
+		want            bool
+	}{
+		{"*", "https://example.com", true},
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com/", "https://Example.com", true},
+		{"https://example.com", "http://example.com", false},
+		{"https://*.example.com", "https://api.example.com", true},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"*.example.com", "http://a.b.example.com", true},
+		{"http://localhost:*", "http://localhost:3000", true},
+		{"http://localhost:*", "http://localhost", true},
+		{"http://localhost", "http://localhost:3000", false},
+		{"https://example.com", "null", false},
+	}
+	for _, test := range tests {
+		if got := matchOrigin(test.pattern, test.origin); got != test.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", test.pattern, test.origin, got, test.want)
+		}
+	}
+}
+
+func TestCORS(t *testing.T) {
+	cors, err := NewCORSWithConfig(zerolog.Nop(), zerolog.Nop(), CORSConfig{
+		Default: CORSPolicy{AllowedOrigins: []string{"https://*.example.com"}, AllowedMethods: []string{"get", "post"},
+			ExposedHeaders: []string{"X-Total"}, AllowCredentials: true, MaxAge: 600},
+		Routes: []CORSRoutePolicy{{RouteMatch: RouteMatch{Pattern: "/public/", Match: "prefix"},
+			CORSPolicy: CORSPolicy{AllowedOrigins: []string{"*"}}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	innerCalls := 0
+	cors.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		innerCalls++
+		res.Write([]byte("ok"))
+	}))
+	serve := func(method, path, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if len(origin) > 0 {
+			req.Header.Set("Origin", origin)
+		}
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		res := httptest.NewRecorder()
+		cors.ServeHTTP(res, req)
+		return res
+	}
+
+	res := serve(http.MethodOptions, "/api", "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method": "POST", "Access-Control-Request-Headers": "content-type"})
+	if res.Code != http.StatusNoContent || innerCalls != 0 {
+		t.Fatalf("preflight must be answered by middleware, got %d and %d inner calls", res.Code, innerCalls)
+	}
+	if got := res.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" {
+		t.Errorf("origin must be echoed for credentials, got %q", got)
+	}
+	if res.Header().Get("Access-Control-Allow-Credentials") != "true" || res.Header().Get("Access-Control-Max-Age") != "600" ||
+		res.Header().Get("Access-Control-Allow-Headers") != "Content-Type" {
+		t.Errorf("unexpected preflight headers: %v", res.Header())
+	}
+
+	res = serve(http.MethodOptions, "/api", "https://app.example.com", map[string]string{
+		"Access-Control-Request-Method": "DELETE"})
+	if res.Code != http.StatusForbidden || innerCalls != 0 {
+		t.Errorf("preflight with not allowed method must be denied, got %d", res.Code)
+	}
+
+	res = serve(http.MethodGet, "/api", "https://other.org", nil)
+	if res.Code != http.StatusOK || innerCalls != 1 || len(res.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("not allowed origin must get response without cors headers, got %d %v", res.Code, res.Header())
+	}
+	if res.Header().Get("Vary") != "Origin" {
+		t.Errorf("vary header is not set: %v", res.Header())
+	}
+
+	res = serve(http.MethodGet, "/api", "https://app.example.com", nil)
+	if res.Header().Get("Access-Control-Expose-Headers") != "X-Total" {
+		t.Errorf("expose headers are not set: %v", res.Header())
+	}
+
+	res = serve(http.MethodGet, "/public/logo.png", "https://other.org", nil)
+	if res.Header().Get("Access-Control-Allow-Origin") != "*" || len(res.Header().Get("Access-Control-Allow-Credentials")) > 0 {
+		t.Errorf("route policy is not applied: %v", res.Header())
+	}
+
+	if _, err := NewCORSWithConfig(zerolog.Nop(), zerolog.Nop(), CORSConfig{
+		Routes: []CORSRoutePolicy{{RouteMatch: RouteMatch{Pattern: "(", Match: "regexp"}}}}); err == nil {
+		t.Error("invalid route regexp must be rejected")
+	}
+	if _, err := NewCORSWithConfig(zerolog.Nop(), zerolog.Nop(), CORSConfig{
+		Default: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}}); err == nil {
+		t.Error("credentials with any origin must be rejected")
+	}
+	if _, err := NewCORSWithConfig(zerolog.Nop(), zerolog.Nop(), CORSConfig{
+		Default: CORSPolicy{AllowedOrigins: []string{"https://example.com"}, AllowCredentials: true},
+		Routes: []CORSRoutePolicy{{RouteMatch: RouteMatch{Pattern: "/public/", Match: "prefix"},
+			CORSPolicy: CORSPolicy{AllowedOrigins: []string{"*"}, AllowCredentials: true}}}}); err == nil {
+		t.Error("credentials with any origin in route policy must be rejected")
+	}
+}
+
+func TestCORSDefaultAllowsNoOrigins(t *testing.T) {
+	cors, err := NewCORSWithConfig(zerolog.Nop(), zerolog.Nop(), CORSConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cors.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+	req := httptest.NewRequest(http.MethodOptions, "/api", nil)
+	req.Header.Set("Origin", "https://other.org")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	res := httptest.NewRecorder()
+	cors.ServeHTTP(res, req)
+	if res.Code != http.StatusForbidden || len(res.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("origin must be denied without allowed origins, got %d %v", res.Code, res.Header())
+	}
+}
@@ -0,0 +1,56 @@
+package mclihttp
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+)
+
+// Locale middleware negotiates locale of request and puts it into context.
+// With url prefix mode /ru/tmpl/home is served as /tmpl/home with locale ru.
+type Locale struct {
+	Inner     http.Handler
+	urlPrefix bool
+}
+
+func NewLocale(urlPrefix bool) *Locale {
+	return &Locale{urlPrefix: urlPrefix}
+}
+
+func (l *Locale) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	locale, path := "", ""
+	if l.urlPrefix {
+		base := ""
+		if router, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router); ok && len(router.sBaseURL) > 0 {
+			base = "/" + router.sBaseURL
+		}
+		if rest, found := strings.CutPrefix(req.URL.Path, base); found {
+			for _, supported := range stateOf(req).Locales() {
+				if rest == "/"+supported || strings.HasPrefix(rest, "/"+supported+"/") {
+					locale = supported
+					path = base + strings.TrimPrefix(rest, "/"+supported)
+					if path == base {
+						path = base + "/"
+					}
+					break
+				}
+			}
+		}
+	}
+	if len(locale) == 0 {
+		locale = NegotiateLocale(req)
+	}
+	ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("Locale"), locale)
+	// url of request is shared with outer handlers, prefix is stripped on copy
+	req = req.Clone(ctx)
+	if len(path) > 0 {
+		req.URL.Path, req.URL.RawPath = path, ""
+	}
+	l.Inner.ServeHTTP(res, req)
+}
+
+func (l *Locale) SetInnerHandler(next http.Handler) {
+	l.Inner = next
+}
@@ -28,14 +28,18 @@ func NewLogger(outILog zerolog.Logger, outErrLog zerolog.Logger, opts LoggerOpts
 func (l *Logger) ServeHTTP(res http.ResponseWriter, req *http.Request) {
 	start := time.Now()
 	l.Inner.ServeHTTP(res, req)
+	infoLog := l.InfoLog
+	if span := SpanFromContext(req.Context()); span != nil {
+		infoLog = span.Logger(infoLog)
+	}
 	if l.ShowUrl && !l.ShowIp {
-		l.InfoLog.Info().Str("URL", req.URL.String()).Msgf("Request time: %v\n", time.Since(start))
+		infoLog.Info().Str("URL", req.URL.String()).Msgf("Request time: %v\n", time.Since(start))
 	} else if !l.ShowUrl && l.ShowIp {
-		l.InfoLog.Info().Str("IP", req.RemoteAddr).Msgf("Request time: %v\n", time.Since(start))
+		infoLog.Info().Str("IP", req.RemoteAddr).Msgf("Request time: %v\n", time.Since(start))
 	} else if l.ShowUrl && l.ShowIp {
-		l.InfoLog.Info().Str("IP", req.RemoteAddr).Str("URL", req.URL.String()).Msgf("Request time: %v\n", time.Since(start))
+		infoLog.Info().Str("IP", req.RemoteAddr).Str("URL", req.URL.String()).Msgf("Request time: %v\n", time.Since(start))
 	} else {
-		l.InfoLog.Info().Msgf("Request time: %v\n", time.Since(start))
+		infoLog.Info().Msgf("Request time: %v\n", time.Since(start))
 	}
 
 	// fmt.Printf("Request time: %v\n", time.Since(start))
@@ -0,0 +1,72 @@
+package mclihttp
+
+import (
+	"net/http"
+
+	"github.com/rs/zerolog"
+)
+
+// RequestId middleware accepts or generates X-Request-ID and traceparent of request,
+// puts server span into context together with logger having correlation fields
+// (zerolog.Ctx(req.Context())) and exports span timing when request is done.
+type RequestId struct {
+	InfoLog  zerolog.Logger
+	SpanName string
+	Inner    http.Handler
+}
+
+func NewRequestId(outILog zerolog.Logger) *RequestId {
+	return &RequestId{InfoLog: outILog, SpanName: "http server"}
+}
+
+// statusRecorder remembers status code written by handlers
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+func (rec *statusRecorder) Flush() {
+	if flusher, ok := rec.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+func (rid *RequestId) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	span := SpanFromHeaders(rid.SpanName, req.Header)
+	span.SetAttribute("method", req.Method)
+	span.SetAttribute("path", req.URL.Path)
+	res.Header().Set("X-Request-ID", span.RequestId)
+
+	logger := span.Logger(rid.InfoLog)
+	ctx := logger.WithContext(ContextWithSpan(req.Context(), span))
+	rec := &statusRecorder{ResponseWriter: res}
+	rid.Inner.ServeHTTP(rec, req.WithContext(ctx))
+
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	span.SetAttribute("status", rec.status)
+	span.End()
+}
+
+func (rid *RequestId) SetInnerHandler(next http.Handler) {
+	rid.Inner = next
+}
@@ -0,0 +1,97 @@
+package mclihttp
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"garbage", false},
+	}
+	for _, test := range tests {
+		if _, _, _, ok := ParseTraceparent(test.value); ok != test.ok {
+			t.Errorf("ParseTraceparent(%q) ok = %v, want %v", test.value, ok, test.ok)
+		}
+	}
+}
+
+func TestRequestId(t *testing.T) {
+	spansFile := filepath.Join(t.TempDir(), "spans.jsonl")
+	writer, err := NewSpanFileWriter(spansFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SpanExport = writer
+	defer func() { SpanExport = nil }()
+
+	var outgoing http.Header
+	rid := NewRequestId(zerolog.Nop())
+	rid.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		outgoing = make(http.Header)
+		SpanFromContext(req.Context()).InjectHeaders(outgoing)
+		res.WriteHeader(http.StatusTeapot)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("X-Request-ID", "req-42")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	res := httptest.NewRecorder()
+	rid.ServeHTTP(res, req)
+
+	if res.Header().Get("X-Request-ID") != "req-42" || outgoing.Get("X-Request-ID") != "req-42" {
+		t.Errorf("request id is not propagated: %v %v", res.Header(), outgoing)
+	}
+	traceId, parentId, _, ok := ParseTraceparent(outgoing.Get("traceparent"))
+	if !ok || traceId != "4bf92f3577b34da6a3ce929d0e0e4736" || parentId == "00f067aa0ba902b7" {
+		t.Errorf("outgoing traceparent must continue trace with server span as parent: %q", outgoing.Get("traceparent"))
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api", nil)
+	req.Header.Set("X-Request-ID", "bad id with spaces")
+	res = httptest.NewRecorder()
+	rid.ServeHTTP(res, req)
+	if id := res.Header().Get("X-Request-ID"); len(id) == 0 || strings.Contains(id, " ") {
+		t.Errorf("invalid request id must be replaced, got %q", id)
+	}
+
+	writer.Close()
+	file, err := os.Open(spansFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	spans := make([]Span, 0, 2)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var span Span
+		if err := json.Unmarshal(scanner.Bytes(), &span); err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, span)
+	}
+	if len(spans) != 2 {
+		t.Fatalf("got %d exported spans, want 2", len(spans))
+	}
+	if spans[0].ParentId != "00f067aa0ba902b7" || spans[0].Attributes["status"] != float64(http.StatusTeapot) {
+		t.Errorf("unexpected exported span: %+v", spans[0])
+	}
+}
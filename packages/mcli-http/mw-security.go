@@ -0,0 +1,336 @@
+package mclihttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+// SecurityHeadersConfig is profile of security headers set for every response.
+// Empty values are replaced with defaults, "-" turns header off.
+type SecurityHeadersConfig struct {
+	Enabled bool `yaml:"enabled"`
+	Hsts    struct {
+		// seconds, HSTS is sent only for https requests, negative value turns it off
+		MaxAge            int  `yaml:"max-age"`
+		IncludeSubdomains bool `yaml:"include-subdomains"`
+		Preload           bool `yaml:"preload"`
+		// addresses or networks (CIDR) of proxies which X-Forwarded-Proto is trusted from
+		TrustedProxies []string `yaml:"trusted-proxies"`
+	} `yaml:"hsts"`
+	FrameOptions      string `yaml:"frame-options"`
+	ReferrerPolicy    string `yaml:"referrer-policy"`
+	PermissionsPolicy string `yaml:"permissions-policy"`
+	Csp               struct {
+		Disabled bool `yaml:"disabled"`
+		// directive -> sources, f.e. script-src: ["'self'", "https://cdn.example.com"]
+		Directives map[string][]string `yaml:"directives"`
+		// directives which get per-request nonce source
+		NonceDirectives []string `yaml:"nonce-directives"`
+		// violations are reported and not blocked
+		ReportOnly bool `yaml:"report-only"`
+		// route of endpoint which logs violations, relative to base url
+		ReportRoute string `yaml:"report-route"`
+	} `yaml:"csp"`
+}
+
+// CSPBuilder assembles Content-Security-Policy header value
+type CSPBuilder struct {
+	directives      []cspDirective
+	nonceDirectives []string
+}
+
+type cspDirective struct {
+	name    string
+	sources []string
+}
+
+var defaultCSPDirectives = []cspDirective{
+	{"default-src", []string{"'self'"}},
+	{"script-src", []string{"'self'"}},
+	{"style-src", []string{"'self'", "'unsafe-inline'"}},
+	{"img-src", []string{"'self'", "data:"}},
+	{"font-src", []string{"'self'"}},
+	{"object-src", []string{"'none'"}},
+	{"base-uri", []string{"'self'"}},
+	{"form-action", []string{"'self'"}},
+	{"frame-ancestors", []string{"'self'"}},
+}
+
+func NewCSPBuilder() *CSPBuilder {
+	return &CSPBuilder{}
+}
+
+// Add appends sources to directive, directive without sources is rendered alone (f.e. upgrade-insecure-requests)
+func (b *CSPBuilder) Add(directive string, sources ...string) *CSPBuilder {
+	directive = strings.ToLower(strings.TrimSpace(directive))
+	for i := range b.directives {
+		if b.directives[i].name == directive {
+			for _, source := range sources {
+				if !slices.Contains(b.directives[i].sources, source) {
+					b.directives[i].sources = append(b.directives[i].sources, source)
+				}
+			}
+			return b
+		}
+	}
+	b.directives = append(b.directives, cspDirective{name: directive, sources: slices.Clone(sources)})
+	return b
+}
+
+// Set replaces sources of directive
+func (b *CSPBuilder) Set(directive string, sources ...string) *CSPBuilder {
+	directive = strings.ToLower(strings.TrimSpace(directive))
+	b.directives = slices.DeleteFunc(b.directives, func(d cspDirective) bool { return d.name == directive })
+	return b.Add(directive, sources...)
+}
+
+// Nonce marks directives which get 'nonce-...' source on Build
+func (b *CSPBuilder) Nonce(directives ...string) *CSPBuilder {
+	b.nonceDirectives = append(b.nonceDirectives, directives...)
+	return b
+}
+
+// Build renders policy, nonce is added to directives marked by Nonce
+func (b *CSPBuilder) Build(nonce string) string {
+	parts := make([]string, 0, len(b.directives))
+	for _, directive := range b.directives {
+		sources := directive.sources
+		if len(nonce) > 0 && slices.Contains(b.nonceDirectives, directive.name) {
+			sources = append(slices.Clone(sources), "'nonce-"+nonce+"'")
+		}
+		parts = append(parts, strings.TrimSpace(directive.name+" "+strings.Join(sources, " ")))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// SecurityHeaders middleware sets security headers profile and puts CSP nonce into context
+type SecurityHeaders struct {
+	Inner   http.Handler
+	headers map[string]string
+	hsts    string
+	// proxies which X-Forwarded-Proto marks https requests
+	trustedProxies []*net.IPNet
+	csp            *CSPBuilder
+	// name of CSP header: enforced or report-only
+	cspHeader   string
+	reportRoute string
+}
+
+func NewSecurityHeaders(config SecurityHeadersConfig) *SecurityHeaders {
+	valueOrDefault := func(value, defaultValue string) string {
+		if len(value) == 0 {
+			return defaultValue
+		}
+		return value
+	}
+	sh := &SecurityHeaders{headers: map[string]string{
+		"X-Content-Type-Options": "nosniff",
+		"X-Frame-Options":        valueOrDefault(config.FrameOptions, "SAMEORIGIN"),
+		"Referrer-Policy":        valueOrDefault(config.ReferrerPolicy, "strict-origin-when-cross-origin"),
+		"Permissions-Policy":     valueOrDefault(config.PermissionsPolicy, "camera=(), microphone=(), geolocation=()"),
+	}}
+	for name, value := range sh.headers {
+		if value == "-" {
+			delete(sh.headers, name)
+		}
+	}
+
+	if config.Hsts.MaxAge >= 0 {
+		maxAge := config.Hsts.MaxAge
+		if maxAge == 0 {
+			maxAge = 31536000
+		}
+		sh.hsts = fmt.Sprintf("max-age=%d", maxAge)
+		if config.Hsts.IncludeSubdomains {
+			sh.hsts += "; includeSubDomains"
+		}
+		if config.Hsts.Preload {
+			sh.hsts += "; preload"
+		}
+	}
+	for _, proxy := range config.Hsts.TrustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if !strings.Contains(proxy, "/") {
+			if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			sh.trustedProxies = append(sh.trustedProxies, network)
+		}
+	}
+
+	if !config.Csp.Disabled {
+		sh.csp = NewCSPBuilder()
+		if len(config.Csp.Directives) == 0 {
+			for _, directive := range defaultCSPDirectives {
+				sh.csp.Add(directive.name, directive.sources...)
+			}
+		} else {
+			names := make([]string, 0, len(config.Csp.Directives))
+			for name := range config.Csp.Directives {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+			for _, name := range names {
+				sh.csp.Add(name, config.Csp.Directives[name]...)
+			}
+		}
+		nonceDirectives := config.Csp.NonceDirectives
+		if len(nonceDirectives) == 0 {
+			nonceDirectives = []string{"script-src"}
+		}
+		sh.csp.Nonce(nonceDirectives...)
+		sh.cspHeader = "Content-Security-Policy"
+		if config.Csp.ReportOnly {
+			sh.cspHeader = "Content-Security-Policy-Report-Only"
+		}
+		sh.reportRoute = config.Csp.ReportRoute
+		if len(sh.reportRoute) == 0 && config.Csp.ReportOnly {
+			sh.reportRoute = "/csp-report"
+		}
+	}
+	return sh
+}
+
+// ReportRoute returns route of CSP violations endpoint or empty string if reporting is off
+func (sh *SecurityHeaders) ReportRoute() string {
+	return sh.reportRoute
+}
+
+func (sh *SecurityHeaders) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	for name, value := range sh.headers {
+		res.Header().Set(name, value)
+	}
+	if len(sh.hsts) > 0 && sh.isHttps(req) {
+		res.Header().Set("Strict-Transport-Security", sh.hsts)
+	}
+	if sh.csp == nil {
+		sh.Inner.ServeHTTP(res, req)
+		return
+	}
+
+	nonce, err := newCSPNonce()
+	if err != nil {
+		HttpErrorLocalized(res, req, http.StatusInternalServerError, err.Error())
+		return
+	}
+	policy := sh.csp.Build(nonce)
+	if len(sh.reportRoute) > 0 {
+		reportUrl := sh.reportRoute
+		if router, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router); ok {
+			reportUrl = router.getResultPattern(sh.reportRoute)
+		}
+		policy += "; report-uri " + reportUrl + "; report-to csp-endpoint"
+		res.Header().Set("Reporting-Endpoints", fmt.Sprintf(`csp-endpoint="%s"`, reportUrl))
+	}
+	res.Header().Set(sh.cspHeader, policy)
+
+	ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("CSPNonce"), nonce)
+	sh.Inner.ServeHTTP(res, req.WithContext(ctx))
+}
+
+// isHttps reports whether request came over tls, X-Forwarded-Proto is trusted only from configured proxies
+func (sh *SecurityHeaders) isHttps(req *http.Request) bool {
+	if req.TLS != nil {
+		return true
+	}
+	if req.Header.Get("X-Forwarded-Proto") != "https" {
+		return false
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && slices.ContainsFunc(sh.trustedProxies, func(network *net.IPNet) bool { return network.Contains(ip) })
+}
+
+func (sh *SecurityHeaders) SetInnerHandler(next http.Handler) {
+	sh.Inner = next
+}
+
+func newCSPNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// CSPNonce returns nonce of request for inline scripts: <script nonce="{{ cspNonce .Req }}">
+func CSPNonce(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	nonce, _ := req.Context().Value(go_common_ddru.ContextKey("CSPNonce")).(string)
+	return nonce
+}
+
+// CSPReportHandler logs CSP violations sent by browsers in report-uri and Reporting API formats
+func CSPReportHandler(logger zerolog.Logger) HandlerFunc {
+	type violation struct {
+		DocumentUri        string `json:"document-uri"`
+		DocumentURL        string `json:"documentURL"`
+		ViolatedDirective  string `json:"violated-directive"`
+		EffectiveDirective string `json:"effectiveDirective"`
+		BlockedUri         string `json:"blocked-uri"`
+		BlockedURL         string `json:"blockedURL"`
+		SourceFile         string `json:"source-file"`
+		LineNumber         int    `json:"line-number"`
+	}
+	return func(res http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodPost {
+			res.Header().Set("Allow", http.MethodPost)
+			HttpErrorLocalized(res, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(req.Body, 64<<10))
+		if err != nil {
+			HttpErrorLocalized(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		violations := make([]violation, 0, 1)
+		var report struct {
+			CspReport violation `json:"csp-report"`
+		}
+		var reports []struct {
+			Type string    `json:"type"`
+			Body violation `json:"body"`
+		}
+		if err := json.Unmarshal(body, &reports); err == nil {
+			for _, r := range reports {
+				if r.Type == "csp-violation" {
+					violations = append(violations, r.Body)
+				}
+			}
+		} else if err := json.Unmarshal(body, &report); err == nil {
+			violations = append(violations, report.CspReport)
+		} else {
+			HttpErrorLocalized(res, req, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		for _, v := range violations {
+			logger.Warn().Str("document", v.DocumentUri+v.DocumentURL).
+				Str("directive", v.ViolatedDirective+v.EffectiveDirective).
+				Str("blocked", v.BlockedUri+v.BlockedURL).Str("source", v.SourceFile).Int("line", v.LineNumber).
+				Msg("csp violation")
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
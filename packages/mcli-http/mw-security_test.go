@@ -0,0 +1,119 @@
+package mclihttp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+func TestCSPBuilder(t *testing.T) {
+	csp := NewCSPBuilder().Add("default-src", "'self'").Add("script-src", "'self'").
+		Add("script-src", "https://cdn.example.com", "'self'").Add("upgrade-insecure-requests").Nonce("script-src")
+	want := "default-src 'self'; script-src 'self' https://cdn.example.com 'nonce-abc'; upgrade-insecure-requests"
+	if got := csp.Build("abc"); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	csp.Set("script-src", "'none'")
+	if got := csp.Build(""); got != "default-src 'self'; upgrade-insecure-requests; script-src 'none'" {
+		t.Errorf("set does not replace sources: %q", got)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	var config SecurityHeadersConfig
+	config.FrameOptions = "DENY"
+	config.ReferrerPolicy = "-"
+	config.Csp.ReportOnly = true
+	sh := NewSecurityHeaders(config)
+	if sh.ReportRoute() != "/csp-report" {
+		t.Errorf("report-only mode must have default report route, got %q", sh.ReportRoute())
+	}
+
+	nonces := make([]string, 0, 2)
+	sh.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		nonces = append(nonces, CSPNonce(req))
+	}))
+	for i := 0; i < 2; i++ {
+		res := httptest.NewRecorder()
+		sh.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/", nil))
+		policy := res.Header().Get("Content-Security-Policy-Report-Only")
+		if !strings.Contains(policy, "'nonce-"+nonces[i]+"'") || !strings.Contains(policy, "report-uri /csp-report") {
+			t.Errorf("policy does not contain nonce %q and report uri: %q", nonces[i], policy)
+		}
+		if res.Header().Get("X-Frame-Options") != "DENY" || res.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("unexpected headers: %v", res.Header())
+		}
+		if _, ok := res.Header()["Referrer-Policy"]; ok {
+			t.Error("header turned off by - is set")
+		}
+		if len(res.Header().Get("Strict-Transport-Security")) > 0 {
+			t.Error("hsts must not be sent over plain http")
+		}
+	}
+	if len(nonces[0]) == 0 || nonces[0] == nonces[1] {
+		t.Errorf("nonce must be unique per request: %v", nonces)
+	}
+
+	report := CSPReportHandler(zerolog.Nop())
+	for body, code := range map[string]int{
+		`{"csp-report":{"document-uri":"http://localhost/","violated-directive":"script-src"}}`: http.StatusNoContent,
+		`[{"type":"csp-violation","body":{"documentURL":"http://localhost/"}}]`:                 http.StatusNoContent,
+		`not json`: http.StatusBadRequest,
+	} {
+		res := httptest.NewRecorder()
+		report(res, httptest.NewRequest(http.MethodPost, "/csp-report", strings.NewReader(body)))
+		if res.Code != code {
+			t.Errorf("report %s: got %d, want %d", body, res.Code, code)
+		}
+	}
+}
+
+func TestSecurityHeadersHstsProxies(t *testing.T) {
+	var config SecurityHeadersConfig
+	config.Csp.Disabled = true
+	config.Hsts.TrustedProxies = []string{"10.0.0.0/8", "::1"}
+	sh := NewSecurityHeaders(config)
+	sh.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {}))
+
+	cases := []struct {
+		remoteAddr, proto string
+		hsts              bool
+	}{
+		{"10.1.2.3:5000", "https", true},
+		{"[::1]:5000", "https", true},
+		{"10.1.2.3:5000", "http", false},
+		{"192.0.2.1:5000", "https", false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = c.remoteAddr
+		req.Header.Set("X-Forwarded-Proto", c.proto)
+		res := httptest.NewRecorder()
+		sh.ServeHTTP(res, req)
+		if hsts := len(res.Header().Get("Strict-Transport-Security")) > 0; hsts != c.hsts {
+			t.Errorf("%s %s: hsts %v, want %v", c.remoteAddr, c.proto, hsts, c.hsts)
+		}
+	}
+}
+
+func TestSignInChangeTemplateNonce(t *testing.T) {
+	templates, err := parseLocalizedTemplates("signin-change", "../../http-data/internal-templates/signin/signin.change.page.html", Locales())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/signin/change", nil)
+	req = req.WithContext(context.WithValue(req.Context(), go_common_ddru.ContextKey("CSPNonce"), "abc"))
+	var out strings.Builder
+	if err := templates[""].Execute(&out, signInData{Req: req}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(out.String(), "<script") != strings.Count(out.String(), `<script nonce="abc">`) ||
+		strings.Contains(out.String(), "onsubmit") {
+		t.Errorf("inline scripts of page must have csp nonce: %s", out.String())
+	}
+}
@@ -21,6 +21,7 @@ type signInDataMember struct {
 	Redirect string
 }
 type signInData struct {
+	Req  *http.Request
 	Data signInDataMember
 }
 
@@ -28,24 +29,25 @@ var tmplSignIn string = `
 		<!DOCTYPE html>
 		<html>
 		<head>
-			<title>Sign in form</title>
+			<title>{{ t .Req "signin.title" }}</title>
 			<link rel="stylesheet" href="/static/css/bootstrap.min.css">
 		</head>
 		<body>
 			<div class="container mt-5">
 				<div class="row justify-content-center">
 					<div class="col-md-4">
-						<h2 class="mb-4">Login</h2>
+						<h2 class="mb-4">{{ t .Req "signin.title" }}</h2>
 						<form method="POST" action="{{ .Data.Action }}">
 							<div class="mb-3">
-								<label for="username" class="form-label">Username</label>
+								<label for="username" class="form-label">{{ t .Req "signin.username" }}</label>
 								<input type="text" id="username" name="username" class="form-control" required>
 							</div>
 							<div class="mb-3">
-								<label for="password" class="form-label">Password</label>
+								<label for="password" class="form-label">{{ t .Req "signin.password" }}</label>
 								<input type="password" id="password" name="password" class="form-control" required>
 							</div>
-							<button type="submit" class="btn btn-primary">Login</button>
+							{{ csrfField .Req }}
+							<button type="submit" class="btn btn-primary">{{ t .Req "signin.submit" }}</button>
 						</form>
 					</div>
 				</div>
@@ -116,16 +118,46 @@ var tmplSignIn string = `
 `
 */
 
-var tmplSignInParsed *template.Template
-var loginData signInData
+// parseLocalizedTemplates parses template file and its locale variants (signin.page.ru.html)
+// returns map locale -> template, default template has empty locale key
+func parseLocalizedTemplates(name, templatePath string, locales []string) (map[string]*template.Template, error) {
+	templates := make(map[string]*template.Template)
+	tmplContent, err := os.ReadFile(templatePath)
+	if err != nil {
+		return nil, err
+	}
+	templates[""], err = template.New(name).Funcs(TemplateFuncs()).Parse(string(tmplContent))
+	if err != nil {
+		return nil, err
+	}
+	for _, locale := range locales {
+		localeContent, err := os.ReadFile(localizedPath(templatePath, locale))
+		if err != nil {
+			continue
+		}
+		templates[locale], err = template.New(name).Funcs(TemplateFuncs()).Parse(string(localeContent))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return templates, nil
+}
+
+// localizedTemplate returns template variant for request locale or default one
+func localizedTemplate(templates map[string]*template.Template, req *http.Request) *template.Template {
+	if tmpl, ok := templates[LocaleFromRequest(req)]; ok {
+		return tmpl
+	}
+	return templates[""]
+}
 
-func GetSignInHandler(signInTemplatePath, baseUrl, action, redirect string) (HandlerFunc, error) {
+// GetSignInHandler returns handler of sign in route with template variants for locales of state
+func GetSignInHandler(st *ServerState, signInTemplatePath, baseUrl, action, redirect string) (HandlerFunc, error) {
 
-	tmplContent, err := os.ReadFile(signInTemplatePath)
+	templates, err := parseLocalizedTemplates("signin", signInTemplatePath, st.Locales())
 	if err != nil {
 		return nil, err
 	}
-	tmplSignIn = string(tmplContent)
 
 	overAllActionUrl := strings.TrimPrefix(action, "/")
 	if !strings.HasPrefix(action, baseUrl) {
@@ -133,18 +165,15 @@ func GetSignInHandler(signInTemplatePath, baseUrl, action, redirect string) (Han
 	}
 	overAllActionUrl = fmt.Sprintf("/%s", overAllActionUrl)
 
-	loginData = signInData{Data: signInDataMember{Action: overAllActionUrl, Redirect: redirect}}
-	tmplSignInParsed, err = template.New("signin").Parse(tmplSignIn)
-	if err != nil {
-		return nil, err
-	}
+	loginData := signInData{Data: signInDataMember{Action: overAllActionUrl, Redirect: redirect}}
 	return func(w http.ResponseWriter, r *http.Request) {
-		signIn(w, r, tmplSignInParsed, loginData)
+		signIn(w, r, localizedTemplate(templates, r), loginData)
 	}, nil
 }
 
 func signIn(w http.ResponseWriter, r *http.Request, template *template.Template, loginData signInData) {
 	if r.Method == http.MethodGet {
+		loginData.Req = WithCsrfCookie(w, r)
 		template.Execute(w, loginData)
 		return
 	}
@@ -155,9 +184,10 @@ func signIn(w http.ResponseWriter, r *http.Request, template *template.Template,
 			http.Error(w, "no router object in context", http.StatusInternalServerError)
 			return
 		}
-		session := NewSession(cookieName, router.KVStore)
-		// fmt.Printf("%v, %T\n", HttpConfig.Server.Auth.AuthTtl, HttpConfig.Server.Auth.AuthTtl)
-		session.Expire = time.Duration(HttpConfig.Server.Auth.AuthTtl)
+		st := router.State()
+		session := NewSession(st.cookieName, router.KVStore)
+		session.state = st
+		session.Expire = time.Duration(st.Config.Server.Auth.AuthTtl)
 
 		var cred Credential = Credential{Expired: true, CredStore: router.CredentialStore}
 
@@ -166,6 +196,11 @@ func signIn(w http.ResponseWriter, r *http.Request, template *template.Template,
 		password, username := "", ""
 		switch contentType {
 		case "application/json":
+			// json body is sent cross-site only after cors preflight
+			if !isSameOrigin(r) && !CheckCsrfToken(r) {
+				http.Error(w, "cross-origin request without csrf token", http.StatusForbidden)
+				return
+			}
 			_, err := processJSONBody(w, r, &cred)
 
 			if err != nil {
@@ -174,6 +209,11 @@ func signIn(w http.ResponseWriter, r *http.Request, template *template.Template,
 				return
 			}
 		case "application/x-www-form-urlencoded":
+			// forms are sent by any site, so token of signin page is required
+			if !CheckCsrfToken(r) {
+				http.Error(w, "wrong csrf token", http.StatusForbidden)
+				return
+			}
 			formValues, _ := processFormValues(w, r)
 			password, _ = getFormValue("password", formValues)
 			username, _ = getFormValue("username", formValues)
@@ -200,7 +240,7 @@ func signIn(w http.ResponseWriter, r *http.Request, template *template.Template,
 		}
 		ok, err = session.Authenticate(cred)
 		if !ok || err != nil {
-			http.Error(w, "auth error: "+err.Error(), http.StatusUnauthorized)
+			HttpErrorLocalized(w, r, http.StatusUnauthorized, "auth error: "+err.Error())
 			clearAuthenticatedCookie(w, session)
 			return
 		}
@@ -298,8 +338,8 @@ func getFormValue(fieldName string, values url.Values) (string, error) {
 func setAuthenticatedCookie(w http.ResponseWriter, session *Session) error {
 	var cookieValueToStore = session.Token
 	var err error
-	if encodeCookies {
-		cookieValueToStore, err = s.Encode(session.CookieName, session.Token)
+	if st := session.serverState(); st.encodeCookies {
+		cookieValueToStore, err = st.encodeCookie(session.CookieName, session.Token)
 	}
 	if err == nil {
 		cookie := &http.Cookie{
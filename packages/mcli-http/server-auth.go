@@ -11,26 +11,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
-	sc "github.com/gorilla/securecookie"
 )
 
-var cookieName string = "session-token"
-var (
-	s             *sc.SecureCookie
-	encodeCookies = false
-)
-
-func SetSecretCookieOptions(doEncoding bool, cookieName string, cookieHash, cookieBlock []byte) {
-	if cookieName == "" {
-		cookieName = "session-token"
-	}
-	encodeCookies = doEncoding
-	s = nil
-	if encodeCookies {
-		s = sc.New(cookieHash, cookieBlock)
-	}
-}
-
 type Credential struct {
 	Username    string   `json:"username"`
 	Password    string   `json:"password"`
@@ -102,6 +84,8 @@ type Session struct {
 	Value      interface{}
 	Expire     time.Duration
 	Store      mcli_type.KVStorer
+	// state of router which session is started by
+	state *ServerState
 }
 
 func NewSession(cookieName string, s mcli_type.KVStorer) *Session {
@@ -109,6 +93,13 @@ func NewSession(cookieName string, s mcli_type.KVStorer) *Session {
 	return &session
 }
 
+func (session *Session) serverState() *ServerState {
+	if session.state != nil {
+		return session.state
+	}
+	return CurrentServerState()
+}
+
 func (session *Session) SetToken(sessionToken string) (string, error) {
 	if sessionToken == "" {
 		sessionToken = uuid.New().String()
@@ -131,7 +122,7 @@ func (session *Session) Authenticate(cred Credential) (bool, error) {
 	if !ok {
 		return ok, fmt.Errorf("authenticate error: %v", err)
 	}
-	sessionPrefix := HttpConfig.Server.Auth.SessionsRedisPrefix
+	sessionPrefix := session.serverState().Config.Server.Auth.SessionsRedisPrefix
 	if sessionPrefix == "" {
 		sessionPrefix = "session-list"
 	}
@@ -145,6 +136,6 @@ func (session *Session) Authenticate(cred Credential) (bool, error) {
 
 func logoutHandler(w http.ResponseWriter, r *http.Request) {
 	//  TODO: check routes and improove cookie name resolution
-	clearAuthenticatedCookie(w, &Session{CookieName: cookieName})
+	clearAuthenticatedCookie(w, &Session{CookieName: stateOf(r).cookieName})
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
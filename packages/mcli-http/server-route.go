@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"regexp"
 	"strings"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
 )
 
 type RouteType int
@@ -142,3 +144,45 @@ func (r *Route) matchRouteParamArray(path string) (bool, []string) {
 
 	return true, params
 }
+
+// RouteMatch selects requests for settings configured per route (cors policies, cache ttl),
+// pattern is relative to base url of router
+type RouteMatch struct {
+	Pattern string `json:"pattern" yaml:"pattern"`
+	// equal, prefix or regexp
+	Match string `json:"match" yaml:"match"`
+
+	routeType RouteType
+	regexp    *regexp.Regexp
+}
+
+func (m *RouteMatch) compile() error {
+	routeType, err := parseRouteType(m.Match)
+	if err != nil {
+		return err
+	}
+	m.routeType = routeType
+	if routeType == Regexp {
+		m.regexp, err = regexp.Compile(m.Pattern)
+	}
+	return err
+}
+
+func (m *RouteMatch) match(path string) bool {
+	switch m.routeType {
+	case Prefix:
+		return strings.HasPrefix(path, m.Pattern)
+	case Regexp:
+		return m.regexp.MatchString(path)
+	}
+	return path == m.Pattern || path == m.Pattern+"/" || path+"/" == m.Pattern
+}
+
+// routerRelativePath returns path of request without base url of router
+func routerRelativePath(req *http.Request) string {
+	path := req.URL.Path
+	if router, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router); ok && len(router.sBaseURL) > 0 {
+		path = strings.TrimPrefix(path, "/"+router.sBaseURL)
+	}
+	return path
+}
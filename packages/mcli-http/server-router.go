@@ -30,8 +30,27 @@ type Router struct {
 	KVStore         mcli_type.KVStorer
 	CredentialStore mcli_type.CredentialStorer
 	Cache           mcli_type.Cacher
-	Ctx             context.Context
-	Notify          chan interface{}
+	// cache for template data sources
+	DataCache mcli_type.Cacher
+	Ctx       context.Context
+	Notify    chan interface{}
+	// template sets served by router
+	tmplSets []*templateSet
+	// missing keys in template data are errors, used by static site build
+	strictTmplData bool
+	// http plugins registered in router and handler name -> plugin name
+	plugins        []PluginStatus
+	pluginHandlers map[string]string
+	// config, catalog and other state router is built with, requests served by router read it
+	state *ServerState
+}
+
+// State returns state router is built with or current state
+func (r *Router) State() *ServerState {
+	if r.state != nil {
+		return r.state
+	}
+	return CurrentServerState()
 }
 
 type RouterOptions struct {
@@ -40,6 +59,10 @@ type RouterOptions struct {
 	CredentialStore mcli_type.CredentialStorer
 	Ctx             context.Context
 	Notify          chan interface{}
+	// StrictTemplateData makes templates fail on missing data keys
+	StrictTemplateData bool
+	// State is state router is built with, current state is used if it is nil
+	State *ServerState
 }
 
 func NewRouter(sPath string, sPrefix string, iLog zerolog.Logger, Elogger zerolog.Logger, opts *RouterOptions) *Router {
@@ -84,6 +107,8 @@ func NewRouter(sPath string, sPrefix string, iLog zerolog.Logger, Elogger zerolo
 		if opts.Notify != nil {
 			router.Notify = opts.Notify
 		}
+		router.strictTmplData = opts.StrictTemplateData
+		router.state = opts.State
 	}
 	router.Cache = mcli_utils.NewCCache(600, 100, func(params ...interface{}) (interface{}, error) {
 		if len(params) == 0 {
@@ -98,6 +123,7 @@ func NewRouter(sPath string, sPrefix string, iLog zerolog.Logger, Elogger zerolo
 		}
 		return nil, fmt.Errorf("too many parameters for cache function")
 	}, router.Ctx, router.Notify)
+	router.DataCache = mcli_utils.NewCCache(0, 0, nil, router.Ctx, router.Notify)
 
 	return &router
 }
@@ -159,17 +185,7 @@ func (r *Router) AddRoute(route *Route) error {
 	case Equal:
 		// if pattern contains :params parts in path, f.e. /baseurl/path1/:section/:post
 		if strings.Contains(route.pattern, ":") {
-			re, err := regexp.Compile(`:([^/]+)`)
-			if err != nil {
-				return err
-			}
-			regexPattern := re.ReplaceAllStringFunc(route.pattern, func(match string) string {
-				// Convert :param to (?P<param>[^/]+)
-				paramName := match[1:]
-				return fmt.Sprintf(`(?P<%s>[^/]+)`, paramName)
-			})
-
-			regExpPattern, err := regexp.Compile("^" + regexPattern + "$")
+			regExpPattern, err := paramPatternRegexp(route.pattern)
 			if err != nil {
 				return err
 			}
@@ -191,6 +207,18 @@ func (r *Router) AddRoute(route *Route) error {
 	return nil
 }
 
+var paramSegmentRegexp = regexp.MustCompile(`:([^/]+)`)
+
+// paramPatternRegexp converts pattern with :params parts in path to regexp with named groups
+func paramPatternRegexp(pattern string) (*regexp.Regexp, error) {
+	regexPattern := paramSegmentRegexp.ReplaceAllStringFunc(pattern, func(match string) string {
+		// Convert :param to (?P<param>[^/]+)
+		paramName := match[1:]
+		return fmt.Sprintf(`(?P<%s>[^/]+)`, paramName)
+	})
+	return regexp.Compile("^" + regexPattern + "$")
+}
+
 func (r *Router) setRouterMapsByMethod(route *Route) {
 	switch route.method {
 	case http.MethodGet:
@@ -213,7 +241,7 @@ func (r *Router) getResultPattern(partial string) string {
 	if len(r.sBaseURL) == 0 {
 		return partial
 	}
-	return HttpConfig.GetFullUrl(partial, r.sBaseURL)
+	return r.State().Config.GetFullUrl(partial, r.sBaseURL)
 }
 
 func (r *Router) AddRouteWithHandler(pattern string, routeType RouteType, f HandlerFunc) error {
@@ -252,7 +280,7 @@ func (r *Router) innerHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if HttpConfig.Server.RouterV2 {
+	if r.State().Config.Server.RouterV2 {
 		// V2 routing
 		// Equal Routes
 		for _, rPath := range reqPaths {
@@ -358,7 +386,7 @@ func (r *Router) innerHandler(res http.ResponseWriter, req *http.Request) {
 				}
 			}
 		}
-		http.Error(res, "404 Not Found", 404)
+		HttpErrorLocalized(res, req, http.StatusNotFound, "")
 	} else {
 		// serving routes in router
 		for _, route := range r.routes {
@@ -389,7 +417,7 @@ func (r *Router) innerHandler(res http.ResponseWriter, req *http.Request) {
 					}
 				}
 			default:
-				http.Error(res, "404 Not Found", 404)
+				HttpErrorLocalized(res, req, http.StatusNotFound, "")
 			}
 		}
 	}
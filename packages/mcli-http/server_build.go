@@ -0,0 +1,337 @@
+package mclihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"golang.org/x/net/html"
+)
+
+// SiteBuildOptions describes static site generation
+type SiteBuildOptions struct {
+	OutDir string
+	// absolute url of published site used in sitemap, e.g. https://docs.direct-dev.ru,
+	// sitemap is not written without it
+	SiteUrl string
+}
+
+// SiteBuildResult lists generated pages (relative to OutDir) and number of copied static assets
+type SiteBuildResult struct {
+	Pages  []string
+	Assets int
+}
+
+// sitePage is page rendered by router and written to outPath
+type sitePage struct {
+	url     string
+	outPath string
+	locale  string
+}
+
+// BuildSite renders every page of template sets into OutDir, rewrites absolute links to relative ones,
+// copies static assets and writes sitemap.xml when site url is given. Any page that fails to render fails the build.
+func (r *Router) BuildSite(opts SiteBuildOptions) (*SiteBuildResult, error) {
+	if len(opts.OutDir) == 0 {
+		return nil, fmt.Errorf("output directory is not specified")
+	}
+	if len(opts.SiteUrl) > 0 {
+		siteUrl, err := url.Parse(opts.SiteUrl)
+		if err != nil || (siteUrl.Scheme != "http" && siteUrl.Scheme != "https") || len(siteUrl.Host) == 0 {
+			return nil, fmt.Errorf("site url %s is not absolute http(s) url", opts.SiteUrl)
+		}
+	}
+	pages := r.collectSitePages()
+	if len(pages) == 0 {
+		return nil, fmt.Errorf("there are no pages to build")
+	}
+	// url -> out path for every locale to resolve links between pages
+	pagesByUrl := make(map[string]map[string]string)
+	for _, page := range pages {
+		if _, ok := pagesByUrl[page.locale]; !ok {
+			pagesByUrl[page.locale] = make(map[string]string)
+		}
+		pagesByUrl[page.locale][page.url] = page.outPath
+	}
+
+	result := &SiteBuildResult{Pages: make([]string, 0, len(pages))}
+	var errs []error
+	for _, page := range pages {
+		content, err := r.renderSitePage(page)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("page %s: %w", page.url, err))
+			continue
+		}
+		if content == nil {
+			r.infoLog.Info().Msgf("page %s is draft or restricted by roles and skipped", page.url)
+			continue
+		}
+		content, err = relativizeLinks(content, page.outPath, func(linkPath string) (string, bool) {
+			return r.resolveSiteLink(linkPath, pagesByUrl[page.locale])
+		})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("page %s: %w", page.url, err))
+			continue
+		}
+		if err := writeSiteFile(filepath.Join(opts.OutDir, filepath.FromSlash(page.outPath)), content); err != nil {
+			return result, err
+		}
+		result.Pages = append(result.Pages, page.outPath)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return result, err
+	}
+
+	if len(r.sPath) > 0 && len(r.sPrefix) > 0 {
+		assets, err := copySiteAssets(r.sPath, filepath.Join(opts.OutDir, r.sPrefix))
+		if err != nil {
+			return result, err
+		}
+		result.Assets = assets
+	}
+	if len(opts.SiteUrl) == 0 {
+		// locations of sitemap must be absolute urls
+		r.infoLog.Warn().Msg("site url is not specified, sitemap.xml is not written")
+		return result, nil
+	}
+	return result, writeSitemap(filepath.Join(opts.OutDir, "sitemap.xml"), opts.SiteUrl, result.Pages)
+}
+
+// collectSitePages returns pages of all template sets, pages in protected folders are skipped.
+// When locales are configured not default ones are placed into <locale>/ folder.
+func (r *Router) collectSitePages() []sitePage {
+	locales := []string{""}
+	st := r.State()
+	if len(st.Config.Server.I18n.Locales) > 0 {
+		locales = []string{st.Catalog.DefaultLocale}
+		for _, locale := range st.Config.Server.I18n.Locales {
+			if locale != st.Catalog.DefaultLocale {
+				locales = append(locales, locale)
+			}
+		}
+	}
+	pages := make([]sitePage, 0)
+	for _, tmplPage := range r.templatePages() {
+		outPath := path.Join(tmplPage.prefix, tmplPage.name+".html")
+		for i, locale := range locales {
+			page := sitePage{url: tmplPage.url, outPath: outPath, locale: locale}
+			if i > 0 {
+				page.outPath = path.Join(locale, outPath)
+			}
+			pages = append(pages, page)
+		}
+	}
+	return pages
+}
+
+// templatePage is page of template set: name is path to page without extension from template folder
+type templatePage struct {
+	name   string
+	url    string
+	prefix string
+}
+
+// templatePages returns pages of all template sets except locale variants and pages in protected folders
+func (r *Router) templatePages() []templatePage {
+	pages := make([]templatePage, 0)
+	locales := r.State().Locales()
+	for _, set := range r.tmplSets {
+		set.cache.RLock()
+		keys := make([]string, 0, len(set.cache.cache))
+		for key := range set.cache.cache {
+			keys = append(keys, key)
+		}
+		set.cache.RUnlock()
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			tmplName, err := filepath.Rel(set.cache.tmplPath, key)
+			if err != nil || isLocaleVariant(key, locales) {
+				continue
+			}
+			tmplName = filepath.ToSlash(tmplName)
+			if strings.HasPrefix(tmplName, "protected/") || strings.Contains(tmplName, "/protected/") {
+				r.infoLog.Trace().Msgf("page %s is protected and skipped", tmplName)
+				continue
+			}
+			pages = append(pages, templatePage{name: tmplName, url: set.urlPrefix + tmplName,
+				prefix: strings.Trim(set.entry.TmplPrefix, "/")})
+		}
+	}
+	return pages
+}
+
+// isLocaleVariant reports whether template key is locale variant of other page: home.page.ru
+func isLocaleVariant(key string, locales []string) bool {
+	for _, locale := range locales {
+		if strings.HasSuffix(key, ".page."+locale) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSiteBuildRequest reports whether request is made by static site build
+func isSiteBuildRequest(req *http.Request) bool {
+	isBuild, ok := req.Context().Value(go_common_ddru.ContextKey("SiteBuild")).(bool)
+	return ok && isBuild
+}
+
+// renderSitePage serves page by router the same way as on request,
+// nil content is returned for pages which must not be published
+func (r *Router) renderSitePage(page sitePage) ([]byte, error) {
+	req := httptest.NewRequest(http.MethodGet, page.url, nil)
+	ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("SiteBuild"), true)
+	if len(page.locale) > 0 {
+		ctx = context.WithValue(ctx, go_common_ddru.ContextKey("Locale"), page.locale)
+	}
+	rec := httptest.NewRecorder()
+	r.serveInternal(rec, req.WithContext(ctx))
+	if rec.Code == http.StatusNoContent {
+		// drafts and pages restricted by roles
+		return nil, nil
+	}
+	if rec.Code != http.StatusOK {
+		return nil, fmt.Errorf("status %d: %s", rec.Code, strings.TrimSpace(rec.Body.String()))
+	}
+	return rec.Body.Bytes(), nil
+}
+
+// resolveSiteLink maps absolute url path to file path relative to site root
+func (r *Router) resolveSiteLink(linkPath string, pagesByUrl map[string]string) (string, bool) {
+	if outPath, ok := pagesByUrl[linkPath]; ok {
+		return outPath, true
+	}
+	if outPath, ok := pagesByUrl[strings.TrimSuffix(linkPath, "/")]; ok {
+		return outPath, true
+	}
+	if len(r.sBaseURL) > 0 && (linkPath == "/"+r.sBaseURL || strings.HasPrefix(linkPath, "/"+r.sBaseURL+"/")) {
+		linkPath = strings.TrimPrefix(linkPath, "/"+r.sBaseURL)
+	}
+	return strings.TrimPrefix(linkPath, "/"), true
+}
+
+// relativizeLinks rewrites absolute href and src attributes to paths relative to page at outPath
+func relativizeLinks(content []byte, outPath string, resolve func(string) (string, bool)) ([]byte, error) {
+	pageDir := path.Dir(outPath)
+	rewrite := func(value string) (string, bool) {
+		if !strings.HasPrefix(value, "/") || strings.HasPrefix(value, "//") {
+			return "", false
+		}
+		link, err := url.Parse(value)
+		if err != nil {
+			return "", false
+		}
+		target, ok := resolve(link.Path)
+		if !ok {
+			return "", false
+		}
+		relPath, err := filepath.Rel(filepath.FromSlash(pageDir), filepath.FromSlash(target))
+		if err != nil {
+			return "", false
+		}
+		link.Path = filepath.ToSlash(relPath)
+		return link.String(), true
+	}
+
+	var out bytes.Buffer
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		tokenType := tokenizer.Next()
+		switch tokenType {
+		case html.ErrorToken:
+			if tokenizer.Err() == io.EOF {
+				return out.Bytes(), nil
+			}
+			return nil, tokenizer.Err()
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := append([]byte(nil), tokenizer.Raw()...)
+			token := tokenizer.Token()
+			changed := false
+			for i, attr := range token.Attr {
+				if attr.Key != "href" && attr.Key != "src" {
+					continue
+				}
+				if value, ok := rewrite(attr.Val); ok {
+					token.Attr[i].Val = value
+					changed = true
+				}
+			}
+			if changed {
+				out.WriteString(token.String())
+			} else {
+				out.Write(raw)
+			}
+		default:
+			out.Write(tokenizer.Raw())
+		}
+	}
+}
+
+func writeSiteFile(filePath string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(filePath, content, 0644)
+}
+
+// copySiteAssets copies static folder to destination and returns number of copied files
+func copySiteAssets(src, dst string) (int, error) {
+	count := 0
+	err := filepath.Walk(src, func(wPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(src, wPath)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return os.MkdirAll(filepath.Join(dst, relPath), 0755)
+		}
+		content, err := os.ReadFile(wPath)
+		if err != nil {
+			return err
+		}
+		count++
+		return writeSiteFile(filepath.Join(dst, relPath), content)
+	})
+	return count, err
+}
+
+type sitemapUrl struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+type sitemapUrlSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Urls    []sitemapUrl `xml:"url"`
+}
+
+func writeSitemap(filePath, siteUrl string, pages []string) error {
+	lastMod := time.Now().Format("2006-01-02")
+	urlSet := sitemapUrlSet{Xmlns: "http://www.sitemaps.org/schemas/sitemap/0.9", Urls: make([]sitemapUrl, 0, len(pages))}
+	for _, page := range pages {
+		urlSet.Urls = append(urlSet.Urls, sitemapUrl{Loc: strings.TrimSuffix(siteUrl, "/") + "/" + page, LastMod: lastMod})
+	}
+	content, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeSiteFile(filePath, append([]byte(xml.Header), content...))
+}
@@ -0,0 +1,134 @@
+package mclihttp
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+func TestBuildSite(t *testing.T) {
+	root := t.TempDir()
+	tmplPath, staticPath := filepath.Join(root, "templates"), filepath.Join(root, "static")
+	writeTestFile(t, filepath.Join(tmplPath, "__base", "base.layout.html"),
+		`{{define "base"}}<html><head><link href="/static/site.css"></head><body>{{template "main" .}}</body></html>{{end}}`)
+	writeTestFile(t, filepath.Join(tmplPath, "__partial", "nav.partial.html"), `{{define "nav"}}<nav></nav>{{end}}`)
+	writeTestFile(t, filepath.Join(tmplPath, "home", "home.page.html"),
+		`{{template "base" .}}{{define "main"}}<a href="/tmpl/docs/intro.page">intro</a>{{end}}`)
+	writeTestFile(t, filepath.Join(tmplPath, "docs", "intro.page.html"),
+		`{{template "base" .}}{{define "main"}}<a href="/tmpl/home/home.page">home</a>{{end}}`)
+	writeTestFile(t, filepath.Join(tmplPath, "protected", "secret.page.html"), `secret`)
+	writeTestFile(t, filepath.Join(staticPath, "site.css"), `body {}`)
+
+	router := NewRouter(staticPath, "static", zerolog.Nop(), zerolog.Nop(), nil)
+	entry := TemplateEntry{TmplName: "site", TmplPath: tmplPath, TmplPrefix: "tmpl"}
+	if err := router.SetTemplatesRoutes(context.Background(), []TemplateEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := router.BuildSite(SiteBuildOptions{OutDir: filepath.Join(root, "out"), SiteUrl: "docs.example.com"}); err == nil {
+		t.Error("site url without scheme must be rejected")
+	}
+
+	outDir := filepath.Join(root, "public")
+	result, err := router.BuildSite(SiteBuildOptions{OutDir: outDir, SiteUrl: "https://docs.example.com/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Pages, ",") != "tmpl/docs/intro.page.html,tmpl/home/home.page.html" || result.Assets != 1 {
+		t.Fatalf("unexpected pages %v and assets %d", result.Pages, result.Assets)
+	}
+	home, err := os.ReadFile(filepath.Join(outDir, "tmpl", "home", "home.page.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(home), `href="../docs/intro.page.html"`) ||
+		!strings.Contains(string(home), `href="../../static/site.css"`) {
+		t.Errorf("links of page must be relative: %s", home)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "static", "site.css")); err != nil {
+		t.Errorf("static asset is not copied: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sitemap sitemapUrlSet
+	if err := xml.Unmarshal(content, &sitemap); err != nil {
+		t.Fatal(err)
+	}
+	if len(sitemap.Urls) != 2 || sitemap.Urls[0].Loc != "https://docs.example.com/tmpl/docs/intro.page.html" ||
+		sitemap.Urls[1].Loc != "https://docs.example.com/tmpl/home/home.page.html" {
+		t.Errorf("unexpected sitemap: %s", content)
+	}
+
+	// sitemap of relative locations is not written
+	outDir = filepath.Join(root, "local")
+	if _, err := router.BuildSite(SiteBuildOptions{OutDir: outDir}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(outDir, "sitemap.xml")); !os.IsNotExist(err) {
+		t.Errorf("sitemap must not be written without site url: %v", err)
+	}
+}
+
+func TestPageRolesOfSearchAndSitemap(t *testing.T) {
+	root := t.TempDir()
+	tmplPath, dataPath := filepath.Join(root, "markdown"), filepath.Join(root, "markdown-data")
+	writeTestFile(t, filepath.Join(tmplPath, "__base", "base.layout.html"),
+		`{{define "base"}}<html><body>{{template "main" .}}</body></html>{{end}}`)
+	writeTestFile(t, filepath.Join(tmplPath, "__partial", "nav.partial.html"), `{{define "nav"}}<nav></nav>{{end}}`)
+	for _, name := range []string{"open", "staff"} {
+		writeTestFile(t, filepath.Join(tmplPath, "docs", name+".page.html"),
+			`{{template "base" .}}{{define "main"}}{{ .Contents.Main }}{{end}}`)
+		writeTestFile(t, filepath.Join(dataPath, "docs", name+".page.yaml"),
+			"TemplateData: {}\nMarkdownContents:\n  Main: "+name+".page.main.md\n")
+	}
+	writeTestFile(t, filepath.Join(dataPath, "docs", "open.page.main.md"), "---\nroles: []\n---\n# Open notes\n")
+	writeTestFile(t, filepath.Join(dataPath, "docs", "staff.page.main.md"), "# Staff notes\n")
+
+	router := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), nil)
+	entry := TemplateEntry{TmplName: "md", TmplType: "markdowm", TmplPath: tmplPath, TmplPrefix: "md",
+		TmplDataPath: dataPath, DefaultRoles: []string{"staff"}}
+	if err := router.SetTemplatesRoutes(context.Background(), []TemplateEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := router.buildSearchIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodGet, "/search", nil)
+	if results := index.Search(req, "notes", 10); len(results) != 1 || results[0].Url != "/md/docs/open.page" {
+		t.Errorf("page without front matter must be restricted by default roles in search: %+v", results)
+	}
+	staff := &Credential{Username: "staff", Roles: []string{"staff"}}
+	ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("AuthUser"), staff)
+	if results := index.Search(req.WithContext(ctx), "notes", 10); len(results) != 2 {
+		t.Errorf("expected 2 results for staff, got: %+v", results)
+	}
+
+	outDir := filepath.Join(root, "public")
+	result, err := router.BuildSite(SiteBuildOptions{OutDir: outDir, SiteUrl: "https://docs.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(result.Pages, ",") != "md/docs/open.page.html" {
+		t.Errorf("page restricted by default roles must not be published: %v", result.Pages)
+	}
+	content, err := os.ReadFile(filepath.Join(outDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), "staff.page") {
+		t.Errorf("page restricted by default roles is in sitemap: %s", content)
+	}
+}
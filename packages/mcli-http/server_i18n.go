@@ -0,0 +1,237 @@
+package mclihttp
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"gopkg.in/yaml.v3"
+)
+
+// MessageCatalog keeps translated messages: locale -> message key -> text
+type MessageCatalog struct {
+	sync.RWMutex
+	DefaultLocale string
+	messages      map[string]map[string]string
+}
+
+// built-in messages for sign in and error pages, catalog files override them
+var defaultMessages = map[string]map[string]string{
+	"en": {
+		"signin.title":       "Sign in",
+		"signin.username":    "Username (email)",
+		"signin.password":    "Password",
+		"signin.submit":      "Login",
+		"search.title":       "Search",
+		"search.placeholder": "Search in documents",
+		"search.submit":      "Find",
+		"search.empty":       "Nothing found",
+		"errors.401":         "Unauthorized",
+		"errors.403":         "Forbidden",
+		"errors.404":         "Not Found",
+		"errors.500":         "Internal Server Error",
+	},
+	"ru": {
+		"signin.title":       "Авторизация",
+		"signin.username":    "Имя пользователя (email)",
+		"signin.password":    "Пароль",
+		"signin.submit":      "Логин",
+		"search.title":       "Поиск",
+		"search.placeholder": "Поиск по документам",
+		"search.submit":      "Найти",
+		"search.empty":       "Ничего не найдено",
+		"errors.401":         "Требуется авторизация",
+		"errors.403":         "Доступ запрещен",
+		"errors.404":         "Не найдено",
+		"errors.500":         "Внутренняя ошибка сервера",
+	},
+}
+
+func NewMessageCatalog(defaultLocale string) *MessageCatalog {
+	if defaultLocale == "" {
+		defaultLocale = "en"
+	}
+	catalog := &MessageCatalog{DefaultLocale: defaultLocale, messages: make(map[string]map[string]string)}
+	for locale, messages := range defaultMessages {
+		for key, text := range messages {
+			catalog.set(locale, key, text)
+		}
+	}
+	return catalog
+}
+
+func (c *MessageCatalog) set(locale, key, text string) {
+	if _, ok := c.messages[locale]; !ok {
+		c.messages[locale] = make(map[string]string)
+	}
+	c.messages[locale][key] = text
+}
+
+// LoadDir loads yaml catalogs named messages.<locale>.yaml or <locale>.yaml,
+// nested keys are joined by dots: signin: {title: ...} -> signin.title
+func (c *MessageCatalog) LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		locale := strings.TrimPrefix(name, "messages.")
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var messages map[string]interface{}
+		if err := yaml.Unmarshal(content, &messages); err != nil {
+			return fmt.Errorf("catalog %s: %w", file, err)
+		}
+		flatMessages := make(map[string]string)
+		flattenMessages("", messages, flatMessages)
+		for key, text := range flatMessages {
+			c.set(locale, key, text)
+		}
+	}
+	return nil
+}
+
+func flattenMessages(prefix string, in map[string]interface{}, out map[string]string) {
+	for key, value := range in {
+		fullKey := key
+		if len(prefix) > 0 {
+			fullKey = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]interface{}); ok {
+			flattenMessages(fullKey, nested, out)
+			continue
+		}
+		out[fullKey] = fmt.Sprint(value)
+	}
+}
+
+// Translate returns message for locale, falls back to default locale and to key itself.
+// Args are used as fmt arguments of message.
+func (c *MessageCatalog) Translate(locale, key string, args ...interface{}) string {
+	c.RLock()
+	text, ok := c.messages[locale][key]
+	if !ok {
+		text, ok = c.messages[c.DefaultLocale][key]
+	}
+	c.RUnlock()
+	if !ok {
+		text = key
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+// Locales returns configured locales or locales of loaded catalogs of current state
+func Locales() []string {
+	return CurrentServerState().Locales()
+}
+
+// parseAcceptLanguage returns language tags ordered by quality: "ru-RU,ru;q=0.9,en;q=0.8"
+func parseAcceptLanguage(header string) []string {
+	type langQ struct {
+		tag string
+		q   float64
+	}
+	langs := make([]langQ, 0)
+	for _, part := range strings.Split(header, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		tag, q := part, 1.0
+		if idx := strings.Index(part, ";"); idx >= 0 {
+			tag = strings.TrimSpace(part[:idx])
+			if qValue, found := strings.CutPrefix(strings.TrimSpace(part[idx+1:]), "q="); found {
+				if parsed, err := strconv.ParseFloat(qValue, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		langs = append(langs, langQ{tag: strings.ToLower(tag), q: q})
+	}
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+	tags := make([]string, 0, len(langs))
+	for _, l := range langs {
+		tags = append(tags, l.tag)
+	}
+	return tags
+}
+
+// NegotiateLocale picks locale from cookie or Accept-Language header, default locale otherwise
+func NegotiateLocale(req *http.Request) string {
+	st := stateOf(req)
+	cookieName := st.Config.Server.I18n.CookieName
+	if cookieName == "" {
+		cookieName = "locale"
+	}
+	if cookie, err := req.Cookie(cookieName); err == nil && st.isSupportedLocale(cookie.Value) {
+		return cookie.Value
+	}
+	for _, tag := range parseAcceptLanguage(req.Header.Get("Accept-Language")) {
+		if st.isSupportedLocale(tag) {
+			return tag
+		}
+		if primary, _, found := strings.Cut(tag, "-"); found && st.isSupportedLocale(primary) {
+			return primary
+		}
+	}
+	return st.Catalog.DefaultLocale
+}
+
+// LocaleFromRequest returns locale set by locale middleware or default one
+func LocaleFromRequest(req *http.Request) string {
+	if req != nil {
+		if locale, ok := req.Context().Value(go_common_ddru.ContextKey("Locale")).(string); ok && len(locale) > 0 {
+			return locale
+		}
+	}
+	return stateOf(req).Catalog.DefaultLocale
+}
+
+// localizedPath inserts locale before extension: home.page.main.md -> home.page.main.ru.md
+func localizedPath(path, locale string) string {
+	if len(locale) == 0 {
+		return path
+	}
+	ext := filepath.Ext(path)
+	return strings.TrimSuffix(path, ext) + "." + locale + ext
+}
+
+// findLocalized returns existing locale variant of path or path itself if it exists, empty string otherwise
+func findLocalized(path, locale string) string {
+	if len(locale) > 0 {
+		if e, _ := exists(localizedPath(path, locale)); e {
+			return localizedPath(path, locale)
+		}
+	}
+	if e, _ := exists(path); e {
+		return path
+	}
+	return ""
+}
+
+// HttpErrorLocalized writes error with status text translated to request locale
+func HttpErrorLocalized(res http.ResponseWriter, req *http.Request, code int, details string) {
+	statusText := stateOf(req).Catalog.Translate(LocaleFromRequest(req), fmt.Sprintf("errors.%d", code))
+	if statusText == fmt.Sprintf("errors.%d", code) {
+		statusText = http.StatusText(code)
+	}
+	message := fmt.Sprintf("%d %s", code, statusText)
+	if len(details) > 0 {
+		message = message + ": " + details
+	}
+	http.Error(res, message, code)
+}
@@ -0,0 +1,91 @@
+package mclihttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocaleNegotiation(t *testing.T) {
+	saved := CurrentServerState()
+	defer PublishServerState(saved)
+	var config Http
+	config.Server.I18n.Locales = []string{"en", "ru"}
+	PublishServerState(NewServerState(config))
+
+	var gotLocale, gotPath string
+	mw := NewLocale(true)
+	mw.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		gotLocale, gotPath = LocaleFromRequest(req), req.URL.Path
+	}))
+
+	cases := []struct {
+		url, acceptLanguage, cookie string
+		locale, path                string
+	}{
+		{"/ru/tmpl/home", "en", "", "ru", "/tmpl/home"},
+		{"/tmpl/home", "de-DE,ru-RU;q=0.9,en;q=0.8", "", "ru", "/tmpl/home"},
+		{"/tmpl/home", "ru", "en", "en", "/tmpl/home"},
+		{"/rus/home", "fr", "", "en", "/rus/home"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, c.url, nil)
+		req.Header.Set("Accept-Language", c.acceptLanguage)
+		if len(c.cookie) > 0 {
+			req.AddCookie(&http.Cookie{Name: "locale", Value: c.cookie})
+		}
+		mw.ServeHTTP(httptest.NewRecorder(), req)
+		if gotLocale != c.locale || gotPath != c.path {
+			t.Errorf("%s: expected %s %s, got %s %s", c.url, c.locale, c.path, gotLocale, gotPath)
+		}
+		if req.URL.Path != c.url {
+			t.Errorf("%s: url of outer request is changed to %s", c.url, req.URL.Path)
+		}
+	}
+}
+
+func TestMessageCatalogAndLocalizedPages(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "i18n", "messages.ru.yaml"), "home:\n  greeting: Привет, %s\n")
+	writeTestFile(t, filepath.Join(root, "tmpl", "__base", "base.layout.html"), `{{define "base"}}{{template "main" .}}{{end}}`)
+	writeTestFile(t, filepath.Join(root, "tmpl", "__partial", "empty.partial.html"), `{{define "empty"}}{{end}}`)
+	writeTestFile(t, filepath.Join(root, "tmpl", "home", "home.page.html"), `{{template "base" .}}{{define "main"}}default{{end}}`)
+	writeTestFile(t, filepath.Join(root, "tmpl", "home", "home.page.ru.html"), `{{template "base" .}}{{define "main"}}ru{{end}}`)
+
+	catalog := NewMessageCatalog("en")
+	if err := catalog.LoadDir(filepath.Join(root, "i18n")); err != nil {
+		t.Fatal(err)
+	}
+	if got := catalog.Translate("ru", "home.greeting", "мир"); got != "Привет, мир" {
+		t.Errorf("unexpected translation: %s", got)
+	}
+	if got := catalog.Translate("de", "signin.title"); got != "Sign in" {
+		t.Errorf("expected fallback to default locale, got: %s", got)
+	}
+	if got := catalog.Translate("ru", "unknown.key"); got != "unknown.key" {
+		t.Errorf("expected key for unknown message, got: %s", got)
+	}
+
+	cache, err := LoadMyTemplatesCache(filepath.Join(root, "tmpl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &MyTemplateCache{cache: cache}
+	homeKey := filepath.Join(root, "tmpl", "home", "home.page")
+	if got := renderTestTemplate(t, c, homeKey+".ru"); got != "ru" {
+		t.Errorf("unexpected localized page: %s", got)
+	}
+	if got := renderTestTemplate(t, c, homeKey); got != "default" {
+		t.Errorf("unexpected default page: %s", got)
+	}
+	mdPath := filepath.Join(root, "home.page.main.md")
+	writeTestFile(t, mdPath, "# main")
+	if got := findLocalized(mdPath, "ru"); got != mdPath {
+		t.Errorf("expected fallback to %s, got %s", mdPath, got)
+	}
+	writeTestFile(t, filepath.Join(root, "home.page.main.ru.md"), "# главная")
+	if got := findLocalized(mdPath, "ru"); got != filepath.Join(root, "home.page.main.ru.md") {
+		t.Errorf("expected localized markdown, got %s", got)
+	}
+}
@@ -9,11 +9,15 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/gomarkdown/markdown"
 	"github.com/gomarkdown/markdown/ast"
 	"github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
 	"github.com/microcosm-cc/bluemonday"
 	"gopkg.in/yaml.v3"
 )
@@ -21,9 +25,25 @@ import (
 type MyRenderer struct {
 	html.Renderer
 }
+
+// MdMetaData is metadata of markdown source given as YAML front matter between --- lines
+// or (legacy form) in the first HTML comment. Roles are nil when front matter does not set them.
 type MdMetaData struct {
-	IsTemplate       bool   `yaml:"is-template"`
-	TemplateDataPath string `yaml:"template-data-path"`
+	IsTemplate       bool     `yaml:"is-template"`
+	TemplateDataPath string   `yaml:"template-data-path"`
+	Title            string   `yaml:"title"`
+	Description      string   `yaml:"description"`
+	Layout           string   `yaml:"layout"`
+	Roles            []string `yaml:"roles"`
+	Draft            bool     `yaml:"draft"`
+}
+
+// MdPage is result of markdown conversion
+type MdPage struct {
+	Meta    MdMetaData
+	Html    []byte
+	Toc     []MdTocEntry
+	TocHtml template.HTML
 }
 
 // an actual rendering of Paragraph is more complicated
@@ -43,15 +63,137 @@ func myRenderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bo
 	return ast.GoToNext, false
 }
 
-func newCustomizedRender() *html.Renderer {
+func newCustomizedRender(admonitions map[*ast.BlockQuote]string) *html.Renderer {
+	var renderer *html.Renderer
 	opts := html.RendererOptions{
-		Flags:          html.CommonFlags,
-		RenderNodeHook: myRenderHook,
+		Flags: html.CommonFlags,
+		RenderNodeHook: func(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+			switch n := node.(type) {
+			case *ast.Heading:
+				return headingRenderHook(renderer, w, n, entering)
+			case *ast.CodeBlock:
+				return codeBlockRenderHook(w, n, entering)
+			case *ast.BlockQuote:
+				return admonitionRenderHook(w, n, entering, admonitions)
+			}
+			return myRenderHook(w, node, entering)
+		},
+	}
+	renderer = html.NewRenderer(opts)
+	return renderer
+}
+
+// markdownPolicy is UGC policy which keeps classes produced by our render hooks
+var markdownPolicy = func() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("class").Matching(
+		regexp.MustCompile(`^(md-[a-z-]+|admonition( admonition-[a-z]+)?|admonition-title|hl-[a-z]+)$`),
+	).OnElements("div", "p", "span", "a")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[a-z0-9]+$`)).OnElements("code")
+	return policy
+}()
+
+// mergeMdMetaData returns page metadata of its markdown contents: page is draft if any content is draft,
+// roles of all contents are joined, title, description and layout are taken from first content which sets them.
+// Page gets default roles when none of contents sets roles (roles: [] in front matter makes page public).
+func mergeMdMetaData(metas map[string]*MdMetaData, defaultRoles []string) MdMetaData {
+	keys := make([]string, 0, len(metas))
+	for key := range metas {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var result MdMetaData
+	hasRoles := false
+	for _, key := range keys {
+		meta := metas[key]
+		result.Draft = result.Draft || meta.Draft
+		hasRoles = hasRoles || meta.Roles != nil
+		for _, role := range meta.Roles {
+			if !slices.Contains(result.Roles, role) {
+				result.Roles = append(result.Roles, role)
+			}
+		}
+		if len(result.Title) == 0 {
+			result.Title = meta.Title
+		}
+		if len(result.Description) == 0 {
+			result.Description = meta.Description
+		}
+		if len(result.Layout) == 0 {
+			result.Layout = meta.Layout
+		}
+	}
+	if !hasRoles {
+		result.Roles = slices.Clone(defaultRoles)
+	}
+	return result
+}
+
+// allowedFor reports whether user of request has any of roles, page without roles is allowed for everyone
+func (meta MdMetaData) allowedFor(req *http.Request) bool {
+	if len(meta.Roles) == 0 {
+		return true
+	}
+	for _, role := range meta.Roles {
+		if tmplHasRole(req, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitMdMetaData returns metadata of markdown source and source without front matter
+func splitMdMetaData(mddata []byte) (MdMetaData, []byte) {
+	var metaData MdMetaData = MdMetaData{IsTemplate: false}
+
+	// front matter: source starts with --- line and metadata ends with next --- line
+	content := bytes.TrimPrefix(mddata, []byte("\ufeff"))
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	if len(lines) > 1 && string(bytes.TrimSpace(lines[0])) == "---" {
+		offset := len(lines[0])
+		for _, line := range lines[1:] {
+			if string(bytes.TrimSpace(line)) == "---" {
+				if err := yaml.Unmarshal(content[len(lines[0]):offset], &metaData); err != nil {
+					return MdMetaData{IsTemplate: false}, mddata
+				}
+				return metaData, content[offset+len(line):]
+			}
+			offset += len(line)
+		}
+	}
+
+	startMarker := []byte("<!--")
+	endMarker := []byte("-->")
+
+	startIndex := bytes.Index(mddata, startMarker)
+	endIndex := bytes.Index(mddata, endMarker)
+
+	if startIndex != -1 && endIndex != -1 && startIndex < endIndex {
+		commentContent := mddata[startIndex+len(startMarker) : endIndex]
+
+		err := yaml.Unmarshal(commentContent, &metaData)
+		if err != nil {
+			metaData = MdMetaData{IsTemplate: false}
+		}
 	}
-	return html.NewRenderer(opts)
+	return metaData, mddata
 }
 
 func ConvertMdToHtml(source string) ([]byte, error) {
+	page, err := ConvertMdToPage(source)
+	if err != nil {
+		return nil, err
+	}
+	return page.Html, nil
+}
+
+// ConvertMdToPage converts markdown source (file path or url) to html with its metadata and table of contents,
+// remote sources are fetched by fetcher of current state
+func ConvertMdToPage(source string) (*MdPage, error) {
+	return convertMdToPage(source, CurrentServerState().RemoteContent)
+}
+
+func convertMdToPage(source string, fetcher *RemoteFetcher) (*MdPage, error) {
 	if len(source) == 0 {
 		return nil, fmt.Errorf("%v", "zero length source")
 	}
@@ -60,32 +202,17 @@ func ConvertMdToHtml(source string) ([]byte, error) {
 
 	// if source is internet resource
 	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
-		// return nil, fmt.Errorf("%v", "uri source don't support")
-
-		// Make the HTTP GET request
-		response, err := http.Get(source)
-		if err != nil {
-
-			return nil, err
-		}
-		defer response.Body.Close()
-
-		// Check the response status code
-		if response.StatusCode != http.StatusOK {
-			err = fmt.Errorf("unexpected status code: %v", response.StatusCode)
-			return nil, err
-		}
-
-		// Read the response body into a byte slice
-		mddata, err = io.ReadAll(response.Body)
+		var err error
+		mddata, err = fetcher.Fetch(source)
 		if err != nil {
 			return nil, err
 		}
-		// os.WriteFile("temp.md", bodyBytes, 0644)
-		// return bodyBytes, nil
 	} else {
 		// is source is file
 		if isExist, e := exists(source); !isExist {
+			if e == nil {
+				e = fmt.Errorf("markdown source %s not found", source)
+			}
 			return nil, e
 		}
 		// Read the Markdown file
@@ -94,21 +221,7 @@ func ConvertMdToHtml(source string) ([]byte, error) {
 			return nil, e
 		}
 	}
-	startMarker := []byte("<!--")
-	endMarker := []byte("-->")
-
-	startIndex := bytes.Index(mddata, startMarker)
-	endIndex := bytes.Index(mddata, endMarker)
-	var metaData MdMetaData = MdMetaData{IsTemplate: false}
-
-	if startIndex != -1 && endIndex != -1 && startIndex < endIndex {
-		commentContent := mddata[startIndex+len(startMarker) : endIndex]
-
-		err := yaml.Unmarshal(commentContent, &metaData)
-		if err != nil {
-			metaData = MdMetaData{IsTemplate: false}
-		}
-	}
+	metaData, mddata := splitMdMetaData(mddata)
 
 	if metaData.IsTemplate {
 		var data interface{} = struct{}{}
@@ -117,7 +230,7 @@ func ConvertMdToHtml(source string) ([]byte, error) {
 		// lets get data
 		var rawDataForMd []byte
 		if strings.HasPrefix(dataSource, "http://") || strings.HasPrefix(dataSource, "https://") {
-			rawDataForMd, err = getHTTP(dataSource)
+			rawDataForMd, err = fetcher.Fetch(dataSource)
 			if err != nil {
 				rawDataForMd = make([]byte, 0)
 			}
@@ -136,7 +249,6 @@ func ConvertMdToHtml(source string) ([]byte, error) {
 		if err != nil {
 			data = struct{}{}
 		}
-		fmt.Println("dataformd:", data)
 		tmpl, err := template.New("mdtmpl").Parse(string(mddata))
 		if err != nil {
 			return nil, err
@@ -144,43 +256,21 @@ func ConvertMdToHtml(source string) ([]byte, error) {
 		var result bytes.Buffer
 		err = tmpl.Execute(&result, data)
 		if err != nil {
-			fmt.Println("error md templates:", err)
 			return nil, err
 		}
 		mddata = result.Bytes()
-		fmt.Println(string(mddata))
 	}
 
 	mddata = markdown.NormalizeNewlines(mddata)
 
-	renderer := newCustomizedRender()
-	maybeUnsafeHTML := markdown.ToHTML(mddata, nil, renderer)
-	html := bluemonday.UGCPolicy().SanitizeBytes(maybeUnsafeHTML)
+	doc := markdown.Parse(mddata, parser.NewWithExtensions(parser.CommonExtensions))
+	toc := setHeadingAnchors(doc)
+	admonitions := findAdmonitions(doc)
 
-	return html, nil
-
-}
+	renderer := newCustomizedRender(admonitions)
+	maybeUnsafeHTML := markdown.Render(doc, renderer)
+	html := markdownPolicy.SanitizeBytes(maybeUnsafeHTML)
 
-func getHTTP(url string) ([]byte, error) {
+	return &MdPage{Meta: metaData, Html: html, Toc: toc, TocHtml: renderToc(toc)}, nil
 
-	// Make the HTTP GET request
-	response, err := http.Get(url)
-	if err != nil {
-		fmt.Println(err)
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	// Check the response status code
-	if response.StatusCode != http.StatusOK {
-		err = fmt.Errorf("unexpected status code: %v", response.StatusCode)
-		return nil, err
-	}
-
-	// Read the response body into a byte slice
-	content, err := io.ReadAll(response.Body)
-	if err != nil {
-		return nil, err
-	}
-	return content, nil
 }
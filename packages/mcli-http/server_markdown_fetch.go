@@ -0,0 +1,228 @@
+package mclihttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	mcli_type "mcli/packages/mcli-type"
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"github.com/rs/zerolog"
+)
+
+// RemoteFetcher downloads remote markdown and data sources from allowed hosts.
+// Responses are cached and revalidated with ETag and Last-Modified,
+// cached copy is served when upstream is not available.
+type RemoteFetcher struct {
+	// host names, "*.example.com" allows all subdomains, empty list denies all remote sources
+	AllowedHosts []string
+	MaxBodySize  int64
+	// cached copy is served without revalidation during this period
+	FreshFor time.Duration
+	Client   *http.Client
+	Cache    mcli_type.Cacher
+	// when it is set cached copies are kept in store under KVPrefix instead of Cache
+	KVStore  mcli_type.KVStorer
+	KVPrefix string
+	// cached copies are kept in store for this period
+	KVTtl    time.Duration
+	ErrorLog zerolog.Logger
+
+	// mu guards calls, concurrent fetches of the same source wait for the first of them
+	mu    sync.Mutex
+	calls map[string]*remoteCall
+}
+
+// remoteCall is fetch of source in progress
+type remoteCall struct {
+	done chan struct{}
+	body []byte
+	err  error
+}
+
+// remoteContent is cached copy of remote source
+type remoteContent struct {
+	Body         []byte    `json:"body"`
+	ETag         string    `json:"etag"`
+	LastModified string    `json:"last-modified"`
+	Fetched      time.Time `json:"fetched"`
+}
+
+func NewRemoteFetcher(allowedHosts []string, timeout time.Duration, maxBodySize int64) *RemoteFetcher {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	if maxBodySize <= 0 {
+		maxBodySize = 5 << 20
+	}
+	return &RemoteFetcher{
+		AllowedHosts: allowedHosts,
+		MaxBodySize:  maxBodySize,
+		FreshFor:     time.Minute,
+		Client:       &http.Client{Timeout: timeout},
+		Cache:        mcli_utils.NewCCache(0, 0, nil, nil, nil),
+		KVPrefix:     "remote-content",
+		KVTtl:        24 * time.Hour,
+		ErrorLog:     zerolog.Nop(),
+	}
+}
+
+// isAllowedHost checks host of url against allow list
+func (f *RemoteFetcher) isAllowedHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, allowed := range f.AllowedHosts {
+		allowed = strings.ToLower(strings.TrimSpace(allowed))
+		if allowed == host {
+			return true
+		}
+		if suffix, found := strings.CutPrefix(allowed, "*."); found && strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *RemoteFetcher) load(key string) (*remoteContent, bool) {
+	if f.KVStore != nil {
+		raw, err, ok := f.KVStore.GetRecord(key, f.KVPrefix)
+		if err != nil || !ok {
+			return nil, false
+		}
+		var content remoteContent
+		if err := f.KVStore.GetUnMarshal()(raw, &content); err != nil {
+			return nil, false
+		}
+		return &content, true
+	}
+	value, err := f.Cache.Get(key)
+	if err != nil {
+		return nil, false
+	}
+	content, ok := value.(*remoteContent)
+	return content, ok
+}
+
+func (f *RemoteFetcher) store(key string, content *remoteContent) {
+	if f.KVStore != nil {
+		if err := f.KVStore.SetRecordEx(key, content, int(f.KVTtl.Seconds()), f.KVPrefix); err != nil {
+			f.ErrorLog.Error().Msgf("remote content %s is not cached: %v", key, err)
+		}
+		return
+	}
+	f.Cache.Set(key, nil, 0, content)
+}
+
+// checkRedirect follows redirects only to allowed hosts
+func (f *RemoteFetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return fmt.Errorf("stopped after 10 redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme of redirect to %s", req.URL.Redacted())
+	}
+	if !f.isAllowedHost(req.URL.Hostname()) {
+		return fmt.Errorf("redirect to host %s is not allowed for remote sources", req.URL.Hostname())
+	}
+	return nil
+}
+
+// Fetch returns body of remote source
+func (f *RemoteFetcher) Fetch(source string) ([]byte, error) {
+	sourceUrl, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	if sourceUrl.Scheme != "http" && sourceUrl.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme of remote source %s", source)
+	}
+	if !f.isAllowedHost(sourceUrl.Hostname()) {
+		return nil, fmt.Errorf("host %s is not allowed for remote sources", sourceUrl.Hostname())
+	}
+
+	// one request to upstream per source at a time keeps cache consistent,
+	// requests of other sources are not blocked
+	f.mu.Lock()
+	if call, found := f.calls[source]; found {
+		f.mu.Unlock()
+		<-call.done
+		return call.body, call.err
+	}
+	if f.calls == nil {
+		f.calls = make(map[string]*remoteCall)
+	}
+	call := &remoteCall{done: make(chan struct{})}
+	f.calls[source] = call
+	f.mu.Unlock()
+
+	call.body, call.err = f.fetchCached(source)
+
+	f.mu.Lock()
+	delete(f.calls, source)
+	f.mu.Unlock()
+	close(call.done)
+	return call.body, call.err
+}
+
+// fetchCached returns fresh cached copy or revalidates it with upstream
+func (f *RemoteFetcher) fetchCached(source string) ([]byte, error) {
+	cached, isCached := f.load(source)
+	if isCached && time.Since(cached.Fetched) < f.FreshFor {
+		return cached.Body, nil
+	}
+	content, err := f.fetch(source, cached)
+	if err != nil {
+		if isCached {
+			f.ErrorLog.Error().Msgf("stale copy of %s is served: %v", source, err)
+			return cached.Body, nil
+		}
+		return nil, err
+	}
+	f.store(source, content)
+	return content.Body, nil
+}
+
+// fetch makes conditional request if there is cached copy
+func (f *RemoteFetcher) fetch(source string, cached *remoteContent) (*remoteContent, error) {
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached != nil {
+		if len(cached.ETag) > 0 {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if len(cached.LastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	// redirects are checked even if client is replaced
+	client := *f.Client
+	client.CheckRedirect = f.checkRedirect
+	response, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		return &remoteContent{Body: cached.Body, ETag: cached.ETag, LastModified: cached.LastModified,
+			Fetched: time.Now()}, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %v", response.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(response.Body, f.MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > f.MaxBodySize {
+		return nil, fmt.Errorf("remote source %s is larger than %d bytes", source, f.MaxBodySize)
+	}
+	return &remoteContent{Body: body, ETag: response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"), Fetched: time.Now()}, nil
+}
@@ -0,0 +1,351 @@
+package mclihttp
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	mcli_utils "mcli/packages/mcli-utils"
+
+	"github.com/gomarkdown/markdown/ast"
+	"github.com/gomarkdown/markdown/html"
+)
+
+// MdTocEntry is heading of markdown page
+type MdTocEntry struct {
+	Level int
+	Id    string
+	Title string
+}
+
+// translitCyrillic transliterates cyrillic letters and keeps other runes as is
+func translitCyrillic(text string) string {
+	var out strings.Builder
+	for _, r := range text {
+		if unicode.Is(unicode.Cyrillic, r) {
+			out.WriteString(mcli_utils.TranslitToLatFromCyr(string(r)))
+		} else {
+			out.WriteRune(r)
+		}
+	}
+	return out.String()
+}
+
+// headingSlug makes anchor id from heading text, cyrillic is transliterated: "Часть 1" -> "chast-1"
+func headingSlug(title string) string {
+	var slug strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(translitCyrillic(title)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			slug.WriteRune(r)
+			lastDash = false
+			continue
+		}
+		if !lastDash {
+			slug.WriteRune('-')
+			lastDash = true
+		}
+	}
+	result := strings.TrimSuffix(slug.String(), "-")
+	if len(result) == 0 {
+		result = "section"
+	}
+	return result
+}
+
+// isSafeAnchor reports whether id consists of [A-Za-z0-9_-] only
+func isSafeAnchor(id string) bool {
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// nodeText returns plain text of node children
+func nodeText(node ast.Node) string {
+	var text strings.Builder
+	ast.WalkFunc(node, func(n ast.Node, entering bool) ast.WalkStatus {
+		if leaf := n.AsLeaf(); entering && leaf != nil {
+			text.Write(leaf.Literal)
+		}
+		return ast.GoToNext
+	})
+	return strings.TrimSpace(text.String())
+}
+
+// setHeadingAnchors sets unique ids of headings and returns table of contents
+func setHeadingAnchors(doc ast.Node) []MdTocEntry {
+	toc := make([]MdTocEntry, 0)
+	used := make(map[string]int)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		heading, ok := node.(*ast.Heading)
+		if !ok || !entering || heading.IsTitleblock {
+			return ast.GoToNext
+		}
+		title := nodeText(heading)
+		id := heading.HeadingID
+		if len(id) == 0 {
+			id = headingSlug(title)
+		} else if !isSafeAnchor(id) {
+			// custom {#id} anchor is limited to [A-Za-z0-9_-], others are slugified
+			id = headingSlug(id)
+		}
+		if count, ok := used[id]; ok {
+			used[id] = count + 1
+			id = fmt.Sprintf("%s-%d", id, count+1)
+		}
+		used[id] = 0
+		heading.HeadingID = id
+		toc = append(toc, MdTocEntry{Level: heading.Level, Id: id, Title: title})
+		return ast.SkipChildren
+	})
+	return toc
+}
+
+// renderToc renders nested lists of headings
+func renderToc(toc []MdTocEntry) template.HTML {
+	if len(toc) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	out.WriteString(`<nav class="md-toc">`)
+	levels := make([]int, 0)
+	for _, entry := range toc {
+		for len(levels) > 0 && levels[len(levels)-1] > entry.Level {
+			out.WriteString("</li></ul>")
+			levels = levels[:len(levels)-1]
+		}
+		if len(levels) == 0 || levels[len(levels)-1] < entry.Level {
+			out.WriteString("<ul>")
+			levels = append(levels, entry.Level)
+		} else {
+			out.WriteString("</li>")
+		}
+		fmt.Fprintf(&out, `<li><a href="#%s">%s</a>`, template.HTMLEscapeString(entry.Id), template.HTMLEscapeString(entry.Title))
+	}
+	for range levels {
+		out.WriteString("</li></ul>")
+	}
+	out.WriteString("</nav>")
+	return template.HTML(out.String())
+}
+
+// headingRenderHook renders heading with anchor link to itself
+func headingRenderHook(r *html.Renderer, w io.Writer, heading *ast.Heading, entering bool) (ast.WalkStatus, bool) {
+	r.Heading(w, heading, entering)
+	if entering && len(heading.HeadingID) > 0 {
+		fmt.Fprintf(w, `<a class="md-anchor" href="#%s">#</a> `, heading.HeadingID)
+	}
+	return ast.GoToNext, true
+}
+
+// admonitionKinds are github style markers of block quotes: > [!NOTE]
+var admonitionKinds = []string{"note", "tip", "important", "warning", "caution"}
+
+// findAdmonitions detects admonition block quotes, removes their markers and returns kind of each of them
+func findAdmonitions(doc ast.Node) map[*ast.BlockQuote]string {
+	admonitions := make(map[*ast.BlockQuote]string)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		quote, ok := node.(*ast.BlockQuote)
+		if !ok || !entering {
+			return ast.GoToNext
+		}
+		para, ok := ast.GetFirstChild(quote).(*ast.Paragraph)
+		if !ok {
+			return ast.GoToNext
+		}
+		// marker can be split by parser into several text nodes: "[", "!NOTE]"
+		var marker []byte
+		texts := make([]*ast.Text, 0)
+		for _, child := range para.GetChildren() {
+			text, ok := child.(*ast.Text)
+			if !ok || bytes.Contains(marker, []byte("]")) {
+				break
+			}
+			marker = append(marker, text.Literal...)
+			texts = append(texts, text)
+		}
+		for _, kind := range admonitionKinds {
+			prefix := []byte("[!" + strings.ToUpper(kind) + "]")
+			if !bytes.HasPrefix(bytes.ToUpper(marker), prefix) {
+				continue
+			}
+			admonitions[quote] = kind
+			// cut marker from text nodes
+			cut := len(prefix)
+			for _, text := range texts {
+				n := min(cut, len(text.Literal))
+				text.Literal = bytes.TrimLeft(text.Literal[n:], " \n")
+				cut -= n
+			}
+			break
+		}
+		return ast.GoToNext
+	})
+	return admonitions
+}
+
+// admonitionRenderHook renders admonition block quotes as div with title
+func admonitionRenderHook(w io.Writer, quote *ast.BlockQuote, entering bool, admonitions map[*ast.BlockQuote]string) (ast.WalkStatus, bool) {
+	kind, ok := admonitions[quote]
+	if !ok {
+		return ast.GoToNext, false
+	}
+	if entering {
+		fmt.Fprintf(w, `<div class="admonition admonition-%s"><p class="admonition-title">%s</p>`,
+			kind, strings.ToUpper(kind[:1])+kind[1:])
+	} else {
+		io.WriteString(w, "</div>\n")
+	}
+	return ast.GoToNext, true
+}
+
+// highlightSyntax describes tokens of language for simple highlighter
+type highlightSyntax struct {
+	keywords       map[string]bool
+	ignoreCase     bool
+	lineComments   []string
+	stringQuotes   string
+	multiLineQuote byte
+}
+
+func newHighlightSyntax(keywords string, lineComments []string, quotes string, multiLineQuote byte) *highlightSyntax {
+	syntax := &highlightSyntax{keywords: make(map[string]bool), lineComments: lineComments,
+		stringQuotes: quotes, multiLineQuote: multiLineQuote}
+	for _, keyword := range strings.Fields(keywords) {
+		syntax.keywords[keyword] = true
+	}
+	return syntax
+}
+
+var highlightSyntaxes = func() map[string]*highlightSyntax {
+	golang := newHighlightSyntax(`break case chan const continue default defer else fallthrough for func go goto if
+		import interface map package range return select struct switch type var nil true false iota`,
+		[]string{"//"}, "\"'`", '`')
+	js := newHighlightSyntax(`async await break case catch class const continue default delete do else export
+		extends finally for function if import in instanceof let new return switch this throw try typeof var
+		void while yield null undefined true false`, []string{"//"}, "\"'`", '`')
+	python := newHighlightSyntax(`and as assert async await break class continue def del elif else except finally
+		for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False`,
+		[]string{"#"}, "\"'", 0)
+	shell := newHighlightSyntax(`if then else elif fi for while until do done case esac in function return
+		export local echo exit`, []string{"#"}, "\"'", 0)
+	yamlSyntax := newHighlightSyntax(`true false null yes no`, []string{"#"}, "\"'", 0)
+	jsonSyntax := newHighlightSyntax(`true false null`, nil, "\"", 0)
+	sql := newHighlightSyntax(`select from where insert into values update set delete create table drop alter
+		join left right inner outer on group by order having limit and or not null as distinct`,
+		[]string{"--"}, "'\"", 0)
+	sql.ignoreCase = true
+	return map[string]*highlightSyntax{
+		"go": golang, "golang": golang,
+		"js": js, "javascript": js, "ts": js, "typescript": js,
+		"python": python, "py": python,
+		"bash": shell, "sh": shell, "shell": shell,
+		"yaml": yamlSyntax, "yml": yamlSyntax,
+		"json": jsonSyntax,
+		"sql":  sql,
+	}
+}()
+
+// codeBlockRenderHook renders fenced code blocks of known languages with highlighted tokens
+func codeBlockRenderHook(w io.Writer, codeBlock *ast.CodeBlock, entering bool) (ast.WalkStatus, bool) {
+	language := strings.ToLower(strings.TrimSpace(string(codeBlock.Info)))
+	if fields := strings.Fields(language); len(fields) > 0 {
+		language = fields[0]
+	}
+	syntax, ok := highlightSyntaxes[language]
+	if !ok {
+		return ast.GoToNext, false
+	}
+	fmt.Fprintf(w, "<pre><code class=\"language-%s\">", language)
+	highlightCode(w, string(codeBlock.Literal), syntax)
+	io.WriteString(w, "</code></pre>\n")
+	return ast.GoToNext, true
+}
+
+func writeHighlighted(w io.Writer, class, text string) {
+	if len(class) == 0 {
+		html.EscapeHTML(w, []byte(text))
+		return
+	}
+	fmt.Fprintf(w, `<span class="hl-%s">`, class)
+	html.EscapeHTML(w, []byte(text))
+	io.WriteString(w, "</span>")
+}
+
+// highlightCode splits code into comments, strings, numbers, keywords and plain text,
+// code is scanned by byte offsets, so tokens are substrings of code without copies of its rest
+func highlightCode(w io.Writer, code string, syntax *highlightSyntax) {
+	isIdent := func(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+	// scan returns offset of first rune from offset j which does not match
+	scan := func(j int, match func(rune) bool) int {
+		for j < len(code) {
+			r, size := utf8.DecodeRuneInString(code[j:])
+			if !match(r) {
+				break
+			}
+			j += size
+		}
+		return j
+	}
+	for i := 0; i < len(code); {
+		rest := code[i:]
+		r, size := utf8.DecodeRuneInString(rest)
+		isComment := false
+		for _, marker := range syntax.lineComments {
+			if strings.HasPrefix(rest, marker) {
+				isComment = true
+			}
+		}
+		switch {
+		case isComment:
+			end := strings.IndexByte(rest, '\n')
+			if end == -1 {
+				end = len(rest)
+			}
+			writeHighlighted(w, "comment", rest[:end])
+			i += end
+		case strings.ContainsRune(syntax.stringQuotes, r):
+			quote, escaped := r, false
+			j := scan(i+size, func(c rune) bool {
+				if escaped {
+					escaped = false
+					return true
+				}
+				if c == '\\' && quote != rune(syntax.multiLineQuote) {
+					escaped = true
+					return true
+				}
+				return c != quote && (c != '\n' || quote == rune(syntax.multiLineQuote))
+			})
+			if j < len(code) {
+				_, closing := utf8.DecodeRuneInString(code[j:])
+				j += closing
+			}
+			writeHighlighted(w, "string", code[i:j])
+			i = j
+		case unicode.IsDigit(r):
+			j := scan(i, func(c rune) bool { return isIdent(c) || c == '.' })
+			writeHighlighted(w, "number", code[i:j])
+			i = j
+		case isIdent(r):
+			j := scan(i, isIdent)
+			word := code[i:j]
+			if syntax.keywords[word] || (syntax.ignoreCase && syntax.keywords[strings.ToLower(word)]) {
+				writeHighlighted(w, "keyword", word)
+			} else {
+				writeHighlighted(w, "", word)
+			}
+			i = j
+		default:
+			writeHighlighted(w, "", rest[:size])
+			i += size
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package mclihttp
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConvertMdToPage(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "notes.page.main.md")
+	writeTestFile(t, source, "---\ntitle: Заметки\nroles: [admin]\nlayout: docs\n---\n"+
+		"# Часть 1. Основы\n\n> [!WARNING]\n> Be careful\n\n## Code\n\n```go\n// comment\nx := \"a<b\"\n```\n\n## Code\n")
+
+	page, err := ConvertMdToPage(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Meta.Title != "Заметки" || page.Meta.Layout != "docs" || len(page.Meta.Roles) != 1 {
+		t.Errorf("unexpected front matter: %+v", page.Meta)
+	}
+	html := string(page.Html)
+	for _, expected := range []string{
+		`<h1 id="chast-1-osnovy">`,
+		`<h2 id="code-1">`,
+		`<div class="admonition admonition-warning"><p class="admonition-title">Warning</p>`,
+		`<code class="language-go"><span class="hl-comment">// comment</span>`,
+		`<span class="hl-string">&#34;a&lt;b&#34;</span>`,
+	} {
+		if !strings.Contains(html, expected) {
+			t.Errorf("expected %s in html:\n%s", expected, html)
+		}
+	}
+	if strings.Contains(html, "---") || strings.Contains(html, "[!WARNING]") {
+		t.Errorf("front matter or admonition marker is rendered:\n%s", html)
+	}
+	if len(page.Toc) != 3 || page.Toc[1].Id != "code" || page.Toc[1].Level != 2 {
+		t.Errorf("unexpected toc: %+v", page.Toc)
+	}
+
+	merged := mergeMdMetaData(map[string]*MdMetaData{"main": &page.Meta, "footer": {Draft: true, Roles: []string{"admin", "editor"}}},
+		[]string{"staff"})
+	if !merged.Draft || len(merged.Roles) != 2 || merged.Title != "Заметки" {
+		t.Errorf("unexpected merged metadata: %+v", merged)
+	}
+
+	// contents without roles get default ones, roles: [] makes page public
+	bare, _ := splitMdMetaData([]byte("# Bare"))
+	public, _ := splitMdMetaData([]byte("---\nroles: []\n---\n# Public"))
+	if roles := mergeMdMetaData(map[string]*MdMetaData{"main": &bare}, []string{"staff"}).Roles; len(roles) != 1 || roles[0] != "staff" {
+		t.Errorf("page without front matter must get default roles: %v", roles)
+	}
+	if roles := mergeMdMetaData(nil, []string{"staff"}).Roles; len(roles) != 1 {
+		t.Errorf("page without markdown contents must get default roles: %v", roles)
+	}
+	if roles := mergeMdMetaData(map[string]*MdMetaData{"main": &public, "footer": &bare}, []string{"staff"}).Roles; len(roles) != 0 {
+		t.Errorf("page with empty roles in front matter must be public: %v", roles)
+	}
+}
+
+func TestRemoteFetcher(t *testing.T) {
+	requests, conditional, broken := 0, 0, false
+	upstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		requests++
+		if broken {
+			res.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if req.Header.Get("If-None-Match") == `"v1"` {
+			conditional++
+			res.WriteHeader(http.StatusNotModified)
+			return
+		}
+		res.Header().Set("ETag", `"v1"`)
+		res.Write([]byte("# Remote"))
+	}))
+	defer upstream.Close()
+	upstreamUrl, _ := url.Parse(upstream.URL)
+
+	fetcher := NewRemoteFetcher(nil, time.Second, 16)
+	if _, err := fetcher.Fetch(upstream.URL + "/doc.md"); err == nil {
+		t.Fatal("host must be denied by empty allow list")
+	}
+	fetcher.AllowedHosts = []string{upstreamUrl.Hostname()}
+	fetcher.FreshFor = 0
+
+	for i := 0; i < 2; i++ {
+		body, err := fetcher.Fetch(upstream.URL + "/doc.md")
+		if err != nil || string(body) != "# Remote" {
+			t.Fatalf("fetch %d: %q %v", i, body, err)
+		}
+	}
+	if requests != 2 || conditional != 1 {
+		t.Errorf("expected second request to be conditional: requests %d, conditional %d", requests, conditional)
+	}
+
+	broken = true
+	if body, err := fetcher.Fetch(upstream.URL + "/doc.md"); err != nil || string(body) != "# Remote" {
+		t.Errorf("stale copy must be served on upstream error: %q %v", body, err)
+	}
+	if _, err := fetcher.Fetch(upstream.URL + "/other.md"); err == nil {
+		t.Error("error is expected for not cached source")
+	}
+
+	broken = false
+	fetcher.MaxBodySize = 4
+	if _, err := fetcher.Fetch(upstream.URL + "/large.md"); err == nil {
+		t.Error("body larger than limit must be rejected")
+	}
+}
+
+func TestRemoteFetcherRedirectAndConcurrency(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		requests[req.URL.Path]++
+		mu.Unlock()
+		switch req.URL.Path {
+		case "/slow.md":
+			<-release
+		case "/redirect.md":
+			http.Redirect(res, req, strings.Replace(req.Host, "127.0.0.1", "http://localhost", 1)+"/doc.md",
+				http.StatusFound)
+			return
+		case "/local.md":
+			http.Redirect(res, req, "/doc.md", http.StatusFound)
+			return
+		}
+		res.Write([]byte(req.URL.Path))
+	}))
+	defer upstream.Close()
+	upstreamUrl, _ := url.Parse(upstream.URL)
+	fetcher := NewRemoteFetcher([]string{upstreamUrl.Hostname()}, time.Second, 1024)
+
+	if _, err := fetcher.Fetch(upstream.URL + "/redirect.md"); err == nil {
+		t.Error("redirect to not allowed host must fail")
+	}
+	if body, err := fetcher.Fetch(upstream.URL + "/local.md"); err != nil || string(body) != "/doc.md" {
+		t.Errorf("redirect to allowed host must be followed: %q %v", body, err)
+	}
+
+	var wg sync.WaitGroup
+	bodies := make([]string, 4)
+	for i := range bodies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body, _ := fetcher.Fetch(upstream.URL + "/slow.md")
+			bodies[i] = string(body)
+		}(i)
+	}
+	// slow source must not block fetches of other sources
+	if body, err := fetcher.Fetch(upstream.URL + "/fast.md"); err != nil || string(body) != "/fast.md" {
+		t.Errorf("unexpected fast source %q %v", body, err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	for i, body := range bodies {
+		if body != "/slow.md" {
+			t.Errorf("unexpected body %d: %q", i, body)
+		}
+	}
+	if requests["/slow.md"] != 1 {
+		t.Errorf("concurrent fetches of source must make one request: %d", requests["/slow.md"])
+	}
+}
+
+func TestHighlightCode(t *testing.T) {
+	cases := []struct{ language, code, expected string }{
+		{"go", "x := \"a\\\"ü\" // Привет\nreturn 3.14", `x := <span class="hl-string">&quot;a\&quot;ü&quot;</span> ` +
+			`<span class="hl-comment">// Привет</span>` + "\n" + `<span class="hl-keyword">return</span> <span class="hl-number">3.14</span>`},
+		{"go", "s := `multi\nline` + 'ы", "s := <span class=\"hl-string\">`multi\nline`</span> + <span class=\"hl-string\">'ы</span>"},
+		{"sql", "SELECT 'x\ny' -- end", `<span class="hl-keyword">SELECT</span> <span class="hl-string">'x` + "\n" +
+			`</span>y<span class="hl-string">' -- end</span>`},
+	}
+	for _, c := range cases {
+		var out strings.Builder
+		highlightCode(&out, c.code, highlightSyntaxes[c.language])
+		if out.String() != c.expected {
+			t.Errorf("%s %q:\n got %s\nwant %s", c.language, c.code, out.String(), c.expected)
+		}
+	}
+
+	// scanning is linear in size of code
+	code := strings.Repeat("ключ := \"значение\" // комментарий\n", 20000)
+	start := time.Now()
+	var out strings.Builder
+	highlightCode(&out, code, highlightSyntaxes["go"])
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("highlight of %d bytes took %v", len(code), elapsed)
+	}
+}
+
+func TestHeadingAnchors(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "anchors.page.main.md")
+	writeTestFile(t, source, "# Hello {#x\"><img src=x onerror=alert(1)>}\n\n## Custom {#my_id-1}\n")
+	page, err := ConvertMdToPage(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Toc) != 2 || page.Toc[0].Id != "x-img-src-x-onerror-alert-1" || page.Toc[1].Id != "my_id-1" {
+		t.Fatalf("unexpected anchors: %+v", page.Toc)
+	}
+	if strings.Contains(string(page.TocHtml), "<img") || strings.Contains(string(page.Html), "<img") {
+		t.Errorf("hostile anchor is rendered:\n%s\n%s", page.TocHtml, page.Html)
+	}
+	if toc := renderToc([]MdTocEntry{{Level: 1, Id: `x"><b>`, Title: "T"}}); strings.Contains(string(toc), "<b>") {
+		t.Errorf("id of toc is not escaped: %s", toc)
+	}
+}
@@ -0,0 +1,650 @@
+package mclihttp
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+// MockConfig is file of mock server, routes are tried in order and first matching route responds
+type MockConfig struct {
+	Name   string      `yaml:"name"`
+	Routes []MockRoute `yaml:"routes"`
+}
+
+// MockMatch selects requests of mock route, empty fields match any request
+type MockMatch struct {
+	Method string `yaml:"method"`
+	// path of request, any path if empty
+	Path string `yaml:"path"`
+	// equal (default, :name segments of path are params), prefix or regexp (named groups are params)
+	PathMatch string `yaml:"path-match"`
+	// values are regexps which must match whole value of query parameter or header
+	Query   map[string]string `yaml:"query"`
+	Headers map[string]string `yaml:"headers"`
+	Body    *MockBodyMatch    `yaml:"body"`
+}
+
+// MockBodyMatch selects requests by body, all given conditions must be met
+type MockBodyMatch struct {
+	Equals   string `yaml:"equals"`
+	Contains string `yaml:"contains"`
+	Regexp   string `yaml:"regexp"`
+	// fields which json object body must have, nested objects are matched by their fields
+	JSON map[string]interface{} `yaml:"json"`
+}
+
+// MockResponse is response of mock route, body and string values of json are templates
+type MockResponse struct {
+	// default is 200
+	Status  int                 `yaml:"status"`
+	Headers map[string][]string `yaml:"headers"`
+	Body    string              `yaml:"body"`
+	// file with body template, path is relative to mock file
+	BodyFile string `yaml:"body-file"`
+	// json value of body, Content-Type is application/json if it is not set by headers
+	JSON interface{} `yaml:"json"`
+}
+
+// MockFault breaks response of mock route
+type MockFault struct {
+	// abort closes connection without response, reset closes it with tcp reset,
+	// status responds with status and empty body
+	Type string `yaml:"type"`
+	// status of status fault, default is 503
+	Status int `yaml:"status"`
+	// share of requests which get fault from 0 to 1, default is 1
+	Rate float64 `yaml:"rate"`
+}
+
+type MockRoute struct {
+	Name     string       `yaml:"name"`
+	Match    MockMatch    `yaml:"match"`
+	Response MockResponse `yaml:"response"`
+	// delay of response in milliseconds, it is random between delay and delay-max if delay-max is greater
+	Delay    int64      `yaml:"delay"`
+	DelayMax int64      `yaml:"delay-max"`
+	Fault    *MockFault `yaml:"fault"`
+	// route responds given times and is skipped then, 0 is unlimited
+	Times int `yaml:"times"`
+
+	pathMatch  RouteMatch
+	query      map[string]*regexp.Regexp
+	headers    map[string]*regexp.Regexp
+	bodyRegexp *regexp.Regexp
+	bodyJSON   interface{}
+	body       *template.Template
+	json       interface{}
+	// body of replayed record, it is not a template
+	raw []byte
+}
+
+// MockRequest is data of response templates: {{ .Params.id }}, {{ .Query.Get "q" }}, {{ .JSON.name }}
+type MockRequest struct {
+	Req    *http.Request
+	Method string
+	Path   string
+	Query  url.Values
+	Header http.Header
+	// :name segments of path or named groups of regexp
+	Params map[string]string
+	Body   string
+	// body decoded from json, nil if body is not json
+	JSON interface{}
+	// number of request served by route starting from 1
+	Count int
+}
+
+// MockMaxBodySize limits bodies of requests read by mock and bodies kept in records
+const MockMaxBodySize = 10 << 20
+
+// MockTemplateFuncs returns functions of response templates: functions of router templates and generators
+func MockTemplateFuncs() template.FuncMap {
+	funcs := TemplateFuncs()
+	funcs["uuid"] = uuid.NewString
+	funcs["randInt"] = func(min, max int) int { return min + rand.Intn(max-min+1) }
+	return funcs
+}
+
+// LoadMockConfig reads mock file, body files of routes are resolved relative to it
+func LoadMockConfig(file string) (MockConfig, error) {
+	var config MockConfig
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return config, err
+	}
+	if err := yaml.Unmarshal(content, &config); err != nil {
+		return config, fmt.Errorf("%s: %w", file, err)
+	}
+	for i := range config.Routes {
+		bodyFile := config.Routes[i].Response.BodyFile
+		if len(bodyFile) > 0 && !filepath.IsAbs(bodyFile) {
+			config.Routes[i].Response.BodyFile = filepath.Join(filepath.Dir(file), bodyFile)
+		}
+	}
+	return config, nil
+}
+
+func (m *MockRoute) compile() error {
+	m.pathMatch = RouteMatch{Pattern: m.Match.Path, Match: m.Match.PathMatch}
+	if len(m.pathMatch.Pattern) == 0 {
+		m.pathMatch = RouteMatch{Pattern: "/", Match: "prefix"}
+	}
+	if err := m.pathMatch.compile(); err != nil {
+		return err
+	}
+	if m.pathMatch.routeType == Equal && strings.Contains(m.pathMatch.Pattern, ":") {
+		re, err := paramPatternRegexp(strings.TrimSuffix(m.pathMatch.Pattern, "/"))
+		if err != nil {
+			return err
+		}
+		m.pathMatch.routeType, m.pathMatch.regexp = Regexp, re
+	}
+	var err error
+	if m.query, err = compileMockValues(m.Match.Query); err != nil {
+		return fmt.Errorf("query: %w", err)
+	}
+	if m.headers, err = compileMockValues(m.Match.Headers); err != nil {
+		return fmt.Errorf("headers: %w", err)
+	}
+	if body := m.Match.Body; body != nil {
+		if len(body.Regexp) > 0 {
+			if m.bodyRegexp, err = regexp.Compile(body.Regexp); err != nil {
+				return fmt.Errorf("body: %w", err)
+			}
+		}
+		if body.JSON != nil {
+			// yaml numbers are made json numbers to be compared with decoded body
+			encoded, err := json.Marshal(body.JSON)
+			if err != nil {
+				return fmt.Errorf("body: %w", err)
+			}
+			json.Unmarshal(encoded, &m.bodyJSON)
+		}
+	}
+	if m.Fault != nil {
+		switch m.Fault.Type {
+		case "abort", "reset", "status":
+		default:
+			return fmt.Errorf("fault %s is not supported, use abort, reset or status", m.Fault.Type)
+		}
+	}
+	if m.raw != nil {
+		return nil
+	}
+
+	bodySource := m.Response.Body
+	if len(m.Response.BodyFile) > 0 {
+		content, err := os.ReadFile(m.Response.BodyFile)
+		if err != nil {
+			return err
+		}
+		bodySource = string(content)
+	}
+	if m.body, err = template.New(m.Name).Funcs(MockTemplateFuncs()).Parse(bodySource); err != nil {
+		return err
+	}
+	if m.Response.JSON != nil {
+		m.json, err = compileMockJSON(m.Name, m.Response.JSON)
+	}
+	return err
+}
+
+func compileMockValues(values map[string]string) (map[string]*regexp.Regexp, error) {
+	result := make(map[string]*regexp.Regexp, len(values))
+	for name, value := range values {
+		re, err := regexp.Compile("^(?:" + value + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		result[name] = re
+	}
+	return result, nil
+}
+
+// compileMockJSON replaces strings with templates in json value of response
+func compileMockJSON(name string, value interface{}) (interface{}, error) {
+	switch value := value.(type) {
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		return template.New(name).Funcs(MockTemplateFuncs()).Parse(value)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			compiled, err := compileMockJSON(name, item)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = compiled
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			compiled, err := compileMockJSON(name, item)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = compiled
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+func renderMockJSON(value interface{}, data *MockRequest) (interface{}, error) {
+	switch value := value.(type) {
+	case *template.Template:
+		var buf bytes.Buffer
+		err := value.Execute(&buf, data)
+		return buf.String(), err
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			rendered, err := renderMockJSON(item, data)
+			if err != nil {
+				return nil, err
+			}
+			result[key] = rendered
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(value))
+		for i, item := range value {
+			rendered, err := renderMockJSON(item, data)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = rendered
+		}
+		return result, nil
+	}
+	return value, nil
+}
+
+// matchMockJSON reports whether value has all fields of expected object, other values must be equal
+func matchMockJSON(value, expected interface{}) bool {
+	expectedObject, ok := expected.(map[string]interface{})
+	if !ok {
+		return reflect.DeepEqual(value, expected)
+	}
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	for key, expectedValue := range expectedObject {
+		if item, ok := object[key]; !ok || !matchMockJSON(item, expectedValue) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether route matches request and returns params of path
+func (m *MockRoute) match(data *MockRequest) (bool, map[string]string) {
+	if len(m.Match.Method) > 0 && !strings.EqualFold(m.Match.Method, data.Method) {
+		return false, nil
+	}
+	params := make(map[string]string)
+	if m.pathMatch.routeType == Regexp {
+		matches := m.pathMatch.regexp.FindStringSubmatch(strings.TrimSuffix(data.Path, "/"))
+		if matches == nil {
+			matches = m.pathMatch.regexp.FindStringSubmatch(data.Path)
+		}
+		if matches == nil {
+			return false, nil
+		}
+		for i, name := range m.pathMatch.regexp.SubexpNames() {
+			if i > 0 && len(name) > 0 {
+				params[name] = matches[i]
+			}
+		}
+	} else if !m.pathMatch.match(data.Path) {
+		return false, nil
+	}
+	for name, re := range m.query {
+		if values, ok := data.Query[name]; !ok || !re.MatchString(values[0]) {
+			return false, nil
+		}
+	}
+	for name, re := range m.headers {
+		if values, ok := data.Header[http.CanonicalHeaderKey(name)]; !ok || !re.MatchString(values[0]) {
+			return false, nil
+		}
+	}
+	if body := m.Match.Body; body != nil {
+		if (len(body.Equals) > 0 && data.Body != body.Equals) ||
+			(len(body.Contains) > 0 && !strings.Contains(data.Body, body.Contains)) ||
+			(m.bodyRegexp != nil && !m.bodyRegexp.MatchString(data.Body)) ||
+			(m.bodyJSON != nil && !matchMockJSON(data.JSON, m.bodyJSON)) {
+			return false, nil
+		}
+	}
+	return true, params
+}
+
+// Mock serves responses of declared routes
+type Mock struct {
+	routes  []*MockRoute
+	infoLog zerolog.Logger
+
+	mu sync.Mutex
+	// number of responses of every route
+	served []int
+}
+
+func NewMock(routes []MockRoute, infoLog zerolog.Logger) (*Mock, error) {
+	mock := &Mock{infoLog: infoLog, routes: make([]*MockRoute, 0, len(routes)), served: make([]int, len(routes))}
+	for i := range routes {
+		route := routes[i]
+		if len(route.Name) == 0 {
+			route.Name = fmt.Sprintf("route-%d", i+1)
+		}
+		if err := route.compile(); err != nil {
+			return nil, fmt.Errorf("mock route %s: %w", route.Name, err)
+		}
+		mock.routes = append(mock.routes, &route)
+	}
+	return mock, nil
+}
+
+// EnableMock registers route of router which passes all requests to mock after middlewares of router,
+// mock matches them with its routes in order of declaration
+func (r *Router) EnableMock(routes []MockRoute) (*Mock, error) {
+	mock, err := NewMock(routes, r.infoLog)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.AddRouteWithHandler(`.*`, Regexp, mock.ServeHTTP); err != nil {
+		return nil, err
+	}
+	return mock, nil
+}
+
+// find returns first route which matches request and has responses left
+func (m *Mock) find(data *MockRequest) *MockRoute {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, route := range m.routes {
+		if route.Times > 0 && m.served[i] >= route.Times {
+			continue
+		}
+		if ok, params := route.match(data); ok {
+			m.served[i]++
+			data.Params, data.Count = params, m.served[i]
+			return route
+		}
+	}
+	return nil
+}
+
+func (m *Mock) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, MockMaxBodySize))
+	if err != nil {
+		restError(res, http.StatusBadRequest, err)
+		return
+	}
+	data := &MockRequest{Req: req, Method: req.Method, Path: req.URL.Path, Query: req.URL.Query(),
+		Header: req.Header, Body: string(body)}
+	if json.Unmarshal(body, &data.JSON) != nil {
+		data.JSON = nil
+	}
+	route := m.find(data)
+	if route == nil {
+		m.infoLog.Info().Msgf("mock %s %s: no route", req.Method, req.URL.RequestURI())
+		restError(res, http.StatusNotFound, fmt.Errorf("no mock route for %s %s", req.Method, req.URL.Path))
+		return
+	}
+
+	delay := route.Delay
+	if route.DelayMax > route.Delay {
+		delay += rand.Int63n(route.DelayMax - route.Delay + 1)
+	}
+	if delay > 0 {
+		select {
+		case <-time.After(time.Duration(delay) * time.Millisecond):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if fault := route.Fault; fault != nil && (fault.Rate <= 0 || rand.Float64() < fault.Rate) {
+		m.infoLog.Info().Msgf("mock %s %s: route %s, fault %s", req.Method, req.URL.RequestURI(), route.Name, fault.Type)
+		if fault.Type == "status" {
+			status := fault.Status
+			if status == 0 {
+				status = http.StatusServiceUnavailable
+			}
+			res.WriteHeader(status)
+			return
+		}
+		abortMockResponse(res, fault.Type == "reset")
+		return
+	}
+
+	status, content, err := route.render(res.Header(), data)
+	if err != nil {
+		restError(res, http.StatusInternalServerError, fmt.Errorf("mock route %s: %w", route.Name, err))
+		return
+	}
+	m.infoLog.Info().Msgf("mock %s %s: route %s, status %d", req.Method, req.URL.RequestURI(), route.Name, status)
+	res.WriteHeader(status)
+	res.Write(content)
+}
+
+// render sets headers of response and returns its status and body
+func (m *MockRoute) render(header http.Header, data *MockRequest) (int, []byte, error) {
+	for name, values := range m.Response.Headers {
+		header[http.CanonicalHeaderKey(name)] = values
+	}
+	status := m.Response.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if m.raw != nil {
+		return status, m.raw, nil
+	}
+	if m.json != nil {
+		value, err := renderMockJSON(m.json, data)
+		if err != nil {
+			return 0, nil, err
+		}
+		content, err := json.Marshal(value)
+		if len(header.Get("Content-Type")) == 0 {
+			header.Set("Content-Type", "application/json")
+		}
+		return status, content, err
+	}
+	var buf bytes.Buffer
+	err := m.body.Execute(&buf, data)
+	return status, buf.Bytes(), err
+}
+
+// abortMockResponse closes connection of request without response
+func abortMockResponse(res http.ResponseWriter, reset bool) {
+	conn, _, err := http.NewResponseController(res).Hijack()
+	if err != nil {
+		// connection of http/2 can not be hijacked, server resets stream
+		panic(http.ErrAbortHandler)
+	}
+	netConn := conn
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		netConn = tlsConn.NetConn()
+	}
+	if tcpConn, ok := netConn.(*net.TCPConn); ok && reset {
+		tcpConn.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// MockRecord is request and response captured by http reverse --record, records are json lines
+type MockRecord struct {
+	Time        time.Time   `json:"time"`
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	RequestBody []byte      `json:"request-body,omitempty"`
+	Status      int         `json:"status"`
+	Headers     http.Header `json:"headers,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+	// milliseconds
+	Duration int64 `json:"duration"`
+}
+
+// MockRedacted replaces values of redacted query parameters and headers of records
+const MockRedacted = "REDACTED"
+
+// Redact replaces values of query parameters of url and response headers of given names
+func (record *MockRecord) Redact(names []string) {
+	if target, err := url.Parse(record.URL); err == nil {
+		query, changed := target.Query(), false
+		for _, name := range names {
+			for i := range query[name] {
+				query[name][i], changed = MockRedacted, true
+			}
+		}
+		if changed {
+			target.RawQuery = query.Encode()
+			record.URL = target.RequestURI()
+		}
+	}
+	for _, name := range names {
+		values := record.Headers[http.CanonicalHeaderKey(name)]
+		for i := range values {
+			values[i] = MockRedacted
+		}
+	}
+}
+
+// MockBodyBuffer keeps body of record while it is streamed, body longer than MockMaxBodySize is not kept
+type MockBodyBuffer struct {
+	bytes.Buffer
+	Overflow bool
+}
+
+func (b *MockBodyBuffer) Write(p []byte) (int, error) {
+	if b.Overflow || b.Len()+len(p) > MockMaxBodySize {
+		b.Overflow = true
+		b.Reset()
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// MockRecorder writes records as json lines with redacted query parameters and headers,
+// it is safe for concurrent use
+type MockRecorder struct {
+	mu     sync.Mutex
+	w      io.Writer
+	redact []string
+}
+
+func NewMockRecorder(w io.Writer, redact []string) *MockRecorder {
+	return &MockRecorder{w: w, redact: redact}
+}
+
+func (r *MockRecorder) Record(record MockRecord) error {
+	record.Headers = record.Headers.Clone()
+	record.Redact(r.redact)
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, err = r.w.Write(append(line, '\n'))
+	return err
+}
+
+// ParseMockRecords reads json lines of recording
+func ParseMockRecords(content []byte) ([]MockRecord, error) {
+	var records []MockRecord
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record MockRecord
+		if err := json.Unmarshal(line, &record); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+// headers of recorded responses which are set by server replaying them
+var mockReplaySkippedHeaders = []string{"Content-Length", "Transfer-Encoding", "Connection", "Keep-Alive", "Date",
+	"X-Request-Id"}
+
+// MockRoutesFromRecords returns routes which replay records. Records of the same request are replayed
+// in recorded order and the last of them is repeated, with timing responses are delayed by recorded duration.
+// Redacted query parameters match any value, redacted headers are not replayed.
+func MockRoutesFromRecords(records []MockRecord, timing bool) ([]MockRoute, error) {
+	routes := make([]MockRoute, 0, len(records))
+	last := make(map[string]int, len(records))
+	for i, record := range records {
+		target, err := url.Parse(record.URL)
+		if err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		route := MockRoute{Name: RequestName(record.Method, record.URL), Times: 1}
+		route.Match.Method = record.Method
+		route.Match.Path, route.Match.PathMatch = "^"+regexp.QuoteMeta(target.Path)+"$", "regexp"
+		route.Match.Query = make(map[string]string)
+		for name, values := range target.Query() {
+			route.Match.Query[name] = regexp.QuoteMeta(values[0])
+			if values[0] == MockRedacted {
+				route.Match.Query[name] = ".*"
+			}
+		}
+		if len(record.RequestBody) > 0 {
+			route.Match.Body = &MockBodyMatch{Equals: string(record.RequestBody)}
+		}
+		route.Response.Status = record.Status
+		route.Response.Headers = record.Headers.Clone()
+		for _, name := range mockReplaySkippedHeaders {
+			delete(route.Response.Headers, name)
+		}
+		for name, values := range route.Response.Headers {
+			if slices.Contains(values, MockRedacted) {
+				delete(route.Response.Headers, name)
+			}
+		}
+		route.raw = record.Body
+		if route.raw == nil {
+			route.raw = []byte{}
+		}
+		if timing {
+			route.Delay = record.Duration
+		}
+		routes = append(routes, route)
+		last[record.Method+" "+record.URL+" "+string(record.RequestBody)] = len(routes) - 1
+	}
+	for _, i := range last {
+		routes[i].Times = 0
+	}
+	if len(routes) == 0 {
+		return nil, errors.New("recording has no records")
+	}
+	return routes, nil
+}
@@ -0,0 +1,210 @@
+package mclihttp
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+)
+
+func TestMock(t *testing.T) {
+	mockFile := `
+routes:
+  - name: unauthorized
+    match: {path: /shodan/host/:ip}
+    response: {status: 401, json: {error: "key is required"}}
+    times: 1
+  - name: host
+    match:
+      method: GET
+      path: /shodan/host/:ip
+      query: {key: "[a-z0-9]+"}
+    response:
+      headers: {X-Mock: [host]}
+      json: {ip_str: "{{ .Params.ip }}", ports: [22, 80], request: "{{ .Count }}"}
+  - name: dns
+    match:
+      method: POST
+      path: /dns
+      body: {json: {hostnames: [example.com], options: {ipv6: true}}}
+    response: {body: "{{ .JSON.options.ipv6 }} {{ .Query.Get \"v\" }}"}
+  - name: flaky
+    match: {path: /flaky, path-match: prefix}
+    delay: 20
+    fault: {type: status, status: 502}
+    times: 1
+  - name: flaky-ok
+    match: {path: /flaky, path-match: prefix}
+    response: {body: ok}
+  - name: broken
+    match: {path: "^/broken/(?P<n>\\d+)$", path-match: regexp}
+    fault: {type: reset}
+`
+	var config MockConfig
+	if err := yaml.Unmarshal([]byte(mockFile), &config); err != nil {
+		t.Fatal(err)
+	}
+	router := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), nil)
+	if _, err := router.EnableMock(config.Routes); err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	send := func(method, path, body string) (int, string, http.Header) {
+		t.Helper()
+		req, _ := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+		defer res.Body.Close()
+		content, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(content), res.Header
+	}
+
+	if status, _, _ := send("GET", "/shodan/host/8.8.8.8", ""); status != http.StatusUnauthorized {
+		t.Errorf("first request must be unauthorized: %d", status)
+	}
+	if status, _, _ := send("GET", "/shodan/host/8.8.8.8", ""); status != http.StatusNotFound {
+		t.Errorf("request without key must not match: %d", status)
+	}
+	status, body, header := send("GET", "/shodan/host/8.8.8.8?key=abc1", "")
+	var host map[string]interface{}
+	json.Unmarshal([]byte(body), &host)
+	if status != http.StatusOK || host["ip_str"] != "8.8.8.8" || host["request"] != "1" ||
+		header.Get("Content-Type") != "application/json" || header.Get("X-Mock") != "host" {
+		t.Errorf("unexpected host response %d %s %v", status, body, header)
+	}
+
+	dns := `{"hostnames": ["example.com"], "options": {"ipv6": true, "ttl": 60}, "extra": 1}`
+	if status, body, _ := send("POST", "/dns?v=2", dns); status != http.StatusOK || body != "true 2" {
+		t.Errorf("unexpected dns response %d %s", status, body)
+	}
+	if status, _, _ := send("POST", "/dns", `{"hostnames": ["example.org"]}`); status != http.StatusNotFound {
+		t.Errorf("body must not match: %d", status)
+	}
+
+	start := time.Now()
+	if status, _, _ := send("GET", "/flaky/1", ""); status != http.StatusBadGateway || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("first flaky request must fail after delay: %d %v", status, time.Since(start))
+	}
+	if status, body, _ := send("GET", "/flaky/1", ""); status != http.StatusOK || body != "ok" {
+		t.Errorf("second flaky request must succeed: %d %s", status, body)
+	}
+	if _, err := http.Get(server.URL + "/broken/1"); err == nil {
+		t.Error("connection must be reset")
+	}
+	if status, _, _ := send("GET", "/", ""); status != http.StatusNotFound {
+		t.Errorf("unknown path must not be found: %d", status)
+	}
+}
+
+func TestMockReplay(t *testing.T) {
+	var recording bytes.Buffer
+	recorder := NewMockRecorder(&recording, nil)
+	records := []MockRecord{
+		{Method: "GET", URL: "/api/job?id=1", Status: 202, Body: []byte("pending"),
+			Headers: http.Header{"Content-Length": {"7"}, "X-Job": {"1"}}},
+		{Method: "GET", URL: "/api/job?id=1", Status: 200, Body: []byte("done")},
+		{Method: "POST", URL: "/api/job", RequestBody: []byte(`{"a":1}`), Status: 201, Body: []byte{0xff, 0x00}},
+	}
+	for _, record := range records {
+		if err := recorder.Record(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parsed, err := ParseMockRecords(recording.Bytes())
+	if err != nil || len(parsed) != 3 {
+		t.Fatalf("unexpected records %v: %v", parsed, err)
+	}
+	routes, err := MockRoutesFromRecords(parsed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := NewMock(routes, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(method, target, body string) *httptest.ResponseRecorder {
+		res := httptest.NewRecorder()
+		mock.ServeHTTP(res, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return res
+	}
+	if res := send("GET", "/api/job?id=1", ""); res.Code != 202 || res.Body.String() != "pending" ||
+		res.Header().Get("X-Job") != "1" || len(res.Header().Get("Content-Length")) > 0 {
+		t.Errorf("unexpected first response %d %s %v", res.Code, res.Body, res.Header())
+	}
+	for i := 0; i < 2; i++ {
+		if res := send("GET", "/api/job?id=1", ""); res.Code != 200 || res.Body.String() != "done" {
+			t.Errorf("last response must be repeated: %d %s", res.Code, res.Body)
+		}
+	}
+	if res := send("GET", "/api/job?id=2", ""); res.Code != http.StatusNotFound {
+		t.Errorf("query must match: %d", res.Code)
+	}
+	if res := send("POST", "/api/job", `{"a":1}`); res.Code != 201 || !bytes.Equal(res.Body.Bytes(), []byte{0xff, 0x00}) {
+		t.Errorf("unexpected binary response %d %v", res.Code, res.Body.Bytes())
+	}
+}
+
+func TestMockRecordRedact(t *testing.T) {
+	var recording bytes.Buffer
+	recorder := NewMockRecorder(&recording, []string{"key", "Set-Cookie"})
+	headers := http.Header{"Set-Cookie": {"session=secret"}, "X-Host": {"1"}}
+	record := MockRecord{Method: "GET", URL: "/shodan/host/8.8.8.8?key=secret&minify=true", Status: 200,
+		Headers: headers, Body: []byte("host")}
+	if err := recorder.Record(record); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(recording.String(), "secret") {
+		t.Fatalf("recording must not contain secrets: %s", recording.String())
+	}
+	if headers.Get("Set-Cookie") != "session=secret" {
+		t.Error("headers of response must not be changed")
+	}
+	parsed, err := ParseMockRecords(recording.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	routes, err := MockRoutesFromRecords(parsed, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mock, err := NewMock(routes, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := httptest.NewRecorder()
+	mock.ServeHTTP(res, httptest.NewRequest("GET", "/shodan/host/8.8.8.8?key=other&minify=true", nil))
+	if res.Code != 200 || res.Body.String() != "host" || res.Header().Get("X-Host") != "1" ||
+		len(res.Header().Values("Set-Cookie")) > 0 {
+		t.Errorf("unexpected replayed response %d %s %v", res.Code, res.Body, res.Header())
+	}
+	res = httptest.NewRecorder()
+	mock.ServeHTTP(res, httptest.NewRequest("GET", "/shodan/host/8.8.8.8?key=other&minify=false", nil))
+	if res.Code != http.StatusNotFound {
+		t.Errorf("not redacted query must match: %d", res.Code)
+	}
+}
+
+func TestMockBodyBuffer(t *testing.T) {
+	var buffer MockBodyBuffer
+	buffer.Write([]byte("small"))
+	if buffer.Overflow || buffer.String() != "small" {
+		t.Errorf("unexpected buffer %q", buffer.String())
+	}
+	buffer.Write(make([]byte, MockMaxBodySize))
+	buffer.Write([]byte("tail"))
+	if !buffer.Overflow || buffer.Len() != 0 {
+		t.Errorf("oversized body must not be kept: %d", buffer.Len())
+	}
+}
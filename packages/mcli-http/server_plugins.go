@@ -0,0 +1,282 @@
+package mclihttp
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	mcli_type "mcli/packages/mcli-type"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+)
+
+// PluginStatus describes http plugin found in plugin directory
+type PluginStatus struct {
+	Name       string   `json:"name"`
+	Version    string   `json:"version"`
+	ApiVersion int      `json:"api-version"`
+	Path       string   `json:"path"`
+	Routes     []string `json:"routes"`
+	// loaded, failed or disabled
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// legacyHttpPlugin adapts plugins of api version 1 to HttpPlugin,
+// every handler HTTP_SOME_NAME is served on /some-name route
+type legacyHttpPlugin struct {
+	name  string
+	funcs mcli_type.HandlerFuncsPlugin
+}
+
+func NewLegacyHttpPlugin(name string, funcs mcli_type.HandlerFuncsPlugin) mcli_type.HttpPlugin {
+	return &legacyHttpPlugin{name: name, funcs: funcs}
+}
+
+func (p *legacyHttpPlugin) Manifest() mcli_type.HttpPluginManifest {
+	handlers := p.funcs.GetHandlerFuncsV2("HTTP_ECHO")
+	names := make([]string, 0, len(handlers))
+	for name := range handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	manifest := mcli_type.HttpPluginManifest{Name: p.name, Version: "v1", ApiVersion: 1}
+	for _, name := range names {
+		pattern := "/" + strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, "HTTP_")), "_", "-")
+		manifest.Routes = append(manifest.Routes, mcli_type.HttpPluginRoute{Name: name, Pattern: pattern,
+			Handler: handlers[name]})
+	}
+	return manifest
+}
+
+func (p *legacyHttpPlugin) Init(config map[string]interface{}) error {
+	return nil
+}
+
+// parseRouteType converts match of plugin or cors route to RouteType
+func parseRouteType(match string) (RouteType, error) {
+	switch strings.ToLower(match) {
+	case "", "equal":
+		return Equal, nil
+	case "prefix":
+		return Prefix, nil
+	case "regexp":
+		return Regexp, nil
+	}
+	return 0, fmt.Errorf("unknown route match type %s", match)
+}
+
+// middlewareNames returns names of middlewares set up in router
+func (r *Router) middlewareNames() []string {
+	names := make([]string, 0, len(r.middleware))
+	for _, mw := range r.middleware {
+		switch mw.(type) {
+		case *Auth:
+			names = append(names, "auth")
+		case *CORS:
+			names = append(names, "cors")
+		case *Locale:
+			names = append(names, "locale")
+		case *Logger:
+			names = append(names, "logger")
+		case *ResponseCache:
+			names = append(names, "cache")
+		case *RequestId:
+			names = append(names, "request-id")
+		case *SecurityHeaders:
+			names = append(names, "security-headers")
+		}
+	}
+	return names
+}
+
+// HasRoute reports whether route with pattern and type is already served by router
+func (r *Router) HasRoute(pattern string, routeType RouteType) bool {
+	fullPattern := r.getResultPattern(pattern)
+	for _, route := range r.routes {
+		if route.routeType == routeType &&
+			(route.pattern == fullPattern || route.pattern == "@UseRegExp->"+fullPattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePluginConfig checks config against schema and returns it with defaults applied
+func validatePluginConfig(schema map[string]mcli_type.HttpPluginConfigField, config map[string]interface{}) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(schema))
+	var errs []error
+	for key := range config {
+		if _, ok := schema[key]; !ok {
+			errs = append(errs, fmt.Errorf("unknown config key %s", key))
+		}
+	}
+	for key, field := range schema {
+		value, ok := config[key]
+		if !ok || value == nil {
+			if field.Required {
+				errs = append(errs, fmt.Errorf("config key %s is required", key))
+			} else if field.Default != nil {
+				result[key] = field.Default
+			}
+			continue
+		}
+		valid := true
+		switch field.Type {
+		case "string":
+			_, valid = value.(string)
+		case "number":
+			switch value.(type) {
+			case int, int32, int64, uint, uint32, uint64, float32, float64:
+			default:
+				valid = false
+			}
+		case "bool":
+			_, valid = value.(bool)
+		case "list":
+			_, valid = value.([]interface{})
+		case "map":
+			_, valid = value.(map[string]interface{})
+		}
+		if !valid {
+			errs = append(errs, fmt.Errorf("config key %s must be %s", key, field.Type))
+			continue
+		}
+		result[key] = value
+	}
+	return result, errors.Join(errs...)
+}
+
+// pluginRouteHandler restricts plugin handler to declared methods and to authenticated users if route needs auth
+func pluginRouteHandler(route mcli_type.HttpPluginRoute) HandlerFunc {
+	methods := make([]string, 0, len(route.Methods))
+	for _, method := range route.Methods {
+		methods = append(methods, strings.ToUpper(method))
+	}
+	needsAuth := slices.Contains(route.Middlewares, "auth")
+	return func(res http.ResponseWriter, req *http.Request) {
+		if len(methods) > 0 && !slices.Contains(methods, req.Method) {
+			res.Header().Set("Allow", strings.Join(methods, ", "))
+			HttpErrorLocalized(res, req, http.StatusMethodNotAllowed, "")
+			return
+		}
+		if needsAuth {
+			if isAuth, ok := req.Context().Value(go_common_ddru.ContextKey("IsAuth")).(bool); !ok || !isAuth {
+				HttpErrorLocalized(res, req, http.StatusUnauthorized, "")
+				return
+			}
+		}
+		route.Handler(res, req)
+	}
+}
+
+// RegisterPlugin validates manifest and config of plugin and adds its routes to router.
+// Plugin is registered entirely or not at all: routes colliding with routes or handler names
+// already registered, unsupported api version or missing middlewares reject whole plugin.
+func (r *Router) RegisterPlugin(path string, plugin mcli_type.HttpPlugin, config map[string]interface{}) error {
+	manifest := plugin.Manifest()
+	status := PluginStatus{Name: manifest.Name, Version: manifest.Version, ApiVersion: manifest.ApiVersion,
+		Path: path, Status: "failed"}
+	err := r.registerPlugin(manifest, plugin, config)
+	if err == nil {
+		status.Status = "loaded"
+		for _, route := range manifest.Routes {
+			status.Routes = append(status.Routes, route.Pattern)
+		}
+	} else {
+		status.Error = err.Error()
+	}
+	r.plugins = append(r.plugins, status)
+	return err
+}
+
+func (r *Router) registerPlugin(manifest mcli_type.HttpPluginManifest, plugin mcli_type.HttpPlugin, config map[string]interface{}) error {
+	if len(manifest.Name) == 0 {
+		return fmt.Errorf("plugin name is empty")
+	}
+	if manifest.ApiVersion != 1 && manifest.ApiVersion != mcli_type.HttpPluginApiVersion {
+		return fmt.Errorf("plugin api version %d is not supported, supported version is %d",
+			manifest.ApiVersion, mcli_type.HttpPluginApiVersion)
+	}
+	for _, registered := range r.plugins {
+		if registered.Name == manifest.Name && registered.Status == "loaded" {
+			return fmt.Errorf("plugin %s is already registered from %s", manifest.Name, registered.Path)
+		}
+	}
+	if r.pluginHandlers == nil {
+		r.pluginHandlers = make(map[string]string)
+	}
+
+	var errs []error
+	middlewares := r.middlewareNames()
+	routeTypes := make([]RouteType, len(manifest.Routes))
+	patterns := make(map[string]bool)
+	names := make(map[string]bool)
+	for i, route := range manifest.Routes {
+		if route.Handler == nil {
+			errs = append(errs, fmt.Errorf("route %s: handler is nil", route.Name))
+			continue
+		}
+		routeType, err := parseRouteType(route.Match)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", route.Name, err))
+			continue
+		}
+		routeTypes[i] = routeType
+		if routeType == Regexp {
+			if _, err := regexp.Compile(route.Pattern); err != nil {
+				errs = append(errs, fmt.Errorf("route %s: %w", route.Name, err))
+			}
+		}
+		if owner, ok := r.pluginHandlers[route.Name]; ok || names[route.Name] {
+			if !ok {
+				owner = manifest.Name
+			}
+			errs = append(errs, fmt.Errorf("handler name %s collides with handler of plugin %s", route.Name, owner))
+		}
+		names[route.Name] = true
+		patternKey := fmt.Sprintf("%d:%s", routeType, route.Pattern)
+		if r.HasRoute(route.Pattern, routeType) || patterns[patternKey] {
+			errs = append(errs, fmt.Errorf("route %s: pattern %s is already registered", route.Name, route.Pattern))
+		}
+		patterns[patternKey] = true
+		for _, mw := range route.Middlewares {
+			if !slices.Contains(middlewares, mw) {
+				errs = append(errs, fmt.Errorf("route %s: middleware %s is not set up", route.Name, mw))
+			}
+		}
+	}
+	validConfig, err := validatePluginConfig(manifest.ConfigSchema, config)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	if err := plugin.Init(validConfig); err != nil {
+		return fmt.Errorf("plugin init: %w", err)
+	}
+
+	for i, route := range manifest.Routes {
+		if err := r.AddRouteWithHandler(route.Pattern, routeTypes[i], pluginRouteHandler(route)); err != nil {
+			return fmt.Errorf("route %s: %w", route.Name, err)
+		}
+		r.pluginHandlers[route.Name] = manifest.Name
+		r.infoLog.Trace().Msgf("plugin %s route %s is registered", manifest.Name, route.Pattern)
+	}
+	return nil
+}
+
+// AddPluginStatus records plugin which was not passed to RegisterPlugin: disabled or failed to load
+func (r *Router) AddPluginStatus(status PluginStatus) {
+	r.plugins = append(r.plugins, status)
+}
+
+// Plugins returns statuses of all plugins found in plugin directory
+func (r *Router) Plugins() []PluginStatus {
+	return slices.Clone(r.plugins)
+}
@@ -0,0 +1,463 @@
+package mclihttp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mcli_type "mcli/packages/mcli-type"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+// Out-of-process plugins are executables started by mcli. Plugin serves http on unix socket
+// from MCLI_PLUGIN_SOCKET environment variable:
+//   - GET /mcli/health answers 200 while plugin is able to serve requests
+//   - GET /mcli/manifest returns manifest as json
+//   - POST /mcli/init gets plugin config as json
+//   - requests to plugin routes are proxied with X-Mcli-Plugin-Route header set to route name
+//
+// Plugin exits when its stdin is closed. ServeProcessPlugin implements this protocol for any HttpPlugin.
+const (
+	ProcessPluginSocketEnv   = "MCLI_PLUGIN_SOCKET"
+	processPluginRouteHeader = "X-Mcli-Plugin-Route"
+	processPluginUserHeader  = "X-Mcli-User"
+)
+
+// processPluginSeq makes socket names of restarted plugin unique
+var processPluginSeq atomic.Int64
+
+type processPluginRoute struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern"`
+	Match       string   `json:"match,omitempty"`
+	Methods     []string `json:"methods,omitempty"`
+	Middlewares []string `json:"middlewares,omitempty"`
+}
+
+type processPluginConfigField struct {
+	Type        string      `json:"type,omitempty"`
+	Required    bool        `json:"required,omitempty"`
+	Default     interface{} `json:"default,omitempty"`
+	Description string      `json:"description,omitempty"`
+}
+
+// processPluginManifest is HttpPluginManifest without handlers in wire format
+type processPluginManifest struct {
+	Name         string                              `json:"name"`
+	Version      string                              `json:"version"`
+	ApiVersion   int                                 `json:"api-version"`
+	Routes       []processPluginRoute                `json:"routes"`
+	ConfigSchema map[string]processPluginConfigField `json:"config-schema,omitempty"`
+}
+
+func toProcessPluginManifest(manifest mcli_type.HttpPluginManifest) processPluginManifest {
+	wire := processPluginManifest{Name: manifest.Name, Version: manifest.Version, ApiVersion: manifest.ApiVersion,
+		Routes: make([]processPluginRoute, 0, len(manifest.Routes)), ConfigSchema: make(map[string]processPluginConfigField)}
+	for _, route := range manifest.Routes {
+		wire.Routes = append(wire.Routes, processPluginRoute{Name: route.Name, Pattern: route.Pattern, Match: route.Match,
+			Methods: route.Methods, Middlewares: route.Middlewares})
+	}
+	for key, field := range manifest.ConfigSchema {
+		wire.ConfigSchema[key] = processPluginConfigField(field)
+	}
+	return wire
+}
+
+// ProcessPlugin runs plugin executable and implements HttpPlugin by proxying requests of its routes to it.
+// Plugin is restarted when it exits or fails health checks, requests to plugin are limited by Timeout.
+type ProcessPlugin struct {
+	Path           string
+	Args           []string
+	Timeout        time.Duration
+	StartTimeout   time.Duration
+	HealthInterval time.Duration
+	infoLog        zerolog.Logger
+	errorLog       zerolog.Logger
+	ctx            context.Context
+	cancel         context.CancelFunc
+	client         *http.Client
+	proxy          *httputil.ReverseProxy
+
+	mu          sync.RWMutex
+	cmd         *exec.Cmd
+	stdin       io.WriteCloser
+	socketDir   string
+	socket      string
+	exited      chan struct{}
+	manifest    processPluginManifest
+	config      map[string]interface{}
+	initialized bool
+	supervised  chan struct{}
+}
+
+func NewProcessPlugin(ctx context.Context, path string, args []string, timeout time.Duration,
+	iLog zerolog.Logger, eLog zerolog.Logger) *ProcessPlugin {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	p := &ProcessPlugin{Path: path, Args: args, Timeout: timeout, StartTimeout: 10 * time.Second,
+		HealthInterval: 10 * time.Second, infoLog: iLog, errorLog: eLog}
+	p.ctx, p.cancel = context.WithCancel(ctx)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", p.socketPath())
+		},
+	}
+	p.client = &http.Client{Transport: transport, Timeout: timeout}
+	p.proxy = &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = "plugin"
+		},
+		Transport: transport,
+		ErrorHandler: func(res http.ResponseWriter, req *http.Request, err error) {
+			p.errorLog.Error().Msgf("plugin %s request %s error: %v", p.Path, req.URL.Path, err)
+			if errors.Is(err, context.DeadlineExceeded) {
+				HttpErrorLocalized(res, req, http.StatusGatewayTimeout, "")
+				return
+			}
+			HttpErrorLocalized(res, req, http.StatusBadGateway, "")
+		},
+	}
+	return p
+}
+
+func (p *ProcessPlugin) socketPath() string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.socket
+}
+
+// Start runs plugin executable, waits until it is healthy and reads its manifest,
+// after that plugin is supervised until Stop is called or context is done
+func (p *ProcessPlugin) Start() error {
+	// sockets are created in directory accessible by owner only, other users can not connect to them
+	socketDir, err := os.MkdirTemp("", "mcli-plugin-")
+	if err != nil {
+		return fmt.Errorf("plugin socket directory: %w", err)
+	}
+	p.mu.Lock()
+	p.socketDir = socketDir
+	p.mu.Unlock()
+	if err := p.start(); err != nil {
+		os.RemoveAll(socketDir)
+		return err
+	}
+	var manifest processPluginManifest
+	if err := p.call(http.MethodGet, "/mcli/manifest", nil, &manifest); err != nil {
+		p.kill()
+		os.RemoveAll(socketDir)
+		return fmt.Errorf("plugin manifest: %w", err)
+	}
+	p.mu.Lock()
+	p.manifest = manifest
+	p.supervised = make(chan struct{})
+	p.mu.Unlock()
+	go p.supervise()
+	return nil
+}
+
+// start runs process and waits for its first successful health check
+func (p *ProcessPlugin) start() error {
+	name := strings.TrimSuffix(filepath.Base(p.Path), filepath.Ext(p.Path))
+	if len(name) > 20 {
+		name = name[:20]
+	}
+	p.mu.RLock()
+	socket := filepath.Join(p.socketDir, fmt.Sprintf("%s-%d.sock", name, processPluginSeq.Add(1)))
+	p.mu.RUnlock()
+
+	cmd := exec.Command(p.Path, p.Args...)
+	cmd.Env = append(os.Environ(), ProcessPluginSocketEnv+"="+socket)
+	cmd.Stdout = &pluginLogWriter{log: p.infoLog, name: name}
+	cmd.Stderr = &pluginLogWriter{log: p.errorLog, name: name}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	p.mu.Lock()
+	p.cmd, p.stdin, p.socket, p.exited = cmd, stdin, socket, exited
+	p.mu.Unlock()
+	// connections to previous process are useless
+	p.client.CloseIdleConnections()
+
+	deadline := time.Now().Add(p.StartTimeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-exited:
+			os.Remove(socket)
+			return fmt.Errorf("plugin %s exited on start", p.Path)
+		case <-time.After(50 * time.Millisecond):
+		}
+		if p.call(http.MethodGet, "/mcli/health", nil, nil) == nil {
+			return nil
+		}
+	}
+	p.kill()
+	return fmt.Errorf("plugin %s is not healthy after %v", p.Path, p.StartTimeout)
+}
+
+// kill closes stdin of plugin to let it exit and kills it if it is still running after a second
+func (p *ProcessPlugin) kill() {
+	p.mu.RLock()
+	cmd, stdin, socket, exited := p.cmd, p.stdin, p.socket, p.exited
+	p.mu.RUnlock()
+	if cmd == nil {
+		return
+	}
+	stdin.Close()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+	os.Remove(socket)
+}
+
+// call makes control request to plugin and decodes json response into result
+func (p *ProcessPlugin) call(method, path string, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(raw)
+	}
+	req, err := http.NewRequestWithContext(p.ctx, method, "http://plugin"+path, reqBody)
+	if err != nil {
+		return err
+	}
+	response, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(response.Body, 1024))
+		return fmt.Errorf("status %d: %s", response.StatusCode, strings.TrimSpace(string(message)))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(response.Body).Decode(result)
+}
+
+// supervise restarts plugin with growing delay when it exits or fails three health checks in a row
+func (p *ProcessPlugin) supervise() {
+	defer close(p.supervised)
+	ticker := time.NewTicker(p.HealthInterval)
+	defer ticker.Stop()
+	backoff, failures := time.Second, 0
+	for {
+		p.mu.RLock()
+		exited := p.exited
+		p.mu.RUnlock()
+		select {
+		case <-p.ctx.Done():
+			p.kill()
+			return
+		case <-ticker.C:
+			err := p.call(http.MethodGet, "/mcli/health", nil, nil)
+			if err == nil {
+				failures, backoff = 0, time.Second
+				continue
+			}
+			failures++
+			if failures < 3 {
+				p.errorLog.Error().Msgf("plugin %s health check failed: %v", p.Path, err)
+				continue
+			}
+			p.errorLog.Error().Msgf("plugin %s is unhealthy and restarted", p.Path)
+			p.kill()
+		case <-exited:
+			p.errorLog.Error().Msgf("plugin %s exited and restarted", p.Path)
+		}
+		failures = 0
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			backoff = min(backoff*2, 30*time.Second)
+			err := p.start()
+			p.mu.RLock()
+			config, initialized := p.config, p.initialized
+			p.mu.RUnlock()
+			if err == nil && initialized {
+				err = p.call(http.MethodPost, "/mcli/init", config, nil)
+			}
+			if err == nil {
+				break
+			}
+			p.errorLog.Error().Msgf("plugin %s restart failed: %v", p.Path, err)
+			p.kill()
+		}
+	}
+}
+
+// Stop stops supervising and terminates plugin process
+func (p *ProcessPlugin) Stop() {
+	p.cancel()
+	p.mu.RLock()
+	supervised, socketDir := p.supervised, p.socketDir
+	p.mu.RUnlock()
+	if supervised != nil {
+		<-supervised
+	} else {
+		p.kill()
+	}
+	if len(socketDir) > 0 {
+		os.RemoveAll(socketDir)
+	}
+}
+
+func (p *ProcessPlugin) Manifest() mcli_type.HttpPluginManifest {
+	p.mu.RLock()
+	wire := p.manifest
+	p.mu.RUnlock()
+	manifest := mcli_type.HttpPluginManifest{Name: wire.Name, Version: wire.Version, ApiVersion: wire.ApiVersion,
+		ConfigSchema: make(map[string]mcli_type.HttpPluginConfigField)}
+	for _, route := range wire.Routes {
+		manifest.Routes = append(manifest.Routes, mcli_type.HttpPluginRoute{Name: route.Name, Pattern: route.Pattern,
+			Match: route.Match, Methods: route.Methods, Middlewares: route.Middlewares, Handler: p.routeHandler(route.Name)})
+	}
+	for key, field := range wire.ConfigSchema {
+		manifest.ConfigSchema[key] = mcli_type.HttpPluginConfigField(field)
+	}
+	return manifest
+}
+
+// Init passes config to plugin, it is passed again after every restart
+func (p *ProcessPlugin) Init(config map[string]interface{}) error {
+	if err := p.call(http.MethodPost, "/mcli/init", config, nil); err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.config, p.initialized = config, true
+	p.mu.Unlock()
+	return nil
+}
+
+// routeHandler proxies request to plugin with name of route and user name of authenticated user
+func (p *ProcessPlugin) routeHandler(name string) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		ctx, cancel := context.WithTimeout(req.Context(), p.Timeout)
+		defer cancel()
+		outReq := req.Clone(ctx)
+		outReq.Header.Set(processPluginRouteHeader, name)
+		outReq.Header.Del(processPluginUserHeader)
+		if user, ok := ctx.Value(go_common_ddru.ContextKey("AuthUser")).(*Credential); ok && user != nil {
+			outReq.Header.Set(processPluginUserHeader, user.Username)
+		}
+		p.proxy.ServeHTTP(res, outReq)
+	}
+}
+
+// pluginLogWriter writes output of plugin process to log line by line
+type pluginLogWriter struct {
+	log  zerolog.Logger
+	name string
+	buf  []byte
+}
+
+func (w *pluginLogWriter) Write(data []byte) (int, error) {
+	w.buf = append(w.buf, data...)
+	for {
+		end := bytes.IndexByte(w.buf, '\n')
+		if end < 0 {
+			// incomplete line waits for the rest
+			break
+		}
+		w.log.Info().Msgf("plugin %s: %s", w.name, w.buf[:end])
+		w.buf = w.buf[end+1:]
+	}
+	return len(data), nil
+}
+
+// ServeProcessPlugin serves plugin by out-of-process plugin protocol on socket from MCLI_PLUGIN_SOCKET.
+// It is called from main of plugin executable and returns when mcli closes stdin of plugin.
+func ServeProcessPlugin(plugin mcli_type.HttpPlugin) error {
+	socket := os.Getenv(ProcessPluginSocketEnv)
+	if len(socket) == 0 {
+		return fmt.Errorf("%s is not set, plugin must be started by mcli", ProcessPluginSocketEnv)
+	}
+	manifest := plugin.Manifest()
+	handlers := make(map[string]http.HandlerFunc, len(manifest.Routes))
+	for _, route := range manifest.Routes {
+		handlers[route.Name] = route.Handler
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/mcli/health", func(res http.ResponseWriter, req *http.Request) {
+		res.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/mcli/manifest", func(res http.ResponseWriter, req *http.Request) {
+		RenderJSON(res, toProcessPluginManifest(manifest), false)
+	})
+	mux.HandleFunc("/mcli/init", func(res http.ResponseWriter, req *http.Request) {
+		config := make(map[string]interface{})
+		if err := json.NewDecoder(req.Body).Decode(&config); err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := plugin.Init(config); err != nil {
+			http.Error(res, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		res.Write([]byte("ok"))
+	})
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if name := req.Header.Get(processPluginRouteHeader); len(name) > 0 {
+			if handler, ok := handlers[name]; ok {
+				handler(res, req)
+				return
+			}
+			http.NotFound(res, req)
+			return
+		}
+		mux.ServeHTTP(res, req)
+	})}
+	go func() {
+		io.Copy(io.Discard, os.Stdin)
+		srv.Close()
+	}()
+	if err := srv.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
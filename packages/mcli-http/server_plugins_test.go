@@ -0,0 +1,148 @@
+package mclihttp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	mcli_type "mcli/packages/mcli-type"
+
+	"github.com/rs/zerolog"
+)
+
+type testHttpPlugin struct {
+	manifest mcli_type.HttpPluginManifest
+	config   map[string]interface{}
+}
+
+func (p *testHttpPlugin) Manifest() mcli_type.HttpPluginManifest { return p.manifest }
+
+func (p *testHttpPlugin) Init(config map[string]interface{}) error {
+	p.config = config
+	return nil
+}
+
+func TestRegisterPlugin(t *testing.T) {
+	r := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), nil)
+	r.AddRouteWithHandler("/echo", Equal, Http_Echo)
+	ok := func(res http.ResponseWriter, req *http.Request) { res.Write([]byte("hello")) }
+
+	hello := &testHttpPlugin{manifest: mcli_type.HttpPluginManifest{Name: "hello", Version: "1.0.0", ApiVersion: 2,
+		Routes: []mcli_type.HttpPluginRoute{{Name: "HELLO", Pattern: "/hello", Methods: []string{"get"}, Handler: ok}},
+		ConfigSchema: map[string]mcli_type.HttpPluginConfigField{
+			"greeting": {Type: "string", Default: "hi"},
+			"limit":    {Type: "number", Required: true},
+		}}}
+	if err := r.RegisterPlugin("hello.so", hello, map[string]interface{}{"limit": "ten"}); err == nil {
+		t.Fatal("config with wrong type must be rejected")
+	}
+	if err := r.RegisterPlugin("hello.so", hello, map[string]interface{}{"limit": 10}); err != nil {
+		t.Fatal(err)
+	}
+	if hello.config["greeting"] != "hi" {
+		t.Errorf("default config value is not applied: %v", hello.config)
+	}
+
+	collisions := []mcli_type.HttpPluginManifest{
+		{Name: "echo", ApiVersion: 2, Routes: []mcli_type.HttpPluginRoute{{Name: "ECHO", Pattern: "/echo", Handler: ok}}},
+		{Name: "other", ApiVersion: 2, Routes: []mcli_type.HttpPluginRoute{{Name: "HELLO", Pattern: "/other", Handler: ok}}},
+		{Name: "secure", ApiVersion: 2, Routes: []mcli_type.HttpPluginRoute{{Name: "SECURE", Pattern: "/secure",
+			Middlewares: []string{"auth"}, Handler: ok}}},
+		{Name: "future", ApiVersion: 3},
+	}
+	for _, manifest := range collisions {
+		if err := r.RegisterPlugin(manifest.Name+".so", &testHttpPlugin{manifest: manifest}, nil); err == nil {
+			t.Errorf("plugin %s must be rejected", manifest.Name)
+		}
+	}
+	plugins := r.Plugins()
+	if len(plugins) != 6 || plugins[1].Status != "loaded" || plugins[2].Status != "failed" {
+		t.Errorf("unexpected plugin statuses: %+v", plugins)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/hello", nil))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Allow") != "GET" {
+		t.Errorf("POST must not be allowed: %d %q", rec.Code, rec.Header().Get("Allow"))
+	}
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/hello", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "hello") {
+		t.Errorf("unexpected response: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestProcessPluginHelper is plugin executable started by TestProcessPlugin
+func TestProcessPluginHelper(t *testing.T) {
+	if len(os.Getenv(ProcessPluginSocketEnv)) == 0 {
+		t.Skip("started by TestProcessPlugin only")
+	}
+	greet := &testHttpPlugin{}
+	greet.manifest = mcli_type.HttpPluginManifest{Name: "greet", Version: "0.1.0", ApiVersion: 2,
+		Routes: []mcli_type.HttpPluginRoute{{Name: "GREET", Pattern: "/greet", Handler: func(res http.ResponseWriter, req *http.Request) {
+			fmt.Fprintf(res, "%v, %s", greet.config["greeting"], req.URL.Query().Get("name"))
+		}}},
+		ConfigSchema: map[string]mcli_type.HttpPluginConfigField{"greeting": {Type: "string", Default: "hello"}}}
+	if err := ServeProcessPlugin(greet); err != nil {
+		t.Fatal(err)
+	}
+	os.Exit(0)
+}
+
+func TestProcessPlugin(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewProcessPlugin(ctx, os.Args[0], []string{"-test.run=^TestProcessPluginHelper$"}, time.Second,
+		zerolog.Nop(), zerolog.Nop())
+	p.HealthInterval = 100 * time.Millisecond
+	if err := p.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if info, err := os.Stat(filepath.Dir(p.socketPath())); err != nil {
+		t.Error(err)
+	} else if info.Mode().Perm() != 0700 {
+		t.Errorf("socket directory must be private, got %v", info.Mode())
+	}
+
+	r := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), nil)
+	if err := r.RegisterPlugin(p.Path, p, map[string]interface{}{"greeting": "hi"}); err != nil {
+		t.Fatal(err)
+	}
+	greet := func() string {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/greet?name=mcli", nil))
+		body, _ := io.ReadAll(rec.Body)
+		return fmt.Sprintf("%d %s", rec.Code, body)
+	}
+	if result := greet(); result != "200 hi, mcli" {
+		t.Fatalf("unexpected response: %s", result)
+	}
+
+	// crashed plugin is restarted and initialized with the same config
+	p.mu.RLock()
+	p.cmd.Process.Kill()
+	p.mu.RUnlock()
+	deadline := time.Now().Add(5 * time.Second)
+	result := greet()
+	for result != "200 hi, mcli" && time.Now().Before(deadline) {
+		time.Sleep(100 * time.Millisecond)
+		result = greet()
+	}
+	if result != "200 hi, mcli" {
+		t.Errorf("plugin is not restarted: %s", result)
+	}
+
+	socketDir := filepath.Dir(p.socketPath())
+	p.Stop()
+	if _, err := os.Stat(socketDir); !os.IsNotExist(err) {
+		t.Errorf("socket directory must be removed on stop: %v", err)
+	}
+}
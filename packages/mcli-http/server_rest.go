@@ -0,0 +1,698 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	mcli_type "mcli/packages/mcli-type"
+
+	"github.com/google/uuid"
+)
+
+// RestScheme describes records of collection, it is converted to mcli_type.Scheme
+type RestScheme struct {
+	// guid (default) or field:<name> - key of created record is taken from field
+	PrimaryKey       string                  `yaml:"primary-key"`
+	AdditionalFields bool                    `yaml:"additional-fields"`
+	Fields           []mcli_type.SchemeField `yaml:"fields"`
+}
+
+// RestCollection is kv store prefix exposed as CRUD endpoints: route/name and route/name/key
+type RestCollection struct {
+	Name string `yaml:"name"`
+	// kv prefix of records, default is name
+	Prefix   string `yaml:"prefix"`
+	ReadOnly bool   `yaml:"read-only"`
+	// reading without authentication
+	PublicRead bool `yaml:"public-read"`
+	// authenticated user must have any of roles, any authenticated user is allowed if roles are empty
+	ReadRoles  []string `yaml:"read-roles"`
+	WriteRoles []string `yaml:"write-roles"`
+	// fields which are removed from records in responses and kept on replace, f.e. password
+	HiddenFields []string `yaml:"hidden-fields"`
+	// records of collection without scheme are arbitrary json values
+	Scheme *RestScheme `yaml:"scheme"`
+
+	scheme *mcli_type.Scheme
+}
+
+type RestConfig struct {
+	Enabled bool `yaml:"enabled"`
+	// route relative to base url, default is /api
+	Route           string           `yaml:"route"`
+	DefaultPageSize int              `yaml:"default-page-size"`
+	MaxPageSize     int              `yaml:"max-page-size"`
+	Collections     []RestCollection `yaml:"collections"`
+}
+
+// restOpenAPIPath is path of OpenAPI document relative to route of api
+const restOpenAPIPath = "openapi.json"
+
+const restMaxBodySize = 1 << 20
+
+var restKeyRegexp = regexp.MustCompile(`^[\w.@+-]+$`)
+
+// RestAPI serves collections of kv store as JSON REST resources
+type RestAPI struct {
+	// full path of api including base url
+	Route       string
+	config      RestConfig
+	kvStore     mcli_type.KVStorer
+	collections map[string]*RestCollection
+	// serializes check and set of created records for stores without atomic set if absent
+	createMu sync.Mutex
+	// state which route and session cookie name are taken from
+	state *ServerState
+}
+
+func NewRestAPI(config RestConfig, kvStore mcli_type.KVStorer) (*RestAPI, error) {
+	return newRestAPI(CurrentServerState(), config, kvStore)
+}
+
+func newRestAPI(st *ServerState, config RestConfig, kvStore mcli_type.KVStorer) (*RestAPI, error) {
+	if len(config.Route) == 0 {
+		config.Route = "/api"
+	}
+	if config.DefaultPageSize <= 0 {
+		config.DefaultPageSize = 20
+	}
+	if config.MaxPageSize < config.DefaultPageSize {
+		config.MaxPageSize = max(100, config.DefaultPageSize)
+	}
+	api := &RestAPI{Route: st.Config.GetFullUrl(config.Route), config: config, kvStore: kvStore,
+		collections: make(map[string]*RestCollection, len(config.Collections)), state: st}
+	for i := range config.Collections {
+		collection := &config.Collections[i]
+		if !restKeyRegexp.MatchString(collection.Name) || collection.Name == restOpenAPIPath {
+			return nil, fmt.Errorf("rest collection name %q is not valid", collection.Name)
+		}
+		if _, ok := api.collections[collection.Name]; ok {
+			return nil, fmt.Errorf("rest collection %s is duplicated", collection.Name)
+		}
+		if len(collection.Prefix) == 0 {
+			collection.Prefix = collection.Name
+		}
+		if collection.Scheme != nil {
+			scheme, err := collection.Scheme.toScheme(collection.Prefix)
+			if err != nil {
+				return nil, fmt.Errorf("rest collection %s: %w", collection.Name, err)
+			}
+			collection.scheme = scheme
+		}
+		api.collections[collection.Name] = collection
+	}
+	return api, nil
+}
+
+func (rs *RestScheme) toScheme(prefix string) (*mcli_type.Scheme, error) {
+	scheme := mcli_type.NewScheme(mcli_type.StoreTypeRedis, "1")
+	scheme.Prefix, scheme.RecordType = prefix, mcli_type.RecordTypePlain
+	scheme.Fields, scheme.AdditionalFields = rs.Fields, rs.AdditionalFields
+	switch {
+	case rs.PrimaryKey == "" || rs.PrimaryKey == "guid":
+		scheme.PKType = mcli_type.PKTypeGuid
+	case strings.HasPrefix(rs.PrimaryKey, "field:"):
+		scheme.PKType, scheme.PKFieldName = mcli_type.PKTypeFieldValue, strings.TrimPrefix(rs.PrimaryKey, "field:")
+	default:
+		return nil, fmt.Errorf("primary key %s is not supported, use guid or field:<name>", rs.PrimaryKey)
+	}
+	if err := scheme.CompilePatterns(); err != nil {
+		return nil, err
+	}
+	return scheme, nil
+}
+
+// EnableRestAPI registers rest api route, records are kept in kvStore or in kv store of router if it is nil
+func (r *Router) EnableRestAPI(config RestConfig, kvStore mcli_type.KVStorer) (*RestAPI, error) {
+	if kvStore == nil {
+		kvStore = r.KVStore
+	}
+	if kvStore == nil {
+		return nil, fmt.Errorf("rest api needs kv store")
+	}
+	api, err := newRestAPI(r.State(), config, kvStore)
+	if err != nil {
+		return nil, err
+	}
+	api.Route = r.getResultPattern(api.config.Route)
+	if err := r.AddRouteWithHandler(api.config.Route, Prefix, api.ServeHTTP); err != nil {
+		return nil, err
+	}
+	return api, nil
+}
+
+func restError(res http.ResponseWriter, code int, err error) {
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(code)
+	RenderErrorJSON(res, err)
+}
+
+func (api *RestAPI) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	res.Header().Set("Cache-Control", "no-store")
+	rest, ok := strings.CutPrefix(strings.TrimSuffix(req.URL.Path, "/"), api.Route)
+	if !ok || (len(rest) > 0 && !strings.HasPrefix(rest, "/")) {
+		restError(res, http.StatusNotFound, errors.New("resource not found"))
+		return
+	}
+	segments := strings.Split(strings.TrimPrefix(rest, "/"), "/")
+	if segments[0] == restOpenAPIPath && len(segments) == 1 {
+		RenderJSON(res, api.OpenAPI(), false)
+		return
+	}
+	collection, ok := api.collections[segments[0]]
+	if !ok || len(segments) > 2 {
+		restError(res, http.StatusNotFound, errors.New("resource not found"))
+		return
+	}
+	key := ""
+	if len(segments) == 2 {
+		key = segments[1]
+		if !restKeyRegexp.MatchString(key) {
+			restError(res, http.StatusBadRequest, fmt.Errorf("key %q is not valid", key))
+			return
+		}
+	}
+
+	write := req.Method != http.MethodGet && req.Method != http.MethodHead
+	if write && collection.ReadOnly {
+		res.Header().Set("Allow", "GET, HEAD")
+		restError(res, http.StatusMethodNotAllowed, errors.New("collection is read only"))
+		return
+	}
+	if !api.isAllowed(res, req, collection, write) {
+		return
+	}
+	if write && !isRestWriteSafe(res, req) {
+		return
+	}
+
+	switch {
+	case len(key) == 0 && !write:
+		api.list(res, req, collection)
+	case len(key) == 0 && req.Method == http.MethodPost:
+		api.create(res, req, collection)
+	case len(key) > 0 && !write:
+		api.get(res, collection, key)
+	case len(key) > 0 && (req.Method == http.MethodPut || req.Method == http.MethodPatch):
+		api.update(res, req, collection, key)
+	case len(key) > 0 && req.Method == http.MethodDelete:
+		api.delete(res, collection, key)
+	default:
+		if len(key) == 0 {
+			res.Header().Set("Allow", "GET, HEAD, POST")
+		} else {
+			res.Header().Set("Allow", "GET, HEAD, PUT, PATCH, DELETE")
+		}
+		restError(res, http.StatusMethodNotAllowed, fmt.Errorf("method %s is not allowed", req.Method))
+	}
+}
+
+// isAllowed checks authentication and roles of user, error response is written if access is denied
+func (api *RestAPI) isAllowed(res http.ResponseWriter, req *http.Request, collection *RestCollection, write bool) bool {
+	if !write && collection.PublicRead {
+		return true
+	}
+	if !IsAuthRequest(req) {
+		restError(res, http.StatusUnauthorized, errors.New("authentication required"))
+		return false
+	}
+	roles := collection.ReadRoles
+	if write {
+		roles = collection.WriteRoles
+	}
+	if len(roles) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if tmplHasRole(req, role) {
+			return true
+		}
+	}
+	restError(res, http.StatusForbidden, errors.New("access denied"))
+	return false
+}
+
+// isRestWriteSafe rejects writes which may be forged by other site with session cookie of user:
+// cross-origin requests without csrf token and bodies which are not json, error response is written
+func isRestWriteSafe(res http.ResponseWriter, req *http.Request) bool {
+	if req.Method != http.MethodDelete {
+		if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			restError(res, http.StatusUnsupportedMediaType, errors.New("request body must be application/json"))
+			return false
+		}
+	}
+	if !isSameOrigin(req) && !CheckCsrfToken(req) {
+		restError(res, http.StatusForbidden, errors.New("cross-origin request without csrf token"))
+		return false
+	}
+	return true
+}
+
+// isSameOrigin reports whether request is not sent by page of other origin, requests of clients
+// which are not browsers have no Origin header
+func isSameOrigin(req *http.Request) bool {
+	if req.Header.Get("Sec-Fetch-Site") == "cross-site" {
+		return false
+	}
+	origin := req.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	originURL, err := url.Parse(origin)
+	return err == nil && originURL.Host == req.Host
+}
+
+// decode returns stored value as json value, values which are not json are returned as strings
+func (api *RestAPI) decode(collection *RestCollection, raw []byte) interface{} {
+	var value interface{}
+	unmarshal := api.kvStore.GetUnMarshal()
+	if unmarshal == nil {
+		unmarshal = json.Unmarshal
+	}
+	if err := unmarshal(raw, &value); err != nil {
+		return string(raw)
+	}
+	if record, ok := value.(map[string]interface{}); ok {
+		for _, field := range collection.HiddenFields {
+			delete(record, field)
+		}
+	}
+	return value
+}
+
+type restRecord struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+func (api *RestAPI) list(res http.ResponseWriter, req *http.Request, collection *RestCollection) {
+	query := req.URL.Query()
+	page, err := strconv.Atoi(query.Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	perPage, err := strconv.Atoi(query.Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = api.config.DefaultPageSize
+	}
+	perPage = min(perPage, api.config.MaxPageSize)
+	pattern := query.Get("pattern")
+	if len(pattern) == 0 {
+		pattern = "*"
+	}
+	if strings.Contains(pattern, ":") {
+		restError(res, http.StatusBadRequest, errors.New("pattern must not contain ':'"))
+		return
+	}
+
+	records, err := api.kvStore.GetRecords(pattern, collection.Prefix)
+	if err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	keys := make([]string, 0, len(records))
+	for key := range records {
+		// nested keys of prefix, f.e. lookup indexes, are not records of collection
+		if key = strings.TrimPrefix(key, collection.Prefix+":"); !strings.Contains(key, ":") {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	items := make([]restRecord, 0, perPage)
+	for i := (page - 1) * perPage; i < len(keys) && i < page*perPage; i++ {
+		items = append(items, restRecord{Key: keys[i],
+			Value: api.decode(collection, records[collection.Prefix+":"+keys[i]])})
+	}
+	RenderJSON(res, struct {
+		Items   []restRecord `json:"items"`
+		Total   int          `json:"total"`
+		Page    int          `json:"page"`
+		PerPage int          `json:"per_page"`
+		Pages   int          `json:"pages"`
+	}{Items: items, Total: len(keys), Page: page, PerPage: perPage, Pages: (len(keys) + perPage - 1) / perPage}, true)
+}
+
+func (api *RestAPI) get(res http.ResponseWriter, collection *RestCollection, key string) {
+	raw, err, ok := api.kvStore.GetRecord(key, collection.Prefix)
+	if err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	if !ok {
+		restError(res, http.StatusNotFound, fmt.Errorf("record %s not found", key))
+		return
+	}
+	RenderJSON(res, restRecord{Key: key, Value: api.decode(collection, raw)}, true)
+}
+
+// readBody decodes json body, records of collection with scheme must be objects
+func readBody(res http.ResponseWriter, req *http.Request, collection *RestCollection) (interface{}, bool) {
+	var value interface{}
+	decoder := json.NewDecoder(http.MaxBytesReader(res, req.Body, restMaxBodySize))
+	if err := decoder.Decode(&value); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = errors.New("request body is empty")
+		}
+		restError(res, http.StatusBadRequest, fmt.Errorf("request body is not valid json: %w", err))
+		return nil, false
+	}
+	if _, isObject := value.(map[string]interface{}); collection.scheme != nil && !isObject {
+		restError(res, http.StatusBadRequest, errors.New("request body must be json object"))
+		return nil, false
+	}
+	return value, true
+}
+
+// primaryKey returns key of new record from field of record
+func primaryKey(scheme *mcli_type.Scheme, record map[string]interface{}) (string, error) {
+	switch value := record[scheme.PKFieldName].(type) {
+	case string:
+		if restKeyRegexp.MatchString(value) {
+			return value, nil
+		}
+	case float64:
+		if value == float64(int64(value)) {
+			return strconv.FormatInt(int64(value), 10), nil
+		}
+	}
+	return "", fmt.Errorf("field %s must be valid key", scheme.PKFieldName)
+}
+
+func (api *RestAPI) validate(collection *RestCollection, value interface{}) error {
+	if collection.scheme == nil {
+		return nil
+	}
+	return collection.scheme.Validate(value.(map[string]interface{}))
+}
+
+func (api *RestAPI) create(res http.ResponseWriter, req *http.Request, collection *RestCollection) {
+	value, ok := readBody(res, req, collection)
+	if !ok {
+		return
+	}
+	if err := api.validate(collection, value); err != nil {
+		restError(res, http.StatusUnprocessableEntity, err)
+		return
+	}
+	key := uuid.New().String()
+	if collection.scheme != nil && collection.scheme.PKType == mcli_type.PKTypeFieldValue {
+		var err error
+		if key, err = primaryKey(collection.scheme, value.(map[string]interface{})); err != nil {
+			restError(res, http.StatusUnprocessableEntity, err)
+			return
+		}
+	}
+	created, err := api.createRecord(key, value, collection.Prefix)
+	if err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	if !created {
+		restError(res, http.StatusConflict, fmt.Errorf("record %s already exists", key))
+		return
+	}
+	res.Header().Set("Location", api.Route+"/"+collection.Name+"/"+key)
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(http.StatusCreated)
+	RenderJSON(res, restRecord{Key: key, Value: api.decode(collection, mustMarshal(value))}, true)
+}
+
+// createRecord sets record if key does not exist and reports whether it is set
+func (api *RestAPI) createRecord(key string, value interface{}, prefix string) (bool, error) {
+	if creator, ok := api.kvStore.(mcli_type.KVCreator); ok {
+		return creator.SetRecordNX(key, value, prefix)
+	}
+	api.createMu.Lock()
+	defer api.createMu.Unlock()
+	if _, err, exists := api.kvStore.GetRecord(key, prefix); err != nil || exists {
+		return false, err
+	}
+	return true, api.kvStore.SetRecord(key, value, prefix)
+}
+
+// update replaces record (PUT) or merges fields into it (PATCH), PUT creates record if it does not exist
+func (api *RestAPI) update(res http.ResponseWriter, req *http.Request, collection *RestCollection, key string) {
+	value, ok := readBody(res, req, collection)
+	if !ok {
+		return
+	}
+	raw, err, exists := api.kvStore.GetRecord(key, collection.Prefix)
+	if err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists && req.Method == http.MethodPatch {
+		restError(res, http.StatusNotFound, fmt.Errorf("record %s not found", key))
+		return
+	}
+
+	var stored map[string]interface{}
+	if exists {
+		unmarshal := api.kvStore.GetUnMarshal()
+		if unmarshal == nil {
+			unmarshal = json.Unmarshal
+		}
+		var storedValue interface{}
+		if err := unmarshal(raw, &storedValue); err != nil {
+			restError(res, http.StatusInternalServerError, fmt.Errorf("stored record %s is not readable: %w", key, err))
+			return
+		}
+		stored, _ = storedValue.(map[string]interface{})
+	}
+	record, isObject := value.(map[string]interface{})
+	if req.Method == http.MethodPatch {
+		if !isObject || stored == nil {
+			restError(res, http.StatusBadRequest, errors.New("only object records may be patched"))
+			return
+		}
+		for name, fieldValue := range record {
+			if fieldValue == nil {
+				delete(stored, name)
+			} else {
+				stored[name] = fieldValue
+			}
+		}
+		record, value = stored, stored
+	} else if isObject && stored != nil {
+		// hidden fields are not shown to clients, so they are kept when record is replaced
+		for _, name := range collection.HiddenFields {
+			if _, ok := record[name]; !ok && stored[name] != nil {
+				record[name] = stored[name]
+			}
+		}
+	}
+
+	if scheme := collection.scheme; scheme != nil && scheme.PKType == mcli_type.PKTypeFieldValue {
+		if _, ok := record[scheme.PKFieldName]; !ok {
+			record[scheme.PKFieldName] = key
+		}
+		if pk, err := primaryKey(scheme, record); err != nil || pk != key {
+			restError(res, http.StatusUnprocessableEntity, fmt.Errorf("field %s must be equal to key %s", scheme.PKFieldName, key))
+			return
+		}
+	}
+	if err := api.validate(collection, value); err != nil {
+		restError(res, http.StatusUnprocessableEntity, err)
+		return
+	}
+	if err := api.kvStore.SetRecord(key, value, collection.Prefix); err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	if !exists {
+		res.Header().Set("Location", api.Route+"/"+collection.Name+"/"+key)
+		res.Header().Set("Content-Type", "application/json")
+		res.WriteHeader(http.StatusCreated)
+	}
+	RenderJSON(res, restRecord{Key: key, Value: api.decode(collection, mustMarshal(value))}, true)
+}
+
+func (api *RestAPI) delete(res http.ResponseWriter, collection *RestCollection, key string) {
+	if _, err, exists := api.kvStore.GetRecord(key, collection.Prefix); err != nil || !exists {
+		if err != nil {
+			restError(res, http.StatusInternalServerError, err)
+		} else {
+			restError(res, http.StatusNotFound, fmt.Errorf("record %s not found", key))
+		}
+		return
+	}
+	if err := api.kvStore.RemoveRecord(key, collection.Prefix); err != nil {
+		restError(res, http.StatusInternalServerError, err)
+		return
+	}
+	res.WriteHeader(http.StatusNoContent)
+}
+
+// mustMarshal marshals value decoded from json, it can not fail
+func mustMarshal(value interface{}) []byte {
+	raw, _ := json.Marshal(value)
+	return raw
+}
+
+// OpenAPI returns OpenAPI 3 document describing collections of api
+func (api *RestAPI) OpenAPI() map[string]interface{} {
+	ref := func(name string) map[string]interface{} {
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	envelope := func(payload interface{}) map[string]interface{} {
+		return map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			"iserror": map[string]interface{}{"type": "boolean"},
+			"error":   map[string]interface{}{"type": "string"},
+			"payload": payload,
+		}}
+	}
+	response := func(description string, schema interface{}) map[string]interface{} {
+		result := map[string]interface{}{"description": description}
+		if schema != nil {
+			result["content"] = map[string]interface{}{"application/json": map[string]interface{}{"schema": schema}}
+		}
+		return result
+	}
+	errorResponse := func(description string) map[string]interface{} {
+		return response(description, ref("Error"))
+	}
+	keyParameter := map[string]interface{}{"name": "key", "in": "path", "required": true,
+		"schema": map[string]interface{}{"type": "string", "pattern": restKeyRegexp.String()}}
+
+	schemas := map[string]interface{}{
+		"Error": map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			"iserror": map[string]interface{}{"type": "boolean"},
+			"error":   map[string]interface{}{"type": "string"},
+		}},
+	}
+	paths := make(map[string]interface{})
+	names := make([]string, 0, len(api.collections))
+	for name := range api.collections {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		collection := api.collections[name]
+		schemaName := strings.ReplaceAll(name, ".", "_")
+		schemas[schemaName] = collection.jsonSchema()
+		record := map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			"key": map[string]interface{}{"type": "string"}, "value": ref(schemaName)}}
+		list := map[string]interface{}{"type": "object", "properties": map[string]interface{}{
+			"items":    map[string]interface{}{"type": "array", "items": record},
+			"total":    map[string]interface{}{"type": "integer"},
+			"page":     map[string]interface{}{"type": "integer"},
+			"per_page": map[string]interface{}{"type": "integer"},
+			"pages":    map[string]interface{}{"type": "integer"},
+		}}
+		body := map[string]interface{}{"required": true, "content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": ref(schemaName)}}}
+		readSecurity := []interface{}{map[string]interface{}{"cookieAuth": []string{}}}
+		if collection.PublicRead {
+			readSecurity = []interface{}{}
+		}
+		writeSecurity := []interface{}{map[string]interface{}{"cookieAuth": []string{}}}
+		operation := func(summary string, security []interface{}, responses map[string]interface{}) map[string]interface{} {
+			responses["401"] = errorResponse("authentication required")
+			responses["403"] = errorResponse("user has no required role")
+			return map[string]interface{}{"tags": []string{name}, "summary": summary, "security": security,
+				"responses": responses}
+		}
+
+		collectionPath := map[string]interface{}{
+			"get": operation("List records of "+name, readSecurity, map[string]interface{}{
+				"200": response("page of records", envelope(list))}),
+		}
+		collectionPath["get"].(map[string]interface{})["parameters"] = []interface{}{
+			map[string]interface{}{"name": "page", "in": "query", "schema": map[string]interface{}{"type": "integer", "minimum": 1}},
+			map[string]interface{}{"name": "per_page", "in": "query",
+				"schema": map[string]interface{}{"type": "integer", "minimum": 1, "maximum": api.config.MaxPageSize}},
+			map[string]interface{}{"name": "pattern", "in": "query", "description": "glob pattern of keys",
+				"schema": map[string]interface{}{"type": "string"}},
+		}
+		recordPath := map[string]interface{}{
+			"parameters": []interface{}{keyParameter},
+			"get": operation("Get record of "+name, readSecurity, map[string]interface{}{
+				"200": response("record", envelope(record)), "404": errorResponse("record not found")}),
+		}
+		if !collection.ReadOnly {
+			create := operation("Create record of "+name, writeSecurity, map[string]interface{}{
+				"201": response("created record", envelope(record)), "409": errorResponse("record already exists"),
+				"422": errorResponse("record is not valid")})
+			create["requestBody"] = body
+			collectionPath["post"] = create
+			replace := operation("Replace or create record of "+name, writeSecurity, map[string]interface{}{
+				"200": response("replaced record", envelope(record)), "201": response("created record", envelope(record)),
+				"422": errorResponse("record is not valid")})
+			replace["requestBody"] = body
+			recordPath["put"] = replace
+			patch := operation("Merge fields into record of "+name+", null removes field", writeSecurity,
+				map[string]interface{}{"200": response("patched record", envelope(record)),
+					"404": errorResponse("record not found"), "422": errorResponse("record is not valid")})
+			patch["requestBody"] = map[string]interface{}{"required": true, "content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": map[string]interface{}{"type": "object"}}}}
+			recordPath["patch"] = patch
+			recordPath["delete"] = operation("Delete record of "+name, writeSecurity, map[string]interface{}{
+				"204": response("record is deleted", nil), "404": errorResponse("record not found")})
+		}
+		paths[api.Route+"/"+name] = collectionPath
+		paths[api.Route+"/"+name+"/{key}"] = recordPath
+	}
+
+	cookieName := api.state.cookieName
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]interface{}{"title": "mcli rest api", "version": "1"},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"cookieAuth": map[string]interface{}{"type": "apiKey", "in": "cookie", "name": cookieName},
+			},
+		},
+	}
+}
+
+// jsonSchema converts scheme of collection to json schema, records without scheme may be any value
+func (collection *RestCollection) jsonSchema() map[string]interface{} {
+	if collection.scheme == nil {
+		return map[string]interface{}{}
+	}
+	properties := make(map[string]interface{}, len(collection.scheme.Fields))
+	required := make([]string, 0)
+	for _, field := range collection.scheme.Fields {
+		property := map[string]interface{}{"type": field.Type}
+		if slices.Contains(collection.HiddenFields, field.Name) {
+			property["writeOnly"] = true
+		}
+		switch field.Type {
+		case "":
+			property["type"] = "string"
+		case "array":
+			property["items"] = map[string]interface{}{}
+		}
+		if len(field.Pattern) > 0 {
+			property["pattern"] = field.Pattern
+		}
+		if len(field.Enum) > 0 {
+			property["enum"] = field.Enum
+		}
+		if field.MaxLength > 0 {
+			property["maxLength"] = field.MaxLength
+		}
+		properties[field.Name] = property
+		if field.Required {
+			required = append(required, field.Name)
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties,
+		"additionalProperties": collection.scheme.AdditionalFields}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
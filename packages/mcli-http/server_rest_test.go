@@ -0,0 +1,218 @@
+package mclihttp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	mcli_type "mcli/packages/mcli-type"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+)
+
+// memKVStore keeps json values of records in map by prefix:key
+type memKVStore struct {
+	records map[string][]byte
+}
+
+func (kv *memKVStore) SetEncrypt(bool, []byte, mcli_type.SecretsCypher)                  {}
+func (kv *memKVStore) SetMarshalling(func(any) ([]byte, error), func([]byte, any) error) {}
+func (kv *memKVStore) GetMarshal() func(any) ([]byte, error)                             { return json.Marshal }
+func (kv *memKVStore) GetUnMarshal() func([]byte, any) error                             { return json.Unmarshal }
+func (kv *memKVStore) SetRecords(map[string]interface{}, ...string) error                { return nil }
+func (kv *memKVStore) SetRecordEx(key string, value interface{}, _ int, prefixes ...string) error {
+	return kv.SetRecord(key, value, prefixes...)
+}
+func (kv *memKVStore) SetRecordsEx(map[string]interface{}, int, ...string) error { return nil }
+func (kv *memKVStore) RemoveRecords([]string, ...string) error                   { return nil }
+func (kv *memKVStore) Close()                                                    {}
+
+func (kv *memKVStore) GetRecord(key string, prefixes ...string) ([]byte, error, bool) {
+	value, ok := kv.records[prefixes[0]+":"+key]
+	return value, nil, ok
+}
+
+func (kv *memKVStore) GetRecordEx(key string, prefixes ...string) ([]byte, int, error) {
+	value, _, _ := kv.GetRecord(key, prefixes...)
+	return value, -1, nil
+}
+
+func (kv *memKVStore) GetRecords(pattern string, prefixes ...string) (map[string][]byte, error) {
+	result := make(map[string][]byte)
+	for key, value := range kv.records {
+		if ok, _ := path.Match(prefixes[0]+":"+pattern, key); ok {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+func (kv *memKVStore) SetRecord(key string, value interface{}, prefixes ...string) error {
+	raw, err := json.Marshal(value)
+	kv.records[prefixes[0]+":"+key] = raw
+	return err
+}
+
+func (kv *memKVStore) RemoveRecord(key string, prefixes ...string) error {
+	delete(kv.records, prefixes[0]+":"+key)
+	return nil
+}
+
+func TestRestAPI(t *testing.T) {
+	kv := &memKVStore{records: map[string][]byte{
+		"userlist:admin": []byte(`{"username":"admin","password":"hash","roles":["admin"]}`),
+		"userlist:bob":   []byte(`{"username":"bob","password":"hash"}`),
+	}}
+	api, err := NewRestAPI(RestConfig{Route: "/api", DefaultPageSize: 1, Collections: []RestCollection{
+		{Name: "users", Prefix: "userlist", ReadOnly: true, ReadRoles: []string{"admin"}, HiddenFields: []string{"password"}},
+		{Name: "notes", PublicRead: true, WriteRoles: []string{"admin"}, Scheme: &RestScheme{
+			PrimaryKey: "field:slug",
+			Fields: []mcli_type.SchemeField{{Name: "slug", Required: true}, {Name: "title", Required: true, MaxLength: 10},
+				{Name: "status", Enum: []string{"draft", "published"}}, {Name: "views", Type: "integer"}},
+		}},
+	}}, kv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Route = "/api"
+
+	type envelope struct {
+		IsError bool            `json:"iserror"`
+		Error   string          `json:"error"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	var headers http.Header
+	serve := func(method, target, body string, roles ...string) (*httptest.ResponseRecorder, envelope) {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		if len(body) > 0 {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+		for name, values := range headers {
+			req.Header[name] = values
+		}
+		if roles != nil {
+			ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("IsAuth"), true)
+			ctx = context.WithValue(ctx, go_common_ddru.ContextKey("AuthUser"), &Credential{Username: "test", Roles: roles})
+			req = req.WithContext(ctx)
+		}
+		res := httptest.NewRecorder()
+		api.ServeHTTP(res, req)
+		var result envelope
+		json.Unmarshal(res.Body.Bytes(), &result)
+		return res, result
+	}
+
+	if res, _ := serve(http.MethodGet, "/api/users", ""); res.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous list of users must be unauthorized, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodGet, "/api/users", "", "user-rw"); res.Code != http.StatusForbidden {
+		t.Errorf("list of users without role must be forbidden, got %d", res.Code)
+	}
+	res, result := serve(http.MethodGet, "/api/users?page=2", "", "admin")
+	var page struct {
+		Items []restRecord `json:"items"`
+		Total int          `json:"total"`
+		Pages int          `json:"pages"`
+	}
+	json.Unmarshal(result.Payload, &page)
+	if res.Code != http.StatusOK || page.Total != 2 || page.Pages != 2 || len(page.Items) != 1 || page.Items[0].Key != "bob" {
+		t.Fatalf("unexpected page of users: %d %s", res.Code, res.Body.String())
+	}
+	if strings.Contains(res.Body.String(), "password") {
+		t.Errorf("hidden field is in response: %s", res.Body.String())
+	}
+	if res, _ := serve(http.MethodDelete, "/api/users/bob", "", "admin"); res.Code != http.StatusMethodNotAllowed {
+		t.Errorf("read only collection must not be changed, got %d", res.Code)
+	}
+
+	if res, _ := serve(http.MethodPost, "/api/notes", `{"slug":"a","title":"A"}`); res.Code != http.StatusUnauthorized {
+		t.Errorf("anonymous write must be unauthorized, got %d", res.Code)
+	}
+	res, result = serve(http.MethodPost, "/api/notes", `{"slug":"a","title":"too long title","status":"x","extra":1}`, "admin")
+	if res.Code != http.StatusUnprocessableEntity || !strings.Contains(result.Error, "extra is not allowed") ||
+		!strings.Contains(result.Error, "status must be one of") || !strings.Contains(result.Error, "title must not be longer") {
+		t.Errorf("invalid record must be rejected with all violations: %d %s", res.Code, result.Error)
+	}
+	res, _ = serve(http.MethodPost, "/api/notes", `{"slug":"a","title":"A","views":1}`, "admin")
+	if res.Code != http.StatusCreated || res.Header().Get("Location") != "/api/notes/a" {
+		t.Fatalf("record is not created: %d %v %s", res.Code, res.Header(), res.Body.String())
+	}
+	if res, _ := serve(http.MethodPost, "/api/notes", `{"slug":"a","title":"A"}`, "admin"); res.Code != http.StatusConflict {
+		t.Errorf("duplicated key must conflict, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodPatch, "/api/notes/a", `{"views":1.5}`, "admin"); res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("patch must be validated, got %d", res.Code)
+	}
+	res, result = serve(http.MethodPatch, "/api/notes/a", `{"views":null,"status":"draft"}`, "admin")
+	if res.Code != http.StatusOK || string(result.Payload) != `{"key":"a","value":{"slug":"a","status":"draft","title":"A"}}` {
+		t.Errorf("unexpected patch result: %d %s", res.Code, res.Body.String())
+	}
+	if res, _ := serve(http.MethodPut, "/api/notes/b", `{"slug":"a","title":"B"}`, "admin"); res.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key field must be equal to key, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodPut, "/api/notes/b", `{"title":"B"}`, "admin"); res.Code != http.StatusCreated {
+		t.Errorf("put must create record, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodGet, "/api/notes/b", ""); res.Code != http.StatusOK {
+		t.Errorf("public read is not allowed, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodDelete, "/api/notes/b", "", "admin"); res.Code != http.StatusNoContent {
+		t.Errorf("record is not deleted, got %d", res.Code)
+	}
+	if res, _ := serve(http.MethodGet, "/api/notes/b", ""); res.Code != http.StatusNotFound {
+		t.Errorf("deleted record is found, got %d", res.Code)
+	}
+
+	// writes with session cookie which may be sent by other sites are rejected
+	headers = http.Header{"Content-Type": {"text/plain"}}
+	if res, _ := serve(http.MethodPost, "/api/notes", `{"slug":"c","title":"C"}`, "admin"); res.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("body which is not json must be rejected, got %d", res.Code)
+	}
+	headers = http.Header{"Origin": {"https://evil.example"}}
+	if res, _ := serve(http.MethodDelete, "/api/notes/a", "", "admin"); res.Code != http.StatusForbidden {
+		t.Errorf("cross-origin write must be rejected, got %d", res.Code)
+	}
+	client := httptest.NewRequest("GET", "/", nil)
+	client.AddCookie(&http.Cookie{Name: csrfCookieName, Value: "client"})
+	headers = http.Header{"Origin": {"https://evil.example"}, "Cookie": {"csrf-id=client"},
+		"X-Csrf-Token": {CsrfToken(client)}}
+	if res, _ := serve(http.MethodPut, "/api/notes/c", `{"title":"C"}`, "admin"); res.Code != http.StatusCreated {
+		t.Errorf("cross-origin write with csrf token must be allowed, got %d", res.Code)
+	}
+	headers = http.Header{"Origin": {"http://example.com"}}
+	if res, _ := serve(http.MethodDelete, "/api/notes/c", "", "admin"); res.Code != http.StatusNoContent {
+		t.Errorf("same origin write must be allowed, got %d", res.Code)
+	}
+	headers = nil
+
+	// concurrent creates of the same key, only one succeeds
+	results := make(chan int, 8)
+	for i := 0; i < cap(results); i++ {
+		go func() {
+			res, _ := serve(http.MethodPost, "/api/notes", `{"slug":"race","title":"R"}`, "admin")
+			results <- res.Code
+		}()
+	}
+	created := 0
+	for i := 0; i < cap(results); i++ {
+		if <-results == http.StatusCreated {
+			created++
+		}
+	}
+	if created != 1 {
+		t.Errorf("record must be created once, created %d times", created)
+	}
+
+	res, _ = serve(http.MethodGet, "/api/openapi.json", "")
+	var document struct {
+		Paths map[string]map[string]interface{} `json:"paths"`
+	}
+	json.Unmarshal(res.Body.Bytes(), &document)
+	if _, ok := document.Paths["/api/notes/{key}"]["patch"]; !ok || len(document.Paths["/api/users/{key}"]) != 2 {
+		t.Errorf("unexpected OpenAPI paths: %v", document.Paths)
+	}
+}
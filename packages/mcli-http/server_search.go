@@ -0,0 +1,383 @@
+package mclihttp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"golang.org/x/net/html"
+)
+
+// PageInfo is filled by template handler when page is rendered internally for search index
+type PageInfo struct {
+	Title       string
+	Description string
+	Roles       []string
+}
+
+// SearchResult is page found by query
+type SearchResult struct {
+	Url     string  `json:"url"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Score   float64 `json:"score"`
+}
+
+type searchDoc struct {
+	url   string
+	title string
+	text  string
+	roles []string
+}
+
+// SearchIndex is inverted index of rendered template and markdown pages
+type SearchIndex struct {
+	sync.RWMutex
+	docs []searchDoc
+	// term -> doc number -> term frequency
+	postings map[string]map[int]int
+	// doc number -> terms of title
+	titles  map[int]map[string]bool
+	updated time.Time
+}
+
+// searchSuffixes are russian (transliterated) and english endings cut by stemmer, longest first
+var searchSuffixes = func() []string {
+	suffixes := strings.Fields(`iyami yami ami ogo ego omu emu ymi imi iya iye iyu ost ing ies ov ev ah yah om em
+		oy ey ay yy iy ya yu ye ie ed es a e i o u y s`)
+	sort.SliceStable(suffixes, func(i, j int) bool { return len(suffixes[i]) > len(suffixes[j]) })
+	return suffixes
+}()
+
+// normalizeSearchTerm makes cyrillic and latin forms of word comparable: "Голанг" and "golang" -> "golang"
+func normalizeSearchTerm(word string) string {
+	term := strings.ToLower(translitCyrillic(word))
+	for _, suffix := range searchSuffixes {
+		if strings.HasSuffix(term, suffix) && len(term)-len(suffix) >= 3 {
+			return strings.TrimSuffix(term, suffix)
+		}
+	}
+	return term
+}
+
+func searchTerms(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		if utf8.RuneCountInString(word) < 2 {
+			continue
+		}
+		terms = append(terms, normalizeSearchTerm(word))
+	}
+	return terms
+}
+
+// extractHtmlText returns title and visible text of html page, when page has <main> element
+// only its text is returned to skip navigation and footers
+func extractHtmlText(content []byte) (string, string) {
+	var title string
+	var text, mainText strings.Builder
+	skip, inMain, inTitle := 0, 0, false
+	tokenizer := html.NewTokenizer(bytes.NewReader(content))
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			result := text.String()
+			if mainText.Len() > 0 {
+				result = mainText.String()
+			}
+			return strings.TrimSpace(title), strings.Join(strings.Fields(result), " ")
+		case html.StartTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style":
+				skip++
+			case "main":
+				inMain++
+			case "title":
+				inTitle = true
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+			switch string(name) {
+			case "script", "style":
+				skip = max(skip-1, 0)
+			case "main":
+				inMain = max(inMain-1, 0)
+			case "title":
+				inTitle = false
+			}
+		case html.TextToken:
+			tokenText := tokenizer.Text()
+			if inTitle {
+				title += string(tokenText)
+			} else if skip == 0 {
+				text.Write(tokenText)
+				text.WriteString(" ")
+				if inMain > 0 {
+					mainText.Write(tokenText)
+					mainText.WriteString(" ")
+				}
+			}
+		}
+	}
+}
+
+// add puts document into index, it is used while index is not published yet
+func (index *SearchIndex) add(doc searchDoc) {
+	docNo := len(index.docs)
+	index.docs = append(index.docs, doc)
+	for _, term := range searchTerms(doc.title + " " + doc.text) {
+		if _, ok := index.postings[term]; !ok {
+			index.postings[term] = make(map[int]int)
+		}
+		index.postings[term][docNo]++
+	}
+	index.titles[docNo] = make(map[string]bool)
+	for _, term := range searchTerms(doc.title) {
+		index.titles[docNo][term] = true
+	}
+}
+
+// Search returns pages matching all words of query and allowed for user of request
+func (index *SearchIndex) Search(req *http.Request, query string, limit int) []SearchResult {
+	terms := searchTerms(query)
+	results := make([]SearchResult, 0)
+	if len(terms) == 0 {
+		return results
+	}
+	index.RLock()
+	defer index.RUnlock()
+
+	scores := make(map[int]float64)
+	for i, term := range terms {
+		postings := index.postings[term]
+		idf := math.Log(1 + float64(len(index.docs))/float64(len(postings)+1))
+		for docNo := range scores {
+			if _, ok := postings[docNo]; !ok {
+				delete(scores, docNo)
+			}
+		}
+		for docNo, frequency := range postings {
+			if _, ok := scores[docNo]; !ok && i > 0 {
+				continue
+			}
+			scores[docNo] += float64(frequency) * idf
+			if index.titles[docNo][term] {
+				scores[docNo] += 2 * idf
+			}
+		}
+	}
+	for docNo, score := range scores {
+		doc := index.docs[docNo]
+		if !(MdMetaData{Roles: doc.roles}).allowedFor(req) {
+			continue
+		}
+		results = append(results, SearchResult{Url: doc.url, Title: doc.title,
+			Snippet: searchSnippet(doc.text, query), Score: math.Round(score*1000) / 1000})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score == results[j].Score {
+			return results[i].Url < results[j].Url
+		}
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchSnippet returns part of text around first word of query found in it
+func searchSnippet(text, query string) string {
+	const around = 80
+	runes := []rune(text)
+	lowerText := strings.ToLower(text)
+	start := 0
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if idx := strings.Index(lowerText, word); idx >= 0 {
+			start = max(utf8.RuneCountInString(lowerText[:idx])-around, 0)
+			break
+		}
+	}
+	end := min(start+2*around, len(runes))
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "..." + snippet
+	}
+	if end < len(runes) {
+		snippet = snippet + "..."
+	}
+	return snippet
+}
+
+// serveInternal serves request by routes without middlewares
+func (r *Router) serveInternal(res http.ResponseWriter, req *http.Request) {
+	r.injectToContext(r.innerHandler, "router", r).ServeHTTP(res, req)
+}
+
+// buildSearchIndex renders all pages of template sets and indexes their text
+func (r *Router) buildSearchIndex() (*SearchIndex, error) {
+	index := &SearchIndex{postings: make(map[string]map[int]int), titles: make(map[int]map[string]bool)}
+	for _, page := range r.templatePages() {
+		info := &PageInfo{}
+		req := httptest.NewRequest(http.MethodGet, page.url, nil)
+		req = req.WithContext(context.WithValue(req.Context(), go_common_ddru.ContextKey("PageInfo"), info))
+		rec := httptest.NewRecorder()
+		r.serveInternal(rec, req)
+		if rec.Code != http.StatusOK {
+			// drafts and pages which cannot be rendered are not indexed
+			r.infoLog.Trace().Msgf("page %s is not indexed: status %d", page.url, rec.Code)
+			continue
+		}
+		title, text := extractHtmlText(rec.Body.Bytes())
+		if len(info.Title) > 0 {
+			title = info.Title
+		}
+		if len(info.Description) > 0 {
+			text = info.Description + " " + text
+		}
+		index.add(searchDoc{url: page.url, title: title, text: text, roles: info.Roles})
+	}
+	index.updated = time.Now()
+	return index, nil
+}
+
+// rebuild replaces content of index by freshly built one
+func (index *SearchIndex) rebuild(r *Router) error {
+	fresh, err := r.buildSearchIndex()
+	if err != nil {
+		return err
+	}
+	index.Lock()
+	index.docs, index.postings, index.titles, index.updated = fresh.docs, fresh.postings, fresh.titles, fresh.updated
+	index.Unlock()
+	return nil
+}
+
+// EnableSearch builds search index of template pages, serves it on route as json
+// and rebuilds it when templates or their data files change
+func (r *Router) EnableSearch(ctx context.Context, route string) error {
+	if len(route) == 0 {
+		route = "/search"
+	}
+	index, err := r.buildSearchIndex()
+	if err != nil {
+		return err
+	}
+	// search template function uses index of router state
+	r.State().searchIndex = index
+	r.infoLog.Trace().Msgf("search index is built: %d pages", len(index.docs))
+
+	err = r.AddRouteWithHandler(route, Equal, func(res http.ResponseWriter, req *http.Request) {
+		query := strings.TrimSpace(req.URL.Query().Get("q"))
+		if len(query) == 0 {
+			res.WriteHeader(http.StatusBadRequest)
+			RenderErrorJSON(res, fmt.Errorf("query parameter q is empty"))
+			return
+		}
+		limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 {
+			limit = 20
+		}
+		results := index.Search(req, query, limit)
+		RenderJSON(res, struct {
+			Query   string         `json:"query"`
+			Total   int            `json:"total"`
+			Results []SearchResult `json:"results"`
+		}{Query: query, Total: len(results), Results: results}, true)
+	})
+	if err != nil {
+		return err
+	}
+	go r.watchSearchSources(ctx, index)
+	return nil
+}
+
+// watchSearchSources rebuilds index after changes in template and data folders,
+// if filesystem watcher is not available folders are checked every 30 seconds
+func (r *Router) watchSearchSources(ctx context.Context, index *SearchIndex) {
+	dirs := make([]string, 0)
+	for _, set := range r.tmplSets {
+		dirs = append(dirs, set.cache.tmplPath)
+		if dataPath := strings.TrimRight(strings.TrimSpace(set.entry.TmplDataPath), "/"); len(dataPath) > 0 {
+			dirs = append(dirs, dataPath)
+		}
+	}
+	events := make(chan string)
+	watched := 0
+	for _, dir := range dirs {
+		dirEvents := make(chan string)
+		if err := watchTemplateTree(ctx, dir, dirEvents); err != nil {
+			r.errorLog.Info().Msgf("search watcher for %s is not available: %v", dir, err)
+			continue
+		}
+		watched++
+		go func() {
+			for path := range dirEvents {
+				select {
+				case events <- path:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	var poll <-chan time.Time
+	if watched < len(dirs) {
+		ticker := time.NewTicker(30 * time.Second)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+	lastModified := latestModTime(dirs)
+	var debounce <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-events:
+			// templates caches are rebuilt by their own watchers, so index waits a bit longer
+			debounce = time.After(2 * templateWatchDebounce)
+		case <-poll:
+			if modified := latestModTime(dirs); modified.After(lastModified) {
+				lastModified = modified
+				debounce = time.After(2 * templateWatchDebounce)
+			}
+		case <-debounce:
+			debounce = nil
+			if err := index.rebuild(r); err != nil {
+				r.errorLog.Error().Msgf("search index rebuild error: %v", err)
+				continue
+			}
+			r.infoLog.Trace().Msg("search index is rebuilt")
+		}
+	}
+}
+
+// latestModTime returns latest modification time of files in dirs
+func latestModTime(dirs []string) time.Time {
+	var latest time.Time
+	for _, dir := range dirs {
+		filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+			if err == nil && info.ModTime().After(latest) {
+				latest = info.ModTime()
+			}
+			return nil
+		})
+	}
+	return latest
+}
@@ -0,0 +1,41 @@
+package mclihttp
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+)
+
+func TestSearchIndex(t *testing.T) {
+	if normalizeSearchTerm("Голанге") != normalizeSearchTerm("golang") {
+		t.Errorf("cyrillic and latin forms differ: %s %s", normalizeSearchTerm("Голанге"), normalizeSearchTerm("golang"))
+	}
+
+	index := &SearchIndex{postings: make(map[string]map[int]int), titles: make(map[int]map[string]bool)}
+	index.add(searchDoc{url: "/md/go", title: "Голанг для администраторов", text: "Утилиты на golang для системных администраторов"})
+	index.add(searchDoc{url: "/md/admin", title: "Admin notes", text: "Секретные заметки про golang", roles: []string{"admin"}})
+	index.add(searchDoc{url: "/md/python", title: "Python", text: "Скрипты на python"})
+
+	title, text := extractHtmlText([]byte(`<html><head><title>Page</title><style>p{}</style></head>` +
+		`<body><nav>Menu</nav><main><h1>Header</h1><p>Text <b>here</b></p><script>var x</script></main></body></html>`))
+	if title != "Page" || text != "Header Text here" {
+		t.Errorf("unexpected extracted text: %q %q", title, text)
+	}
+
+	req := httptest.NewRequest("GET", "/search", nil)
+	results := index.Search(req, "GOLANG администратор", 10)
+	if len(results) != 1 || results[0].Url != "/md/go" {
+		t.Fatalf("unexpected results: %+v", results)
+	}
+	if results := index.Search(req, "golang", 10); len(results) != 1 {
+		t.Errorf("page restricted by roles is found by anonymous user: %+v", results)
+	}
+
+	admin := &Credential{Username: "admin", Roles: []string{"admin"}}
+	ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("AuthUser"), admin)
+	if results := index.Search(req.WithContext(ctx), "golang", 10); len(results) != 2 {
+		t.Errorf("expected 2 results for admin, got: %+v", results)
+	}
+}
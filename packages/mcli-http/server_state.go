@@ -0,0 +1,107 @@
+package mclihttp
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	sc "github.com/gorilla/securecookie"
+)
+
+// ServerState is state of http server built together with router: config, message catalog,
+// remote content fetcher, search index and session cookie options.
+// Router keeps state it is built with and requests read state of router which serves them,
+// so requests drained by previous router on config reload do not see new config.
+// Code which does not run for request of router reads state published by PublishServerState.
+type ServerState struct {
+	Config        Http
+	Catalog       *MessageCatalog
+	RemoteContent *RemoteFetcher
+
+	searchIndex   *SearchIndex
+	cookieName    string
+	secureCookie  *sc.SecureCookie
+	encodeCookies bool
+}
+
+// NewServerState returns state of config with empty catalog, default fetcher and not encoded session cookie
+func NewServerState(config Http) *ServerState {
+	st := &ServerState{Config: config, Catalog: NewMessageCatalog("en"),
+		RemoteContent: NewRemoteFetcher(nil, 10*time.Second, 5<<20)}
+	st.SetSecretCookieOptions(false, config.Server.Auth.AuthTokenName, nil, nil)
+	return st
+}
+
+var currentState atomic.Pointer[ServerState]
+
+func init() {
+	currentState.Store(NewServerState(Http{}))
+}
+
+// CurrentServerState returns state published last
+func CurrentServerState() *ServerState {
+	return currentState.Load()
+}
+
+// PublishServerState makes state current, state must not be changed after it is published
+func PublishServerState(st *ServerState) {
+	currentState.Store(st)
+}
+
+// stateOf returns state of router which serves request or current state
+func stateOf(req *http.Request) *ServerState {
+	if req != nil {
+		if router, ok := req.Context().Value(go_common_ddru.ContextKey("router")).(*Router); ok {
+			return router.State()
+		}
+	}
+	return CurrentServerState()
+}
+
+// SetSecretCookieOptions sets name of session cookie and keys to encode its value
+func (st *ServerState) SetSecretCookieOptions(doEncoding bool, cookieName string, cookieHash, cookieBlock []byte) {
+	if cookieName == "" {
+		cookieName = "session-token"
+	}
+	st.cookieName = cookieName
+	st.encodeCookies = doEncoding
+	st.secureCookie = nil
+	if doEncoding {
+		st.secureCookie = sc.New(cookieHash, cookieBlock)
+	}
+}
+
+// Locales returns configured locales or locales of loaded catalogs
+func (st *ServerState) Locales() []string {
+	if len(st.Config.Server.I18n.Locales) > 0 {
+		return st.Config.Server.I18n.Locales
+	}
+	st.Catalog.RLock()
+	defer st.Catalog.RUnlock()
+	locales := make([]string, 0, len(st.Catalog.messages))
+	for locale := range st.Catalog.messages {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// encodeCookie encodes value of session cookie by keys of state
+func (st *ServerState) encodeCookie(name, value string) (string, error) {
+	if st.secureCookie == nil {
+		return "", fmt.Errorf("keys of session cookie are not set")
+	}
+	return st.secureCookie.Encode(name, value)
+}
+
+func (st *ServerState) isSupportedLocale(locale string) bool {
+	for _, supported := range st.Locales() {
+		if supported == locale {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,73 @@
+package mclihttp
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestServerStateReload(t *testing.T) {
+	saved := CurrentServerState()
+	defer PublishServerState(saved)
+
+	newRouter := func(port, locale string) *Router {
+		var config Http
+		config.Server.Port = port
+		config.Server.I18n.Locales = []string{locale}
+		st := NewServerState(config)
+		st.Catalog = NewMessageCatalog(locale)
+		r := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), &RouterOptions{State: st})
+		r.Use(NewLocale(false))
+		r.AddRouteWithHandler("/state", Equal, func(res http.ResponseWriter, req *http.Request) {
+			fmt.Fprintf(res, "%s %s %s", stateOf(req).Config.Server.Port, LocaleFromRequest(req), stateOf(req).cookieName)
+		})
+		r.ConstructFinalHandler()
+		return r
+	}
+	get := func(r *Router) string {
+		res := httptest.NewRecorder()
+		r.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/state", nil))
+		return res.Body.String()
+	}
+
+	previous := newRouter("8080", "en")
+	PublishServerState(previous.State())
+
+	// previous router drains requests while new router is built and its state is published
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if got := get(previous); got != "8080 en session-token" {
+					t.Errorf("request of previous router sees other state: %s", got)
+					return
+				}
+			}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		next := newRouter("9090", "ru")
+		next.State().SetSecretCookieOptions(false, "sid", nil, nil)
+		PublishServerState(next.State())
+		if got := get(next); got != "9090 ru sid" {
+			t.Errorf("request of new router sees other state: %s", got)
+		}
+		if locales := Locales(); len(locales) != 1 || locales[0] != "ru" {
+			t.Errorf("published state is not current: %v", locales)
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
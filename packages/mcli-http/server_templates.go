@@ -1,7 +1,9 @@
 package mclihttp
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"html/template"
 	"io"
@@ -11,9 +13,12 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	mcli_utils "mcli/packages/mcli-utils"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
 )
 
 type TemplateEntry struct {
@@ -24,6 +29,23 @@ type TemplateEntry struct {
 	TmplDataPath        string `yaml:"tmpl-datapath"`
 	TmplRefreshType     string `yaml:"tmpl-refresh-type"`
 	TmplRefreshInterval string `yaml:"tmpl-refresh-interval"`
+	// additional data for templates available as .Sources.<Name>
+	TmplDataSources []TemplateDataSource `yaml:"tmpl-datasources"`
+	// roles of pages whose markdown contents set no roles in front matter, empty means public
+	DefaultRoles []string `yaml:"default-roles"`
+}
+
+// TemplateBindData is passed to every template executed by router
+type TemplateBindData struct {
+	Req      *http.Request
+	Data     interface{}
+	Contents map[string]template.HTML
+	Sources  map[string]interface{}
+	// front matter and table of contents of markdown contents by the same keys as Contents
+	Meta map[string]*MdMetaData
+	Toc  map[string]template.HTML
+	// CSP nonce of request for inline scripts: <script nonce="{{ .Nonce }}">
+	Nonce string
 }
 
 func exists(path string) (bool, error) {
@@ -41,51 +63,150 @@ func exists(path string) (bool, error) {
 type MyTemplate struct {
 	template     *template.Template
 	templatePath string
-	timestamp    time.Time
+	// layout and partial folders the page was parsed with - used to find dependents of changed layouts
+	layoutPath  string
+	partialPath string
+	timestamp   time.Time
 }
 type MyTemplateCache struct {
 	sync.RWMutex
 	cache    map[string]*MyTemplate
 	tmplName string
 	tmplPath string
+	// true when filesystem watcher keeps cache in actual state
+	isWatched atomic.Bool
+	// missing keys in template data are errors
+	strict bool
 }
 
-func processTemplDir(dir, base, part string, cache *map[string]*MyTemplate) error {
-	// fmt.Println(dir, base, part)
+// templateSet is template entry with its cache and url prefix served by router
+type templateSet struct {
+	entry     TemplateEntry
+	cache     *MyTemplateCache
+	urlPrefix string
+}
 
-	pages, err := filepath.Glob(filepath.Join(dir, "*.page.html"))
+// setStrictOption makes templates of cache fail on missing keys in data maps
+func setStrictOption(cache map[string]*MyTemplate) {
+	for _, tmpl := range cache {
+		tmpl.template.Option("missingkey=error")
+	}
+}
+
+func (c *MyTemplateCache) get(key string) (*MyTemplate, bool) {
+	c.RLock()
+	defer c.RUnlock()
+	tmpl, ok := c.cache[key]
+	return tmpl, ok
+}
+
+func (c *MyTemplateCache) reload() error {
+	cache, err := LoadMyTemplatesCache(c.tmplPath)
 	if err != nil {
+		// keep last good cache
 		return err
 	}
+	if c.strict {
+		setStrictOption(cache)
+	}
+	c.Lock()
+	c.cache = cache
+	c.Unlock()
+	return nil
+}
 
-	for _, page := range pages {
-		basename := filepath.Base(page)
-		filename := strings.TrimSuffix(basename, filepath.Ext(basename))
+// parseTemplatePage parses page with all layouts from base folder and all partials from part folder
+func parseTemplatePage(page, base, part string) (*MyTemplate, error) {
+	pageFileStats, err := os.Stat(page)
+	if err != nil {
+		return nil, err
+	}
 
-		pageFileStats, err := os.Stat(page)
-		if err != nil {
-			return err
-		}
+	ts, err := template.New(filepath.Base(page)).Funcs(TemplateFuncs()).ParseFiles(page)
+	if err != nil {
+		return nil, err
+	}
 
-		ts, err := template.ParseFiles(page)
-		if err != nil {
-			return err
-		}
+	// we use method ParseGlob to add all skeleton templates *.layout.html
+	ts, err = ts.ParseGlob(filepath.Join(base, "*.layout.html"))
+	if err != nil {
+		return nil, err
+	}
 
-		// we use method ParseGlob to add all skeleton templates *.layout.html
-		ts, err = ts.ParseGlob(filepath.Join(base, "*.layout.html"))
-		if err != nil {
-			return err
-		}
+	// we use method ParseGlob to add all addon templates
+	// *.partial.html
+	ts, err = ts.ParseGlob(filepath.Join(part, "*.partial.html"))
+	if err != nil {
+		return nil, err
+	}
+	return &MyTemplate{template: ts, templatePath: page, layoutPath: base, partialPath: part,
+		timestamp: pageFileStats.ModTime()}, nil
+}
 
-		// we use method ParseGlob to add all addon templates
-		// *.partial.html
-		ts, err = ts.ParseGlob(filepath.Join(part, "*.partial.html"))
+// templateCacheKey returns key in cache for page path: dir/name.page.html -> dir/name.page
+func templateCacheKey(page string) string {
+	basename := filepath.Base(page)
+	filename := strings.TrimSuffix(basename, filepath.Ext(basename))
+	return filepath.Join(filepath.Dir(page), filename)
+}
+
+// resolveTemplateDirs returns layout and partial folders for pages in dir:
+// own __base and __partial subfolders or the root ones
+func resolveTemplateDirs(rootTmpl, dir string) (string, string) {
+	var layoutPath string = ""
+	var partialPath string = ""
+
+	if e, _ := exists(filepath.Join(rootTmpl, "__base")); e {
+		layoutPath = filepath.Join(rootTmpl, "__base")
+	}
+	if e, _ := exists(filepath.Join(rootTmpl, "__partial")); e {
+		partialPath = filepath.Join(rootTmpl, "__partial")
+	}
+	if e, _ := exists(filepath.Join(dir, "__base")); e {
+		layoutPath = filepath.Join(dir, "__base")
+	}
+	if e, _ := exists(filepath.Join(dir, "__partial")); e {
+		partialPath = filepath.Join(dir, "__partial")
+	}
+	return layoutPath, partialPath
+}
+
+// isTemplatePage reports whether file is a page or its locale variant: name.page.html, name.page.ru.html
+func isTemplatePage(name string) bool {
+	if strings.HasSuffix(name, ".page.html") {
+		return true
+	}
+	withoutExt, found := strings.CutSuffix(name, ".html")
+	return found && strings.HasSuffix(strings.TrimSuffix(withoutExt, filepath.Ext(withoutExt)), ".page")
+}
+
+// globTemplatePages returns pages of dir including locale variants
+func globTemplatePages(dir string) ([]string, error) {
+	pages, err := filepath.Glob(filepath.Join(dir, "*.page.html"))
+	if err != nil {
+		return nil, err
+	}
+	localePages, err := filepath.Glob(filepath.Join(dir, "*.page.*.html"))
+	if err != nil {
+		return nil, err
+	}
+	return append(pages, localePages...), nil
+}
+
+func processTemplDir(dir, base, part string, cache *map[string]*MyTemplate) error {
+	// fmt.Println(dir, base, part)
+
+	pages, err := globTemplatePages(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, page := range pages {
+		myTmpl, err := parseTemplatePage(page, base, part)
 		if err != nil {
 			return err
 		}
-
-		(*cache)[filepath.Join(dir, filename)] = &MyTemplate{template: ts, templatePath: page, timestamp: pageFileStats.ModTime()}
+		(*cache)[templateCacheKey(page)] = myTmpl
 	}
 	return nil
 }
@@ -114,15 +235,7 @@ func LoadMyTemplatesCache(rootTmpl string) (map[string]*MyTemplate, error) {
 		// If current path is Dir - process it
 		if info.IsDir() && !(strings.Contains(wPath, "__base") || strings.Contains(wPath, "__partial")) {
 
-			layoutPath := mainLayoutPath
-			partialPath := mainPartialPath
-
-			if e, _ := exists(filepath.Join(wPath, "__base")); e {
-				layoutPath = filepath.Join(wPath, "__base")
-			}
-			if e, _ := exists(filepath.Join(wPath, "__partial")); e {
-				partialPath = filepath.Join(wPath, "__partial")
-			}
+			layoutPath, partialPath := resolveTemplateDirs(rootTmpl, wPath)
 
 			err := processTemplDir(wPath, layoutPath, partialPath, &cache)
 			if err != nil {
@@ -142,15 +255,18 @@ func LoadMyTemplatesCache(rootTmpl string) (map[string]*MyTemplate, error) {
 
 // Method to set multiply templates routes
 
-func (r *Router) SetTemplatesRoutes(ctx context.Context, templates []TemplateEntry) {
+func (r *Router) SetTemplatesRoutes(ctx context.Context, templates []TemplateEntry) error {
+	var errs []error
 	for _, t := range templates {
 		err := r.setTmplRoutes(ctx, t)
 		if err != nil {
 			r.infoLog.Error().Msgf("error load templates: %v", err)
+			errs = append(errs, fmt.Errorf("%s: %w", t.TmplName, err))
 		} else {
 			r.infoLog.Trace().Msgf("setting up template cache: %v is successfull", t.TmplName)
 		}
 	}
+	return errors.Join(errs...)
 }
 
 func (r *Router) refreshTemplateCache(ctx context.Context, d time.Duration, myTmplCache *MyTemplateCache) {
@@ -168,17 +284,13 @@ func (r *Router) refreshTemplateCache(ctx context.Context, d time.Duration, myTm
 			return
 		case <-ticker.C:
 			// r.infoLog.Trace().Msg("Refresh Task running ... ")
-			myTmplCache.Lock()
-			cache, err := LoadMyTemplatesCache(myTmplCache.tmplPath)
+			err := myTmplCache.reload()
 			if err != nil {
+				// last good cache stays in use
 				r.errorLog.Error().Msgf("refreshing of template caching %v got error: %v", myTmplCache.tmplName, err)
-				ticker.Stop()
-				return
 			} else {
-				myTmplCache.cache = cache
 				r.infoLog.Trace().Msgf("refreshing of template cache: %v is successfull", myTmplCache.tmplName)
 			}
-			myTmplCache.Unlock()
 		}
 	}
 }
@@ -216,7 +328,10 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 			r.errorLog.Error().Msgf("template caching error: %v", err)
 			return err
 		}
-		myTemplateCache := &MyTemplateCache{cache: cache, tmplName: t.TmplName, tmplPath: tmplPath}
+		myTemplateCache := &MyTemplateCache{cache: cache, tmplName: t.TmplName, tmplPath: tmplPath, strict: r.strictTmplData}
+		if r.strictTmplData {
+			setStrictOption(cache)
+		}
 		if t.TmplRefreshType == "on-interval" {
 			interval, err := strconv.Atoi(t.TmplRefreshInterval)
 			if err != nil || interval == 0 {
@@ -227,6 +342,14 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 			duration := time.Duration(int64(interval) * int64(time.Second))
 			go r.refreshTemplateCache(ctx, duration, myTemplateCache)
 		}
+		if t.TmplRefreshType == "on-change" {
+			err := r.watchTemplateCache(ctx, myTemplateCache)
+			if err != nil {
+				r.errorLog.Info().Msgf("template watcher for %v is not available, checking files on request: %v", t.TmplName, err)
+			} else {
+				myTemplateCache.isWatched.Store(true)
+			}
+		}
 
 		r.infoLog.Trace().Msg("Templates path:" + tmplPath + " Templates prefix:" + tmplPrefix)
 		tmplPrefix = "/" + tmplPrefix + "/"
@@ -234,19 +357,29 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 		// constucting new route
 		// fmt.Println(tmplPrefix, Prefix)
 
+		r.tmplSets = append(r.tmplSets, &templateSet{entry: t, cache: myTemplateCache, urlPrefix: r.getResultPattern(tmplPrefix)})
+
 		tmplRoute := NewRoute(tmplPrefix, Prefix)
 		tmplRoute.SetHandler(func(res http.ResponseWriter, req *http.Request) {
 			url := req.URL.Path
 			tmplName := strings.TrimPrefix(url, r.getResultPattern(tmplPrefix))
 			// fmt.Println(url, tmplPrefix, tmplName)
 			tmplKey := tmplPath + "/" + tmplName
-			tmpl, ok := myTemplateCache.cache[tmplKey]
-			if !ok && !(t.TmplRefreshType == "on-change") {
-				http.Error(res, "404 Template Not Found: "+tmplKey, 404)
+			locale := LocaleFromRequest(req)
+			// locale variant of page goes first: home/home.page.ru
+			tmpl, ok := myTemplateCache.get(tmplKey + "." + locale)
+			if ok {
+				tmplKey = tmplKey + "." + locale
+			} else {
+				tmpl, ok = myTemplateCache.get(tmplKey)
+			}
+			isPolling := t.TmplRefreshType == "on-change" && !myTemplateCache.isWatched.Load()
+			if !ok && !isPolling {
+				HttpErrorLocalized(res, req, http.StatusNotFound, "template "+tmplKey)
 				return
 			}
 
-			if t.TmplRefreshType == "on-change" && ok {
+			if isPolling && ok {
 				tmplFileStats, err := os.Stat(tmpl.templatePath)
 				if err != nil {
 					http.Error(res, err.Error(), http.StatusInternalServerError)
@@ -254,25 +387,25 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 				}
 
 				if modtime := tmplFileStats.ModTime(); modtime.UnixNano() > tmpl.timestamp.UnixNano() {
-					myTemplateCache.cache, err = LoadMyTemplatesCache(tmplPath)
+					err = myTemplateCache.reload()
 					if err != nil {
 						http.Error(res, fmt.Sprintf("template caching error: %v", err), http.StatusInternalServerError)
 					}
 				}
-				tmpl, ok = myTemplateCache.cache[tmplKey]
+				tmpl, ok = myTemplateCache.get(tmplKey)
 				if !ok {
-					http.Error(res, "404 Template Not Found: "+tmplKey, 404)
+					HttpErrorLocalized(res, req, http.StatusNotFound, "template "+tmplKey)
 					return
 				}
 			}
-			if t.TmplRefreshType == "on-change" && !ok {
-				myTemplateCache.cache, err = LoadMyTemplatesCache(tmplPath)
+			if isPolling && !ok {
+				err := myTemplateCache.reload()
 				if err != nil {
 					http.Error(res, fmt.Sprintf("template caching error: %v", err), http.StatusInternalServerError)
 				}
-				tmpl, ok = myTemplateCache.cache[tmplKey]
+				tmpl, ok = myTemplateCache.get(tmplKey)
 				if !ok {
-					http.Error(res, "404 Template Not Found: "+tmplKey, 404)
+					HttpErrorLocalized(res, req, http.StatusNotFound, "template "+tmplKey)
 					return
 				}
 			}
@@ -338,72 +471,36 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 				// noExt := path.Join(dir, name)
 				// tmplName - e.g. "home/home.page"
 				// lets try first candidate tmplDataPath + "/bson/"+noExt+".bson"
-				candidatePath := tmplDataPath + "/bson/" + tmplName + ".bson"
-				isExist, _ := exists(candidatePath)
-				if isExist {
-					pathToData = candidatePath
-				}
-				if !isExist {
-					candidatePath = tmplDataPath + "/" + tmplName + ".bson"
-					isExist, _ = exists(candidatePath)
-					if isExist {
-						pathToData = candidatePath
-					}
-				}
-				if !isExist {
-					candidatePath = tmplDataPath + "/" + tmplName + ".json"
-					isExist, _ = exists(candidatePath)
-					if isExist {
-						pathToData = candidatePath
-					}
-				}
-				if !isExist {
-					candidatePath = tmplDataPath + "/" + tmplName + ".yaml"
-					isExist, _ = exists(candidatePath)
-					if isExist {
-						pathToData = candidatePath
+				// every candidate is tried with locale suffix first: home/home.page.ru.yaml
+				for _, candidatePath := range []string{
+					tmplDataPath + "/bson/" + tmplName + ".bson",
+					tmplDataPath + "/" + tmplName + ".bson",
+					tmplDataPath + "/" + tmplName + ".json",
+					tmplDataPath + "/" + tmplName + ".yaml",
+				} {
+					if found := findLocalized(candidatePath, locale); len(found) > 0 {
+						pathToData = found
+						break
 					}
 				}
 			}
-			var bytesDataForTemplate []byte
 			var templateData interface{}
-			var bindData interface{}
-
-			bindData = struct {
-				Req  *http.Request
-				Data interface{}
-			}{
-				Req:  req,
-				Data: struct{}{},
+			var csrf *csrfPage
+			if !isSiteBuildRequest(req) {
+				// csrf tokens of page are bound to session or to csrf cookie of client
+				req, csrf = withCsrfPage(req)
 			}
-			if t.TmplType == "markdowm" {
-				bindData = struct {
-					Req      *http.Request
-					Data     interface{}
-					Contents map[string]template.HTML
-				}{
-					Req:      req,
-					Data:     struct{}{},
-					Contents: make(map[string]template.HTML),
-				}
+			bindData := &TemplateBindData{
+				Req:      req,
+				Data:     struct{}{},
+				Contents: make(map[string]template.HTML),
+				Meta:     make(map[string]*MdMetaData),
+				Toc:      make(map[string]template.HTML),
+				Nonce:    CSPNonce(req),
 			}
 
 			if len(pathToData) > 0 {
-				bytesDataForTemplate, err = os.ReadFile(pathToData)
-				if err != nil {
-					templateData, err = mcli_utils.JsonStringToInterface("{}")
-				} else {
-					// fmt.Println(filepath.Ext(pathToData))
-					if filepath.Ext(pathToData) == ".bson" {
-						templateData, err = mcli_utils.BsonDataToInterfaceMap(bytesDataForTemplate)
-					}
-					if filepath.Ext(pathToData) == ".json" {
-						templateData, err = mcli_utils.JsonStringToInterface(string(bytesDataForTemplate))
-					}
-					if filepath.Ext(pathToData) == ".yaml" {
-						templateData, err = mcli_utils.YamlStringToInterface(bytesDataForTemplate)
-					}
-				}
+				templateData, err = loadTemplateDataFile(pathToData)
 				if err != nil {
 					http.Error(res, "error converting data file to interface: "+err.Error(), http.StatusInternalServerError)
 					return
@@ -420,26 +517,10 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 					http.Error(res, "error find TemplateData member in data map", http.StatusInternalServerError)
 					return
 				}
-
-				bindData = struct {
-					Req  *http.Request
-					Data interface{}
-				}{
-					Req:  req,
-					Data: templateData,
-				}
+				bindData.Data = templateData
 
 				// if template type is markdown
 				if t.TmplType == "markdowm" {
-					bindData = struct {
-						Req      *http.Request
-						Data     interface{}
-						Contents map[string]template.HTML
-					}{
-						Req:      req,
-						Data:     templateData,
-						Contents: make(map[string]template.HTML),
-					}
 					if mdValue, ok := typedTemplateData["MarkdownContents"]; ok {
 						markdownSources, ok := mdValue.(map[string]interface{})
 						if !ok {
@@ -464,38 +545,85 @@ func (r *Router) setTmplRoutes(ctx context.Context, t TemplateEntry) error {
 								strings.HasPrefix(pathToMd, "/") {
 								resultPathToMd = pathToMd
 							}
+							// home.page.main.md -> home.page.main.ru.md if exists
+							if !strings.HasPrefix(resultPathToMd, "http://") && !strings.HasPrefix(resultPathToMd, "https://") {
+								if found := findLocalized(resultPathToMd, locale); len(found) > 0 {
+									resultPathToMd = found
+								}
+							}
 							// fmt.Println(resultPathToMd)
-							htmlContent, err := ConvertMdToHtml(resultPathToMd)
+							mdPage, err := convertMdToPage(resultPathToMd, stateOf(req).RemoteContent)
 							if err != nil {
 								http.Error(res, "error converting md with source "+resultPathToMd+"to html", http.StatusInternalServerError)
 								return
 							}
-							mdMap[key] = template.HTML(string(htmlContent))
-						}
-						bindData = struct {
-							Req      *http.Request
-							Data     interface{}
-							Contents map[string]template.HTML
-						}{
-							Req:      req,
-							Data:     templateData,
-							Contents: mdMap,
+							mdMap[key] = template.HTML(string(mdPage.Html))
+							bindData.Toc[key] = mdPage.TocHtml
+							bindData.Meta[key] = &mdPage.Meta
 						}
+						bindData.Contents = mdMap
 					} else {
 						http.Error(res, "error find MarkdownContents member in template map", http.StatusInternalServerError)
 						return
 					}
 				}
 			}
+
+			// drafts and pages restricted by roles of markdown front matter
+			pageMeta := mergeMdMetaData(bindData.Meta, t.DefaultRoles)
+			// internal render for search index gets page metadata and is not restricted by roles
+			pageInfo, isInternal := req.Context().Value(go_common_ddru.ContextKey("PageInfo")).(*PageInfo)
+			if isInternal {
+				pageInfo.Title, pageInfo.Description, pageInfo.Roles = pageMeta.Title, pageMeta.Description, pageMeta.Roles
+			}
+			if ((pageMeta.Draft || len(pageMeta.Roles) > 0) && isSiteBuildRequest(req)) || (pageMeta.Draft && isInternal) {
+				// such pages are not published by static site build and not indexed
+				res.WriteHeader(http.StatusNoContent)
+				return
+			}
+			if pageMeta.Draft {
+				HttpErrorLocalized(res, req, http.StatusNotFound, "")
+				return
+			}
+			if len(pageMeta.Roles) > 0 && !IsAuthRequest(req) && !isInternal {
+				HttpErrorLocalized(res, req, http.StatusUnauthorized, "")
+				return
+			}
+			if !pageMeta.allowedFor(req) && !isInternal {
+				HttpErrorLocalized(res, req, http.StatusForbidden, "")
+				return
+			}
+
+			// declarative data sources of template entry
+			bindData.Sources, err = r.getTemplateSources(t, tmplDataPath, tmplName)
+			if err != nil {
+				http.Error(res, "error getting template data sources: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
 			// fmt.Println("request processing " + req.URL.String())
 
-			err = tmpl.template.Execute(res, bindData)
+			var page bytes.Buffer
+			if len(pageMeta.Layout) > 0 {
+				// layout from front matter is a template defined in layouts: {{define "docs"}}
+				if tmpl.template.Lookup(pageMeta.Layout) == nil {
+					http.Error(res, "layout not found: "+pageMeta.Layout, http.StatusInternalServerError)
+					return
+				}
+				err = tmpl.template.ExecuteTemplate(&page, pageMeta.Layout, bindData)
+			} else {
+				err = tmpl.template.Execute(&page, bindData)
+			}
 
 			if err != nil {
 				r.infoLog.Trace().Msgf("url : %v", err)
 				http.Error(res, err.Error(), http.StatusInternalServerError)
 				return
 			}
+			// page is rendered before it is written as headers depend on use of csrf token
+			if csrf != nil {
+				csrf.finish(res)
+			}
+			res.Write(page.Bytes())
 			r.infoLog.Trace().Msg(url + " : " + queryStrData)
 		})
 		return r.AddRoute(tmplRoute)
@@ -515,7 +643,7 @@ func processDirectory(dir, base, part string, cache *map[string]*template.Templa
 		basename := filepath.Base(page)
 		filename := strings.TrimSuffix(basename, filepath.Ext(basename))
 
-		ts, err := template.ParseFiles(page)
+		ts, err := template.New(basename).Funcs(TemplateFuncs()).ParseFiles(page)
 		if err != nil {
 			return err
 		}
@@ -0,0 +1,170 @@
+package mclihttp
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	mcli_utils "mcli/packages/mcli-utils"
+)
+
+// TemplateDataSource describes data bound to templates as .Sources.<Name>
+//
+//	tmpl-datasources:
+//	  - name: Users
+//	    type: kv               # file, kv or http
+//	    source: "*"            # path to file (may be glob), kv key (may be pattern) or url of json
+//	    key-prefix: userlist
+//	    pages: [home/home.page] # empty - for all templates of entry
+//	    ttl: 30                 # seconds to keep data in cache
+type TemplateDataSource struct {
+	Name      string   `yaml:"name"`
+	Type      string   `yaml:"type"`
+	Source    string   `yaml:"source"`
+	KeyPrefix string   `yaml:"key-prefix"`
+	Pages     []string `yaml:"pages"`
+	Ttl       int      `yaml:"ttl"`
+}
+
+type cachedDataSource struct {
+	value   interface{}
+	expires time.Time
+}
+
+func (ds TemplateDataSource) isForPage(tmplName string) bool {
+	if len(ds.Pages) == 0 {
+		return true
+	}
+	for _, page := range ds.Pages {
+		if strings.Trim(page, "/") == strings.Trim(tmplName, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// loadTemplateDataFile reads bson, json or yaml file into interface
+func loadTemplateDataFile(pathToData string) (interface{}, error) {
+	bytesData, err := os.ReadFile(pathToData)
+	if err != nil {
+		return nil, err
+	}
+	switch filepath.Ext(pathToData) {
+	case ".bson":
+		return mcli_utils.BsonDataToInterfaceMap(bytesData)
+	case ".json":
+		return mcli_utils.JsonStringToInterface(string(bytesData))
+	case ".yaml", ".yml":
+		return mcli_utils.YamlStringToInterface(bytesData)
+	}
+	return nil, fmt.Errorf("unsupported data file format: %s", pathToData)
+}
+
+// getTemplateSources returns data of all sources declared for template, cached ones are taken from router DataCache
+func (r *Router) getTemplateSources(t TemplateEntry, tmplDataPath, tmplName string) (map[string]interface{}, error) {
+	sources := make(map[string]interface{}, len(t.TmplDataSources))
+	for _, ds := range t.TmplDataSources {
+		if !ds.isForPage(tmplName) {
+			continue
+		}
+		cacheKey := "tmpl-source:" + t.TmplName + ":" + ds.Name
+		if ds.Ttl > 0 && r.DataCache != nil {
+			if cached, err := r.DataCache.Get(cacheKey); err == nil {
+				if entry, ok := cached.(cachedDataSource); ok && time.Now().Before(entry.expires) {
+					sources[ds.Name] = entry.value
+					continue
+				}
+			}
+		}
+
+		value, err := r.loadTemplateSource(ds, tmplDataPath)
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", ds.Name, err)
+		}
+		if ds.Ttl > 0 && r.DataCache != nil {
+			ttl := time.Duration(ds.Ttl) * time.Second
+			_, err = r.DataCache.Set(cacheKey, nil, ttl, cachedDataSource{value: value, expires: time.Now().Add(ttl)})
+			if err != nil {
+				r.errorLog.Err(err).Msgf("set data source cache for %s has fault:", cacheKey)
+			}
+		}
+		sources[ds.Name] = value
+	}
+	return sources, nil
+}
+
+func (r *Router) loadTemplateSource(ds TemplateDataSource, tmplDataPath string) (interface{}, error) {
+	switch ds.Type {
+	case "file", "":
+		pathToData := ds.Source
+		if !filepath.IsAbs(pathToData) {
+			pathToData = filepath.Join(tmplDataPath, pathToData)
+		}
+		if !strings.Contains(pathToData, "*") {
+			return loadTemplateDataFile(pathToData)
+		}
+		// several files by glob - map of file name without extension to data
+		files, err := filepath.Glob(pathToData)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]interface{}, len(files))
+		for _, file := range files {
+			data, err := loadTemplateDataFile(file)
+			if err != nil {
+				return nil, err
+			}
+			result[strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))] = data
+		}
+		return result, nil
+	case "kv":
+		if r.KVStore == nil {
+			return nil, fmt.Errorf("kv store is not configured")
+		}
+		keyPrefixes := make([]string, 0, 1)
+		if len(ds.KeyPrefix) > 0 {
+			keyPrefixes = append(keyPrefixes, ds.KeyPrefix)
+		}
+		if strings.Contains(ds.Source, "*") {
+			records, err := r.KVStore.GetRecords(ds.Source, keyPrefixes...)
+			if err != nil {
+				return nil, err
+			}
+			result := make(map[string]interface{}, len(records))
+			for key, raw := range records {
+				var value interface{}
+				if err := r.KVStore.GetUnMarshal()(raw, &value); err != nil {
+					value = string(raw)
+				}
+				result[key] = value
+			}
+			return result, nil
+		}
+		raw, err, ok := r.KVStore.GetRecord(ds.Source, keyPrefixes...)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("key %s not found", ds.Source)
+		}
+		var value interface{}
+		if err := r.KVStore.GetUnMarshal()(raw, &value); err != nil {
+			return string(raw), nil
+		}
+		return value, nil
+	case "http":
+		raw, err := r.State().RemoteContent.Fetch(ds.Source)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+	return nil, fmt.Errorf("unknown data source type %s", ds.Type)
+}
@@ -0,0 +1,307 @@
+package mclihttp
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+)
+
+// key to sign csrf tokens, it lives as long as process lives
+var csrfKey []byte = func() []byte {
+	k := make([]byte, 32)
+	if _, err := rand.Read(k); err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+// TemplateFuncs returns functions library available in all templates served by router.
+// Functions which depend on request take it as first argument: {{ hasRole .Req "admin" }}
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		// formatting
+		"upper":    strings.ToUpper,
+		"lower":    strings.ToLower,
+		"trim":     strings.TrimSpace,
+		"replace":  strings.ReplaceAll,
+		"contains": strings.Contains,
+		"split":    strings.Split,
+		"join":     tmplJoin,
+		"truncate": tmplTruncate,
+		"default":  tmplDefault,
+		"toJson":   tmplToJson,
+		"safeHtml": func(s string) template.HTML { return template.HTML(s) },
+		// dates
+		"now":        time.Now,
+		"formatDate": tmplFormatDate,
+		// markdown
+		"markdown": tmplMarkdown,
+		// urls
+		"url": func(path string) string { return CurrentServerState().Config.GetFullUrl(path) },
+		// current user
+		"isAuth":      IsAuthRequest,
+		"currentUser": CurrentUser,
+		"userRoles":   tmplUserRoles,
+		"hasRole":     tmplHasRole,
+		// csrf
+		"csrfToken": CsrfToken,
+		"csrfField": tmplCsrfField,
+		// csp
+		"cspNonce": CSPNonce,
+		// full-text search over pages: {{ range search .Req (.Req.FormValue "q") }}
+		"search": tmplSearch,
+		// i18n
+		"t":       tmplTranslate,
+		"locale":  LocaleFromRequest,
+		"locales": Locales,
+	}
+}
+
+func tmplSearch(req *http.Request, query string) []SearchResult {
+	index := stateOf(req).searchIndex
+	if index == nil {
+		return []SearchResult{}
+	}
+	return index.Search(req, query, 20)
+}
+
+// tmplTranslate returns message of catalog for request locale: {{ t .Req "signin.title" }}
+func tmplTranslate(req *http.Request, key string, args ...interface{}) string {
+	return stateOf(req).Catalog.Translate(LocaleFromRequest(req), key, args...)
+}
+
+func tmplJoin(sep string, items interface{}) string {
+	switch v := items.(type) {
+	case []string:
+		return strings.Join(v, sep)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, sep)
+	}
+	return fmt.Sprint(items)
+}
+
+func tmplTruncate(length int, s string) string {
+	runes := []rune(s)
+	if length <= 0 || len(runes) <= length {
+		return s
+	}
+	return string(runes[:length]) + "..."
+}
+
+func tmplDefault(defaultValue interface{}, value interface{}) interface{} {
+	if value == nil {
+		return defaultValue
+	}
+	if s, ok := value.(string); ok && len(s) == 0 {
+		return defaultValue
+	}
+	return value
+}
+
+func tmplToJson(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// tmplFormatDate formats time.Time, unix seconds or RFC3339 string with go layout
+func tmplFormatDate(layout string, value interface{}) (string, error) {
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case int:
+		t = time.Unix(int64(v), 0)
+	case int64:
+		t = time.Unix(v, 0)
+	case float64:
+		t = time.Unix(int64(v), 0)
+	case string:
+		if unixTime, err := strconv.ParseInt(v, 10, 64); err == nil {
+			t = time.Unix(unixTime, 0)
+		} else {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return "", err
+			}
+			t = parsed
+		}
+	default:
+		return "", fmt.Errorf("formatDate: unsupported value type %T", value)
+	}
+	return t.Format(layout), nil
+}
+
+// tmplMarkdown converts markdown file or http source to html
+func tmplMarkdown(source string) (template.HTML, error) {
+	htmlContent, err := ConvertMdToHtml(source)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(string(htmlContent)), nil
+}
+
+func IsAuthRequest(req *http.Request) bool {
+	if req == nil {
+		return false
+	}
+	isAuth, ok := req.Context().Value(go_common_ddru.ContextKey("IsAuth")).(bool)
+	return ok && isAuth
+}
+
+// CurrentUser returns authenticated user from request context or nil
+func CurrentUser(req *http.Request) *Credential {
+	if req == nil {
+		return nil
+	}
+	user, ok := req.Context().Value(go_common_ddru.ContextKey("AuthUser")).(*Credential)
+	if !ok {
+		return nil
+	}
+	return user
+}
+
+func tmplUserRoles(req *http.Request) []string {
+	user := CurrentUser(req)
+	if user == nil {
+		return []string{}
+	}
+	return user.Roles
+}
+
+func tmplHasRole(req *http.Request, role string) bool {
+	for _, userRole := range tmplUserRoles(req) {
+		if userRole == role {
+			return true
+		}
+	}
+	return false
+}
+
+// csrfCookieName is cookie of random client id which binds csrf tokens of clients without session
+const csrfCookieName = "csrf-id"
+
+// csrfBinding returns value which csrf token of request is bound to: session cookie or csrf cookie
+func csrfBinding(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if cookie, err := req.Cookie(stateOf(req).cookieName); err == nil && len(cookie.Value) > 0 {
+		return "session:" + cookie.Value
+	}
+	if cookie, err := req.Cookie(csrfCookieName); err == nil && len(cookie.Value) > 0 {
+		return "client:" + cookie.Value
+	}
+	return ""
+}
+
+// CsrfToken returns token bound to session cookie of request or to csrf cookie of client without session,
+// token is empty when request has none of them
+func CsrfToken(req *http.Request) string {
+	if page, ok := req.Context().Value(go_common_ddru.ContextKey("CsrfPage")).(*csrfPage); ok {
+		page.used = true
+	}
+	binding := csrfBinding(req)
+	if len(binding) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, csrfKey)
+	mac.Write([]byte(binding))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckCsrfToken checks token from form field "csrf_token" or header "X-CSRF-Token"
+func CheckCsrfToken(req *http.Request) bool {
+	expected := CsrfToken(req)
+	if len(expected) == 0 {
+		return false
+	}
+	token := req.Header.Get("X-CSRF-Token")
+	if len(token) == 0 {
+		token = req.FormValue("csrf_token")
+	}
+	return hmac.Equal([]byte(token), []byte(expected))
+}
+
+// WithCsrfCookie sets random csrf cookie for client without session and csrf cookies,
+// returned request carries the cookie, so tokens of page rendered for it are checked by next request of client.
+// Response is marked private as it embeds token of the client.
+func WithCsrfCookie(res http.ResponseWriter, req *http.Request) *http.Request {
+	setPrivateNoStore(res.Header())
+	req, cookie := withCsrfId(req)
+	if cookie != nil {
+		http.SetCookie(res, cookie)
+	}
+	return req
+}
+
+// withCsrfId returns request with new csrf cookie and the cookie for client without session and csrf cookies
+func withCsrfId(req *http.Request) (*http.Request, *http.Cookie) {
+	if len(csrfBinding(req)) > 0 {
+		return req, nil
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return req, nil
+	}
+	cookie := &http.Cookie{Name: csrfCookieName, Value: hex.EncodeToString(id), Path: "/",
+		HttpOnly: true, Secure: req.TLS != nil, SameSite: http.SameSiteLaxMode}
+	req = req.Clone(req.Context())
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+	return req, cookie
+}
+
+// csrfPage tracks whether page rendered for request uses csrf token
+type csrfPage struct {
+	cookie *http.Cookie
+	used   bool
+}
+
+// withCsrfPage returns request which csrf tokens are bound to new csrf cookie when client has no cookies,
+// cookie is set and response is marked private by finish only if page uses token
+func withCsrfPage(req *http.Request) (*http.Request, *csrfPage) {
+	req, cookie := withCsrfId(req)
+	page := &csrfPage{cookie: cookie}
+	return req.WithContext(context.WithValue(req.Context(), go_common_ddru.ContextKey("CsrfPage"), page)), page
+}
+
+// finish sets csrf cookie and marks response private when token is used by page, it is called before body is written
+func (page *csrfPage) finish(res http.ResponseWriter) {
+	if !page.used {
+		return
+	}
+	setPrivateNoStore(res.Header())
+	if page.cookie != nil {
+		http.SetCookie(res, page.cookie)
+	}
+}
+
+// setPrivateNoStore keeps response which depends on cookies of client from shared caches
+func setPrivateNoStore(header http.Header) {
+	header.Set("Cache-Control", "private, no-store")
+	if !slices.Contains(varyNames(header), "Cookie") {
+		header.Add("Vary", "Cookie")
+	}
+}
+
+func tmplCsrfField(req *http.Request) template.HTML {
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="csrf_token" value="%s">`, CsrfToken(req)))
+}
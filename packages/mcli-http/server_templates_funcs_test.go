@@ -0,0 +1,164 @@
+package mclihttp
+
+import (
+	"context"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/rs/zerolog"
+)
+
+func TestCsrfToken(t *testing.T) {
+	anonymous := httptest.NewRequest(http.MethodPost, "/", nil)
+	if token := CsrfToken(anonymous); len(token) > 0 || CheckCsrfToken(anonymous) {
+		t.Fatalf("request without session and csrf cookies must have no token: %q", token)
+	}
+
+	res := httptest.NewRecorder()
+	page := WithCsrfCookie(res, httptest.NewRequest(http.MethodGet, "/", nil))
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName || !cookies[0].HttpOnly || len(cookies[0].Value) != 32 {
+		t.Fatalf("unexpected csrf cookie %v", cookies)
+	}
+	token := CsrfToken(page)
+	if len(token) == 0 || WithCsrfCookie(httptest.NewRecorder(), page) != page {
+		t.Fatal("page request must carry csrf cookie")
+	}
+
+	post := func(cookie *http.Cookie, token string) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(url.Values{"csrf_token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.AddCookie(cookie)
+		return req
+	}
+	if !CheckCsrfToken(post(cookies[0], token)) {
+		t.Error("token of page must be accepted with cookie of client")
+	}
+	if CheckCsrfToken(post(&http.Cookie{Name: csrfCookieName, Value: "other"}, token)) {
+		t.Error("token of page must be rejected with cookie of other client")
+	}
+	if CheckCsrfToken(post(&http.Cookie{Name: CurrentServerState().cookieName, Value: "session"}, token)) {
+		t.Error("token of client must be rejected for session")
+	}
+	session := post(&http.Cookie{Name: CurrentServerState().cookieName, Value: "session"}, "")
+	session.Header.Set("X-CSRF-Token", CsrfToken(session))
+	if !CheckCsrfToken(session) {
+		t.Error("token of session must be accepted from header")
+	}
+}
+
+func TestSignInCsrf(t *testing.T) {
+	tmpl := template.Must(template.New("signin").Funcs(TemplateFuncs()).Parse(`{{ csrfField .Req }}`))
+
+	res := httptest.NewRecorder()
+	signIn(res, httptest.NewRequest(http.MethodGet, "/signin", nil), tmpl, signInData{})
+	cookies := res.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != csrfCookieName ||
+		!strings.Contains(res.Body.String(), `name="csrf_token" value="`) {
+		t.Fatalf("signin page must set csrf cookie and render token: %v %s", cookies, res.Body)
+	}
+
+	send := func(contentType, body string, header http.Header) int {
+		req := httptest.NewRequest(http.MethodPost, "http://example.com/signin", strings.NewReader(body))
+		req.Header = header.Clone()
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookies[0])
+		ctx := context.WithValue(req.Context(), go_common_ddru.ContextKey("router"), &Router{})
+		res := httptest.NewRecorder()
+		signIn(res, req.WithContext(ctx), tmpl, signInData{})
+		return res.Code
+	}
+	form := url.Values{"username": {"admin"}, "password": {"secret"}}.Encode()
+	if code := send("application/x-www-form-urlencoded", form, http.Header{}); code != http.StatusForbidden {
+		t.Errorf("form without csrf token must be rejected, got %d", code)
+	}
+	if code := send("application/x-www-form-urlencoded", form+"&csrf_token=wrong", http.Header{}); code != http.StatusForbidden {
+		t.Errorf("form with wrong csrf token must be rejected, got %d", code)
+	}
+	crossSite := http.Header{"Origin": {"https://evil.example"}}
+	if code := send("application/json", `{"username":"admin"}`, crossSite); code != http.StatusForbidden {
+		t.Errorf("cross-origin json without csrf token must be rejected, got %d", code)
+	}
+	page := httptest.NewRequest(http.MethodGet, "/signin", nil)
+	page.AddCookie(cookies[0])
+	if code := send("application/x-www-form-urlencoded", "csrf_token="+CsrfToken(page), http.Header{}); code != http.StatusBadRequest {
+		t.Errorf("form with csrf token of page must pass to credentials check, got %d", code)
+	}
+}
+
+func TestCsrfPagesAreNotShared(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "__base", "base.layout.html"), `{{define "base"}}{{template "main" .}}{{end}}`)
+	writeTestFile(t, filepath.Join(root, "__partial", "nav.partial.html"), `{{define "nav"}}{{end}}`)
+	writeTestFile(t, filepath.Join(root, "home", "form.page.html"), `{{template "base" .}}{{define "main"}}{{ csrfField .Req }}{{end}}`)
+	writeTestFile(t, filepath.Join(root, "home", "plain.page.html"), `{{template "base" .}}{{define "main"}}plain{{end}}`)
+	router := NewRouter("", "", zerolog.Nop(), zerolog.Nop(), nil)
+	entry := TemplateEntry{TmplName: "site", TmplPath: root, TmplPrefix: "tmpl"}
+	if err := router.SetTemplatesRoutes(context.Background(), []TemplateEntry{entry}); err != nil {
+		t.Fatal(err)
+	}
+	signInTmpl := template.Must(template.New("signin").Funcs(TemplateFuncs()).Parse(`{{ csrfField .Req }}`))
+	rc, err := NewResponseCache(ResponseCacheConfig{Enabled: true, DefaultTtl: 60}, nil, zerolog.Nop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.SetInnerHandler(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/signin" {
+			signIn(res, req, signInTmpl, signInData{})
+			return
+		}
+		router.ServeHTTP(res, req)
+	}))
+
+	get := func(path string, cookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		res := httptest.NewRecorder()
+		rc.ServeHTTP(res, req)
+		return res
+	}
+	tokenOf := func(body string) string {
+		_, token, _ := strings.Cut(body, `value="`)
+		token, _, _ = strings.Cut(token, `"`)
+		return token
+	}
+	for _, path := range []string{"/signin", "/tmpl/home/form.page"} {
+		first := get(path, nil)
+		cookies := first.Result().Cookies()
+		if len(cookies) != 1 || first.Header().Get("Cache-Control") != "private, no-store" ||
+			!slices.Contains(varyNames(first.Header()), "Cookie") {
+			t.Fatalf("%s must set csrf cookie and be private: %v", path, first.Header())
+		}
+		if res := get(path, cookies[0]); res.Header().Get("X-Cache") != "BYPASS" {
+			t.Errorf("%s of client with csrf cookie must bypass cache: %v", path, res.Header())
+		}
+		other := get(path, nil)
+		if other.Header().Get("X-Cache") == "HIT" || len(other.Result().Cookies()) != 1 {
+			t.Fatalf("%s of other client must not be served from cache: %v", path, other.Header())
+		}
+		form := url.Values{"csrf_token": {tokenOf(other.Body.String())}}.Encode()
+		post := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form))
+		post.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		post.AddCookie(other.Result().Cookies()[0])
+		if !CheckCsrfToken(post) {
+			t.Errorf("%s token of other client must be valid with its cookie", path)
+		}
+	}
+
+	// page without csrf token sets no cookie and is shared
+	if res := get("/tmpl/home/plain.page", nil); len(res.Result().Cookies()) > 0 || res.Header().Get("X-Cache") != "MISS" {
+		t.Errorf("page without token must not set cookie: %v", res.Header())
+	}
+	if res := get("/tmpl/home/plain.page", nil); res.Header().Get("X-Cache") != "HIT" || res.Body.String() != "plain" {
+		t.Errorf("page without token must be cached: %v %q", res.Header(), res.Body.String())
+	}
+}
@@ -0,0 +1,149 @@
+package mclihttp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// editors write files in several steps, so we wait for burst of events to settle down
+const templateWatchDebounce = 300 * time.Millisecond
+
+// watchTemplateCache starts filesystem watcher on template tree and rebuilds changed entries of cache
+func (r *Router) watchTemplateCache(ctx context.Context, myTmplCache *MyTemplateCache) error {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	events := make(chan string, 64)
+	err := watchTemplateTree(ctx, myTmplCache.tmplPath, events)
+	if err != nil {
+		return err
+	}
+
+	go func() {
+		defer myTmplCache.isWatched.Store(false)
+
+		changed := make(map[string]struct{})
+		var debounce <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
+				r.infoLog.Trace().Msgf("template watcher for %v stopped", myTmplCache.tmplName)
+				return
+			case changedPath, ok := <-events:
+				if !ok {
+					r.errorLog.Error().Msgf("template watcher for %v stopped unexpectedly, checking files on request", myTmplCache.tmplName)
+					return
+				}
+				changed[changedPath] = struct{}{}
+				debounce = time.After(templateWatchDebounce)
+			case <-debounce:
+				paths := make([]string, 0, len(changed))
+				for changedPath := range changed {
+					paths = append(paths, changedPath)
+				}
+				changed = make(map[string]struct{})
+				debounce = nil
+
+				rebuilt, err := myTmplCache.applyChanges(paths)
+				if err != nil {
+					r.errorLog.Error().Msgf("refreshing of template cache %v got error: %v", myTmplCache.tmplName, err)
+				}
+				r.infoLog.Trace().Msgf("template cache %v: %d entries rebuilt", myTmplCache.tmplName, rebuilt)
+			}
+		}
+	}()
+	return nil
+}
+
+// applyChanges rebuilds cache entries affected by changed paths and returns number of rebuilt entries.
+// Change of layout or partial rebuilds all pages parsed with it, change of folders reloads whole cache.
+// If page parsing fails its previous version stays in cache.
+func (c *MyTemplateCache) applyChanges(paths []string) (int, error) {
+	pages := make(map[string]struct{})
+	layoutDirs := make(map[string]struct{})
+	fullReload := false
+
+	c.RLock()
+	for _, changedPath := range paths {
+		name := filepath.Base(changedPath)
+		dir := filepath.Dir(changedPath)
+		switch {
+		case strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~"):
+			// editors temporary files
+			continue
+		case name == "__base" || name == "__partial":
+			fullReload = true
+		case filepath.Base(dir) == "__base" || filepath.Base(dir) == "__partial":
+			layoutDirs[dir] = struct{}{}
+		case isTemplatePage(name):
+			pages[changedPath] = struct{}{}
+		default:
+			// folder was created, removed or renamed
+			info, err := os.Stat(changedPath)
+			if err == nil && info.IsDir() {
+				fullReload = true
+			}
+			if err != nil {
+				for _, tmpl := range c.cache {
+					if strings.HasPrefix(tmpl.templatePath, changedPath+string(filepath.Separator)) {
+						fullReload = true
+						break
+					}
+				}
+			}
+		}
+	}
+	// dependents of changed layouts and partials
+	for _, tmpl := range c.cache {
+		_, isLayoutChanged := layoutDirs[tmpl.layoutPath]
+		_, isPartialChanged := layoutDirs[tmpl.partialPath]
+		if isLayoutChanged || isPartialChanged {
+			pages[tmpl.templatePath] = struct{}{}
+		}
+	}
+	c.RUnlock()
+
+	if fullReload {
+		if err := c.reload(); err != nil {
+			return 0, err
+		}
+		c.RLock()
+		defer c.RUnlock()
+		return len(c.cache), nil
+	}
+
+	updated := make(map[string]*MyTemplate, len(pages))
+	removed := make([]string, 0)
+	errs := make([]string, 0)
+	for page := range pages {
+		if e, _ := exists(page); !e {
+			removed = append(removed, templateCacheKey(page))
+			continue
+		}
+		layoutPath, partialPath := resolveTemplateDirs(c.tmplPath, filepath.Dir(page))
+		myTmpl, err := parseTemplatePage(page, layoutPath, partialPath)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", page, err))
+			continue
+		}
+		updated[templateCacheKey(page)] = myTmpl
+	}
+
+	c.Lock()
+	for key, myTmpl := range updated {
+		c.cache[key] = myTmpl
+	}
+	for _, key := range removed {
+		delete(c.cache, key)
+	}
+	c.Unlock()
+
+	if len(errs) > 0 {
+		return len(updated), fmt.Errorf("previous versions are kept for: %s", strings.Join(errs, "; "))
+	}
+	return len(updated), nil
+}
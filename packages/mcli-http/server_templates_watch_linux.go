@@ -0,0 +1,105 @@
+//go:build linux
+
+package mclihttp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const inotifyWatchMask = unix.IN_CREATE | unix.IN_CLOSE_WRITE | unix.IN_MODIFY | unix.IN_DELETE |
+	unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+
+// watchTemplateTree sends paths of changed files and folders under root to events channel.
+// It uses inotify and closes events channel when watching stops.
+func watchTemplateTree(ctx context.Context, root string, events chan<- string) error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	// watch descriptor -> folder
+	watches := make(map[int]string)
+	addWatches := func(dir string) error {
+		return filepath.Walk(dir, func(wPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() {
+				return nil
+			}
+			wd, err := unix.InotifyAddWatch(fd, wPath, inotifyWatchMask)
+			if err != nil {
+				return err
+			}
+			watches[wd] = wPath
+			return nil
+		})
+	}
+	if err := addWatches(root); err != nil {
+		unix.Close(fd)
+		return err
+	}
+
+	go func() {
+		defer close(events)
+		defer unix.Close(fd)
+
+		buf := make([]byte, 64*(unix.SizeofInotifyEvent+unix.NAME_MAX+1))
+		pollFds := []unix.PollFd{{Fd: int32(fd), Events: unix.POLLIN}}
+		for {
+			if ctx.Err() != nil {
+				return
+			}
+			// poll with timeout to notice context cancellation
+			ready, err := unix.Poll(pollFds, 500)
+			if err != nil && err != unix.EINTR {
+				return
+			}
+			if ready <= 0 {
+				continue
+			}
+			n, err := unix.Read(fd, buf)
+			if err != nil {
+				if err == unix.EAGAIN || err == unix.EINTR {
+					continue
+				}
+				return
+			}
+
+			for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+				event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + unix.SizeofInotifyEvent
+				name := strings.TrimRight(string(buf[nameStart:nameStart+int(event.Len)]), "\x00")
+				offset = nameStart + int(event.Len)
+
+				if event.Mask&unix.IN_IGNORED != 0 {
+					// folder was removed and kernel dropped its watch
+					delete(watches, int(event.Wd))
+					continue
+				}
+				dir, ok := watches[int(event.Wd)]
+				if !ok {
+					continue
+				}
+				changedPath := dir
+				if len(name) > 0 {
+					changedPath = filepath.Join(dir, name)
+				}
+				if event.Mask&unix.IN_ISDIR != 0 && event.Mask&(unix.IN_CREATE|unix.IN_MOVED_TO) != 0 {
+					addWatches(changedPath)
+				}
+				select {
+				case events <- changedPath:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
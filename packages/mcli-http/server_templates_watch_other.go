@@ -0,0 +1,12 @@
+//go:build !linux
+
+package mclihttp
+
+import (
+	"context"
+	"errors"
+)
+
+func watchTemplateTree(ctx context.Context, root string, events chan<- string) error {
+	return errors.New("current platform not supported, template watcher is only supported on Linux")
+}
@@ -0,0 +1,92 @@
+package mclihttp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func renderTestTemplate(t *testing.T, c *MyTemplateCache, key string) string {
+	t.Helper()
+	tmpl, ok := c.get(key)
+	if !ok {
+		t.Fatalf("template %s not found in cache", key)
+	}
+	var out bytes.Buffer
+	if err := tmpl.template.Execute(&out, nil); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestTemplateCacheApplyChanges(t *testing.T) {
+	root := t.TempDir()
+	writeTestFile(t, filepath.Join(root, "__base", "base.layout.html"), `{{define "base"}}[{{template "main" .}}|{{template "footer" .}}]{{end}}`)
+	writeTestFile(t, filepath.Join(root, "__partial", "footer.partial.html"), `{{define "footer"}}footer-v1{{end}}`)
+	writeTestFile(t, filepath.Join(root, "home", "home.page.html"), `{{template "base" .}}{{define "main"}}home-v1{{end}}`)
+	writeTestFile(t, filepath.Join(root, "about", "about.page.html"), `{{template "base" .}}{{define "main"}}about-v1{{end}}`)
+
+	cache, err := LoadMyTemplatesCache(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &MyTemplateCache{cache: cache, tmplName: "test", tmplPath: root}
+	homeKey := filepath.Join(root, "home", "home.page")
+	aboutKey := filepath.Join(root, "about", "about.page")
+
+	// change of partial rebuilds all dependent pages
+	partialPath := filepath.Join(root, "__partial", "footer.partial.html")
+	writeTestFile(t, partialPath, `{{define "footer"}}footer-v2{{end}}`)
+	rebuilt, err := c.applyChanges([]string{partialPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt != 2 {
+		t.Errorf("expected 2 rebuilt entries, got %d", rebuilt)
+	}
+	if got := renderTestTemplate(t, c, aboutKey); got != "[about-v1|footer-v2]" {
+		t.Errorf("unexpected render after partial change: %s", got)
+	}
+
+	// broken page keeps last good version
+	homePath := filepath.Join(root, "home", "home.page.html")
+	writeTestFile(t, homePath, `{{template "base" .}}{{define "main"}}home-v2{{end`)
+	_, err = c.applyChanges([]string{homePath})
+	if err == nil {
+		t.Error("expected parse error for broken page")
+	}
+	if got := renderTestTemplate(t, c, homeKey); got != "[home-v1|footer-v2]" {
+		t.Errorf("last good template expected, got: %s", got)
+	}
+
+	// removed page leaves cache
+	if err := os.Remove(homePath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.applyChanges([]string{homePath}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.get(homeKey); ok {
+		t.Error("removed page is still in cache")
+	}
+
+	// new folder with page reloads whole tree
+	writeTestFile(t, filepath.Join(root, "news", "news.page.html"), `{{template "base" .}}{{define "main"}}news{{end}}`)
+	if _, err = c.applyChanges([]string{filepath.Join(root, "news")}); err != nil {
+		t.Fatal(err)
+	}
+	if got := renderTestTemplate(t, c, filepath.Join(root, "news", "news.page")); got != "[news|footer-v2]" {
+		t.Errorf("unexpected render of new page: %s", got)
+	}
+}
@@ -0,0 +1,180 @@
+package mclihttp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	go_common_ddru "github.com/Direct-Dev-Ru/go_common_ddru"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+)
+
+// Span is timing of one operation within trace. Trace and parent ids follow W3C trace context,
+// request id is carried in X-Request-ID header along with traceparent.
+type Span struct {
+	TraceId    string                 `json:"trace-id"`
+	SpanId     string                 `json:"span-id"`
+	ParentId   string                 `json:"parent-id,omitempty"`
+	RequestId  string                 `json:"request-id"`
+	Name       string                 `json:"name"`
+	Start      time.Time              `json:"start"`
+	Duration   float64                `json:"duration-ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	// trace flags of traceparent, 01 is sampled
+	flags string
+}
+
+// SpanWriter exports finished spans as JSON lines
+type SpanWriter struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// SpanExport receives finished spans, spans are not exported when it is nil
+var SpanExport *SpanWriter
+
+func NewSpanFileWriter(path string) (*SpanWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &SpanWriter{file: file}, nil
+}
+
+func (sw *SpanWriter) Write(span *Span) error {
+	line, err := json.Marshal(span)
+	if err != nil {
+		return err
+	}
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	_, err = sw.file.Write(append(line, '\n'))
+	return err
+}
+
+func (sw *SpanWriter) Close() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	return sw.file.Close()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func isHex(s string, length int) bool {
+	if len(s) != length || strings.Trim(s, "0") == "" {
+		return false
+	}
+	_, err := hex.DecodeString(s)
+	return err == nil && strings.ToLower(s) == s
+}
+
+// ParseTraceparent returns trace id, parent span id and flags of W3C traceparent header value
+func ParseTraceparent(value string) (traceId, parentId, flags string, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return "", "", "", false
+	}
+	if !isHex(parts[1], 32) || !isHex(parts[2], 16) || len(parts[3]) != 2 {
+		return "", "", "", false
+	}
+	if _, err := hex.DecodeString(parts[3]); err != nil {
+		return "", "", "", false
+	}
+	return parts[1], parts[2], parts[3], true
+}
+
+// isValidRequestId accepts ids of reasonable length without spaces and control characters
+func isValidRequestId(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("-_.:", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// NewSpan starts span, it is child of parent or root of new trace if parent is nil
+func NewSpan(name string, parent *Span) *Span {
+	span := &Span{SpanId: randomHex(8), Name: name, Start: time.Now(), flags: "01"}
+	if parent != nil {
+		span.TraceId, span.ParentId, span.RequestId, span.flags = parent.TraceId, parent.SpanId, parent.RequestId, parent.flags
+	} else {
+		span.TraceId, span.RequestId = randomHex(16), uuid.New().String()
+	}
+	return span
+}
+
+// SpanFromHeaders starts server span continuing trace and request id of incoming request or starting new ones
+func SpanFromHeaders(name string, header http.Header) *Span {
+	span := NewSpan(name, nil)
+	if traceId, parentId, flags, ok := ParseTraceparent(header.Get("traceparent")); ok {
+		span.TraceId, span.ParentId, span.flags = traceId, parentId, flags
+	}
+	if requestId := header.Get("X-Request-ID"); isValidRequestId(requestId) {
+		span.RequestId = requestId
+	}
+	return span
+}
+
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, go_common_ddru.ContextKey("Span"), span)
+}
+
+// SpanFromContext returns current span or nil
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(go_common_ddru.ContextKey("Span")).(*Span)
+	return span
+}
+
+// StartSpan starts child of span in ctx and returns context with it
+func StartSpan(ctx context.Context, name string) (context.Context, *Span) {
+	span := NewSpan(name, SpanFromContext(ctx))
+	return ContextWithSpan(ctx, span), span
+}
+
+// Traceparent returns traceparent header value with span as parent of callee
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceId + "-" + s.SpanId + "-" + s.flags
+}
+
+// InjectHeaders sets correlation headers of outgoing request
+func (s *Span) InjectHeaders(header http.Header) {
+	header.Set("X-Request-ID", s.RequestId)
+	header.Set("traceparent", s.Traceparent())
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+}
+
+// Logger returns logger with correlation fields of span
+func (s *Span) Logger(logger zerolog.Logger) zerolog.Logger {
+	return logger.With().Str("request-id", s.RequestId).Str("trace-id", s.TraceId).Str("span-id", s.SpanId).Logger()
+}
+
+// End finishes span and exports it
+func (s *Span) End() {
+	s.Duration = float64(time.Since(s.Start).Microseconds()) / 1000
+	if SpanExport != nil {
+		SpanExport.Write(s)
+	}
+}
@@ -5,10 +5,10 @@ import (
 	"strings"
 )
 
-var HttpConfig Http
-
 type Server struct {
-	Timeout           int64           `yaml:"timeout"`
+	Timeout int64 `yaml:"timeout"`
+	// time in milliseconds to drain requests on shutdown and config reload
+	ShutdownTimeout   int64           `yaml:"shutdown-timeout"`
 	Port              string          `yaml:"port"`
 	BaseUrl           string          `yaml:"base-url"`
 	StaticPath        string          `yaml:"static-path"`
@@ -18,7 +18,9 @@ type Server struct {
 	TmplDataPath      string          `yaml:"tmpl-datapath"`
 	Templates         []TemplateEntry `yaml:"templates"`
 	CorsParamFilePath string          `yaml:"cors-filepath"`
-	RouterV2          bool
+	// cors section takes precedence over cors-filepath
+	Cors     *CORSConfig `yaml:"cors"`
+	RouterV2 bool
 
 	RootPage struct {
 		RootPageTemplate     string `yaml:"rootpage-template"`
@@ -26,6 +28,46 @@ type Server struct {
 		RedirectUnauthorized bool   `yaml:"redirect-unauthorized"`
 	} `yaml:"root-page"`
 
+	I18n struct {
+		DefaultLocale string   `yaml:"default-locale"`
+		Locales       []string `yaml:"locales"`
+		CookieName    string   `yaml:"cookie-name"`
+		UrlPrefix     bool     `yaml:"url-prefix"`
+		CatalogPath   string   `yaml:"catalog-path"`
+	} `yaml:"i18n"`
+
+	SecurityHeaders SecurityHeadersConfig `yaml:"security-headers"`
+	Cache           ResponseCacheConfig   `yaml:"cache"`
+	Rest            RestConfig            `yaml:"rest"`
+
+	Search struct {
+		Enabled bool   `yaml:"enabled"`
+		Route   string `yaml:"route"`
+	} `yaml:"search"`
+
+	RemoteContent struct {
+		AllowedHosts []string `yaml:"allowed-hosts"`
+		Timeout      int64    `yaml:"timeout"`
+		MaxBodySize  int64    `yaml:"max-body-size"`
+		FreshFor     int64    `yaml:"fresh-for"`
+		CacheInKV    bool     `yaml:"cache-in-kv"`
+	} `yaml:"remote-content"`
+
+	Plugins struct {
+		Dir string `yaml:"dir"`
+		// file names or plugin names which are not loaded
+		Disabled []string `yaml:"disabled"`
+		// plugin name -> plugin config
+		Config map[string]map[string]interface{} `yaml:"config"`
+		// out-of-process plugins: executables started by mcli
+		Processes []struct {
+			Path string   `yaml:"path"`
+			Args []string `yaml:"args"`
+			// timeout of requests to plugin in milliseconds
+			Timeout int64 `yaml:"timeout"`
+		} `yaml:"processes"`
+	} `yaml:"plugins"`
+
 	Auth struct {
 		IsAuthenticate bool `yaml:"is-authenticate"`
 
@@ -64,11 +106,28 @@ type Request struct {
 	URL     string                 `yaml:"url"`
 	Headers map[string][]string    `yaml:"headers"`
 	Body    map[string]interface{} `yaml:"body"`
+	// checks of response, status 2xx is expected if empty
+	Assert ResponseAssertions `yaml:"assert"`
+	Retry  RetryPolicy        `yaml:"retry"`
+	// authentication by secret of vault
+	Auth RequestAuth `yaml:"auth"`
+	TLS  ClientTLS   `yaml:"tls"`
+	// file of cookies of profiles and profile of requests
+	CookieJar string `yaml:"cookie-jar"`
+	Profile   string `yaml:"profile"`
+	// number of followed redirects, 10 if it is 0
+	MaxRedirects int `yaml:"max-redirects"`
+}
+
+type Tracing struct {
+	// file to append finished spans as JSON lines, spans are not exported if it is empty
+	SpansFile string `yaml:"spans-file"`
 }
 
 type Http struct {
 	Server  Server
 	Request Request
+	Tracing Tracing `yaml:"tracing"`
 }
 
 func (config *Http) GetFullUrl(url string, baseUrl ...string) string {
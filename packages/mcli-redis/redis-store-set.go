@@ -108,6 +108,29 @@ func (rs *RedisStore) SetRecord(key string, value interface{}, keyPrefixes ...st
 	return nil
 }
 
+// SetRecordNX sets record only if key does not exist, it reports whether record is set
+func (rs *RedisStore) SetRecordNX(key string, value interface{}, keyPrefixes ...string) (bool, error) {
+	resultKey := key
+	if len(keyPrefixes) > 0 && len(keyPrefixes[0]) > 0 {
+		resultKey = fmt.Sprintf("%s:%s", keyPrefixes[0], key)
+	} else if len(rs.KeyPrefix) > 0 {
+		resultKey = fmt.Sprintf("%s:%s", rs.KeyPrefix, key)
+	}
+
+	conn := rs.RedisPool.Get()
+	defer conn.Close()
+
+	valueToStore, err := rs.getValueToStore(value)
+	if err != nil {
+		return false, err
+	}
+	reply, err := rs.ExecuteCommand(conn, "SET", resultKey, valueToStore, "NX")
+	if err != nil {
+		return false, err
+	}
+	return reply != nil, nil
+}
+
 func (rs *RedisStore) SetRecordEx(key string, value interface{}, expiration int, keyPrefixes ...string) error {
 	resultKeys := []string{key}
 	if len(keyPrefixes) > 0 {
@@ -8,7 +8,52 @@ import (
 
 type ContextKey string
 
+// HandlerFuncsPlugin is contract of http plugins of api version 1, they only return map of named handlers
 type HandlerFuncsPlugin interface {
 	GetHandlerFuncsV2(inputArgs ...interface{}) map[string]http.HandlerFunc
 	GetHandlerFuncs()
 }
+
+// HttpPluginApiVersion is version of HttpPlugin contract implemented by mcli,
+// plugins declaring other version are rejected (version 1 is HandlerFuncsPlugin)
+const HttpPluginApiVersion = 2
+
+// HttpPluginRoute is route declared by http plugin
+type HttpPluginRoute struct {
+	// handler name unique across all plugins, f.e. HTTP_ECHO
+	Name    string
+	Pattern string
+	// equal (default), prefix or regexp
+	Match string
+	// allowed methods, all methods are allowed if empty
+	Methods []string
+	// middlewares which must be set up in router for route: auth, cache, cors, locale, logger, request-id, security-headers
+	Middlewares []string
+	Handler     http.HandlerFunc
+}
+
+// HttpPluginConfigField describes one key of plugin config
+type HttpPluginConfigField struct {
+	// string, number, bool, list, map or empty for any value
+	Type        string
+	Required    bool
+	Default     interface{}
+	Description string
+}
+
+// HttpPluginManifest is what plugin declares about itself
+type HttpPluginManifest struct {
+	Name         string
+	Version      string
+	ApiVersion   int
+	Routes       []HttpPluginRoute
+	ConfigSchema map[string]HttpPluginConfigField
+}
+
+// HttpPlugin is contract of http plugins since api version 2.
+// Plugin exports variable implementing it as HandlerFuncsPlugin symbol,
+// Init gets plugin config validated against ConfigSchema with defaults applied.
+type HttpPlugin interface {
+	Manifest() HttpPluginManifest
+	Init(config map[string]interface{}) error
+}
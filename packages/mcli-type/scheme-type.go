@@ -1,5 +1,12 @@
 package mclitype
 
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
 type StoreType int
 
 const (
@@ -30,13 +37,29 @@ type SchemeIndex struct {
 	NotUnique bool
 }
 
+// SchemeField describes field of record, type is string, integer, number, boolean, object or array
+type SchemeField struct {
+	Name      string   `yaml:"name" json:"name"`
+	Type      string   `yaml:"type" json:"type"`
+	Required  bool     `yaml:"required" json:"required,omitempty"`
+	Pattern   string   `yaml:"pattern" json:"pattern,omitempty"`
+	Enum      []string `yaml:"enum" json:"enum,omitempty"`
+	MaxLength int      `yaml:"max-length" json:"max-length,omitempty"`
+}
+
 type Scheme struct {
-	StoreType      StoreType
-	PKType         PKType
-	PKFieldName    string
-	Indexes        []SchemeIndex
-	RecordType     RecordType
-	Prefix         string
+	StoreType   StoreType
+	PKType      PKType
+	PKFieldName string
+	Indexes     []SchemeIndex
+	RecordType  RecordType
+	Prefix      string
+	// fields records are validated against, records are not validated if it is empty
+	Fields []SchemeField
+	// fields which are not described in Fields are allowed
+	AdditionalFields bool
+	// compiled patterns of fields by field name
+	patterns       map[string]*regexp.Regexp
 	encyptedFields []string
 	version        string
 }
@@ -60,3 +83,109 @@ func (sch *Scheme) SetSchemeVersion(version string) {
 func (sch *Scheme) GetSchemeVersion() string {
 	return sch.version
 }
+
+// CompilePatterns compiles patterns of fields once, it must be called before scheme is used concurrently
+func (sch *Scheme) CompilePatterns() error {
+	patterns := make(map[string]*regexp.Regexp)
+	for _, field := range sch.Fields {
+		if len(field.Pattern) == 0 {
+			continue
+		}
+		re, err := regexp.Compile(field.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern of field %s: %w", field.Name, err)
+		}
+		patterns[field.Name] = re
+	}
+	sch.patterns = patterns
+	return nil
+}
+
+// Validate checks record against fields of scheme, all violations are joined in returned error.
+// Patterns are compiled on every call if CompilePatterns was not called.
+func (sch *Scheme) Validate(record map[string]interface{}) error {
+	if len(sch.Fields) == 0 {
+		return nil
+	}
+	patterns := sch.patterns
+	if patterns == nil {
+		patterns = make(map[string]*regexp.Regexp)
+		for _, field := range sch.Fields {
+			if re, err := regexp.Compile(field.Pattern); err == nil && len(field.Pattern) > 0 {
+				patterns[field.Name] = re
+			}
+		}
+	}
+	problems := make([]string, 0)
+	known := make(map[string]bool, len(sch.Fields))
+	for _, field := range sch.Fields {
+		known[field.Name] = true
+		value, ok := record[field.Name]
+		if !ok || value == nil {
+			if field.Required {
+				problems = append(problems, fmt.Sprintf("%s is required", field.Name))
+			}
+			continue
+		}
+		if problem := field.check(value, patterns[field.Name]); len(problem) > 0 {
+			problems = append(problems, fmt.Sprintf("%s %s", field.Name, problem))
+		}
+	}
+	if !sch.AdditionalFields {
+		for name := range record {
+			if !known[name] {
+				problems = append(problems, fmt.Sprintf("%s is not allowed", name))
+			}
+		}
+	}
+	if len(problems) > 0 {
+		slices.Sort(problems)
+		return fmt.Errorf("record is not valid: %s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// check returns description of violation or empty string, value is decoded from json,
+// pattern is compiled pattern of field
+func (field SchemeField) check(value interface{}, pattern *regexp.Regexp) string {
+	switch field.Type {
+	case "", "string":
+		str, ok := value.(string)
+		if !ok {
+			return "must be string"
+		}
+		if field.MaxLength > 0 && len([]rune(str)) > field.MaxLength {
+			return fmt.Sprintf("must not be longer than %d", field.MaxLength)
+		}
+		if len(field.Pattern) > 0 && (pattern == nil || !pattern.MatchString(str)) {
+			return fmt.Sprintf("must match %s", field.Pattern)
+		}
+		if len(field.Enum) > 0 && !slices.Contains(field.Enum, str) {
+			return fmt.Sprintf("must be one of %s", strings.Join(field.Enum, ", "))
+		}
+	case "integer":
+		number, ok := value.(float64)
+		if !ok || number != float64(int64(number)) {
+			return "must be integer"
+		}
+	case "number":
+		if _, ok := value.(float64); !ok {
+			return "must be number"
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return "must be boolean"
+		}
+	case "object":
+		if _, ok := value.(map[string]interface{}); !ok {
+			return "must be object"
+		}
+	case "array":
+		if _, ok := value.([]interface{}); !ok {
+			return "must be array"
+		}
+	default:
+		return fmt.Sprintf("has unknown type %s", field.Type)
+	}
+	return ""
+}
@@ -21,6 +21,11 @@ type KVStorer interface {
 	Close()
 }
 
+// KVCreator is implemented by stores which set record only if key does not exist atomically
+type KVCreator interface {
+	SetRecordNX(key string, value interface{}, keyPrefixes ...string) (bool, error)
+}
+
 type KVStorerV2 interface {
 	SetEncryptV2(encrypt bool, key []byte, cypher SecretsCypher)
 	SetMarshallingV2(fMarshal func(any) ([]byte, error), fUnMarshal func([]byte, any) error)
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strconv"
 	"strings"
 
 	"gopkg.in/mgo.v2/bson"
@@ -150,6 +151,70 @@ func JsonStringToInterface(jsonString string) (interface{}, error) {
 	return data, nil
 }
 
+// JsonPathGet returns value of decoded json data by simple JSONPath: $.a.b[0]['c-d'], negative index counts from end
+func JsonPathGet(data interface{}, path string) (interface{}, error) {
+	rest, ok := strings.CutPrefix(strings.TrimSpace(path), "$")
+	if !ok {
+		return nil, fmt.Errorf("json path %s must start with $", path)
+	}
+	current := data
+	for len(rest) > 0 {
+		var key string
+		index, isIndex := 0, false
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key, rest = rest[:end], rest[end:]
+			if len(key) == 0 {
+				return nil, fmt.Errorf("json path %s has empty field name", path)
+			}
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("json path %s has unclosed bracket", path)
+			}
+			selector := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+			if unquoted, err := strconv.Unquote(strings.ReplaceAll(selector, "'", `"`)); err == nil {
+				key = unquoted
+			} else if number, err := strconv.Atoi(selector); err == nil {
+				index, isIndex = number, true
+			} else {
+				return nil, fmt.Errorf("json path %s has wrong selector [%s]", path, selector)
+			}
+		default:
+			return nil, fmt.Errorf("json path %s is not valid at %s", path, rest)
+		}
+
+		if isIndex {
+			list, ok := current.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("json path %s: value is not array", path)
+			}
+			if index < 0 {
+				index += len(list)
+			}
+			if index < 0 || index >= len(list) {
+				return nil, fmt.Errorf("json path %s: index %d is out of range", path, index)
+			}
+			current = list[index]
+			continue
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("json path %s: value is not object", path)
+		}
+		if current, ok = object[key]; !ok {
+			return nil, fmt.Errorf("json path %s: field %s not found", path, key)
+		}
+	}
+	return current, nil
+}
+
 func BsonDataToInterfaceMap(bsonData []byte) (interface{}, error) {
 	var data map[string]interface{} = make(map[string]interface{})
 	err := bson.Unmarshal(bsonData, &data)